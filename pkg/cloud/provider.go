@@ -174,9 +174,13 @@ type CustomPricing struct {
 	CurrencyCode                 string `json:"currencyCode"`
 	Discount                     string `json:"discount"`
 	NegotiatedDiscount           string `json:"negotiatedDiscount"`
+	DiscountByCluster            string `json:"discountByCluster,omitempty"`
+	ReservedDiscount             string `json:"reservedDiscount,omitempty"`
+	ReservedTermMonths           string `json:"reservedTermMonths,omitempty"`
 	SharedOverhead               string `json:"sharedOverhead"`
 	ClusterName                  string `json:"clusterName"`
 	SharedNamespaces             string `json:"sharedNamespaces"`
+	SystemNamespaces             string `json:"systemNamespaces"`
 	SharedLabelNames             string `json:"sharedLabelNames"`
 	SharedLabelValues            string `json:"sharedLabelValues"`
 	ShareTenancyCosts            string `json:"shareTenancyCosts"` // TODO clean up configuration so we can use a type other that string (this should be a bool, but the app panics if it's not a string)
@@ -326,6 +330,61 @@ func SharedNamespaces(p Provider) []string {
 	return namespaces
 }
 
+// DefaultSystemNamespaces are the system namespaces used when none are
+// defined in the application settings
+var DefaultSystemNamespaces = []string{"kube-system"}
+
+// SystemNamespaces returns a list of names of system namespaces, whose costs
+// are platform costs rather than tenant costs, as defined in the application
+// settings, or DefaultSystemNamespaces if none are defined
+func SystemNamespaces(p Provider) []string {
+	namespaces := []string{}
+
+	config, err := p.GetConfig()
+	if err != nil || config.SystemNamespaces == "" {
+		return append(namespaces, DefaultSystemNamespaces...)
+	}
+	// trim spaces so that "kube-system, kube-public" is equivalent to "kube-system,kube-public"
+	for _, ns := range strings.Split(config.SystemNamespaces, ",") {
+		namespaces = append(namespaces, strings.Trim(ns, " "))
+	}
+
+	return namespaces
+}
+
+// ClusterDiscount is the discount and negotiated discount configured for a
+// single cluster, as percent strings; e.g. "30%".
+type ClusterDiscount struct {
+	Discount           string
+	NegotiatedDiscount string
+}
+
+// DiscountsByCluster returns the discounts configured per cluster, keyed by
+// cluster ID; e.g. for "cluster-a:30%:10%,cluster-b:20%:5%" this returns
+// discounts of 30% and 20%, and negotiated discounts of 10% and 5%, for
+// cluster-a and cluster-b respectively. Illegal entries are skipped.
+func DiscountsByCluster(p Provider) map[string]ClusterDiscount {
+	discounts := map[string]ClusterDiscount{}
+
+	config, err := p.GetConfig()
+	if err != nil || config == nil || config.DiscountByCluster == "" {
+		return discounts
+	}
+	for _, entry := range strings.Split(config.DiscountByCluster, ",") {
+		fields := strings.Split(strings.TrimSpace(entry), ":")
+		if len(fields) != 3 || strings.TrimSpace(fields[0]) == "" {
+			log.Warningf("Config field 'discountByCluster' has illegal entry %q: must be cluster:discount:negotiatedDiscount", entry)
+			continue
+		}
+		discounts[strings.TrimSpace(fields[0])] = ClusterDiscount{
+			Discount:           strings.TrimSpace(fields[1]),
+			NegotiatedDiscount: strings.TrimSpace(fields[2]),
+		}
+	}
+
+	return discounts
+}
+
 // SharedLabel returns the configured set of shared labels as a parallel tuple of keys to values; e.g.
 // for app:kubecost,type:staging this returns (["app", "type"], ["kubecost", "staging"]) in order to
 // match the signature of the NewSharedResourceInfo
@@ -38,6 +38,16 @@ const (
 	// cost data that do not have the given label.
 	UnallocatedSubfield = "__unallocated__"
 
+	// IdleAllocationKey indicates the synthetic allocation that holds the
+	// cost of cluster capacity not allocated to any namespace or pod, such
+	// that allocated and idle costs sum to the total cluster cost.
+	IdleAllocationKey = "__idle__"
+
+	// SystemAllocationKey indicates the synthetic allocation that holds the
+	// cost of system namespaces, e.g. kube-system, as a platform cost rather
+	// than a cost charged to tenants.
+	SystemAllocationKey = "__system__"
+
 	clusterCostsCacheMinutes = 5.0
 )
 
@@ -198,23 +208,52 @@ func GetTotalContainerCost(costData map[string]*CostData, rate string, cp cloud.
 	return totalContainerCost
 }
 
+// cachedClusterCosts returns the cluster costs over the given window and
+// offset from the cluster costs cache, or computes them on a cache miss.
+func (a *Accesses) cachedClusterCosts(cli prometheusClient.Client, cp cloud.Provider, window, offset time.Duration) (map[string]*ClusterCosts, error) {
+	fmtWindow, fmtOffset := timeutil.DurationOffsetStrings(window, offset)
+	key := fmt.Sprintf("%s:%s", fmtWindow, fmtOffset)
+	if data, valid := a.ClusterCostsCache.Get(key); valid {
+		return data.(map[string]*ClusterCosts), nil
+	}
+
+	return a.ComputeClusterCosts(cli, cp, window, offset, false)
+}
+
+// clusterTotalCost returns the total cumulative cost, over the given window
+// and offset, of the clusters appearing in the given cost data; i.e. the
+// total from which idle cost is computed.
+func (a *Accesses) clusterTotalCost(costData map[string]*CostData, cli prometheusClient.Client, cp cloud.Provider, window, offset time.Duration) (float64, error) {
+	clusterCosts, err := a.cachedClusterCosts(cli, cp, window, offset)
+	if err != nil {
+		return 0.0, err
+	}
+
+	clusterIDs := map[string]bool{}
+	for _, costDatum := range costData {
+		clusterIDs[costDatum.ClusterID] = true
+	}
+
+	total := 0.0
+	for cid := range clusterIDs {
+		if costs, ok := clusterCosts[cid]; ok {
+			total += costs.TotalCumulative
+		}
+	}
+
+	return total, nil
+}
+
 func (a *Accesses) ComputeIdleCoefficient(costData map[string]*CostData, cli prometheusClient.Client, cp cloud.Provider, discount float64, customDiscount float64, window, offset time.Duration) (map[string]float64, error) {
 	coefficients := make(map[string]float64)
 
 	profileName := "ComputeIdleCoefficient: ComputeClusterCosts"
 	profileStart := time.Now()
 
-	var clusterCosts map[string]*ClusterCosts
-	var err error
 	fmtWindow, fmtOffset := timeutil.DurationOffsetStrings(window, offset)
-	key := fmt.Sprintf("%s:%s", fmtWindow, fmtOffset)
-	if data, valid := a.ClusterCostsCache.Get(key); valid {
-		clusterCosts = data.(map[string]*ClusterCosts)
-	} else {
-		clusterCosts, err = a.ComputeClusterCosts(cli, cp, window, offset, false)
-		if err != nil {
-			return nil, err
-		}
+	clusterCosts, err := a.cachedClusterCosts(cli, cp, window, offset)
+	if err != nil {
+		return nil, err
 	}
 
 	measureTime(profileStart, profileThreshold, profileName)
@@ -250,6 +289,48 @@ func (a *Accesses) ComputeIdleCoefficient(costData map[string]*CostData, cli pro
 	return coefficients, nil
 }
 
+// IdlePolicy determines how AggregateCostData distributes idle cost; i.e. the
+// portion of the cluster total cost not allocated to any namespace or pod.
+type IdlePolicy int
+
+const (
+	// IdlePolicyKeep keeps idle cost in the IdleAllocationKey aggregation, so
+	// that allocated and idle costs sum to the cluster total cost.
+	IdlePolicyKeep IdlePolicy = iota
+
+	// IdlePolicyDrop drops idle cost, omitting the IdleAllocationKey
+	// aggregation. Aggregations then sum only to the allocated cost, which is
+	// less than the cluster total cost by the idle cost.
+	IdlePolicyDrop
+
+	// IdlePolicyProportional shares idle cost among the aggregations in
+	// proportion to their total costs, so that they sum to the cluster total
+	// cost. If nothing is allocated, idle cost is kept as by IdlePolicyKeep.
+	IdlePolicyProportional
+
+	// IdlePolicyOwner attributes all idle cost to the aggregation given by
+	// AggregationOptions.IdleOwner, e.g. a platform team's namespace, creating
+	// it if necessary, so that aggregations sum to the cluster total cost.
+	IdlePolicyOwner
+)
+
+// ParseIdlePolicy parses an IdlePolicy from its name; i.e. "keep", "drop",
+// "proportional", or "owner". The empty string parses to IdlePolicyKeep.
+func ParseIdlePolicy(s string) (IdlePolicy, error) {
+	switch strings.ToLower(s) {
+	case "", "keep":
+		return IdlePolicyKeep, nil
+	case "drop":
+		return IdlePolicyDrop, nil
+	case "proportional":
+		return IdlePolicyProportional, nil
+	case "owner":
+		return IdlePolicyOwner, nil
+	}
+
+	return IdlePolicyKeep, fmt.Errorf("illegal idle policy %q: must be one of keep, drop, proportional, or owner", s)
+}
+
 // AggregationOptions provides optional parameters to AggregateCostData, allowing callers to perform more complex operations
 type AggregationOptions struct {
 	Discount               float64            // percent by which to discount CPU, RAM, and GPU cost
@@ -265,6 +346,10 @@ type AggregationOptions struct {
 	FilteredEnvironments   map[string]int
 	SharedSplit            string
 	TotalContainerCost     float64
+	ClusterTotalCost       float64    // total cost of the aggregated clusters, from which the idle allocation is computed; no idle allocation if zero
+	IdlePolicy             IdlePolicy // how idle cost is distributed among namespace and pod aggregations
+	IdleOwner              string     // aggregation to which idle cost is attributed by IdlePolicyOwner
+	SystemNamespaces       []string   // namespaces whose costs are attributed to SystemAllocationKey when aggregating by namespace or pod
 }
 
 // Helper method to test request/usgae values against allocation averages for efficiency scores. Generate a warning log if
@@ -306,6 +391,11 @@ func AggregateCostData(costData map[string]*CostData, field string, subfields []
 		idleCoefficients = make(map[string]float64)
 	}
 
+	systemNamespaces := make(map[string]bool, len(opts.SystemNamespaces))
+	for _, ns := range opts.SystemNamespaces {
+		systemNamespaces[ns] = true
+	}
+
 	// aggregations collects key-value pairs of resource group-to-aggregated data
 	// e.g. namespace-to-data or label-value-to-data
 	aggregations := make(map[string]*Aggregation)
@@ -328,6 +418,8 @@ func AggregateCostData(costData map[string]*CostData, field string, subfields []
 			for _, pv := range pvvs {
 				sharedResourceCost += totalVectors(pv)
 			}
+		} else if (field == "namespace" || field == "pod") && systemNamespaces[costDatum.Namespace] {
+			aggregateDatum(cp, aggregations, costDatum, field, subfields, rate, SystemAllocationKey, discount, customDiscount, idleCoefficient, false)
 		} else {
 			if field == "cluster" {
 				aggregateDatum(cp, aggregations, costDatum, field, subfields, rate, costDatum.ClusterID, discount, customDiscount, idleCoefficient, false)
@@ -582,9 +674,117 @@ func AggregateCostData(costData map[string]*CostData, field string, subfields []
 		}
 	}
 
+	// Namespace and pod aggregations include an idle allocation, even if zero,
+	// whenever the cluster total cost is known, so that consumers can rely on
+	// allocated and idle costs summing to the total cluster cost, unless the
+	// idle policy distributes it.
+	if (field == "namespace" || field == "pod") && opts.ClusterTotalCost > 0 {
+		idle := idleAggregation(aggregations, field, subfields, opts.ClusterTotalCost)
+		distributeIdle(aggregations, idle, opts.IdlePolicy, opts.IdleOwner)
+	}
+
 	return aggregations
 }
 
+// distributeIdle distributes the given idle aggregation among the given
+// aggregations according to the given policy. See IdlePolicy.
+func distributeIdle(aggregations map[string]*Aggregation, idle *Aggregation, policy IdlePolicy, owner string) {
+	switch policy {
+	case IdlePolicyDrop:
+		return
+	case IdlePolicyProportional:
+		allocatedCost := 0.0
+		for key, agg := range aggregations {
+			if key == IdleAllocationKey {
+				continue
+			}
+			allocatedCost += agg.TotalCost
+		}
+		if allocatedCost <= 0 {
+			break
+		}
+		for key, agg := range aggregations {
+			if key == IdleAllocationKey {
+				continue
+			}
+			addIdle(agg, idle, agg.TotalCost/allocatedCost)
+		}
+		return
+	case IdlePolicyOwner:
+		if owner == "" || owner == IdleAllocationKey {
+			log.DedupedWarningf(5, "AggregateCostData: idle policy owner requires an owner; keeping idle cost")
+			break
+		}
+		agg, ok := aggregations[owner]
+		if !ok {
+			agg = &Aggregation{
+				Aggregator:  idle.Aggregator,
+				Subfields:   idle.Subfields,
+				Environment: owner,
+			}
+			aggregations[owner] = agg
+		}
+		addIdle(agg, idle, 1.0)
+		return
+	}
+
+	aggregations[IdleAllocationKey] = idle
+}
+
+// addIdle adds the given fraction of each of the idle aggregation's costs to
+// the given aggregation, such that its per-resource costs still sum to its
+// total cost.
+func addIdle(agg, idle *Aggregation, fraction float64) {
+	agg.CPUCost += idle.CPUCost * fraction
+	agg.RAMCost += idle.RAMCost * fraction
+	agg.GPUCost += idle.GPUCost * fraction
+	agg.PVCost += idle.PVCost * fraction
+	agg.TotalCost += idle.TotalCost * fraction
+}
+
+// idleAggregation returns an Aggregation holding the portion of the given
+// total cluster cost not accounted for by the given aggregations. Idle cost
+// is never negative, and is split among CPU, RAM, GPU, and PV costs in
+// proportion to those allocated. If no such costs are allocated, only the
+// total idle cost is set.
+func idleAggregation(aggregations map[string]*Aggregation, field string, subfields []string, clusterTotalCost float64) *Aggregation {
+	allocatedCost := 0.0
+	cpuCost, ramCost, gpuCost, pvCost := 0.0, 0.0, 0.0, 0.0
+	for key, agg := range aggregations {
+		if key == IdleAllocationKey {
+			continue
+		}
+		allocatedCost += agg.TotalCost
+		cpuCost += agg.CPUCost
+		ramCost += agg.RAMCost
+		gpuCost += agg.GPUCost
+		pvCost += agg.PVCost
+	}
+
+	idleCost := clusterTotalCost - allocatedCost
+	if idleCost < 0 {
+		log.DedupedWarningf(5, "AggregateCostData: allocated cost %f exceeds cluster total cost %f; setting idle cost to 0", allocatedCost, clusterTotalCost)
+		idleCost = 0
+	}
+
+	idle := &Aggregation{
+		Aggregator:  field,
+		Subfields:   subfields,
+		Environment: IdleAllocationKey,
+		TotalCost:   idleCost,
+	}
+
+	resourceCost := cpuCost + ramCost + gpuCost + pvCost
+	if resourceCost > 0 {
+		idle.CPUCost = idleCost * cpuCost / resourceCost
+		idle.RAMCost = idleCost * ramCost / resourceCost
+		idle.GPUCost = idleCost * gpuCost / resourceCost
+		idle.PVCost = idleCost * pvCost / resourceCost
+	}
+
+	return idle
+}
+
 func aggregateDatum(cp cloud.Provider, aggregations map[string]*Aggregation, costDatum *CostData, field string, subfields []string, rate string, key string, discount float64, customDiscount float64, idleCoefficient float64, includeProperties bool) {
 	// add new entry to aggregation results if a new key is encountered
 	if _, ok := aggregations[key]; !ok {
@@ -1027,24 +1227,32 @@ type AggregateQueryOpts struct {
 	RemoteEnabled         bool
 	DisableSharedOverhead bool
 	UseETLAdapter         bool
+	IdlePolicy            IdlePolicy
+	IdleOwner             string
+	// ExcludeSystemNamespaces attributes the costs of the configured system
+	// namespaces to SystemAllocationKey rather than to their namespaces or pods
+	ExcludeSystemNamespaces bool
 }
 
 func DefaultAggregateQueryOpts() *AggregateQueryOpts {
 	return &AggregateQueryOpts{
-		Rate:                  "",
-		Filters:               map[string]string{},
-		SharedResources:       nil,
-		ShareSplit:            SplitTypeWeighted,
-		AllocateIdle:          false,
-		IncludeTimeSeries:     true,
-		IncludeEfficiency:     true,
-		DisableCache:          false,
-		ClearCache:            false,
-		NoCache:               false,
-		NoExpireCache:         false,
-		RemoteEnabled:         env.IsRemoteEnabled(),
-		DisableSharedOverhead: false,
-		UseETLAdapter:         false,
+		Rate:                    "",
+		Filters:                 map[string]string{},
+		SharedResources:         nil,
+		ShareSplit:              SplitTypeWeighted,
+		AllocateIdle:            false,
+		IncludeTimeSeries:       true,
+		IncludeEfficiency:       true,
+		DisableCache:            false,
+		ClearCache:              false,
+		NoCache:                 false,
+		NoExpireCache:           false,
+		RemoteEnabled:           env.IsRemoteEnabled(),
+		DisableSharedOverhead:   false,
+		UseETLAdapter:           false,
+		IdlePolicy:              IdlePolicyKeep,
+		IdleOwner:               "",
+		ExcludeSystemNamespaces: false,
 	}
 }
 
@@ -1505,6 +1713,28 @@ func (a *Accesses) ComputeAggregateCostModel(promClient prometheusClient.Client,
 	// filter cost data by namespace and cluster after caching for maximal cache hits
 	costData, filteredContainerCount, filteredEnvironments := FilterCostData(costData, retainFuncs, filterFuncs)
 
+	// Idle cost is the cluster total cost not allocated to any namespace or
+	// pod, so it is only computed for cumulative costs of whole clusters; i.e.
+	// not for rates, nor for data filtered to only part of a cluster.
+	clusterTotalCost := 0.0
+	wholeClusters := filters["namespace"] == "" && filters["node"] == "" && filters["labels"] == "" && filters["annotations"] == "" && filters["podprefix"] == ""
+	if (field == "namespace" || field == "pod") && rate == "" && wholeClusters {
+		dur, off, err := window.DurationOffset()
+		if err != nil {
+			return nil, "", err
+		}
+
+		if a.ThanosClient != nil && off < thanos.OffsetDuration() {
+			log.Infof("ComputeAggregateCostModel: not computing idle cost: offset %s is within the Thanos offset %s", off, thanos.OffsetDuration())
+		} else {
+			clusterTotalCost, err = a.clusterTotalCost(costData, promClient, a.CloudProvider, dur, off)
+			if err != nil {
+				log.Warningf("ComputeAggregateCostModel: not computing idle cost: %s", err)
+				clusterTotalCost = 0.0
+			}
+		}
+	}
+
 	// aggregate cost model data by given fields and cache the result for the default expiration
 	aggOpts := &AggregationOptions{
 		Discount:               discount,
@@ -1520,6 +1750,12 @@ func (a *Accesses) ComputeAggregateCostModel(promClient prometheusClient.Client,
 		FilteredEnvironments:   filteredEnvironments,
 		TotalContainerCost:     totalContainerCost,
 		SharedSplit:            shared,
+		ClusterTotalCost:       clusterTotalCost,
+		IdlePolicy:             opts.IdlePolicy,
+		IdleOwner:              opts.IdleOwner,
+	}
+	if opts.ExcludeSystemNamespaces {
+		aggOpts.SystemNamespaces = cloud.SystemNamespaces(a.CloudProvider)
 	}
 	result := AggregateCostData(costData, field, subfields, a.CloudProvider, aggOpts)
 
@@ -1719,9 +1955,9 @@ func GenerateAggKey(window kubecost.Window, field string, subfields []string, op
 		offset = ""
 	}
 
-	return fmt.Sprintf("%s:%s:%s:%s:%s:%s:%s:%t:%t:%t", duration, offset, filterStr, fieldStr, opts.Rate,
+	return fmt.Sprintf("%s:%s:%s:%s:%s:%s:%s:%t:%t:%t:%d:%s:%t", duration, offset, filterStr, fieldStr, opts.Rate,
 		opts.SharedResources, opts.ShareSplit, opts.AllocateIdle, opts.IncludeTimeSeries,
-		opts.IncludeEfficiency)
+		opts.IncludeEfficiency, opts.IdlePolicy, opts.IdleOwner, opts.ExcludeSystemNamespaces)
 }
 
 // Aggregator is capable of computing the aggregated cost model. This is
@@ -1972,6 +2208,21 @@ func (a *Accesses) AggregateCostModelHandler(w http.ResponseWriter, r *http.Requ
 		opts.AllocateIdle = (idleFlag == "true")
 	}
 
+	// idlePolicy determines how idle cost is distributed among namespace and
+	// pod aggregations; idleOwner is the recipient of the "owner" policy
+	idlePolicy, err := ParseIdlePolicy(r.URL.Query().Get("idlePolicy"))
+	if err != nil {
+		WriteError(w, BadRequest(err.Error()))
+		return
+	}
+	opts.IdlePolicy = idlePolicy
+	opts.IdleOwner = r.URL.Query().Get("idleOwner")
+
+	// excludeSystemNamespaces, if set to "true", attributes the costs of the
+	// configured system namespaces to the __system__ aggregation rather than
+	// to the namespaces or pods that incurred them
+	opts.ExcludeSystemNamespaces = r.URL.Query().Get("excludeSystemNamespaces") == "true"
+
 	opts.Rate = r.URL.Query().Get("rate")
 
 	opts.ShareSplit = r.URL.Query().Get("sharedSplit")
@@ -1,8 +1,11 @@
 package costmodel
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/kubecost"
 	"github.com/kubecost/cost-model/pkg/util"
 )
 
@@ -193,3 +196,221 @@ func TestScaleHourlyCostData(t *testing.T) {
 		}
 	}
 }
+
+func TestAggregateCostData_IdleAllocation(t *testing.T) {
+	cp := &mockProvider{config: &cloud.CustomPricing{CPU: "1.0", RAM: "0.0", GPU: "0.0", Storage: "0.0"}}
+
+	cpuAllocation := func(cores float64) []*util.Vector {
+		return []*util.Vector{{Timestamp: 1609459200, Value: cores}}
+	}
+
+	costData := map[string]*CostData{
+		"ns1/pod1": {Namespace: "ns1", PodName: "pod1", ClusterID: "cluster1", CPUAllocation: cpuAllocation(2.0)},
+		"ns2/pod2": {Namespace: "ns2", PodName: "pod2", ClusterID: "cluster1", CPUAllocation: cpuAllocation(3.0)},
+	}
+
+	for _, field := range []string{"namespace", "pod"} {
+		aggs := AggregateCostData(costData, field, nil, cp, &AggregationOptions{ClusterTotalCost: 8.0})
+
+		idle, ok := aggs[IdleAllocationKey]
+		if !ok {
+			t.Fatalf("%s: expected %s allocation", field, IdleAllocationKey)
+		}
+
+		total := 0.0
+		for _, agg := range aggs {
+			total += agg.TotalCost
+		}
+		if !util.IsApproximately(idle.TotalCost, 3.0) {
+			t.Errorf("%s: expected idle cost %f; got %f", field, 3.0, idle.TotalCost)
+		}
+		if !util.IsApproximately(total, 8.0) {
+			t.Errorf("%s: expected allocated + idle cost to equal cluster total %f; got %f", field, 8.0, total)
+		}
+	}
+
+	// Idle is emitted, as zero, if the cluster is fully allocated
+	aggs := AggregateCostData(costData, "namespace", nil, cp, &AggregationOptions{ClusterTotalCost: 5.0})
+	if idle, ok := aggs[IdleAllocationKey]; !ok || idle.TotalCost != 0 {
+		t.Errorf("expected zero %s allocation; got %+v", IdleAllocationKey, idle)
+	}
+
+	// Idle is not emitted without a cluster total, from which to compute it
+	aggs = AggregateCostData(costData, "namespace", nil, cp, &AggregationOptions{})
+	if idle, ok := aggs[IdleAllocationKey]; ok {
+		t.Errorf("expected no %s allocation without a cluster total; got %+v", IdleAllocationKey, idle)
+	}
+}
+
+func TestAggregateCostData_IdlePolicy(t *testing.T) {
+	cp := &mockProvider{config: &cloud.CustomPricing{CPU: "1.0", RAM: "0.0", GPU: "0.0", Storage: "0.0"}}
+
+	cpuAllocation := func(cores float64) []*util.Vector {
+		return []*util.Vector{{Timestamp: 1609459200, Value: cores}}
+	}
+
+	// $2 and $3 allocated of an $8 cluster: $3 idle
+	costData := map[string]*CostData{
+		"ns1/pod1": {Namespace: "ns1", PodName: "pod1", ClusterID: "cluster1", CPUAllocation: cpuAllocation(2.0)},
+		"ns2/pod2": {Namespace: "ns2", PodName: "pod2", ClusterID: "cluster1", CPUAllocation: cpuAllocation(3.0)},
+	}
+
+	cases := map[string]struct {
+		opts     *AggregationOptions
+		expected map[string]float64
+		total    float64
+	}{
+		"keep": {
+			opts:     &AggregationOptions{ClusterTotalCost: 8.0, IdlePolicy: IdlePolicyKeep},
+			expected: map[string]float64{"ns1": 2.0, "ns2": 3.0, IdleAllocationKey: 3.0},
+			total:    8.0,
+		},
+		"drop": {
+			opts:     &AggregationOptions{ClusterTotalCost: 8.0, IdlePolicy: IdlePolicyDrop},
+			expected: map[string]float64{"ns1": 2.0, "ns2": 3.0},
+			total:    5.0,
+		},
+		"proportional": {
+			opts:     &AggregationOptions{ClusterTotalCost: 8.0, IdlePolicy: IdlePolicyProportional},
+			expected: map[string]float64{"ns1": 2.0 + 3.0*0.4, "ns2": 3.0 + 3.0*0.6},
+			total:    8.0,
+		},
+		"owner": {
+			opts:     &AggregationOptions{ClusterTotalCost: 8.0, IdlePolicy: IdlePolicyOwner, IdleOwner: "ns1"},
+			expected: map[string]float64{"ns1": 5.0, "ns2": 3.0},
+			total:    8.0,
+		},
+		"new owner": {
+			opts:     &AggregationOptions{ClusterTotalCost: 8.0, IdlePolicy: IdlePolicyOwner, IdleOwner: "platform"},
+			expected: map[string]float64{"ns1": 2.0, "ns2": 3.0, "platform": 3.0},
+			total:    8.0,
+		},
+		"no owner": {
+			opts:     &AggregationOptions{ClusterTotalCost: 8.0, IdlePolicy: IdlePolicyOwner},
+			expected: map[string]float64{"ns1": 2.0, "ns2": 3.0, IdleAllocationKey: 3.0},
+			total:    8.0,
+		},
+	}
+
+	for name, tc := range cases {
+		aggs := AggregateCostData(costData, "namespace", nil, cp, tc.opts)
+
+		if len(aggs) != len(tc.expected) {
+			t.Errorf("%s: expected %d aggregations; got %d", name, len(tc.expected), len(aggs))
+		}
+
+		total := 0.0
+		for key, agg := range aggs {
+			total += agg.TotalCost
+			exp, ok := tc.expected[key]
+			if !ok {
+				t.Errorf("%s: unexpected aggregation %s", name, key)
+				continue
+			}
+			if !util.IsApproximately(agg.TotalCost, exp) {
+				t.Errorf("%s: expected %s cost %f; got %f", name, key, exp, agg.TotalCost)
+			}
+			resourceCost := agg.CPUCost + agg.RAMCost + agg.GPUCost + agg.PVCost + agg.NetworkCost + agg.SharedCost
+			if !util.IsApproximately(resourceCost, agg.TotalCost) {
+				t.Errorf("%s: expected %s resource costs to sum to total %f; got %f", name, key, agg.TotalCost, resourceCost)
+			}
+		}
+		if !util.IsApproximately(total, tc.total) {
+			t.Errorf("%s: expected aggregations to sum to %f; got %f", name, tc.total, total)
+		}
+	}
+}
+
+func TestAggregateCostData_SystemNamespaces(t *testing.T) {
+	cp := &mockProvider{config: &cloud.CustomPricing{CPU: "1.0", RAM: "0.0", GPU: "0.0", Storage: "0.0", SystemNamespaces: "kube-system, kube-public"}}
+
+	cpuAllocation := func(cores float64) []*util.Vector {
+		return []*util.Vector{{Timestamp: 1609459200, Value: cores}}
+	}
+
+	costData := map[string]*CostData{
+		"tenant/pod1":      {Namespace: "tenant", PodName: "pod1", ClusterID: "cluster1", CPUAllocation: cpuAllocation(2.0)},
+		"kube-system/dns":  {Namespace: "kube-system", PodName: "dns", ClusterID: "cluster1", CPUAllocation: cpuAllocation(1.0)},
+		"kube-public/info": {Namespace: "kube-public", PodName: "info", ClusterID: "cluster1", CPUAllocation: cpuAllocation(0.5)},
+	}
+
+	opts := &AggregationOptions{SystemNamespaces: cloud.SystemNamespaces(cp)}
+
+	for _, field := range []string{"namespace", "pod"} {
+		aggs := AggregateCostData(costData, field, nil, cp, opts)
+
+		system, ok := aggs[SystemAllocationKey]
+		if !ok {
+			t.Fatalf("%s: expected %s aggregation", field, SystemAllocationKey)
+		}
+		if !util.IsApproximately(system.TotalCost, 1.5) {
+			t.Errorf("%s: expected system cost 1.5; got %f", field, system.TotalCost)
+		}
+		for key := range aggs {
+			if strings.HasPrefix(key, "kube-") {
+				t.Errorf("%s: expected no tenant aggregation for system namespace; got %s", field, key)
+			}
+		}
+
+		total := 0.0
+		for _, agg := range aggs {
+			total += agg.TotalCost
+		}
+		if !util.IsApproximately(total, 3.5) {
+			t.Errorf("%s: expected aggregations to sum to 3.5; got %f", field, total)
+		}
+	}
+
+	// Other fields are unaffected
+	aggs := AggregateCostData(costData, "cluster", nil, cp, opts)
+	if _, ok := aggs[SystemAllocationKey]; ok || len(aggs) != 1 {
+		t.Errorf("expected a single cluster aggregation; got %d", len(aggs))
+	}
+
+	// Without system namespaces, kube-system is charged as a tenant
+	aggs = AggregateCostData(costData, "namespace", nil, cp, &AggregationOptions{})
+	if _, ok := aggs["kube-system"]; !ok {
+		t.Errorf("expected kube-system aggregation without system namespaces")
+	}
+	if defaults := cloud.SystemNamespaces(&mockProvider{config: &cloud.CustomPricing{}}); len(defaults) != 1 || defaults[0] != "kube-system" {
+		t.Errorf("expected default system namespaces [kube-system]; got %v", defaults)
+	}
+}
+
+func TestGenerateAggKey_ExcludeSystemNamespaces(t *testing.T) {
+	window, err := kubecost.ParseWindowUTC("1d")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	opts := DefaultAggregateQueryOpts()
+	key := GenerateAggKey(window, "namespace", nil, opts)
+
+	opts.ExcludeSystemNamespaces = true
+	if excludedKey := GenerateAggKey(window, "namespace", nil, opts); excludedKey == key {
+		t.Errorf("expected excluding system namespaces to change the aggregation key %s", key)
+	}
+}
+
+func TestParseIdlePolicy(t *testing.T) {
+	cases := map[string]IdlePolicy{
+		"":             IdlePolicyKeep,
+		"keep":         IdlePolicyKeep,
+		"drop":         IdlePolicyDrop,
+		"Proportional": IdlePolicyProportional,
+		"owner":        IdlePolicyOwner,
+	}
+	for s, expected := range cases {
+		policy, err := ParseIdlePolicy(s)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", s, err)
+		}
+		if policy != expected {
+			t.Errorf("%q: expected policy %d; got %d", s, expected, policy)
+		}
+	}
+
+	if _, err := ParseIdlePolicy("share"); err == nil {
+		t.Errorf("expected error for illegal idle policy")
+	}
+}
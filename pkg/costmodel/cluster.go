@@ -1,63 +1,137 @@
 package costmodel
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kubecost/cost-model/pkg/util/timeutil"
 
 	"github.com/kubecost/cost-model/pkg/cloud"
 	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
 	"github.com/kubecost/cost-model/pkg/log"
 	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util"
 
 	prometheus "github.com/prometheus/client_golang/api"
 	"k8s.io/klog"
 )
 
+// ErrNoData is returned, wrapped with context, when Prometheus returns no data
+// for a query over the selected time range. Match it with errors.Is.
+var ErrNoData = errors.New("not enough data available in the selected time range")
+
 const (
 	queryClusterCores = `sum(
-		avg(avg_over_time(kube_node_status_capacity_cpu_cores[%s] %s)) by (node, %s) * avg(avg_over_time(node_cpu_hourly_cost[%s] %s)) by (node, %s) * 730 +
-		avg(avg_over_time(node_gpu_hourly_cost[%s] %s)) by (node, %s) * 730
+		avg(avg_over_time(kube_node_status_capacity_cpu_cores[%s] %s)) by (node, %s) * avg(%s) by (node, %s) * 730
+	  ) by (%s)`
+
+	// GPU costs are queried separately from CPU costs, so that GPU-less
+	// clusters, without node_gpu_hourly_cost, simply have no GPU data.
+	queryClusterGPU = `sum(
+		avg(%s) by (node, %s) * 730
 	  ) by (%s)`
 
 	queryClusterRAM = `sum(
-		avg(avg_over_time(kube_node_status_capacity_memory_bytes[%s] %s)) by (node, %s) / 1024 / 1024 / 1024 * avg(avg_over_time(node_ram_hourly_cost[%s] %s)) by (node, %s) * 730
+		avg(avg_over_time(kube_node_status_capacity_memory_bytes[%s] %s)) by (node, %s) / 1024 / 1024 / 1024 * avg(%s) by (node, %s) * 730
 	  ) by (%s)`
 
 	queryStorage = `sum(
 		avg(avg_over_time(pv_hourly_cost[%s] %s)) by (persistentvolume, %s) * 730
-		* avg(avg_over_time(kube_persistentvolume_capacity_bytes[%s] %s)) by (persistentvolume, %s) / 1024 / 1024 / 1024
-	  ) by (%s) %s`
+		* avg(avg_over_time(kube_persistentvolume_capacity_bytes[%s] %s)) by (persistentvolume, %s) / %s
+	  ) by (%s)%s`
 
 	queryTotal = `sum(avg(node_total_hourly_cost) by (node, %s)) * 730 +
 	  sum(
 		avg(avg_over_time(pv_hourly_cost[1h])) by (persistentvolume, %s) * 730
-		* avg(avg_over_time(kube_persistentvolume_capacity_bytes[1h])) by (persistentvolume, %s) / 1024 / 1024 / 1024
-	  ) by (%s) %s`
+		* avg(avg_over_time(kube_persistentvolume_capacity_bytes[1h])) by (persistentvolume, %s) / %s
+	  ) by (%s)%s`
 
-	queryNodes = `sum(avg(node_total_hourly_cost) by (node, %s)) * 730 %s`
+	queryNodes = `sum(avg(node_total_hourly_cost) by (node, %s)) * 730%s`
 )
 
 // Costs represents cumulative and monthly cluster costs over a given duration. Costs
 // are broken down by cores, memory, and storage.
 type ClusterCosts struct {
-	Start             *time.Time             `json:"startTime"`
-	End               *time.Time             `json:"endTime"`
-	CPUCumulative     float64                `json:"cpuCumulativeCost"`
-	CPUMonthly        float64                `json:"cpuMonthlyCost"`
-	CPUBreakdown      *ClusterCostsBreakdown `json:"cpuBreakdown"`
-	GPUCumulative     float64                `json:"gpuCumulativeCost"`
-	GPUMonthly        float64                `json:"gpuMonthlyCost"`
-	RAMCumulative     float64                `json:"ramCumulativeCost"`
-	RAMMonthly        float64                `json:"ramMonthlyCost"`
-	RAMBreakdown      *ClusterCostsBreakdown `json:"ramBreakdown"`
-	StorageCumulative float64                `json:"storageCumulativeCost"`
-	StorageMonthly    float64                `json:"storageMonthlyCost"`
-	StorageBreakdown  *ClusterCostsBreakdown `json:"storageBreakdown"`
-	TotalCumulative   float64                `json:"totalCumulativeCost"`
-	TotalMonthly      float64                `json:"totalMonthlyCost"`
-	DataMinutes       float64
+	Start                 *time.Time             `json:"startTime"`
+	End                   *time.Time             `json:"endTime"`
+	DataStart             *time.Time             `json:"dataStartTime"`
+	DataEnd               *time.Time             `json:"dataEndTime"`
+	Window                string                 `json:"window"`
+	Offset                string                 `json:"offset"`
+	CPUCumulative         float64                `json:"cpuCumulativeCost"`
+	CPUMonthly            float64                `json:"cpuMonthlyCost"`
+	CPUBreakdown          *ClusterCostsBreakdown `json:"cpuBreakdown"`
+	GPUCumulative         float64                `json:"gpuCumulativeCost"`
+	GPUMonthly            float64                `json:"gpuMonthlyCost"`
+	RAMCumulative         float64                `json:"ramCumulativeCost"`
+	RAMMonthly            float64                `json:"ramMonthlyCost"`
+	RAMBreakdown          *ClusterCostsBreakdown `json:"ramBreakdown"`
+	StorageCumulative     float64                `json:"storageCumulativeCost"`
+	StorageMonthly        float64                `json:"storageMonthlyCost"`
+	StorageBreakdown      *ClusterCostsBreakdown `json:"storageBreakdown"`
+	TotalCumulative       float64                `json:"totalCumulativeCost"`
+	TotalMonthly          float64                `json:"totalMonthlyCost"`
+	DataMinutes           float64
+	NodeCount             int                  `json:"nodeCount,omitempty"`
+	ProvisionedCPU        float64              `json:"provisionedCPU,omitempty"`
+	ProvisionedRAMGiB     float64              `json:"provisionedRAMGiB,omitempty"`
+	ProvisionedStorageGiB float64              `json:"provisionedStorageGiB,omitempty"`
+	EffectiveDiscounts    map[string]float64   `json:"effectiveDiscounts"`
+	Markup                float64              `json:"markup,omitempty"`
+	ZeroPricedResources   []string             `json:"zeroPricedResources,omitempty"`
+	CoverageByResource    map[string]float64   `json:"coverageByResource"`
+	ProjectionConfidence  ProjectionConfidence `json:"projectionConfidence,omitempty"`
+	Warnings              []string             `json:"warnings,omitempty"`
+}
+
+// ProjectionConfidence describes how reliably the monthly-rate costs of a
+// ClusterCosts project the costs observed over its window.
+type ProjectionConfidence string
+
+const (
+	// ProjectionConfidenceHigh indicates a window of at least a day, nearly
+	// fully covered by data
+	ProjectionConfidenceHigh ProjectionConfidence = "high"
+
+	// ProjectionConfidenceMedium indicates a window shorter than a day, or one
+	// only partially covered by data
+	ProjectionConfidenceMedium ProjectionConfidence = "medium"
+
+	// ProjectionConfidenceLow indicates a window shorter than the minimum
+	// projection window, or one mostly lacking data
+	ProjectionConfidenceLow ProjectionConfidence = "low"
+)
+
+// DefaultMinProjectionWindow is the window below which monthly-rate costs are
+// flagged as low confidence by default.
+const DefaultMinProjectionWindow = time.Hour
+
+// projectionConfidence returns the ProjectionConfidence of monthly-rate costs
+// projected from the given window, of which the given number of minutes are
+// covered by data.
+func projectionConfidence(window time.Duration, dataMins float64, minWindow time.Duration) ProjectionConfidence {
+	coverage := 0.0
+	if window > 0 {
+		coverage = dataMins / window.Minutes()
+	}
+
+	switch {
+	case window < minWindow || coverage < 0.5:
+		return ProjectionConfidenceLow
+	case window < 24*time.Hour || coverage < 0.9:
+		return ProjectionConfidenceMedium
+	default:
+		return ProjectionConfidenceHigh
+	}
 }
 
 // ClusterCostsBreakdown provides percentage-based breakdown of a resource by
@@ -69,10 +143,63 @@ type ClusterCostsBreakdown struct {
 	User   float64 `json:"user"`
 }
 
+// Clone returns a deep copy of the ClusterCosts, sharing no pointers, maps, or
+// slices with the original. Results of ComputeClusterCosts may be shared, e.g.
+// when cached, so callers should mutate a clone rather than a shared result.
+func (cc *ClusterCosts) Clone() *ClusterCosts {
+	if cc == nil {
+		return nil
+	}
+
+	cloneTime := func(t *time.Time) *time.Time {
+		if t == nil {
+			return nil
+		}
+		clone := *t
+		return &clone
+	}
+
+	clone := *cc
+	clone.Start = cloneTime(cc.Start)
+	clone.End = cloneTime(cc.End)
+	clone.DataStart = cloneTime(cc.DataStart)
+	clone.DataEnd = cloneTime(cc.DataEnd)
+	clone.CPUBreakdown = cc.CPUBreakdown.clone()
+	clone.RAMBreakdown = cc.RAMBreakdown.clone()
+	clone.StorageBreakdown = cc.StorageBreakdown.clone()
+
+	if cc.EffectiveDiscounts != nil {
+		clone.EffectiveDiscounts = make(map[string]float64, len(cc.EffectiveDiscounts))
+		for k, v := range cc.EffectiveDiscounts {
+			clone.EffectiveDiscounts[k] = v
+		}
+	}
+	if cc.CoverageByResource != nil {
+		clone.CoverageByResource = make(map[string]float64, len(cc.CoverageByResource))
+		for k, v := range cc.CoverageByResource {
+			clone.CoverageByResource[k] = v
+		}
+	}
+	if cc.ZeroPricedResources != nil {
+		clone.ZeroPricedResources = append([]string{}, cc.ZeroPricedResources...)
+	}
+	if cc.Warnings != nil {
+		clone.Warnings = append([]string{}, cc.Warnings...)
+	}
+
+	return &clone
+}
+
 // NewClusterCostsFromCumulative takes cumulative cost data over a given time range, computes
 // the associated monthly rate data, and returns the Costs.
 func NewClusterCostsFromCumulative(cpu, gpu, ram, storage float64, window, offset time.Duration, dataHours float64) (*ClusterCosts, error) {
-	start, end := timeutil.ParseTimeRange(window, offset)
+	return newClusterCostsFromCumulativeAt(time.Now(), cpu, gpu, ram, storage, window, offset, dataHours)
+}
+
+// newClusterCostsFromCumulativeAt is NewClusterCostsFromCumulative, with the
+// window and offset taken relative to the given time rather than now.
+func newClusterCostsFromCumulativeAt(now time.Time, cpu, gpu, ram, storage float64, window, offset time.Duration, dataHours float64) (*ClusterCosts, error) {
+	start, end := timeutil.ParseAlignedTimeRangeAt(now, window, offset, timeutil.AlignNone)
 
 	// If the number of hours is not given (i.e. is zero) compute one from the window and offset
 	if dataHours == 0 {
@@ -84,9 +211,13 @@ func NewClusterCostsFromCumulative(cpu, gpu, ram, storage float64, window, offse
 		return nil, fmt.Errorf("illegal time range: window %s, offset %s", window, offset)
 	}
 
+	fmtWindow, fmtOffset := timeutil.DurationOffsetStrings(window, offset)
+
 	cc := &ClusterCosts{
 		Start:             &start,
 		End:               &end,
+		Window:            fmtWindow,
+		Offset:            fmtOffset,
 		CPUCumulative:     cpu,
 		GPUCumulative:     gpu,
 		RAMCumulative:     ram,
@@ -102,6 +233,549 @@ func NewClusterCostsFromCumulative(cpu, gpu, ram, storage float64, window, offse
 	return cc, nil
 }
 
+// Scale returns a clone of the ClusterCosts with all cumulative and monthly
+// costs multiplied by the given factor; e.g. 1.3 to estimate the costs of the
+// cluster having grown by 30%. Breakdowns are percentages, so they are copied
+// unchanged. Returns nil if the factor is negative.
+func (cc *ClusterCosts) Scale(factor float64) *ClusterCosts {
+	if cc == nil {
+		return nil
+	}
+
+	if factor < 0 {
+		log.Warningf("ClusterCosts.Scale: illegal negative factor: %f", factor)
+		return nil
+	}
+
+	scaled := cc.Clone()
+
+	scaled.CPUCumulative *= factor
+	scaled.CPUMonthly *= factor
+	scaled.GPUCumulative *= factor
+	scaled.GPUMonthly *= factor
+	scaled.RAMCumulative *= factor
+	scaled.RAMMonthly *= factor
+	scaled.StorageCumulative *= factor
+	scaled.StorageMonthly *= factor
+	scaled.TotalCumulative *= factor
+	scaled.TotalMonthly *= factor
+
+	return scaled
+}
+
+// MonthToDate returns the cost to date of the month containing the given time,
+// i.e. the TotalMonthly projection scaled by the fraction of the month elapsed
+// as of the given time, in the given time's location.
+func (cc *ClusterCosts) MonthToDate(now time.Time) float64 {
+	if cc == nil {
+		return 0.0
+	}
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	monthEnd := monthStart.AddDate(0, 1, 0)
+	elapsed := now.Sub(monthStart).Hours() / monthEnd.Sub(monthStart).Hours()
+
+	return cc.TotalMonthly * elapsed
+}
+
+// breakdownCompleteTolerance is the amount by which the fractions of a
+// complete ClusterCostsBreakdown may differ from summing to 1.0.
+const breakdownCompleteTolerance = 0.01
+
+// Merge adds each of the other breakdown's fractions to the breakdown's; e.g.
+// merging a system-only and a user-only partial breakdown results in a
+// breakdown with both system and user fractions. Merging nil is a no-op.
+func (ccb *ClusterCostsBreakdown) Merge(other *ClusterCostsBreakdown) {
+	if ccb == nil || other == nil {
+		return
+	}
+
+	ccb.Idle += other.Idle
+	ccb.Other += other.Other
+	ccb.System += other.System
+	ccb.User += other.User
+}
+
+// Complete returns true if the breakdown's fractions sum to approximately 1.0
+func (ccb *ClusterCostsBreakdown) Complete() bool {
+	if ccb == nil {
+		return false
+	}
+
+	return math.Abs(ccb.Idle+ccb.Other+ccb.System+ccb.User-1.0) <= breakdownCompleteTolerance
+}
+
+// clone returns a copy of the ClusterCostsBreakdown, or nil if it is nil
+func (ccb *ClusterCostsBreakdown) clone() *ClusterCostsBreakdown {
+	if ccb == nil {
+		return nil
+	}
+
+	c := *ccb
+	return &c
+}
+
+// ClusterCostsHourly holds the hourly cost rates of a cluster, broken down by
+// cores, memory, and storage.
+type ClusterCostsHourly struct {
+	CPUHourly     float64 `json:"cpuHourlyCost"`
+	GPUHourly     float64 `json:"gpuHourlyCost"`
+	RAMHourly     float64 `json:"ramHourlyCost"`
+	StorageHourly float64 `json:"storageHourlyCost"`
+	TotalHourly   float64 `json:"totalHourlyCost"`
+}
+
+// HourlyRates returns the hourly cost rates of the cluster, derived from the
+// monthly rates using timeutil.HoursPerMonth.
+func (cc *ClusterCosts) HourlyRates() *ClusterCostsHourly {
+	if cc == nil {
+		return nil
+	}
+
+	return &ClusterCostsHourly{
+		CPUHourly:     cc.CPUMonthly / timeutil.HoursPerMonth,
+		GPUHourly:     cc.GPUMonthly / timeutil.HoursPerMonth,
+		RAMHourly:     cc.RAMMonthly / timeutil.HoursPerMonth,
+		StorageHourly: cc.StorageMonthly / timeutil.HoursPerMonth,
+		TotalHourly:   cc.TotalMonthly / timeutil.HoursPerMonth,
+	}
+}
+
+// ClusterCostsShares holds the fraction of a cluster's total cost due to each
+// of cores, memory, and storage.
+type ClusterCostsShares struct {
+	CPUSharePct     float64 `json:"cpuSharePct"`
+	GPUSharePct     float64 `json:"gpuSharePct"`
+	RAMSharePct     float64 `json:"ramSharePct"`
+	StorageSharePct float64 `json:"storageSharePct"`
+}
+
+// ResourceShares returns the fraction, in [0, 1], of the cumulative cost of
+// all resources due to each resource. The shares are relative to the sum of
+// the resource costs, rather than TotalCumulative, so that they sum to one
+// even if GPU costs are excluded from the total. All shares are zero if the
+// sum is zero.
+func (cc *ClusterCosts) ResourceShares() *ClusterCostsShares {
+	if cc == nil {
+		return nil
+	}
+
+	shares := &ClusterCostsShares{}
+	total := cc.CPUCumulative + cc.GPUCumulative + cc.RAMCumulative + cc.StorageCumulative
+	if total == 0 {
+		return shares
+	}
+
+	shares.CPUSharePct = cc.CPUCumulative / total
+	shares.GPUSharePct = cc.GPUCumulative / total
+	shares.RAMSharePct = cc.RAMCumulative / total
+	shares.StorageSharePct = cc.StorageCumulative / total
+
+	return shares
+}
+
+// clusterStoragePVName is the name of the PV to which ToAllocation attributes
+// a cluster's storage cost, which is not broken down by PV.
+const clusterStoragePVName = "__storage__"
+
+// ToAllocation converts the cumulative ClusterCosts of the given cluster to an
+// Allocation covering the window from Start to End. Storage cost is
+// attributed to a single PV named clusterStoragePVName.
+func (cc *ClusterCosts) ToAllocation(clusterID string) kubecost.Allocation {
+	alloc := kubecost.Allocation{
+		Name:       clusterID,
+		Properties: &kubecost.AllocationProperties{Cluster: clusterID},
+		Window:     kubecost.NewWindow(cc.Start, cc.End),
+		CPUCost:    cc.CPUCumulative,
+		GPUCost:    cc.GPUCumulative,
+		RAMCost:    cc.RAMCumulative,
+	}
+
+	if cc.Start != nil {
+		alloc.Start = *cc.Start
+	}
+	if cc.End != nil {
+		alloc.End = *cc.End
+	}
+
+	if cc.StorageCumulative != 0 {
+		alloc.PVs = kubecost.PVAllocations{
+			{Cluster: clusterID, Name: clusterStoragePVName}: {Cost: cc.StorageCumulative},
+		}
+	}
+
+	return alloc
+}
+
+// influxTagEscaper escapes the characters that are special in line protocol
+// tag keys and values.
+var influxTagEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, " ", `\ `, "=", `\=`)
+
+// WriteInfluxLineProtocol writes the ClusterCosts of the given cluster to w as
+// a single InfluxDB line protocol point of the measurement "cluster_cost",
+// tagged by cluster_id, with a field for each cost and breakdown category, and
+// timestamped at t with nanosecond precision.
+func (cc *ClusterCosts) WriteInfluxLineProtocol(w io.Writer, clusterID string, t time.Time) error {
+	return cc.WriteInfluxLineProtocolWithOptions(w, clusterID, t, nil)
+}
+
+// WriteInfluxLineProtocolWithOptions is WriteInfluxLineProtocol, with values
+// written to the decimal precision given by the options. By default, values
+// are written in their shortest exact representation.
+func (cc *ClusterCosts) WriteInfluxLineProtocolWithOptions(w io.Writer, clusterID string, t time.Time, opts *ExportOptions) error {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	precision := opts.precision(-1)
+	breakdownPrecision := opts.breakdownPrecision(-1)
+
+	if clusterID == "" {
+		return fmt.Errorf("illegal cluster ID: must not be empty")
+	}
+
+	fields := []string{
+		fmt.Sprintf("cpu_cumulative_cost=%s", formatInfluxFloat(cc.CPUCumulative, precision)),
+		fmt.Sprintf("cpu_monthly_cost=%s", formatInfluxFloat(cc.CPUMonthly, precision)),
+		fmt.Sprintf("gpu_cumulative_cost=%s", formatInfluxFloat(cc.GPUCumulative, precision)),
+		fmt.Sprintf("gpu_monthly_cost=%s", formatInfluxFloat(cc.GPUMonthly, precision)),
+		fmt.Sprintf("ram_cumulative_cost=%s", formatInfluxFloat(cc.RAMCumulative, precision)),
+		fmt.Sprintf("ram_monthly_cost=%s", formatInfluxFloat(cc.RAMMonthly, precision)),
+		fmt.Sprintf("storage_cumulative_cost=%s", formatInfluxFloat(cc.StorageCumulative, precision)),
+		fmt.Sprintf("storage_monthly_cost=%s", formatInfluxFloat(cc.StorageMonthly, precision)),
+		fmt.Sprintf("total_cumulative_cost=%s", formatInfluxFloat(cc.TotalCumulative, precision)),
+		fmt.Sprintf("total_monthly_cost=%s", formatInfluxFloat(cc.TotalMonthly, precision)),
+	}
+
+	breakdowns := []struct {
+		resource  string
+		breakdown *ClusterCostsBreakdown
+	}{
+		{"cpu", cc.CPUBreakdown},
+		{"ram", cc.RAMBreakdown},
+		{"storage", cc.StorageBreakdown},
+	}
+	for _, bd := range breakdowns {
+		if bd.breakdown == nil {
+			continue
+		}
+		fields = append(fields,
+			fmt.Sprintf("%s_breakdown_idle=%s", bd.resource, formatInfluxFloat(bd.breakdown.Idle, breakdownPrecision)),
+			fmt.Sprintf("%s_breakdown_other=%s", bd.resource, formatInfluxFloat(bd.breakdown.Other, breakdownPrecision)),
+			fmt.Sprintf("%s_breakdown_system=%s", bd.resource, formatInfluxFloat(bd.breakdown.System, breakdownPrecision)),
+			fmt.Sprintf("%s_breakdown_user=%s", bd.resource, formatInfluxFloat(bd.breakdown.User, breakdownPrecision)),
+		)
+	}
+
+	_, err := fmt.Fprintf(w, "cluster_cost,cluster_id=%s %s %d\n", influxTagEscaper.Replace(clusterID), strings.Join(fields, ","), t.UnixNano())
+	return err
+}
+
+// promLabelValueEscaper escapes the characters that are special in label
+// values of the Prometheus text exposition format.
+var promLabelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promLabelValue returns the given value as a valid, escaped Prometheus label
+// value; i.e. valid UTF-8, with special characters escaped.
+func promLabelValue(value string) string {
+	return promLabelValueEscaper.Replace(strings.ToValidUTF8(value, "\uFFFD"))
+}
+
+// WritePrometheus writes the ClusterCosts of the given cluster to w in the
+// Prometheus text exposition format, with a gauge for each cost and breakdown
+// category, e.g. cluster_cpu_cumulative_cost. Each sample is labeled by
+// cluster_id and by window, carrying the Window of the ClusterCosts, so that
+// costs of the same cluster over different windows (e.g. 1d and 7d) are
+// distinct series when exported together.
+func (cc *ClusterCosts) WritePrometheus(w io.Writer, clusterID string) error {
+	if clusterID == "" {
+		return fmt.Errorf("illegal cluster ID: must not be empty")
+	}
+
+	type sample struct {
+		name  string
+		value float64
+	}
+
+	samples := []sample{
+		{"cpu_cumulative_cost", cc.CPUCumulative},
+		{"cpu_monthly_cost", cc.CPUMonthly},
+		{"gpu_cumulative_cost", cc.GPUCumulative},
+		{"gpu_monthly_cost", cc.GPUMonthly},
+		{"ram_cumulative_cost", cc.RAMCumulative},
+		{"ram_monthly_cost", cc.RAMMonthly},
+		{"storage_cumulative_cost", cc.StorageCumulative},
+		{"storage_monthly_cost", cc.StorageMonthly},
+		{"total_cumulative_cost", cc.TotalCumulative},
+		{"total_monthly_cost", cc.TotalMonthly},
+	}
+
+	breakdowns := []struct {
+		resource  string
+		breakdown *ClusterCostsBreakdown
+	}{
+		{"cpu", cc.CPUBreakdown},
+		{"ram", cc.RAMBreakdown},
+		{"storage", cc.StorageBreakdown},
+	}
+	for _, bd := range breakdowns {
+		if bd.breakdown == nil {
+			continue
+		}
+		samples = append(samples,
+			sample{bd.resource + "_breakdown_idle", bd.breakdown.Idle},
+			sample{bd.resource + "_breakdown_other", bd.breakdown.Other},
+			sample{bd.resource + "_breakdown_system", bd.breakdown.System},
+			sample{bd.resource + "_breakdown_user", bd.breakdown.User},
+		)
+	}
+
+	labels := fmt.Sprintf(`cluster_id="%s",window="%s"`, promLabelValue(clusterID), promLabelValue(cc.Window))
+	for _, sample := range samples {
+		if _, err := fmt.Fprintf(w, "cluster_%s{%s} %s\n", sample.name, labels, strconv.FormatFloat(sample.value, 'g', -1, 64)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// formatInfluxFloat formats the given value as a line protocol float field
+// value, with the given number of decimal places, or in its shortest exact
+// representation if negative. Line protocol has no representation of NaN or
+// Inf, so those are written as zero.
+func formatInfluxFloat(f float64, precision int) string {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		f = 0.0
+	}
+	return strconv.FormatFloat(f, 'f', precision, 64)
+}
+
+// AggregateClusterCosts rolls up the given per-cluster costs into a single
+// ClusterCosts spanning all of them. Costs are summed using compensated
+// summation, so that the aggregate matches the per-cluster sum even across
+// many clusters, and breakdowns are averaged, weighted by each cluster's data
+// minutes. Returns nil if there are no costs.
+func AggregateClusterCosts(costs map[string]*ClusterCosts) *ClusterCosts {
+	if len(costs) == 0 {
+		return nil
+	}
+
+	var cpuCumulative, cpuMonthly, gpuCumulative, gpuMonthly util.KahanSum
+	var ramCumulative, ramMonthly, storageCumulative, storageMonthly util.KahanSum
+	var totalCumulative, totalMonthly, dataMinutes util.KahanSum
+
+	cpuBD := &weightedBreakdown{}
+	ramBD := &weightedBreakdown{}
+	storageBD := &weightedBreakdown{}
+
+	agg := &ClusterCosts{}
+	for _, cc := range costs {
+		if cc == nil {
+			continue
+		}
+
+		if cc.Start != nil && (agg.Start == nil || cc.Start.Before(*agg.Start)) {
+			start := *cc.Start
+			agg.Start = &start
+		}
+		if cc.End != nil && (agg.End == nil || cc.End.After(*agg.End)) {
+			end := *cc.End
+			agg.End = &end
+		}
+
+		cpuCumulative.Add(cc.CPUCumulative)
+		cpuMonthly.Add(cc.CPUMonthly)
+		gpuCumulative.Add(cc.GPUCumulative)
+		gpuMonthly.Add(cc.GPUMonthly)
+		ramCumulative.Add(cc.RAMCumulative)
+		ramMonthly.Add(cc.RAMMonthly)
+		storageCumulative.Add(cc.StorageCumulative)
+		storageMonthly.Add(cc.StorageMonthly)
+		totalCumulative.Add(cc.TotalCumulative)
+		totalMonthly.Add(cc.TotalMonthly)
+		dataMinutes.Add(cc.DataMinutes)
+
+		cpuBD.add(cc.CPUBreakdown, cc.DataMinutes)
+		ramBD.add(cc.RAMBreakdown, cc.DataMinutes)
+		storageBD.add(cc.StorageBreakdown, cc.DataMinutes)
+	}
+
+	agg.CPUCumulative = cpuCumulative.Value()
+	agg.CPUMonthly = cpuMonthly.Value()
+	agg.GPUCumulative = gpuCumulative.Value()
+	agg.GPUMonthly = gpuMonthly.Value()
+	agg.RAMCumulative = ramCumulative.Value()
+	agg.RAMMonthly = ramMonthly.Value()
+	agg.StorageCumulative = storageCumulative.Value()
+	agg.StorageMonthly = storageMonthly.Value()
+	agg.TotalCumulative = totalCumulative.Value()
+	agg.TotalMonthly = totalMonthly.Value()
+	agg.DataMinutes = dataMinutes.Value()
+	agg.CPUBreakdown = cpuBD.value()
+	agg.RAMBreakdown = ramBD.value()
+	agg.StorageBreakdown = storageBD.value()
+
+	return agg
+}
+
+// weightedBreakdown accumulates a weighted average of ClusterCostsBreakdowns
+type weightedBreakdown struct {
+	idle, other, system, user, weight util.KahanSum
+}
+
+// add adds the given breakdown, with the given weight, to the average. Nil
+// breakdowns are ignored.
+func (wb *weightedBreakdown) add(bd *ClusterCostsBreakdown, weight float64) {
+	if bd == nil || weight <= 0 {
+		return
+	}
+
+	wb.idle.Add(bd.Idle * weight)
+	wb.other.Add(bd.Other * weight)
+	wb.system.Add(bd.System * weight)
+	wb.user.Add(bd.User * weight)
+	wb.weight.Add(weight)
+}
+
+// value returns the weighted average breakdown, or nil if none were added
+func (wb *weightedBreakdown) value() *ClusterCostsBreakdown {
+	weight := wb.weight.Value()
+	if weight == 0 {
+		return nil
+	}
+
+	return &ClusterCostsBreakdown{
+		Idle:   wb.idle.Value() / weight,
+		Other:  wb.other.Value() / weight,
+		System: wb.system.Value() / weight,
+		User:   wb.user.Value() / weight,
+	}
+}
+
+// ClusterCostsDiff describes the differences between two sets of per-cluster
+// costs, as computed by DiffClusterCosts.
+type ClusterCostsDiff struct {
+	Added   []string              `json:"added"`
+	Removed []string              `json:"removed"`
+	Changed []*ClusterCostsChange `json:"changed"`
+}
+
+// ClusterCostsChange describes the change in total cumulative cost of a
+// single cluster.
+type ClusterCostsChange struct {
+	Cluster  string  `json:"cluster"`
+	OldTotal float64 `json:"oldTotal"`
+	NewTotal float64 `json:"newTotal"`
+	Delta    float64 `json:"delta"`
+}
+
+// ClustersMissingPricing returns the sorted IDs of the clusters that have
+// capacity, i.e. zero-priced resources or a non-zero node count, but zero total
+// cost. Such clusters are likely missing pricing metrics or configuration.
+// The costs must be computed WithZeroPriceWarnings or WithNodeCount.
+func ClustersMissingPricing(costs map[string]*ClusterCosts) []string {
+	ids := []string{}
+
+	for id, cc := range costs {
+		if cc == nil || cc.TotalCumulative != 0 {
+			continue
+		}
+		if len(cc.ZeroPricedResources) == 0 && cc.NodeCount == 0 {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+// DiffClusterCosts compares two maps of per-cluster costs and classifies each
+// cluster as added, removed, or changed. A cluster present in both maps is only
+// considered changed if its total cumulative cost moved by more than the given
+// threshold, expressed as a fraction of the old total; e.g. 0.1 for 10%.
+// Results are sorted by cluster ID.
+func DiffClusterCosts(old, new map[string]*ClusterCosts, threshold float64) *ClusterCostsDiff {
+	diff := &ClusterCostsDiff{
+		Added:   []string{},
+		Removed: []string{},
+		Changed: []*ClusterCostsChange{},
+	}
+
+	for id := range new {
+		if _, ok := old[id]; !ok {
+			diff.Added = append(diff.Added, id)
+		}
+	}
+
+	for id, oldCosts := range old {
+		newCosts, ok := new[id]
+		if !ok {
+			diff.Removed = append(diff.Removed, id)
+			continue
+		}
+
+		oldTotal, newTotal := 0.0, 0.0
+		if oldCosts != nil {
+			oldTotal = oldCosts.TotalCumulative
+		}
+		if newCosts != nil {
+			newTotal = newCosts.TotalCumulative
+		}
+
+		delta := newTotal - oldTotal
+		if delta == 0 {
+			continue
+		}
+
+		// Any change from zero is considered significant
+		if oldTotal != 0 && math.Abs(delta/oldTotal) <= threshold {
+			continue
+		}
+
+		diff.Changed = append(diff.Changed, &ClusterCostsChange{
+			Cluster:  id,
+			OldTotal: oldTotal,
+			NewTotal: newTotal,
+			Delta:    delta,
+		})
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].Cluster < diff.Changed[j].Cluster
+	})
+
+	return diff
+}
+
+// ResourceDeltas returns the change in monthly-rate cost of each resource,
+// keyed by "cpu", "ram", "storage", and "gpu", from the baseline costs to the
+// current costs; e.g. to attribute an increase in cost to its resources. A nil
+// baseline, or current, is treated as zero cost.
+func ResourceDeltas(current, baseline *ClusterCosts) map[string]float64 {
+	monthly := func(cc *ClusterCosts) map[string]float64 {
+		if cc == nil {
+			return map[string]float64{}
+		}
+		return map[string]float64{
+			"cpu":     cc.CPUMonthly,
+			"ram":     cc.RAMMonthly,
+			"storage": cc.StorageMonthly,
+			"gpu":     cc.GPUMonthly,
+		}
+	}
+
+	currentMonthly, baselineMonthly := monthly(current), monthly(baseline)
+
+	deltas := map[string]float64{}
+	for _, resource := range []string{"cpu", "ram", "storage", "gpu"} {
+		deltas[resource] = currentMonthly[resource] - baselineMonthly[resource]
+	}
+	return deltas
+}
+
 type Disk struct {
 	Cluster    string
 	Name       string
@@ -216,7 +890,11 @@ func ClusterDisks(client prometheus.Client, provider cloud.Provider, duration, o
 				Local:     true,
 			}
 		}
-		diskMap[key].Breakdown.System = cost / diskMap[key].Cost
+		used, clamped := usedFraction(cost, diskMap[key].Cost)
+		if clamped {
+			log.Warningf("ClusterDisks: used cost %f of local disk %s exceeds its cost %f; capping used fraction", cost, key, diskMap[key].Cost)
+		}
+		diskMap[key].Breakdown.System = used
 	}
 
 	for _, result := range resLocalStorageBytes {
@@ -497,22 +1175,75 @@ func ClusterNodes(cp cloud.Provider, client prometheus.Client, duration, offset
 	return nodeMap, nil
 }
 
-type LoadBalancer struct {
-	Cluster    string
-	Name       string
-	ProviderID string
-	Cost       float64
-	Start      time.Time
-	Minutes    float64
+// Node labels identifying the node pool, or node group, of a node by provider
+const (
+	gkeNodePoolLabel  = "cloud.google.com/gke-nodepool"
+	eksNodeGroupLabel = "eks.amazonaws.com/nodegroup"
+	aksAgentPoolLabel = "kubernetes.azure.com/agentpool"
+)
+
+// defaultNodePoolLabel returns the node label identifying node pools on the
+// given provider, or an empty string if the provider has no such label.
+func defaultNodePoolLabel(provider cloud.Provider) string {
+	switch provider.(type) {
+	case *cloud.GCP:
+		return gkeNodePoolLabel
+	case *cloud.AWS:
+		return eksNodeGroupLabel
+	case *cloud.Azure:
+		return aksAgentPoolLabel
+	}
+
+	return ""
 }
 
-func ClusterLoadBalancers(client prometheus.Client, duration, offset time.Duration) (map[string]*LoadBalancer, error) {
-	durationStr := fmt.Sprintf("%dm", int64(duration.Minutes()))
-	offsetStr := fmt.Sprintf(" offset %dm", int64(offset.Minutes()))
-	if offset < time.Minute {
-		offsetStr = ""
+// Per-node cumulative cost queries, by node and cluster, for joining to other
+// per-node metrics; e.g. node labels or taints
+const (
+	fmtNodeCPUCost = `
+		sum_over_time(avg(kube_node_status_capacity_cpu_cores) by (node, %s)[%s:%dm]%s) *
+		avg(avg_over_time(node_cpu_hourly_cost[%s:%dm]%s)) by (node, %s) * %f
+	`
+
+	fmtNodeRAMCost = `
+		sum_over_time(avg(kube_node_status_capacity_memory_bytes) by (node, %s)[%s:%dm]%s) / 1024 / 1024 / 1024 *
+		avg(avg_over_time(node_ram_hourly_cost[%s:%dm]%s)) by (node, %s) * %f
+	`
+
+	fmtNodeGPUCost = `
+		sum(sum_over_time(node_gpu_hourly_cost[%s:%dm]%s) * %f) by (node, %s)
+	`
+)
+
+// ClusterCostsByNodePool gives the cumulative and monthly-rate CPU, GPU, and RAM costs over a window of time, keyed
+// by cluster ID and then by node pool, as identified by the given node label; e.g. "cloud.google.com/gke-nodepool".
+// If poolLabel is empty, the provider's default node pool label is used. Costs of nodes without the label are
+// attributed to UnallocatedSubfield. Storage is not attributed to node pools.
+func ClusterCostsByNodePool(client prometheus.Client, provider cloud.Provider, window, offset time.Duration, poolLabel string) (map[string]map[string]*ClusterCosts, error) {
+	return ClusterCostsByNodePoolWithOptions(client, provider, window, offset, poolLabel, nil)
+}
+
+// ClusterCostsByNodePoolWithOptions is ClusterCostsByNodePool with the given options, which may be nil. Of the options,
+// DiscountByCluster is applied as in ComputeClusterCosts and, if poolLabel is in LabelMask, node pools are keyed by
+// pseudonyms of their names.
+func ClusterCostsByNodePoolWithOptions(client prometheus.Client, provider cloud.Provider, window, offset time.Duration, poolLabel string, opts *ClusterCostsOptions) (map[string]map[string]*ClusterCosts, error) {
+	if opts == nil {
+		opts = &ClusterCostsOptions{}
+	}
+
+	if poolLabel == "" {
+		poolLabel = defaultNodePoolLabel(provider)
+		if poolLabel == "" {
+			return nil, fmt.Errorf("no default node pool label for provider; a node pool label is required")
+		}
 	}
 
+	if err := timeutil.ValidateTimeRange(window, offset, env.GetPrometheusRetention()); err != nil {
+		return nil, err
+	}
+
+	mins := timeutil.ParseTimeRangeDetailed(window, offset, time.Minute).Minutes()
+
 	// minsPerResolution determines accuracy and resource use for the following
 	// queries. Smaller values (higher resolution) result in better accuracy,
 	// but more expensive queries, and vice-a-versa.
@@ -523,31 +1254,169 @@ func ClusterLoadBalancers(client prometheus.Client, duration, offset time.Durati
 	// [$/hr] * [min/res]*[hr/min] = [$/res]
 	hourlyToCumulative := float64(minsPerResolution) * (1.0 / 60.0)
 
-	ctx := prom.NewNamedContext(client, prom.ClusterContextName)
-	queryLBCost := fmt.Sprintf(`sum_over_time((avg(kubecost_load_balancer_cost) by (namespace, service_name, %s, ingress_ip))[%s:%dm]%s) * %f`, env.GetPromClusterLabel(), durationStr, minsPerResolution, offsetStr, hourlyToCumulative)
-	queryActiveMins := fmt.Sprintf(`count(kubecost_load_balancer_cost) by (namespace, service_name, %s, ingress_ip)[%s:%dm]%s`, env.GetPromClusterLabel(), durationStr, minsPerResolution, offsetStr)
+	// Each per-node cost is joined to the node's pool label from
+	// kube_node_labels, or to no pool label, for nodes with capacity but
+	// missing from kube_node_labels
+	const fmtQueryNodePoolCost = `
+		sum(
+			(%s)
+			* on (node, %s) group_left(%s) (
+				max(max_over_time(kube_node_labels[%s]%s)) by (node, %s, %s)
+				or on (node, %s)
+				max(max_over_time(kube_node_status_capacity_cpu_cores[%s]%s)) by (node, %s) * 0 + 1
+			)
+		) by (%s, %s)
+	`
 
-	resChLBCost := ctx.Query(queryLBCost)
-	resChActiveMins := ctx.Query(queryActiveMins)
+	fmtOffset := timeutil.DurationToPromOffsetString(offset)
+	clusterLabel := env.GetPromClusterLabel()
+	poolPromLabel := "label_" + prom.SanitizeLabelName(poolLabel)
 
-	resLBCost, _ := resChLBCost.Await()
-	resActiveMins, _ := resChActiveMins.Await()
+	nodePoolQuery := func(nodeCost string) string {
+		return fmt.Sprintf(fmtQueryNodePoolCost, nodeCost, clusterLabel, poolPromLabel, window, fmtOffset, clusterLabel, poolPromLabel, clusterLabel, window, fmtOffset, clusterLabel, clusterLabel, poolPromLabel)
+	}
+
+	queryCPU := nodePoolQuery(fmt.Sprintf(fmtNodeCPUCost, clusterLabel, window, minsPerResolution, fmtOffset, window, minsPerResolution, fmtOffset, clusterLabel, hourlyToCumulative))
+	queryRAM := nodePoolQuery(fmt.Sprintf(fmtNodeRAMCost, clusterLabel, window, minsPerResolution, fmtOffset, window, minsPerResolution, fmtOffset, clusterLabel, hourlyToCumulative))
+	queryGPU := nodePoolQuery(fmt.Sprintf(fmtNodeGPUCost, window, minsPerResolution, fmtOffset, hourlyToCumulative, clusterLabel))
 
+	ctx := prom.NewNamedContext(client, prom.ClusterContextName)
+	resChs := ctx.QueryAll(queryCPU, queryRAM, queryGPU)
+
+	resCPU, _ := resChs[0].Await()
+	resRAM, _ := resChs[1].Await()
+	resGPU, _ := resChs[2].Await()
 	if ctx.HasErrors() {
 		return nil, ctx.ErrorCollection()
 	}
 
-	loadBalancerMap := map[string]*LoadBalancer{}
-
-	for _, result := range resLBCost {
-		cluster, err := result.GetString(env.GetPromClusterLabel())
-		if err != nil {
-			cluster = env.GetClusterID()
-		}
-		namespace, err := result.GetString("namespace")
-		if err != nil {
-			log.Warningf("ClusterLoadBalancers: LB cost data missing namespace")
-			continue
+	// Apply the same discounts as ComputeClusterCosts
+	discounts := providerDiscounts(provider, opts.DiscountByCluster)
+
+	costData := buildNodePoolCostData(poolPromLabel, opts.defaultClusterID(), map[string][]*prom.QueryResult{
+		"cpu": resCPU,
+		"ram": resRAM,
+		"gpu": resGPU,
+	})
+
+	costsByPool := map[string]map[string]*ClusterCosts{}
+	for clusterID, pools := range costData {
+		discount, customDiscount := discounts.forCluster(clusterID)
+		costsByPool[clusterID] = map[string]*ClusterCosts{}
+		for pool, cd := range pools {
+			cpu := cd["cpu"] * (1.0 - discount) * (1.0 - customDiscount)
+			ram := cd["ram"] * (1.0 - discount) * (1.0 - customDiscount)
+			gpu := cd["gpu"] * (1.0 - customDiscount)
+
+			costs, err := NewClusterCostsFromCumulative(cpu, gpu, ram, 0.0, window, offset, mins/timeutil.MinsPerHour)
+			if err != nil {
+				return nil, err
+			}
+			costs.DataMinutes = mins
+			costsByPool[clusterID][pool] = costs
+		}
+	}
+
+	return maskCostsByLabelValue(costsByPool, opts.LabelMask, poolLabel, poolPromLabel), nil
+}
+
+// GPUCostsByModel gives the cumulative GPU cost over the given window, keyed
+// by cluster ID and then by GPU model name. The model name is taken from the
+// modelName label of node_gpu_hourly_cost if present, falling back on the
+// modelName reported by the DCGM exporter for the same node. GPU costs for
+// nodes with no known model are attributed to "unknown".
+func GPUCostsByModel(client prometheus.Client, window, offset time.Duration) (map[string]map[string]float64, error) {
+	durationStr := fmt.Sprintf("%dm", int64(window.Minutes()))
+	offsetStr := fmt.Sprintf(" offset %dm", int64(offset.Minutes()))
+	if offset < time.Minute {
+		offsetStr = ""
+	}
+
+	// minsPerResolution determines accuracy and resource use for the following
+	// queries. Smaller values (higher resolution) result in better accuracy,
+	// but more expensive queries, and vice-a-versa.
+	minsPerResolution := 5
+
+	// hourlyToCumulative is a scaling factor that, when multiplied by an hourly
+	// value, converts it to a cumulative value; i.e.
+	// [$/hr] * [min/res]*[hr/min] = [$/res]
+	hourlyToCumulative := float64(minsPerResolution) * (1.0 / 60.0)
+
+	requiredCtx := prom.NewNamedContext(client, prom.ClusterContextName)
+	optionalCtx := prom.NewNamedContext(client, prom.ClusterOptionalContextName)
+
+	queryGPUCost := fmt.Sprintf(`sum(sum_over_time(node_gpu_hourly_cost[%s:%dm]%s) * %f) by (%s, node, modelName)`, durationStr, minsPerResolution, offsetStr, hourlyToCumulative, env.GetPromClusterLabel())
+	queryGPUModel := fmt.Sprintf(`count(count_over_time(DCGM_FI_DEV_GPU_UTIL[%s]%s)) by (%s, Hostname, modelName)`, durationStr, offsetStr, env.GetPromClusterLabel())
+
+	resChGPUCost := requiredCtx.Query(queryGPUCost)
+	resChGPUModel := optionalCtx.Query(queryGPUModel)
+
+	resGPUCost, _ := resChGPUCost.Await()
+	resGPUModel, _ := resChGPUModel.Await()
+
+	if optionalCtx.HasErrors() {
+		for _, err := range optionalCtx.Errors() {
+			log.Warningf("GPUCostsByModel: %s", err)
+		}
+	}
+	if requiredCtx.HasErrors() {
+		return nil, requiredCtx.ErrorCollection()
+	}
+
+	return buildGPUCostsByModel(resGPUCost, resGPUModel, env.GetClusterIDOrDefault()), nil
+}
+
+type LoadBalancer struct {
+	Cluster    string
+	Name       string
+	ProviderID string
+	Cost       float64
+	Start      time.Time
+	Minutes    float64
+}
+
+func ClusterLoadBalancers(client prometheus.Client, duration, offset time.Duration) (map[string]*LoadBalancer, error) {
+	durationStr := fmt.Sprintf("%dm", int64(duration.Minutes()))
+	offsetStr := fmt.Sprintf(" offset %dm", int64(offset.Minutes()))
+	if offset < time.Minute {
+		offsetStr = ""
+	}
+
+	// minsPerResolution determines accuracy and resource use for the following
+	// queries. Smaller values (higher resolution) result in better accuracy,
+	// but more expensive queries, and vice-a-versa.
+	minsPerResolution := 5
+
+	// hourlyToCumulative is a scaling factor that, when multiplied by an hourly
+	// value, converts it to a cumulative value; i.e.
+	// [$/hr] * [min/res]*[hr/min] = [$/res]
+	hourlyToCumulative := float64(minsPerResolution) * (1.0 / 60.0)
+
+	ctx := prom.NewNamedContext(client, prom.ClusterContextName)
+	queryLBCost := fmt.Sprintf(`sum_over_time((avg(kubecost_load_balancer_cost) by (namespace, service_name, %s, ingress_ip))[%s:%dm]%s) * %f`, env.GetPromClusterLabel(), durationStr, minsPerResolution, offsetStr, hourlyToCumulative)
+	queryActiveMins := fmt.Sprintf(`count(kubecost_load_balancer_cost) by (namespace, service_name, %s, ingress_ip)[%s:%dm]%s`, env.GetPromClusterLabel(), durationStr, minsPerResolution, offsetStr)
+
+	resChLBCost := ctx.Query(queryLBCost)
+	resChActiveMins := ctx.Query(queryActiveMins)
+
+	resLBCost, _ := resChLBCost.Await()
+	resActiveMins, _ := resChActiveMins.Await()
+
+	if ctx.HasErrors() {
+		return nil, ctx.ErrorCollection()
+	}
+
+	loadBalancerMap := map[string]*LoadBalancer{}
+
+	for _, result := range resLBCost {
+		cluster, err := result.GetString(env.GetPromClusterLabel())
+		if err != nil {
+			cluster = env.GetClusterID()
+		}
+		namespace, err := result.GetString("namespace")
+		if err != nil {
+			log.Warningf("ClusterLoadBalancers: LB cost data missing namespace")
+			continue
 		}
 		serviceName, err := result.GetString("service_name")
 		if err != nil {
@@ -612,17 +1481,678 @@ func ClusterLoadBalancers(client prometheus.Client, duration, offset time.Durati
 	return loadBalancerMap, nil
 }
 
+// DiscountConfig holds the discounts, as fractions in [0, 1], applied to the
+// costs of a cluster. Discount applies to CPU and RAM; NegotiatedDiscount
+// applies to all resources.
+type DiscountConfig struct {
+	Discount           float64 `json:"discount"`
+	NegotiatedDiscount float64 `json:"negotiatedDiscount"`
+}
+
+// PriceAggregation determines how node prices, which may vary over a window
+// (e.g. spot prices), are aggregated over the window.
+type PriceAggregation int
+
+const (
+	// PriceAggregationAvg aggregates prices by their average over the window
+	PriceAggregationAvg PriceAggregation = iota
+
+	// PriceAggregationMedian aggregates prices by their median over the
+	// window, which is robust to short-lived price spikes
+	PriceAggregationMedian
+)
+
+// overTime returns a PromQL expression aggregating the given range vector
+// selector of prices over time.
+func (pa PriceAggregation) overTime(selector string) string {
+	if pa == PriceAggregationMedian {
+		return fmt.Sprintf("quantile_over_time(0.5, %s)", selector)
+	}
+	return fmt.Sprintf("avg_over_time(%s)", selector)
+}
+
+// CPUModeAggregation determines how the fractions of CPU time spent in each
+// mode are aggregated over the window for the CPU breakdown.
+type CPUModeAggregation int
+
+const (
+	// CPUModeAggregationRate computes the fractions from the rate of CPU time
+	// over the whole window, evaluated once at the end of the window
+	CPUModeAggregationRate CPUModeAggregation = iota
+
+	// CPUModeAggregationAvg averages the fractions computed at each step of
+	// the window, giving a smoother breakdown, representative of the whole
+	// window, which is less sensitive to spikes
+	CPUModeAggregationAvg
+)
+
+// StorageUnit determines the unit of storage capacity to which the per-unit
+// pv_hourly_cost is applied.
+type StorageUnit int
+
+const (
+	// StorageUnitGiB prices storage per binary gigabyte (2^30 bytes), as the
+	// cost model always has
+	StorageUnitGiB StorageUnit = iota
+
+	// StorageUnitGB prices storage per decimal gigabyte (10^9 bytes), as
+	// cloud bills typically do. Storage costs are ~7.4% (2^30 / 10^9) higher
+	// than in GiB, and reconcile more closely with invoices.
+	StorageUnitGB
+)
+
+// divisor returns a PromQL expression dividing bytes into the StorageUnit
+func (su StorageUnit) divisor() string {
+	if su == StorageUnitGB {
+		return "1000 / 1000 / 1000"
+	}
+	return "1024 / 1024 / 1024"
+}
+
+// CostBasis determines the quantity of CPU and RAM that is priced for cluster
+// costs.
+type CostBasis int
+
+const (
+	// CostBasisNodeCapacity prices the full capacity of each node, whether or
+	// not it is requested, as the cost model always has
+	CostBasisNodeCapacity CostBasis = iota
+
+	// CostBasisRequests prices only the CPU and RAM requested by containers on
+	// each node, giving the cost of what was asked for. Unrequested capacity
+	// is not priced, so idle cost appears as the gap between costs on this
+	// basis and on CostBasisNodeCapacity.
+	CostBasisRequests
+)
+
+// cpuCores returns a PromQL expression of the CPU cores priced per node
+func (cb CostBasis) cpuCores(clusterLabel string) string {
+	if cb == CostBasisRequests {
+		return fmt.Sprintf(`sum(kube_pod_container_resource_requests{resource="cpu", unit="core", container!="", container!="POD", node!=""}) by (node, %s)`, clusterLabel)
+	}
+	return "kube_node_status_capacity_cpu_cores"
+}
+
+// ramBytes returns a PromQL expression of the RAM bytes priced per node
+func (cb CostBasis) ramBytes(clusterLabel string) string {
+	if cb == CostBasisRequests {
+		return fmt.Sprintf(`sum(kube_pod_container_resource_requests{resource="memory", unit="byte", container!="", container!="POD", node!=""}) by (node, %s)`, clusterLabel)
+	}
+	return "kube_node_status_capacity_memory_bytes"
+}
+
+// ClusterCostsOptions provides optional parameters to ComputeClusterCostsWithOptions.
+//
+// The metrics queried for cluster costs are treated as follows:
+//   - gauges: node_cpu_hourly_cost, node_ram_hourly_cost, node_gpu_hourly_cost,
+//     pv_hourly_cost, kube_node_status_capacity_cpu_cores,
+//     kube_node_status_capacity_memory_bytes, kube_persistentvolume_capacity_bytes,
+//     container_memory_usage_bytes, kubecost_cluster_memory_working_set_bytes
+//   - counters: node_cpu_seconds_total
+//
+// Gauges are accumulated with sum_over_time. Counters are accumulated with
+// rate, which accounts for counter resets (e.g. on node restarts) within the
+// window, so they are never undercounted as they would be by sum_over_time.
+type ClusterCostsOptions struct {
+	WithBreakdown bool // set to true to receive CPU, RAM, and storage breakdowns
+	WithNodeCount bool // set to true to receive the number of nodes in each cluster over the window
+	WithCoverage  bool // set to true to receive the fraction of the window covered by each resource's price metrics
+	WithCapacity  bool // set to true to receive the average CPU cores, RAM GiB, and storage GiB provisioned in each cluster over the window
+
+	// WithZeroPriceWarnings, if true, queries CPU, RAM, and GPU capacity to
+	// warn about, and populate ZeroPricedResources with, resources that have
+	// capacity, but zero cost, which usually indicates misconfigured pricing.
+	WithZeroPriceWarnings bool
+
+	// StaticPricing, if set, is used to synthesize CPU, RAM, and GPU costs from
+	// node capacity metrics for clusters missing the node_*_hourly_cost metrics.
+	StaticPricing *StaticPricing
+
+	// UtilizationPercentile, if non-zero, computes the RAM usage breakdown
+	// from the given quantile of usage over the window (e.g. 0.95 for p95)
+	// rather than from the average. Must be in the range (0, 1).
+	UtilizationPercentile float64
+
+	// AlignTo snaps the end of the window back to the given boundary (e.g. the
+	// start of the hour or day), so that results are stable and cacheable.
+	// Queries are pinned to the aligned end via PromQL's @ modifier, which
+	// requires Prometheus support for @.
+	AlignTo timeutil.Alignment
+
+	// Location is the timezone in which AlignTo boundaries are snapped, e.g.
+	// so that days start at midnight in America/New_York. Defaults to UTC if
+	// nil. A day crossing a daylight saving time transition lasts 23 or 25
+	// hours.
+	Location *time.Location
+
+	// Logger receives the logs emitted while computing costs. Defaults to a
+	// klog-backed Logger if nil.
+	Logger log.Logger
+
+	// CPUModeCategories maps node_cpu_seconds_total modes (e.g. "iowait",
+	// "steal") to CPU breakdown categories ("idle", "system", "user", or
+	// "other"). Defaults to DefaultCPUModeCategories if nil.
+	CPUModeCategories map[string]string
+
+	// CPUUserModes are the node_cpu_seconds_total modes categorized as "user",
+	// taking precedence over CPUModeCategories. Defaults to
+	// DefaultCPUUserModes if both are nil, so that the defaults never override
+	// the given CPUModeCategories.
+	CPUUserModes []string
+
+	// MinProjectionWindow is the window below which monthly-rate costs, which
+	// are extrapolated from the window, are flagged with a warning and low
+	// ProjectionConfidence. Defaults to DefaultMinProjectionWindow if zero.
+	MinProjectionWindow time.Duration
+
+	// QueryTimeout, if positive, is passed to Prometheus as the timeout of
+	// each query, so that expensive queries fail fast server-side.
+	QueryTimeout time.Duration
+
+	// PriceAggregation determines how node prices are aggregated over the
+	// window. Defaults to PriceAggregationAvg.
+	PriceAggregation PriceAggregation
+
+	// StorageUnit determines whether PV storage is priced per GiB or per GB.
+	// Defaults to StorageUnitGiB. See StorageUnit for reconciliation.
+	StorageUnit StorageUnit
+
+	// CostBasis determines whether CPU and RAM costs are of node capacity or
+	// of container requests. Defaults to CostBasisNodeCapacity. Breakdowns and
+	// static resource hours are always of node capacity.
+	CostBasis CostBasis
+
+	// DiscountByCluster, if set, overrides the provider's discounts for the
+	// listed clusters, keyed by cluster ID, e.g. for clusters billed to
+	// accounts with different negotiated discounts. Clusters not listed
+	// receive the provider's discounts, including any per-cluster discounts
+	// configured by the provider's discountByCluster, which other cost APIs
+	// apply as well.
+	DiscountByCluster map[string]DiscountConfig
+
+	// Markup, if positive, is a fraction by which all costs are marked up
+	// after discounts, e.g. 0.15 for a 15% platform markup for internal
+	// chargeback. The markup is recorded on each resulting ClusterCosts.
+	Markup float64
+
+	// RecordingRuleTotals, if true, takes the CPU, RAM, GPU, and storage totals
+	// from the hourly cost recording rules named by RecordingRuleTotalMetric,
+	// e.g. "cluster:cost:cpu", which are cheaper to query than the raw
+	// metrics. Breakdowns are still computed from raw metrics and discounts
+	// are applied as usual. Any resource whose recording rule has no data
+	// falls back to its raw total.
+	RecordingRuleTotals bool
+
+	// QueryOverrides replaces the default query for the cumulative cost of a
+	// resource ("cpu", "gpu", "ram", or "storage") with the given template,
+	// whose two %s placeholders are filled with the window and offset, e.g.
+	// `sum(sum_over_time(my_ram_cost[%s:5m]%s)) by (cluster_id)`. Queries
+	// must give cumulative cost by cluster. Overrides take precedence over
+	// RecordingRuleTotals; discounts and markup are applied as usual.
+	QueryOverrides map[string]string
+
+	// CPUModeAggregation determines how the CPU breakdown is aggregated over
+	// the window. Defaults to CPUModeAggregationRate.
+	CPUModeAggregation CPUModeAggregation
+
+	// ExcludeGPU, if true, excludes GPU costs from TotalCumulative and
+	// TotalMonthly, e.g. for GPUs billed to a separate cost center. GPU costs
+	// are still reported in the GPU-specific fields.
+	ExcludeGPU bool
+
+	// Clock provides the time relative to which the window and offset are
+	// interpreted, which determines the resulting Start and End. Defaults to
+	// timeutil.RealClock if nil.
+	Clock timeutil.Clock
+
+	// GroupLabel, if set, groups costs by the given Prometheus label in place
+	// of the cluster label, e.g. "tenant". Series missing the label are keyed
+	// by UnallocatedSubfield. Provider-specific local storage queries group by
+	// cluster, so local storage costs are omitted when grouping by a label.
+	GroupLabel string
+
+	// DefaultClusterID keys the costs of series missing the cluster label,
+	// in place of the process-wide cluster ID from the environment, so that
+	// callers computing costs for several clusters in one process need not
+	// mutate the environment. Defaults to env.GetClusterIDOrDefault() if
+	// empty. Has no effect when grouping by GroupLabel.
+	DefaultClusterID string
+
+	// LabelMask lists sensitive labels, e.g. "customer_id", whose values must
+	// not leave the service. If GroupLabel is masked, each resulting key is
+	// replaced by a pseudonym derived from a hash of the label value, which
+	// keeps groups distinct without revealing their values. The by-label cost
+	// APIs, e.g. ClusterCostsByNodePoolWithOptions, mask their keys likewise.
+	LabelMask []string
+
+	// EvalTime, if set, pins queries to the given absolute evaluation time via
+	// PromQL's @ modifier, rather than evaluating relative to now, so that
+	// historical snapshots are reproducible. The window and offset end at
+	// EvalTime less the offset. Requires Prometheus support for @.
+	EvalTime time.Time
+
+	// OnProgress, if set, is called as each query completes with the number
+	// of queries completed so far and the total number of queries, e.g. to
+	// render a progress bar. Calls are made from a single goroutine, in order
+	// of completion, so the callback need not be safe for concurrent use, but
+	// must return quickly, as pending calls delay the completion of queries.
+	// All calls are made before ComputeClusterCostsWithOptions returns.
+	OnProgress func(completed, total int)
+}
+
+// defaultClusterID returns the ID keying the costs of series missing the
+// cluster label; i.e. DefaultClusterID, or env.GetClusterIDOrDefault() if
+// unset.
+func (opts *ClusterCostsOptions) defaultClusterID() string {
+	if opts == nil || opts.DefaultClusterID == "" {
+		return env.GetClusterIDOrDefault()
+	}
+	return opts.DefaultClusterID
+}
+
+// progressClient is a prometheus.Client that signals done as each request
+// completes, successfully or not, for reporting progress.
+type progressClient struct {
+	prometheus.Client
+	done chan<- struct{}
+}
+
+func (pc *progressClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, prometheus.Warnings, error) {
+	defer func() { pc.done <- struct{}{} }()
+	return pc.Client.Do(ctx, req)
+}
+
+// reportProgress calls onProgress once for each of the total signals received
+// on done, then closes finished.
+func reportProgress(done <-chan struct{}, total int, onProgress func(completed, total int), finished chan<- struct{}) {
+	defer close(finished)
+	for completed := 1; completed <= total; completed++ {
+		<-done
+		onProgress(completed, total)
+	}
+}
+
+// countQueries returns the number of the given channels that are non-nil, and
+// hence of queries submitted.
+func countQueries(resChs ...prom.QueryResultsChan) int {
+	n := 0
+	for _, resCh := range resChs {
+		if resCh != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// validateUtilizationPercentile returns an error if the given percentile does
+// not lie in the open range (0, 1).
+func validateUtilizationPercentile(percentile float64) error {
+	if percentile <= 0.0 || percentile >= 1.0 {
+		return fmt.Errorf("illegal utilization percentile: %f; must be in (0, 1)", percentile)
+	}
+
+	return nil
+}
+
+// queryRAMPctAtPercentile returns a query for the fraction of RAM capacity,
+// by cluster, used by the given usage selector at the given percentile of
+// usage over the window.
+func queryRAMPctAtPercentile(percentile float64, usage, clusterLabel string, window time.Duration, minsPerResolution int, fmtOffset string) string {
+	return queryUsagePctAtPercentile(percentile, usage, "kube_node_status_capacity_memory_bytes", clusterLabel, window, minsPerResolution, fmtOffset)
+}
+
+// queryUsagePctAtPercentile returns a query for the fraction of the given
+// capacity, by cluster, used by the given usage expression at the given
+// percentile of usage over the window.
+func queryUsagePctAtPercentile(percentile float64, usage, capacity, clusterLabel string, window time.Duration, minsPerResolution int, fmtOffset string) string {
+	const fmtQueryUsagePctAtPercentile = `
+		quantile_over_time(%g, sum(%s) by (%s)[%s:%dm]%s)
+		/ avg_over_time(sum(%s) by (%s)[%s:%dm]%s)
+	`
+
+	return fmt.Sprintf(fmtQueryUsagePctAtPercentile, percentile, usage, clusterLabel, window, minsPerResolution, fmtOffset, capacity, clusterLabel, window, minsPerResolution, fmtOffset)
+}
+
 // ComputeClusterCosts gives the cumulative and monthly-rate cluster costs over a window of time for all clusters.
 func (a *Accesses) ComputeClusterCosts(client prometheus.Client, provider cloud.Provider, window, offset time.Duration, withBreakdown bool) (map[string]*ClusterCosts, error) {
-	// Compute number of minutes in the full interval, for use interpolating missed scrapes or scaling missing data
-	start, end := timeutil.ParseTimeRange(window, offset)
+	return a.ComputeClusterCostsWithOptions(client, provider, window, offset, &ClusterCostsOptions{WithBreakdown: withBreakdown})
+}
+
+// clockSkewTolerance is the amount by which a requested time range may extend
+// past the current time, due to clock skew between caller and server, before
+// it is rejected as lying in the future.
+const clockSkewTolerance = time.Minute
+
+// ComputeClusterCostsAt gives the cumulative and monthly-rate cluster costs for all clusters over the given window,
+// beginning at the given absolute time; e.g. at=2021-01-01T00:00:00Z and window="1d" computes costs for January 1.
+// See ClusterCostsOptions; the offset of the window is taken relative to the time given by opts.Clock.
+func (a *Accesses) ComputeClusterCostsAt(ctx context.Context, client prometheus.Client, provider cloud.Provider, at time.Time, window string, opts *ClusterCostsOptions) (map[string]*ClusterCosts, error) {
+	if opts == nil {
+		opts = &ClusterCostsOptions{}
+	}
 
-	mins := end.Sub(start).Minutes()
+	dur, err := timeutil.ParseDuration(window)
+	if err != nil {
+		return nil, fmt.Errorf("illegal window: %s", err)
+	}
+
+	clock := opts.Clock
+	if clock == nil {
+		clock = timeutil.RealClock{}
+	}
+	now := clock.Now()
+
+	offset, err := offsetAt(now, at, dur)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Compute costs relative to the same time as the offset, so that the
+	// window begins exactly at the given time
+	atOpts := *opts
+	atOpts.Clock = &timeutil.FakeClock{T: now}
+
+	return a.ComputeClusterCostsWithOptions(client, provider, dur, offset, &atOpts)
+}
+
+// offsetAt returns the offset, relative to now, of a window of the given
+// duration beginning at the given time; i.e. now - (at + window). Windows
+// ending in the future by no more than clockSkewTolerance are treated as
+// ending now; other windows beginning or ending in the future are illegal.
+func offsetAt(now, at time.Time, window time.Duration) (time.Duration, error) {
+	if at.After(now) {
+		return 0, fmt.Errorf("illegal time %s: must not be in the future", at.Format(time.RFC3339))
+	}
+
+	offset := now.Sub(at.Add(window))
+	if offset < 0 {
+		if -offset > clockSkewTolerance {
+			return 0, fmt.Errorf("illegal window %s at %s: must not end in the future", window, at.Format(time.RFC3339))
+		}
+		offset = 0
+	}
+
+	return offset.Truncate(time.Second), nil
+}
+
+// ComputeClusterCostsRange gives the cumulative and monthly-rate cluster costs, with breakdowns, for all clusters over
+// the given absolute range of time, which must satisfy start < end <= now.
+func (a *Accesses) ComputeClusterCostsRange(ctx context.Context, client prometheus.Client, provider cloud.Provider, start, end time.Time) (map[string]*ClusterCosts, error) {
+	return a.computeClusterCostsRange(ctx, client, provider, time.Now(), start, end)
+}
+
+func (a *Accesses) computeClusterCostsRange(ctx context.Context, client prometheus.Client, provider cloud.Provider, now, start, end time.Time) (map[string]*ClusterCosts, error) {
+	window, offset, err := windowOffsetForRange(now, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return a.ComputeClusterCostsWithOptions(client, provider, window, offset, &ClusterCostsOptions{WithBreakdown: true})
+}
+
+// windowOffsetForRange returns the window and offset, relative to now, that
+// are equivalent to the given range. Ranges ending in the future by no more
+// than clockSkewTolerance are treated as ending now.
+func windowOffsetForRange(now, start, end time.Time) (time.Duration, time.Duration, error) {
+	if !start.Before(end) {
+		return 0, 0, fmt.Errorf("illegal range [%s, %s]: start must be before end", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	if end.After(now.Add(clockSkewTolerance)) {
+		return 0, 0, fmt.Errorf("illegal range [%s, %s]: end must not be in the future", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	if end.After(now) {
+		end = now
+	}
+
+	window := end.Sub(start).Truncate(time.Second)
+	offset := now.Sub(end).Truncate(time.Second)
+	if window <= 0 {
+		return 0, 0, fmt.Errorf("illegal range [%s, %s]: must be at least one second", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+
+	return window, offset, nil
+}
+
+// ComputeCostsBy gives the cumulative and monthly-rate costs over a window of time, with breakdowns, grouped by the
+// given Prometheus label (e.g. "tenant") rather than by cluster. See ClusterCostsOptions.GroupLabel.
+func (a *Accesses) ComputeCostsBy(ctx context.Context, client prometheus.Client, provider cloud.Provider, groupLabel string, window, offset time.Duration) (map[string]*ClusterCosts, error) {
+	return a.ComputeCostsByWithOptions(ctx, client, provider, groupLabel, window, offset, nil)
+}
+
+// ComputeCostsByWithOptions is ComputeCostsBy with the given options, which may be nil, e.g. to mask the values of
+// groupLabel by LabelMask. The options' GroupLabel is replaced by groupLabel, and breakdowns are always computed.
+func (a *Accesses) ComputeCostsByWithOptions(ctx context.Context, client prometheus.Client, provider cloud.Provider, groupLabel string, window, offset time.Duration, opts *ClusterCostsOptions) (map[string]*ClusterCosts, error) {
+	if err := validateGroupLabel(groupLabel); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	groupOpts := ClusterCostsOptions{}
+	if opts != nil {
+		groupOpts = *opts
+	}
+	groupOpts.WithBreakdown = true
+	groupOpts.GroupLabel = groupLabel
+
+	return a.ComputeClusterCostsWithOptions(client, provider, window, offset, &groupOpts)
+}
+
+// validateGroupLabel returns an error if the given label is not a valid
+// Prometheus label name.
+func validateGroupLabel(label string) error {
+	if label == "" || prom.SanitizeLabelName(label) != label || (label[0] >= '0' && label[0] <= '9') {
+		return fmt.Errorf("illegal group label: %q", label)
+	}
+
+	return nil
+}
+
+// CostPerPod gives, per cluster, the total monthly-rate cost divided by the
+// average number of running pods over the window, as a measure of bin-packing
+// efficiency. Clusters without running pods are omitted, as their cost per pod
+// is undefined.
+func (a *Accesses) CostPerPod(client prometheus.Client, provider cloud.Provider, window, offset time.Duration) (map[string]float64, error) {
+	if err := timeutil.ValidateTimeRange(window, offset, env.GetPrometheusRetention()); err != nil {
+		return nil, err
+	}
+
+	const fmtQueryRunningPods = `
+		avg_over_time(sum(kube_pod_status_phase{phase="Running"}) by (%s)[%s:%dm]%s)
+	`
+
+	minsPerResolution := 5
+	fmtOffset := timeutil.DurationToPromOffsetString(offset)
+	queryRunningPods := fmt.Sprintf(fmtQueryRunningPods, env.GetPromClusterLabel(), window, minsPerResolution, fmtOffset)
+
+	ctx := prom.NewNamedContext(client, prom.ClusterContextName)
+	resChRunningPods := ctx.Query(queryRunningPods)
+
+	costs, err := a.ComputeClusterCosts(client, provider, window, offset, false)
+	if err != nil {
+		// Drain the pod query before returning
+		resChRunningPods.Await()
+		return nil, err
+	}
+
+	resRunningPods, _ := resChRunningPods.Await()
+	if ctx.HasErrors() {
+		return nil, ctx.ErrorCollection()
+	}
+
+	defaultClusterID := env.GetClusterIDOrDefault()
+	podsByCluster := map[string]float64{}
+	for _, result := range resRunningPods {
+		clusterID, _ := result.GetString(env.GetPromClusterLabel())
+		if clusterID == "" {
+			clusterID = defaultClusterID
+		}
+		if len(result.Values) == 0 {
+			continue
+		}
+		podsByCluster[clusterID] += result.Values[0].Value
+	}
+
+	costPerPod := map[string]float64{}
+	for clusterID, cc := range costs {
+		pods := podsByCluster[clusterID]
+		if pods <= 0 {
+			log.Debugf("CostPerPod: no running pods in cluster %s", clusterID)
+			continue
+		}
+		costPerPod[clusterID] = cc.TotalMonthly / pods
+	}
+
+	return costPerPod, nil
+}
+
+// localStorageClause returns the clause adding the given local storage query
+// to another query, or the empty string if there is no local storage query.
+func localStorageClause(localStorageQuery string) string {
+	if localStorageQuery == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(" + %s", localStorageQuery)
+}
+
+// buildStorageQuery returns the monthly-rate storage cost query over the given
+// window and offset, in the given unit, including the given local storage
+// query, if any.
+func buildStorageQuery(window, offset, localStorageQuery string, unit StorageUnit) string {
+	clusterLabel := env.GetPromClusterLabel()
+
+	return fmt.Sprintf(queryStorage, window, offset, clusterLabel, window, offset, clusterLabel, unit.divisor(), clusterLabel, localStorageClause(localStorageQuery))
+}
+
+// localStorageQuery returns the provider's local storage query for the given
+// parameters, as by GetLocalStorageQuery, or an error naming the provider if
+// the query is malformed. Providers without local storage costs return an
+// empty query, which is valid.
+func localStorageQuery(provider cloud.Provider, window, offset time.Duration, rate, used bool) (string, error) {
+	query := provider.GetLocalStorageQuery(window, offset, rate, used)
+	if strings.TrimSpace(query) == "" {
+		return "", nil
+	}
+
+	if err := prom.ValidateExpression(query); err != nil {
+		return "", fmt.Errorf("provider %T returned an invalid local storage query: %s: %q", provider, err, query)
+	}
+
+	return query, nil
+}
+
+// ComputeClusterCostsWithOptions gives the cumulative and monthly-rate cluster costs over a window of time for all
+// clusters. See ClusterCostsOptions for optional parameters.
+func (a *Accesses) ComputeClusterCostsWithOptions(client prometheus.Client, provider cloud.Provider, window, offset time.Duration, opts *ClusterCostsOptions) (map[string]*ClusterCosts, error) {
+	if opts == nil {
+		opts = &ClusterCostsOptions{}
+	}
+	withBreakdown := opts.WithBreakdown
+
+	// Prefer the given provider, for pricing config such as discounts, falling
+	// back to the provider of the Accesses
+	if provider == nil {
+		provider = a.CloudProvider
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.NewKlogLogger()
+	}
+
+	minProjectionWindow := opts.MinProjectionWindow
+	if minProjectionWindow == 0 {
+		minProjectionWindow = DefaultMinProjectionWindow
+	}
+
+	clusterLabel := env.GetPromClusterLabel()
+	defaultClusterID := opts.defaultClusterID()
+	if opts.GroupLabel != "" {
+		clusterLabel = opts.GroupLabel
+		defaultClusterID = UnallocatedSubfield
+	}
+
+	if err := timeutil.ValidateTimeRange(window, offset, env.GetPrometheusRetention()); err != nil {
+		return nil, err
+	}
+
+	if opts.UtilizationPercentile != 0 {
+		if err := validateUtilizationPercentile(opts.UtilizationPercentile); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Markup < 0 {
+		return nil, fmt.Errorf("illegal markup: %f; must not be negative", opts.Markup)
+	}
+
+	if err := validateQueryOverrides(opts.QueryOverrides); err != nil {
+		return nil, err
+	}
+
+	clock := opts.Clock
+	if clock == nil {
+		clock = timeutil.RealClock{}
+	}
+	now := clock.Now()
+
+	// evalOffset is the offset of the evaluation time from now, if pinned, so
+	// that queries unable to use the @ modifier can offset to it instead
+	var evalOffset time.Duration
+	evalTime := opts.EvalTime
+	if !opts.EvalTime.IsZero() {
+		evalOffset = now.Sub(opts.EvalTime)
+		if evalOffset < 0 {
+			return nil, fmt.Errorf("illegal evaluation time %s: must not be in the future", opts.EvalTime.Format(time.RFC3339))
+		}
+		if err := prom.ValidateAtModifier(client, opts.EvalTime); err != nil {
+			return nil, err
+		}
+		now = opts.EvalTime
+	}
+
+	// Compute number of minutes in the full interval, for use interpolating missed scrapes or scaling missing data
+	timeWindow := timeutil.ParseAlignedWindowIn(now, window, offset, opts.AlignTo, opts.Location)
+
+	// If the window is aligned, pin queries to the aligned end time via the @
+	// modifier, rather than offsetting from now, so that results do not drift
+	// with the time of evaluation. Query over the aligned window, which may
+	// differ in duration from the requested window across a daylight saving
+	// time transition.
+	if opts.AlignTo != timeutil.AlignNone {
+		if opts.EvalTime.IsZero() {
+			if err := prom.ValidateAtModifier(client, timeWindow.End); err != nil {
+				return nil, err
+			}
+		}
+		evalOffset += now.Sub(timeWindow.End)
+		evalTime = timeWindow.End
+		now = timeWindow.End
+		offset = 0
+		window = timeWindow.Duration()
+	}
 
 	// minsPerResolution determines accuracy and resource use for the following
 	// queries. Smaller values (higher resolution) result in better accuracy,
 	// but more expensive queries, and vice-a-versa.
 	minsPerResolution := 5
+	resolution := time.Duration(minsPerResolution) * time.Minute
+
+	// The minutes in, and the number of samples expected over, the window, at
+	// the query resolution, from which data minutes and coverage are derived
+	timeRange := timeutil.NewTimeRangeDetail(timeWindow.Start, timeWindow.End, resolution)
+	mins := timeRange.Minutes()
 
 	// hourlyToCumulative is a scaling factor that, when multiplied by an hourly
 	// value, converts it to a cumulative value; i.e.
@@ -633,6 +2163,16 @@ func (a *Accesses) ComputeClusterCosts(client prometheus.Client, provider cloud.
 		count_over_time(sum(kube_node_status_capacity_cpu_cores) by (%s)[%s:%dm]%s) * %d
 	`
 
+	const fmtQueryRecordingRuleTotal = `
+		sum(
+			sum_over_time(%s[%s:%dm]%s) * %f
+		) by (%s)
+	`
+
+	const fmtQueryDataRange = `
+		count(kube_node_status_capacity_cpu_cores) by (%s)[%s:%dm]%s
+	`
+
 	const fmtQueryTotalGPU = `
 		sum(
 			sum_over_time(node_gpu_hourly_cost[%s:%dm]%s) * %f
@@ -641,30 +2181,65 @@ func (a *Accesses) ComputeClusterCosts(client prometheus.Client, provider cloud.
 
 	const fmtQueryTotalCPU = `
 		sum(
-			sum_over_time(avg(kube_node_status_capacity_cpu_cores) by (node, %s)[%s:%dm]%s) *
-			avg(avg_over_time(node_cpu_hourly_cost[%s:%dm]%s)) by (node, %s) * %f
+			sum_over_time(avg(%s) by (node, %s)[%s:%dm]%s) *
+			avg(%s) by (node, %s) * %f
 		) by (%s)
 	`
 
 	const fmtQueryTotalRAM = `
 		sum(
-			sum_over_time(avg(kube_node_status_capacity_memory_bytes) by (node, %s)[%s:%dm]%s) / 1024 / 1024 / 1024 *
-			avg(avg_over_time(node_ram_hourly_cost[%s:%dm]%s)) by (node, %s) * %f
+			sum_over_time(avg(%s) by (node, %s)[%s:%dm]%s) / 1024 / 1024 / 1024 *
+			avg(%s) by (node, %s) * %f
 		) by (%s)
 	`
 
 	const fmtQueryTotalStorage = `
 		sum(
-			sum_over_time(avg(kube_persistentvolume_capacity_bytes) by (persistentvolume, %s)[%s:%dm]%s) / 1024 / 1024 / 1024 *
+			sum_over_time(avg(kube_persistentvolume_capacity_bytes) by (persistentvolume, %s)[%s:%dm]%s) / %s *
 			avg(avg_over_time(pv_hourly_cost[%s:%dm]%s)) by (persistentvolume, %s) * %f
 		) by (%s)
 	`
 
+	const fmtQueryStaticCPUCoreHours = `
+		sum_over_time(avg(kube_node_status_capacity_cpu_cores) by (node, %s)[%s:%dm]%s) * %f
+	`
+
+	const fmtQueryStaticRAMGiBHours = `
+		sum_over_time(avg(kube_node_status_capacity_memory_bytes) by (node, %s)[%s:%dm]%s) / 1024 / 1024 / 1024 * %f
+	`
+
+	const fmtQueryStaticGPUHours = `
+		sum_over_time(avg(kube_node_status_capacity{resource="nvidia_com_gpu"}) by (node, %s)[%s:%dm]%s) * %f
+	`
+
+	const fmtQueryStaticNodeLabels = `
+		avg_over_time(kube_node_labels[%s]%s)
+	`
+
+	const fmtQueryNodeCount = `
+		count(max(max_over_time(kube_node_status_capacity_cpu_cores[%s]%s)) by (node, %s)) by (%s)
+	`
+
+	const fmtQuerySampleCount = `
+		count_over_time(sum(%s) by (%s)[%s:%dm]%s)
+	`
+
+	const fmtQueryCapacity = `
+		sum(avg_over_time(%s[%s:%dm]%s)) by (%s)
+	`
+
 	const fmtQueryCPUModePct = `
 		sum(rate(node_cpu_seconds_total[%s]%s)) by (%s, mode) / ignoring(mode)
 		group_left sum(rate(node_cpu_seconds_total[%s]%s)) by (%s)
 	`
 
+	const fmtQueryCPUModePctAvg = `
+		avg_over_time((
+			sum(rate(node_cpu_seconds_total[%dm])) by (%s, mode) / ignoring(mode)
+			group_left sum(rate(node_cpu_seconds_total[%dm])) by (%s)
+		)[%s:%dm]%s)
+	`
+
 	const fmtQueryRAMSystemPct = `
 		sum(sum_over_time(container_memory_usage_bytes{container_name!="",namespace="kube-system"}[%s:%dm]%s)) by (%s)
 		/ sum(sum_over_time(kube_node_status_capacity_memory_bytes[%s:%dm]%s)) by (%s)
@@ -679,30 +2254,109 @@ func (a *Accesses) ComputeClusterCosts(client prometheus.Client, provider cloud.
 	// const fmtQueryPVStorageUsePct = `(sum(kube_persistentvolumeclaim_info) by (persistentvolumeclaim, storageclass,namespace) + on (persistentvolumeclaim,namespace)
 	// group_right(storageclass) sum(kubelet_volume_stats_used_bytes) by (persistentvolumeclaim,namespace))`
 
-	queryUsedLocalStorage := provider.GetLocalStorageQuery(window, offset, false, true)
-
-	queryTotalLocalStorage := provider.GetLocalStorageQuery(window, offset, false, false)
-	if queryTotalLocalStorage != "" {
-		queryTotalLocalStorage = fmt.Sprintf(" + %s", queryTotalLocalStorage)
+	var queryUsedLocalStorage, queryTotalLocalStorage string
+	if opts.GroupLabel == "" {
+		var err error
+		queryUsedLocalStorage, err = localStorageQuery(provider, window, offset+evalOffset, false, true)
+		if err != nil {
+			return nil, err
+		}
+		queryTotalLocalStorage, err = localStorageQuery(provider, window, offset+evalOffset, false, false)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	fmtOffset := timeutil.DurationToPromOffsetString(offset)
+	if !evalTime.IsZero() {
+		fmtOffset = strings.TrimSpace(fmt.Sprintf("@ %d %s", evalTime.Unix(), fmtOffset))
+	}
+
+	queryDataCount := fmt.Sprintf(fmtQueryDataCount, clusterLabel, window, minsPerResolution, fmtOffset, minsPerResolution)
+	queryDataRange := fmt.Sprintf(fmtQueryDataRange, clusterLabel, window, minsPerResolution, fmtOffset)
+	queryTotalGPU := fmt.Sprintf(fmtQueryTotalGPU, window, minsPerResolution, fmtOffset, hourlyToCumulative, clusterLabel)
+	cpuPrice := opts.PriceAggregation.overTime(fmt.Sprintf("node_cpu_hourly_cost[%s:%dm]%s", window, minsPerResolution, fmtOffset))
+	ramPrice := opts.PriceAggregation.overTime(fmt.Sprintf("node_ram_hourly_cost[%s:%dm]%s", window, minsPerResolution, fmtOffset))
+	queryTotalCPU := fmt.Sprintf(fmtQueryTotalCPU, opts.CostBasis.cpuCores(clusterLabel), clusterLabel, window, minsPerResolution, fmtOffset, cpuPrice, clusterLabel, hourlyToCumulative, clusterLabel)
+	queryTotalRAM := fmt.Sprintf(fmtQueryTotalRAM, opts.CostBasis.ramBytes(clusterLabel), clusterLabel, window, minsPerResolution, fmtOffset, ramPrice, clusterLabel, hourlyToCumulative, clusterLabel)
+	queryTotalStorage := fmt.Sprintf(fmtQueryTotalStorage, clusterLabel, window, minsPerResolution, fmtOffset, opts.StorageUnit.divisor(), window, minsPerResolution, fmtOffset, clusterLabel, hourlyToCumulative, clusterLabel)
+
+	// Replace the default queries of any overridden resources
+	queryTotals := map[string]*string{
+		"cpu":     &queryTotalCPU,
+		"gpu":     &queryTotalGPU,
+		"ram":     &queryTotalRAM,
+		"storage": &queryTotalStorage,
+	}
+	for resource, template := range opts.QueryOverrides {
+		*queryTotals[resource] = fmt.Sprintf(template, window, fmtOffset)
+		logger.Debug("ComputeClusterCosts: using query override", "resource", resource)
+	}
 
-	queryDataCount := fmt.Sprintf(fmtQueryDataCount, env.GetPromClusterLabel(), window, minsPerResolution, fmtOffset, minsPerResolution)
-	queryTotalGPU := fmt.Sprintf(fmtQueryTotalGPU, window, minsPerResolution, fmtOffset, hourlyToCumulative, env.GetPromClusterLabel())
-	queryTotalCPU := fmt.Sprintf(fmtQueryTotalCPU, env.GetPromClusterLabel(), window, minsPerResolution, fmtOffset, window, minsPerResolution, fmtOffset, env.GetPromClusterLabel(), hourlyToCumulative, env.GetPromClusterLabel())
-	queryTotalRAM := fmt.Sprintf(fmtQueryTotalRAM, env.GetPromClusterLabel(), window, minsPerResolution, fmtOffset, window, minsPerResolution, fmtOffset, env.GetPromClusterLabel(), hourlyToCumulative, env.GetPromClusterLabel())
-	queryTotalStorage := fmt.Sprintf(fmtQueryTotalStorage, env.GetPromClusterLabel(), window, minsPerResolution, fmtOffset, window, minsPerResolution, fmtOffset, env.GetPromClusterLabel(), hourlyToCumulative, env.GetPromClusterLabel())
+	// Count completed queries, to be reported once all have been submitted
+	// and their total is known. Recording rules are awaited before then, so
+	// their completions are buffered.
+	var done chan struct{}
+	if opts.OnProgress != nil {
+		done = make(chan struct{}, len(recordingRuleTotalResources))
+		client = &progressClient{Client: client, done: done}
+	}
 
 	ctx := prom.NewNamedContext(client, prom.ClusterContextName)
+	ctx.SetTimeout(opts.QueryTimeout)
+
+	// Prefer recording rule totals, unless overridden, querying raw totals
+	// only for resources whose recording rules have no data
+	var resChsRecordingRuleTotal []prom.QueryResultsChan
+	resRecordingRuleTotals := map[string][]*prom.QueryResult{}
+	if opts.RecordingRuleTotals {
+		var resources []string
+		for _, resource := range recordingRuleTotalResources {
+			if _, ok := opts.QueryOverrides[resource]; ok {
+				continue
+			}
+			resources = append(resources, resource)
+			resChsRecordingRuleTotal = append(resChsRecordingRuleTotal, ctx.Query(fmt.Sprintf(fmtQueryRecordingRuleTotal, RecordingRuleTotalMetric(resource), window, minsPerResolution, fmtOffset, hourlyToCumulative, clusterLabel)))
+		}
+		for i, resource := range resources {
+			resRule, _ := resChsRecordingRuleTotal[i].Await()
+			if len(resRule) == 0 {
+				logger.Debug("ComputeClusterCosts: recording rule has no data; using raw total", "metric", RecordingRuleTotalMetric(resource))
+				continue
+			}
+			resRecordingRuleTotals[resource] = resRule
+		}
+		if ctx.HasErrors() {
+			return nil, ctx.ErrorCollection()
+		}
+	}
 
-	resChs := ctx.QueryAll(
-		queryDataCount,
-		queryTotalGPU,
-		queryTotalCPU,
-		queryTotalRAM,
-		queryTotalStorage,
-	)
+	// queryTotal submits the given raw total query of the resource, unless its
+	// total is taken from its recording rule
+	queryTotal := func(resource, query string) prom.QueryResultsChan {
+		if _, ok := resRecordingRuleTotals[resource]; ok {
+			return nil
+		}
+		return ctx.Query(query)
+	}
+
+	// awaitTotal returns the total of the resource, from its raw total query,
+	// if submitted, or else from its recording rule
+	awaitTotal := func(resource string, resCh prom.QueryResultsChan) []*prom.QueryResult {
+		if resCh == nil {
+			return resRecordingRuleTotals[resource]
+		}
+		res, _ := resCh.Await()
+		return res
+	}
+
+	resChs := []prom.QueryResultsChan{
+		ctx.Query(queryDataCount),
+		queryTotal("gpu", queryTotalGPU),
+		queryTotal("cpu", queryTotalCPU),
+		queryTotal("ram", queryTotalRAM),
+		queryTotal("storage", queryTotalStorage),
+	}
 
 	// Only submit the local storage query if it is valid. Otherwise Prometheus
 	// will return errors. Always append something to resChs, regardless, to
@@ -714,9 +2368,16 @@ func (a *Accesses) ComputeClusterCosts(client prometheus.Client, provider cloud.
 	}
 
 	if withBreakdown {
-		queryCPUModePct := fmt.Sprintf(fmtQueryCPUModePct, window, fmtOffset, env.GetPromClusterLabel(), window, fmtOffset, env.GetPromClusterLabel())
-		queryRAMSystemPct := fmt.Sprintf(fmtQueryRAMSystemPct, window, minsPerResolution, fmtOffset, env.GetPromClusterLabel(), window, minsPerResolution, fmtOffset, env.GetPromClusterLabel())
-		queryRAMUserPct := fmt.Sprintf(fmtQueryRAMUserPct, window, minsPerResolution, fmtOffset, env.GetPromClusterLabel(), window, minsPerResolution, fmtOffset, env.GetPromClusterLabel())
+		queryCPUModePct := fmt.Sprintf(fmtQueryCPUModePct, window, fmtOffset, clusterLabel, window, fmtOffset, clusterLabel)
+		if opts.CPUModeAggregation == CPUModeAggregationAvg {
+			queryCPUModePct = fmt.Sprintf(fmtQueryCPUModePctAvg, minsPerResolution, clusterLabel, minsPerResolution, clusterLabel, window, minsPerResolution, fmtOffset)
+		}
+		queryRAMSystemPct := fmt.Sprintf(fmtQueryRAMSystemPct, window, minsPerResolution, fmtOffset, clusterLabel, window, minsPerResolution, fmtOffset, clusterLabel)
+		queryRAMUserPct := fmt.Sprintf(fmtQueryRAMUserPct, window, minsPerResolution, fmtOffset, clusterLabel, window, minsPerResolution, fmtOffset, clusterLabel)
+		if opts.UtilizationPercentile != 0 {
+			queryRAMSystemPct = queryRAMPctAtPercentile(opts.UtilizationPercentile, `container_memory_usage_bytes{container_name!="",namespace="kube-system"}`, clusterLabel, window, minsPerResolution, fmtOffset)
+			queryRAMUserPct = queryRAMPctAtPercentile(opts.UtilizationPercentile, `kubecost_cluster_memory_working_set_bytes`, clusterLabel, window, minsPerResolution, fmtOffset)
+		}
 
 		bdResChs := ctx.QueryAll(
 			queryCPUModePct,
@@ -736,20 +2397,71 @@ func (a *Accesses) ComputeClusterCosts(client prometheus.Client, provider cloud.
 		resChs = append(resChs, bdResChs...)
 	}
 
+	resChDataRange := ctx.Query(queryDataRange)
+
+	var staticResChs []prom.QueryResultsChan
+	if opts.StaticPricing != nil {
+		staticResChs = ctx.QueryAll(
+			fmt.Sprintf(fmtQueryStaticCPUCoreHours, clusterLabel, window, minsPerResolution, fmtOffset, hourlyToCumulative),
+			fmt.Sprintf(fmtQueryStaticRAMGiBHours, clusterLabel, window, minsPerResolution, fmtOffset, hourlyToCumulative),
+			fmt.Sprintf(fmtQueryStaticGPUHours, clusterLabel, window, minsPerResolution, fmtOffset, hourlyToCumulative),
+			fmt.Sprintf(fmtQueryStaticNodeLabels, window, fmtOffset),
+		)
+	}
+
+	// CPU and RAM capacity are shared by zero price warnings and provisioned
+	// capacity, so they are queried once for either
+	var resChCPUCapacity, resChRAMCapacity, resChGPUCapacity, resChStorageCapacity prom.QueryResultsChan
+	if opts.WithZeroPriceWarnings || opts.WithCapacity {
+		resChCPUCapacity = ctx.Query(fmt.Sprintf(fmtQueryCapacity, "kube_node_status_capacity_cpu_cores", window, minsPerResolution, fmtOffset, clusterLabel))
+		resChRAMCapacity = ctx.Query(fmt.Sprintf(fmtQueryCapacity, "kube_node_status_capacity_memory_bytes", window, minsPerResolution, fmtOffset, clusterLabel))
+	}
+	if opts.WithZeroPriceWarnings {
+		resChGPUCapacity = ctx.Query(fmt.Sprintf(fmtQueryCapacity, `kube_node_status_capacity{resource="nvidia_com_gpu"}`, window, minsPerResolution, fmtOffset, clusterLabel))
+	}
+	if opts.WithCapacity {
+		resChStorageCapacity = ctx.Query(fmt.Sprintf(fmtQueryCapacity, "kube_persistentvolume_capacity_bytes", window, minsPerResolution, fmtOffset, clusterLabel))
+	}
+
+	var resChNodeCount prom.QueryResultsChan
+	if opts.WithNodeCount {
+		resChNodeCount = ctx.Query(fmt.Sprintf(fmtQueryNodeCount, window, fmtOffset, clusterLabel, clusterLabel))
+	}
+
+	var resChsSampleCount []prom.QueryResultsChan
+	if opts.WithCoverage {
+		for _, resource := range coverageResources {
+			resChsSampleCount = append(resChsSampleCount, ctx.Query(fmt.Sprintf(fmtQuerySampleCount, coverageMetrics[resource], clusterLabel, window, minsPerResolution, fmtOffset)))
+		}
+	}
+
+	if opts.OnProgress != nil {
+		numQueries := countQueries(resChs...) +
+			countQueries(staticResChs...) +
+			countQueries(resChsRecordingRuleTotal...) +
+			countQueries(resChsSampleCount...) +
+			countQueries(resChDataRange, resChCPUCapacity, resChRAMCapacity, resChGPUCapacity, resChStorageCapacity, resChNodeCount)
+
+		finished := make(chan struct{})
+		go reportProgress(done, numQueries, opts.OnProgress, finished)
+		defer func() { <-finished }()
+	}
+
 	resDataCount, _ := resChs[0].Await()
-	resTotalGPU, _ := resChs[1].Await()
-	resTotalCPU, _ := resChs[2].Await()
-	resTotalRAM, _ := resChs[3].Await()
-	resTotalStorage, _ := resChs[4].Await()
+	resTotalGPU := awaitTotal("gpu", resChs[1])
+	resTotalCPU := awaitTotal("cpu", resChs[2])
+	resTotalRAM := awaitTotal("ram", resChs[3])
+	resTotalStorage := awaitTotal("storage", resChs[4])
+	resDataRange, _ := resChDataRange.Await()
 	if ctx.HasErrors() {
 		return nil, ctx.ErrorCollection()
 	}
 
-	defaultClusterID := env.GetClusterID()
+	dataRangeByCluster := buildDataRangeMap(resDataRange, resolution, timeWindow.Start, timeWindow.End, clusterLabel, defaultClusterID)
 
 	dataMinsByCluster := map[string]float64{}
 	for _, result := range resDataCount {
-		clusterID, _ := result.GetString(env.GetPromClusterLabel())
+		clusterID, _ := result.GetString(clusterLabel)
 		if clusterID == "" {
 			clusterID = defaultClusterID
 		}
@@ -757,57 +2469,162 @@ func (a *Accesses) ComputeClusterCosts(client prometheus.Client, provider cloud.
 		if len(result.Values) > 0 {
 			dataMins = result.Values[0].Value
 		} else {
-			klog.V(3).Infof("[Warning] cluster cost data count returned no results for cluster %s", clusterID)
+			logger.Warn("ComputeClusterCosts: cluster cost data count returned no results", "cluster", clusterID)
 		}
 		dataMinsByCluster[clusterID] = dataMins
 	}
 
-	// Determine combined discount
-	discount, customDiscount := 0.0, 0.0
-	c, err := a.CloudProvider.GetConfig()
-	if err == nil {
-		discount, err = ParsePercentString(c.Discount)
-		if err != nil {
-			discount = 0.0
-		}
-		customDiscount, err = ParsePercentString(c.NegotiatedDiscount)
-		if err != nil {
-			customDiscount = 0.0
-		}
-	}
+	// Determine combined discounts, preferring per-cluster overrides, if any,
+	// to the provider's discounts
+	discounts := providerDiscounts(provider, opts.DiscountByCluster)
 
 	// Intermediate structure storing mapping of [clusterID][type ∈ {cpu, ram, storage, total}]=cost
 	costData := make(map[string]map[string]float64)
 
+	// Whether the sustained use discount applies to each resource, for
+	// auditing the combined discount applied to each
+	sustainedDiscounts := map[string]bool{}
+
 	// Helper function to iterate over Prom query results, parsing the raw values into
-	// the intermediate costData structure.
-	setCostsFromResults := func(costData map[string]map[string]float64, results []*prom.QueryResult, name string, discount float64, customDiscount float64) {
+	// the intermediate costData structure. Custom discounts always apply;
+	// sustained use discounts apply only if sustained is true.
+	setCostsFromResults := func(costData map[string]map[string]float64, results []*prom.QueryResult, name string, sustained bool) {
+		resource := name
+		if resource == "localstorage" {
+			resource = "storage"
+		}
+		sustainedDiscounts[resource] = sustained
+
 		for _, result := range results {
-			clusterID, _ := result.GetString(env.GetPromClusterLabel())
+			clusterID, _ := result.GetString(clusterLabel)
 			if clusterID == "" {
 				clusterID = defaultClusterID
 			}
 			if _, ok := costData[clusterID]; !ok {
 				costData[clusterID] = map[string]float64{}
 			}
+			discount, customDiscount := discounts.forCluster(clusterID)
+			if !sustained {
+				discount = 0.0
+			}
 			if len(result.Values) > 0 {
-				costData[clusterID][name] += result.Values[0].Value * (1.0 - discount) * (1.0 - customDiscount)
-				costData[clusterID]["total"] += result.Values[0].Value * (1.0 - discount) * (1.0 - customDiscount)
+				cost := result.Values[0].Value * (1.0 - discount) * (1.0 - customDiscount) * (1.0 + opts.Markup)
+				costData[clusterID][name] += cost
+				costData[clusterID]["total"] += cost
 			}
 		}
 	}
 	// Apply both sustained use and custom discounts to RAM and CPU
-	setCostsFromResults(costData, resTotalCPU, "cpu", discount, customDiscount)
-	setCostsFromResults(costData, resTotalRAM, "ram", discount, customDiscount)
+	setCostsFromResults(costData, resTotalCPU, "cpu", true)
+	setCostsFromResults(costData, resTotalRAM, "ram", true)
 	// Apply only custom discount to GPU and storage
-	setCostsFromResults(costData, resTotalGPU, "gpu", 0.0, customDiscount)
-	setCostsFromResults(costData, resTotalStorage, "storage", 0.0, customDiscount)
+	setCostsFromResults(costData, resTotalGPU, "gpu", false)
+	setCostsFromResults(costData, resTotalStorage, "storage", false)
 	if queryTotalLocalStorage != "" {
 		resTotalLocalStorage, err := resChs[5].Await()
 		if err != nil {
 			return nil, err
 		}
-		setCostsFromResults(costData, resTotalLocalStorage, "localstorage", 0.0, customDiscount)
+		setCostsFromResults(costData, resTotalLocalStorage, "localstorage", false)
+	}
+
+	// Synthesize costs from static pricing for any resource missing cost data
+	if opts.StaticPricing != nil {
+		resStaticCPUCoreHours, _ := staticResChs[0].Await()
+		resStaticRAMGiBHours, _ := staticResChs[1].Await()
+		resStaticGPUHours, _ := staticResChs[2].Await()
+		resStaticNodeLabels, _ := staticResChs[3].Await()
+		if ctx.HasErrors() {
+			return nil, ctx.ErrorCollection()
+		}
+
+		staticCostData := buildStaticCostData(opts.StaticPricing, resStaticCPUCoreHours, resStaticRAMGiBHours, resStaticGPUHours, resStaticNodeLabels, clusterLabel, defaultClusterID)
+		for clusterID, scd := range staticCostData {
+			if _, ok := costData[clusterID]; !ok {
+				costData[clusterID] = map[string]float64{}
+			}
+			discount, customDiscount := discounts.forCluster(clusterID)
+			for name, cost := range scd {
+				if _, ok := costData[clusterID][name]; ok {
+					continue
+				}
+
+				// Apply the same discounts and markup as for metric-based costs
+				if name == "gpu" {
+					cost *= 1.0 - customDiscount
+				} else {
+					cost *= (1.0 - discount) * (1.0 - customDiscount)
+				}
+				cost *= 1.0 + opts.Markup
+
+				logger.Debug("ComputeClusterCosts: using static pricing", "cluster", clusterID, "resource", name)
+				costData[clusterID][name] = cost
+				costData[clusterID]["total"] += cost
+			}
+		}
+	}
+
+	var resCPUCapacity, resRAMCapacity []*prom.QueryResult
+	if opts.WithZeroPriceWarnings || opts.WithCapacity {
+		resCPUCapacity, _ = resChCPUCapacity.Await()
+		resRAMCapacity, _ = resChRAMCapacity.Await()
+	}
+
+	// Warn about resources with capacity, but no cost, which usually indicates
+	// misconfigured pricing rather than free resources
+	var zeroPricedByCluster map[string][]string
+	if opts.WithZeroPriceWarnings {
+		resGPUCapacity, _ := resChGPUCapacity.Await()
+		if ctx.HasErrors() {
+			return nil, ctx.ErrorCollection()
+		}
+		zeroPricedByCluster = buildZeroPricedResources(costData, clusterLabel, defaultClusterID, map[string][]*prom.QueryResult{
+			"cpu": resCPUCapacity,
+			"ram": resRAMCapacity,
+			"gpu": resGPUCapacity,
+		})
+	}
+
+	var capacityByCluster map[string]map[string]float64
+	if opts.WithCapacity {
+		resStorageCapacity, _ := resChStorageCapacity.Await()
+		if ctx.HasErrors() {
+			return nil, ctx.ErrorCollection()
+		}
+		capacityByCluster = buildProvisionedCapacity(map[string][]*prom.QueryResult{
+			"cpu":     resCPUCapacity,
+			"ram":     resRAMCapacity,
+			"storage": resStorageCapacity,
+		}, clusterLabel, defaultClusterID)
+	}
+
+	var coverageByCluster map[string]map[string]float64
+	if opts.WithCoverage {
+		resSampleCountByResource := map[string][]*prom.QueryResult{}
+		for i, resource := range coverageResources {
+			resSampleCountByResource[resource], _ = resChsSampleCount[i].Await()
+		}
+		if ctx.HasErrors() {
+			return nil, ctx.ErrorCollection()
+		}
+		coverageByCluster = buildCoverageByResource(resSampleCountByResource, float64(timeRange.Samples), clusterLabel, defaultClusterID)
+	}
+
+	nodeCountByCluster := map[string]int{}
+	if opts.WithNodeCount {
+		resNodeCount, _ := resChNodeCount.Await()
+		if ctx.HasErrors() {
+			return nil, ctx.ErrorCollection()
+		}
+		for _, result := range resNodeCount {
+			clusterID, _ := result.GetString(clusterLabel)
+			if clusterID == "" {
+				clusterID = defaultClusterID
+			}
+			if len(result.Values) > 0 {
+				nodeCountByCluster[clusterID] += int(result.Values[0].Value)
+			}
+		}
 	}
 
 	cpuBreakdownMap := map[string]*ClusterCostsBreakdown{}
@@ -821,8 +2638,9 @@ func (a *Accesses) ComputeClusterCosts(client prometheus.Client, provider cloud.
 			return nil, ctx.ErrorCollection()
 		}
 
+		cpuCategories := cpuModeCategories(opts.CPUModeCategories, opts.CPUUserModes)
 		for _, result := range resCPUModePct {
-			clusterID, _ := result.GetString(env.GetPromClusterLabel())
+			clusterID, _ := result.GetString(clusterLabel)
 			if clusterID == "" {
 				clusterID = defaultClusterID
 			}
@@ -833,50 +2651,37 @@ func (a *Accesses) ComputeClusterCosts(client prometheus.Client, provider cloud.
 
 			mode, err := result.GetString("mode")
 			if err != nil {
-				klog.V(3).Infof("[Warning] ComputeClusterCosts: unable to read CPU mode: %s", err)
+				logger.Warn("ComputeClusterCosts: unable to read CPU mode", "cluster", clusterID, "error", err)
 				mode = "other"
 			}
 
-			switch mode {
-			case "idle":
-				cpuBD.Idle += result.Values[0].Value
-			case "system":
-				cpuBD.System += result.Values[0].Value
-			case "user":
-				cpuBD.User += result.Values[0].Value
-			default:
-				cpuBD.Other += result.Values[0].Value
+			addCPUModeToBreakdown(cpuBD, mode, result.Values[0].Value, cpuCategories)
+		}
+
+		for clusterID, cpuBD := range cpuBreakdownMap {
+			if !cpuBD.Complete() {
+				logger.Warn("ComputeClusterCosts: CPU breakdown does not sum to 1.0", "cluster", clusterID, "breakdown", *cpuBD)
 			}
 		}
 
+		// System and user RAM fractions are queried separately, so merge the
+		// partial breakdowns of each before attributing the remainder to idle.
 		for _, result := range resRAMSystemPct {
-			clusterID, _ := result.GetString(env.GetPromClusterLabel())
+			clusterID, _ := result.GetString(clusterLabel)
 			if clusterID == "" {
 				clusterID = defaultClusterID
 			}
-			if _, ok := ramBreakdownMap[clusterID]; !ok {
-				ramBreakdownMap[clusterID] = &ClusterCostsBreakdown{}
-			}
-			ramBD := ramBreakdownMap[clusterID]
-			ramBD.System += result.Values[0].Value
+			mergeBreakdown(ramBreakdownMap, clusterID, &ClusterCostsBreakdown{System: result.Values[0].Value})
 		}
 		for _, result := range resRAMUserPct {
-			clusterID, _ := result.GetString(env.GetPromClusterLabel())
+			clusterID, _ := result.GetString(clusterLabel)
 			if clusterID == "" {
 				clusterID = defaultClusterID
 			}
-			if _, ok := ramBreakdownMap[clusterID]; !ok {
-				ramBreakdownMap[clusterID] = &ClusterCostsBreakdown{}
-			}
-			ramBD := ramBreakdownMap[clusterID]
-			ramBD.User += result.Values[0].Value
+			mergeBreakdown(ramBreakdownMap, clusterID, &ClusterCostsBreakdown{User: result.Values[0].Value})
 		}
 		for _, ramBD := range ramBreakdownMap {
-			remaining := 1.0
-			remaining -= ramBD.Other
-			remaining -= ramBD.System
-			remaining -= ramBD.User
-			ramBD.Idle = remaining
+			ramBD.Idle = 1.0 - (ramBD.Other + ramBD.System + ramBD.User)
 		}
 
 		if queryUsedLocalStorage != "" {
@@ -885,7 +2690,7 @@ func (a *Accesses) ComputeClusterCosts(client prometheus.Client, provider cloud.
 				return nil, err
 			}
 			for _, result := range resUsedLocalStorage {
-				clusterID, _ := result.GetString(env.GetPromClusterLabel())
+				clusterID, _ := result.GetString(clusterLabel)
 				if clusterID == "" {
 					clusterID = defaultClusterID
 				}
@@ -907,11 +2712,11 @@ func (a *Accesses) ComputeClusterCosts(client prometheus.Client, provider cloud.
 		dataMins, ok := dataMinsByCluster[id]
 		if !ok {
 			dataMins = mins
-			klog.V(3).Infof("[Warning] cluster cost data count not found for cluster %s", id)
+			logger.Warn("ComputeClusterCosts: cluster cost data count not found", "cluster", id)
 		}
-		costs, err := NewClusterCostsFromCumulative(cd["cpu"], cd["gpu"], cd["ram"], cd["storage"]+cd["localstorage"], window, offset, dataMins/timeutil.MinsPerHour)
+		costs, err := newClusterCostsFromCumulativeAt(now, cd["cpu"], cd["gpu"], cd["ram"], cd["storage"]+cd["localstorage"], window, offset, dataMins/timeutil.MinsPerHour)
 		if err != nil {
-			klog.V(3).Infof("[Warning] Failed to parse cluster costs on %s (%s) from cumulative data: %+v", window, offset, cd)
+			logger.Warn("ComputeClusterCosts: failed to parse cluster costs from cumulative data", "window", window, "offset", offset, "data", cd)
 			return nil, err
 		}
 
@@ -923,29 +2728,354 @@ func (a *Accesses) ComputeClusterCosts(client prometheus.Client, provider cloud.
 		}
 		costs.StorageBreakdown = &ClusterCostsBreakdown{}
 		if pvUC, ok := pvUsedCostMap[id]; ok {
-			costs.StorageBreakdown.Idle = (costs.StorageCumulative - pvUC) / costs.StorageCumulative
-			costs.StorageBreakdown.User = pvUC / costs.StorageCumulative
+			used, clamped := usedFraction(pvUC, costs.StorageCumulative)
+			if clamped {
+				logger.Warn("ComputeClusterCosts: used storage cost exceeds storage cost; capping used fraction", "cluster", id, "used", pvUC, "total", costs.StorageCumulative)
+			}
+			costs.StorageBreakdown.Idle = 1.0 - used
+			costs.StorageBreakdown.User = used
+		}
+		if opts.ExcludeGPU {
+			costs.TotalCumulative -= costs.GPUCumulative
+			costs.TotalMonthly -= costs.GPUMonthly
 		}
 		costs.DataMinutes = dataMins
+		costs.NodeCount = nodeCountByCluster[id]
+		if opts.WithCapacity {
+			costs.ProvisionedCPU = capacityByCluster[id]["cpu"]
+			costs.ProvisionedRAMGiB = capacityByCluster[id]["ram"]
+			costs.ProvisionedStorageGiB = capacityByCluster[id]["storage"]
+		}
+		discount, customDiscount := discounts.forCluster(id)
+		costs.EffectiveDiscounts = make(map[string]float64, len(sustainedDiscounts))
+		for resource, sustained := range sustainedDiscounts {
+			if sustained {
+				costs.EffectiveDiscounts[resource] = 1.0 - (1.0-discount)*(1.0-customDiscount)
+			} else {
+				costs.EffectiveDiscounts[resource] = customDiscount
+			}
+		}
+		costs.Markup = opts.Markup
+		costs.ZeroPricedResources = zeroPricedByCluster[id]
+		if opts.WithCoverage {
+			costs.CoverageByResource = make(map[string]float64, len(coverageResources))
+			for _, resource := range coverageResources {
+				costs.CoverageByResource[resource] = coverageByCluster[id][resource]
+			}
+		}
+		costs.ProjectionConfidence = projectionConfidence(window, dataMins, minProjectionWindow)
+		if window < minProjectionWindow {
+			costs.Warnings = append(costs.Warnings, fmt.Sprintf("monthly costs are projected from a window of %s, shorter than the minimum of %s", timeutil.DurationString(window), timeutil.DurationString(minProjectionWindow)))
+		}
+		for _, resource := range zeroPricedByCluster[id] {
+			logger.Warn("ComputeClusterCosts: resource has capacity but zero cost; check pricing configuration", "cluster", id, "resource", resource)
+			costs.Warnings = append(costs.Warnings, fmt.Sprintf("%s capacity is present, but %s cost is zero; check pricing configuration", resource, resource))
+		}
+		if opts.AlignTo != timeutil.AlignNone {
+			costs.Start = &timeWindow.Start
+			costs.End = &timeWindow.End
+		}
+		logger.Debug("ComputeClusterCosts: computed cluster costs", "cluster", id, "totalCumulative", costs.TotalCumulative, "dataMinutes", dataMins)
+		if dr, ok := dataRangeByCluster[id]; ok {
+			costs.DataStart = &dr.start
+			costs.DataEnd = &dr.end
+		}
 		costsByCluster[id] = costs
 	}
 
+	if opts.GroupLabel != "" && isMaskedLabel(opts.LabelMask, opts.GroupLabel) {
+		masked := make(map[string]*ClusterCosts, len(costsByCluster))
+		for id, costs := range costsByCluster {
+			masked[maskLabelValue(id)] = costs
+		}
+		costsByCluster = masked
+	}
+
 	return costsByCluster, nil
 }
 
 type Totals struct {
+	TotalCost   [][]string    `json:"totalcost"`
+	CPUCost     [][]string    `json:"cpucost"`
+	GPUCost     [][]string    `json:"gpucost"`
+	MemCost     [][]string    `json:"memcost"`
+	StorageCost [][]string    `json:"storageCost"`
+	Counts      *TotalsCounts `json:"counts,omitempty"`
+	Warnings    []string      `json:"warnings,omitempty"`
+}
+
+// TotalsCounts holds, parallel to each series of Totals, the number of raw
+// price samples backing each [timestamp, value] point, as [timestamp, count]
+// pairs, so that points backed by few samples can be flagged.
+type TotalsCounts struct {
 	TotalCost   [][]string `json:"totalcost"`
 	CPUCost     [][]string `json:"cpucost"`
+	GPUCost     [][]string `json:"gpucost"`
 	MemCost     [][]string `json:"memcost"`
 	StorageCost [][]string `json:"storageCost"`
 }
 
+// alignCounts returns the counts at the timestamps of the given totals, so
+// that the counts are parallel to the totals. Timestamps missing from the
+// counts are counted as zero.
+func alignCounts(totals, counts [][]string) [][]string {
+	countsByTimestamp := map[string]string{}
+	for _, count := range counts {
+		if len(count) == 2 {
+			countsByTimestamp[count[0]] = count[1]
+		}
+	}
+
+	aligned := make([][]string, 0, len(totals))
+	for _, total := range totals {
+		if len(total) == 0 {
+			continue
+		}
+		count, ok := countsByTimestamp[total[0]]
+		if !ok {
+			count = fmt.Sprintf("%f", 0.0)
+		}
+		aligned = append(aligned, []string{total[0], count})
+	}
+	return aligned
+}
+
+// series returns the series of Totals, followed by those of its Counts, if any
+func (t *Totals) series() [][][]string {
+	series := [][][]string{t.TotalCost, t.CPUCost, t.GPUCost, t.MemCost, t.StorageCost}
+	if t.Counts != nil {
+		series = append(series, t.Counts.TotalCost, t.Counts.CPUCost, t.Counts.GPUCost, t.Counts.MemCost, t.Counts.StorageCost)
+	}
+	return series
+}
+
+// totalsTimestamp returns the timestamp of the given [timestamp, value] entry.
+// Entries without a numeric timestamp are ordered last.
+func totalsTimestamp(entry []string) float64 {
+	if len(entry) == 0 {
+		return math.Inf(1)
+	}
+	ts, err := strconv.ParseFloat(entry[0], 64)
+	if err != nil {
+		return math.Inf(1)
+	}
+	return ts
+}
+
+// sortTotalsSeries returns a copy of the given series, sorted by timestamp.
+// Entries with equal timestamps keep their relative order.
+func sortTotalsSeries(series [][]string) [][]string {
+	if series == nil {
+		return nil
+	}
+	sorted := make([][]string, len(series))
+	copy(sorted, series)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return totalsTimestamp(sorted[i]) < totalsTimestamp(sorted[j])
+	})
+	return sorted
+}
+
+// IsSorted returns true if every series of the Totals, including its Counts,
+// is in non-decreasing order of timestamp.
+func (t *Totals) IsSorted() bool {
+	for _, series := range t.series() {
+		for i := 1; i < len(series); i++ {
+			if totalsTimestamp(series[i]) < totalsTimestamp(series[i-1]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SortByTime returns a copy of the Totals with every series, including those
+// of its Counts, sorted by timestamp. Each series is sorted by the same key,
+// so series that were aligned by timestamp remain aligned.
+func (t *Totals) SortByTime() *Totals {
+	sorted := &Totals{
+		TotalCost:   sortTotalsSeries(t.TotalCost),
+		CPUCost:     sortTotalsSeries(t.CPUCost),
+		GPUCost:     sortTotalsSeries(t.GPUCost),
+		MemCost:     sortTotalsSeries(t.MemCost),
+		StorageCost: sortTotalsSeries(t.StorageCost),
+	}
+	if t.Warnings != nil {
+		sorted.Warnings = append([]string{}, t.Warnings...)
+	}
+	if t.Counts != nil {
+		sorted.Counts = &TotalsCounts{
+			TotalCost:   sortTotalsSeries(t.Counts.TotalCost),
+			CPUCost:     sortTotalsSeries(t.Counts.CPUCost),
+			GPUCost:     sortTotalsSeries(t.Counts.GPUCost),
+			MemCost:     sortTotalsSeries(t.Counts.MemCost),
+			StorageCost: sortTotalsSeries(t.Counts.StorageCost),
+		}
+	}
+	return sorted
+}
+
+// ResourceDimension selects one of the series of Totals
+type ResourceDimension int
+
+const (
+	// DimensionTotal selects Totals.TotalCost
+	DimensionTotal ResourceDimension = iota
+
+	// DimensionCPU selects Totals.CPUCost
+	DimensionCPU
+
+	// DimensionRAM selects Totals.MemCost
+	DimensionRAM
+
+	// DimensionStorage selects Totals.StorageCost
+	DimensionStorage
+
+	// DimensionGPU selects Totals.GPUCost
+	DimensionGPU
+)
+
+// Sum returns the sum of the values of the series of Totals selected by the
+// given dimension. Returns an error if the dimension is unknown, or if any
+// entry of the series is not a [timestamp, value] pair with a numeric value.
+func (t *Totals) Sum(dim ResourceDimension) (float64, error) {
+	var series [][]string
+	switch dim {
+	case DimensionTotal:
+		series = t.TotalCost
+	case DimensionCPU:
+		series = t.CPUCost
+	case DimensionRAM:
+		series = t.MemCost
+	case DimensionStorage:
+		series = t.StorageCost
+	case DimensionGPU:
+		series = t.GPUCost
+	default:
+		return 0.0, fmt.Errorf("illegal resource dimension: %d", dim)
+	}
+
+	sum := 0.0
+	for i, entry := range series {
+		if len(entry) != 2 {
+			return 0.0, fmt.Errorf("illegal totals entry %d: expected [timestamp, value]; got %v", i, entry)
+		}
+		value, err := strconv.ParseFloat(entry[1], 64)
+		if err != nil {
+			return 0.0, fmt.Errorf("illegal totals entry %d: %s", i, err)
+		}
+		sum += value
+	}
+
+	return sum, nil
+}
+
+// SumTotalsAcrossClusters returns the point-wise sum of the given Totals,
+// keyed by cluster ID, e.g. for a fleet-wide total alongside per-cluster
+// series. Each series is summed over the union of the clusters' timestamps,
+// so clusters with differing timestamp grids are aligned, with a cluster
+// missing a point contributing zero to it. Entries that are not numeric
+// [timestamp, value] pairs are skipped. Counts are summed only if every
+// cluster has them. Warnings are prefixed by the cluster ID, in order.
+func SumTotalsAcrossClusters(totalsByCluster map[string]*Totals) *Totals {
+	clusterIDs := make([]string, 0, len(totalsByCluster))
+	for clusterID, t := range totalsByCluster {
+		if t == nil {
+			continue
+		}
+		clusterIDs = append(clusterIDs, clusterID)
+	}
+	sort.Strings(clusterIDs)
+
+	sum := func(selector func(*Totals) [][]string) [][]string {
+		series := make([][][]string, 0, len(clusterIDs))
+		for _, clusterID := range clusterIDs {
+			series = append(series, selector(totalsByCluster[clusterID]))
+		}
+		return sumTotalsSeries(series)
+	}
+
+	summed := &Totals{
+		TotalCost:   sum(func(t *Totals) [][]string { return t.TotalCost }),
+		CPUCost:     sum(func(t *Totals) [][]string { return t.CPUCost }),
+		GPUCost:     sum(func(t *Totals) [][]string { return t.GPUCost }),
+		MemCost:     sum(func(t *Totals) [][]string { return t.MemCost }),
+		StorageCost: sum(func(t *Totals) [][]string { return t.StorageCost }),
+	}
+
+	withCounts := len(clusterIDs) > 0
+	for _, clusterID := range clusterIDs {
+		t := totalsByCluster[clusterID]
+		if t.Counts == nil {
+			withCounts = false
+		}
+		for _, warning := range t.Warnings {
+			summed.Warnings = append(summed.Warnings, fmt.Sprintf("%s: %s", clusterID, warning))
+		}
+	}
+	if withCounts {
+		summed.Counts = &TotalsCounts{
+			TotalCost:   sum(func(t *Totals) [][]string { return t.Counts.TotalCost }),
+			CPUCost:     sum(func(t *Totals) [][]string { return t.Counts.CPUCost }),
+			GPUCost:     sum(func(t *Totals) [][]string { return t.Counts.GPUCost }),
+			MemCost:     sum(func(t *Totals) [][]string { return t.Counts.MemCost }),
+			StorageCost: sum(func(t *Totals) [][]string { return t.Counts.StorageCost }),
+		}
+	}
+
+	return summed
+}
+
+// sumTotalsSeries returns the point-wise sum of the given series of
+// [timestamp, value] entries, in order of timestamp, over the union of their
+// timestamps. Entries that are not numeric [timestamp, value] pairs are
+// skipped.
+func sumTotalsSeries(series [][][]string) [][]string {
+	sums := map[float64]float64{}
+	for _, s := range series {
+		for _, entry := range s {
+			if len(entry) != 2 {
+				continue
+			}
+			ts, err := strconv.ParseFloat(entry[0], 64)
+			if err != nil {
+				continue
+			}
+			value, err := strconv.ParseFloat(entry[1], 64)
+			if err != nil {
+				continue
+			}
+			sums[ts] += value
+		}
+	}
+
+	timestamps := make([]float64, 0, len(sums))
+	for ts := range sums {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Float64s(timestamps)
+
+	summed := make([][]string, 0, len(timestamps))
+	for _, ts := range timestamps {
+		summed = append(summed, []string{fmt.Sprintf("%f", ts), fmt.Sprintf("%f", sums[ts])})
+	}
+
+	return summed
+}
+
+// resultToTotals converts the first of the given range query results to a
+// series of [timestamp, value] totals. Returns an error wrapping ErrNoData if
+// there are no results, or an error if the results are instant, rather than
+// range, results.
 func resultToTotals(qrs []*prom.QueryResult) ([][]string, error) {
 	if len(qrs) == 0 {
-		return [][]string{}, fmt.Errorf("Not enough data available in the selected time range")
+		return [][]string{}, fmt.Errorf("no range query results: %w", ErrNoData)
 	}
 
 	result := qrs[0]
+	if !result.IsRange() {
+		return [][]string{}, fmt.Errorf("expected range (matrix) query results for totals; got instant (vector) results")
+	}
 	totals := [][]string{}
 	for _, value := range result.Values {
 		d0 := fmt.Sprintf("%f", value.Timestamp)
@@ -959,11 +3089,58 @@ func resultToTotals(qrs []*prom.QueryResult) ([][]string, error) {
 	return totals, nil
 }
 
+// zeroTotals returns a series of zero-valued totals at the timestamps of the
+// given totals.
+func zeroTotals(totals [][]string) [][]string {
+	zeros := make([][]string, 0, len(totals))
+	for _, total := range totals {
+		if len(total) == 0 {
+			continue
+		}
+		zeros = append(zeros, []string{total[0], fmt.Sprintf("%f", 0.0)})
+	}
+	return zeros
+}
+
+// ClusterCostsOverTimeOptions provides optional parameters to ClusterCostsOverTimeWithOptions
+type ClusterCostsOverTimeOptions struct {
+	// StrictStorage, if true, returns an error when the storage query returns
+	// no data, rather than treating storage cost as zero. Clusters without
+	// PVs legitimately have no storage data, so this is false by default.
+	StrictStorage bool
+
+	// QueryTimeout, if positive, is passed to Prometheus as the timeout of
+	// each query, so that expensive queries fail fast server-side.
+	QueryTimeout time.Duration
+
+	// PriceAggregation determines how node prices are aggregated over each
+	// step. Defaults to PriceAggregationAvg.
+	PriceAggregation PriceAggregation
+
+	// StorageUnit determines whether PV storage is priced per GiB or per GB.
+	// Defaults to StorageUnitGiB. See StorageUnit for reconciliation.
+	StorageUnit StorageUnit
+
+	// WithCounts, if true, populates Totals.Counts with the number of raw
+	// samples backing each point, at the cost of additional queries.
+	WithCounts bool
+}
+
 // ClusterCostsOverTime gives the full cluster costs over time
 func ClusterCostsOverTime(cli prometheus.Client, provider cloud.Provider, startString, endString string, window, offset time.Duration) (*Totals, error) {
-	localStorageQuery := provider.GetLocalStorageQuery(window, offset, true, false)
-	if localStorageQuery != "" {
-		localStorageQuery = fmt.Sprintf("+ %s", localStorageQuery)
+	return ClusterCostsOverTimeWithOptions(cli, provider, startString, endString, window, offset, nil)
+}
+
+// ClusterCostsOverTimeWithOptions gives the full cluster costs over time. See ClusterCostsOverTimeOptions for optional
+// parameters.
+func ClusterCostsOverTimeWithOptions(cli prometheus.Client, provider cloud.Provider, startString, endString string, window, offset time.Duration, opts *ClusterCostsOverTimeOptions) (*Totals, error) {
+	if opts == nil {
+		opts = &ClusterCostsOverTimeOptions{}
+	}
+
+	queryLocalStorage, err := localStorageQuery(provider, window, offset, true, false)
+	if err != nil {
+		return nil, err
 	}
 
 	layout := "2006-01-02T15:04:05.000Z"
@@ -986,24 +3163,55 @@ func ClusterCostsOverTime(cli prometheus.Client, provider cloud.Provider, startS
 		return nil, err
 	}
 
+	// Guard against range queries returning enough points to exhaust memory.
+	// Range queries evaluate at both start and end, so a range of n steps
+	// returns n+1 points.
+	if maxPoints := env.GetMaxQueryRangePoints(); maxPoints > 0 {
+		points := timeutil.NewTimeRangeDetail(start, end, window).Samples + 1
+		if points > maxPoints {
+			return nil, fmt.Errorf("range [%s, %s] with step %s requests %d points, exceeding the maximum of %d; use a larger step or a shorter range", startString, endString, fmtWindow, points, maxPoints)
+		}
+	}
+
 	fmtOffset := timeutil.DurationToPromOffsetString(offset)
 
-	qCores := fmt.Sprintf(queryClusterCores, fmtWindow, fmtOffset, env.GetPromClusterLabel(), fmtWindow, fmtOffset, env.GetPromClusterLabel(), fmtWindow, fmtOffset, env.GetPromClusterLabel(), env.GetPromClusterLabel())
-	qRAM := fmt.Sprintf(queryClusterRAM, fmtWindow, fmtOffset, env.GetPromClusterLabel(), fmtWindow, fmtOffset, env.GetPromClusterLabel(), env.GetPromClusterLabel())
-	qStorage := fmt.Sprintf(queryStorage, fmtWindow, fmtOffset, env.GetPromClusterLabel(), fmtWindow, fmtOffset, env.GetPromClusterLabel(), env.GetPromClusterLabel(), localStorageQuery)
-	qTotal := fmt.Sprintf(queryTotal, env.GetPromClusterLabel(), env.GetPromClusterLabel(), env.GetPromClusterLabel(), env.GetPromClusterLabel(), localStorageQuery)
+	cpuPrice := opts.PriceAggregation.overTime(fmt.Sprintf("node_cpu_hourly_cost[%s] %s", fmtWindow, fmtOffset))
+	gpuPrice := opts.PriceAggregation.overTime(fmt.Sprintf("node_gpu_hourly_cost[%s] %s", fmtWindow, fmtOffset))
+	ramPrice := opts.PriceAggregation.overTime(fmt.Sprintf("node_ram_hourly_cost[%s] %s", fmtWindow, fmtOffset))
+
+	qCores := fmt.Sprintf(queryClusterCores, fmtWindow, fmtOffset, env.GetPromClusterLabel(), cpuPrice, env.GetPromClusterLabel(), env.GetPromClusterLabel())
+	qGPU := fmt.Sprintf(queryClusterGPU, gpuPrice, env.GetPromClusterLabel(), env.GetPromClusterLabel())
+	qRAM := fmt.Sprintf(queryClusterRAM, fmtWindow, fmtOffset, env.GetPromClusterLabel(), ramPrice, env.GetPromClusterLabel(), env.GetPromClusterLabel())
+	qStorage := buildStorageQuery(fmtWindow, fmtOffset, queryLocalStorage, opts.StorageUnit)
+	qTotal := fmt.Sprintf(queryTotal, env.GetPromClusterLabel(), env.GetPromClusterLabel(), env.GetPromClusterLabel(), opts.StorageUnit.divisor(), env.GetPromClusterLabel(), localStorageClause(queryLocalStorage))
 
 	ctx := prom.NewNamedContext(cli, prom.ClusterContextName)
+	ctx.SetTimeout(opts.QueryTimeout)
 	resChClusterCores := ctx.QueryRange(qCores, start, end, window)
+	resChClusterGPU := ctx.QueryRange(qGPU, start, end, window)
 	resChClusterRAM := ctx.QueryRange(qRAM, start, end, window)
 	resChStorage := ctx.QueryRange(qStorage, start, end, window)
 	resChTotal := ctx.QueryRange(qTotal, start, end, window)
 
+	// Count the raw samples of the price metric underlying each series
+	var resChCounts []prom.QueryResultsChan
+	if opts.WithCounts {
+		for _, metric := range []string{"node_total_hourly_cost", "node_cpu_hourly_cost", "node_gpu_hourly_cost", "node_ram_hourly_cost", "pv_hourly_cost"} {
+			qCount := fmt.Sprintf("sum(count_over_time(%s[%s] %s))", metric, fmtWindow, fmtOffset)
+			resChCounts = append(resChCounts, ctx.QueryRange(qCount, start, end, window))
+		}
+	}
+
 	resultClusterCores, err := resChClusterCores.Await()
 	if err != nil {
 		return nil, err
 	}
 
+	resultClusterGPU, err := resChClusterGPU.Await()
+	if err != nil {
+		return nil, err
+	}
+
 	resultClusterRAM, err := resChClusterRAM.Await()
 	if err != nil {
 		return nil, err
@@ -1019,21 +3227,47 @@ func ClusterCostsOverTime(cli prometheus.Client, provider cloud.Provider, startS
 		return nil, err
 	}
 
+	// Resources without data have empty series, rather than failing the
+	// whole call, so long as there is total cost data
+	var warnings []string
+
 	coreTotal, err := resultToTotals(resultClusterCores)
 	if err != nil {
+		if !errors.Is(err, ErrNoData) {
+			return nil, err
+		}
 		klog.Infof("[Warning] ClusterCostsOverTime: no cpu data: %s", err)
-		return nil, err
+		warnings = append(warnings, "no CPU cost data in range")
+		coreTotal = [][]string{}
+	}
+
+	// Clusters without GPUs legitimately have no GPU data
+	gpuTotal, err := resultToTotals(resultClusterGPU)
+	if err != nil {
+		if !errors.Is(err, ErrNoData) {
+			return nil, err
+		}
+		gpuTotal = zeroTotals(coreTotal)
 	}
 
 	ramTotal, err := resultToTotals(resultClusterRAM)
 	if err != nil {
+		if !errors.Is(err, ErrNoData) {
+			return nil, err
+		}
 		klog.Infof("[Warning] ClusterCostsOverTime: no ram data: %s", err)
-		return nil, err
+		warnings = append(warnings, "no RAM cost data in range")
+		ramTotal = [][]string{}
 	}
 
 	storageTotal, err := resultToTotals(resultStorage)
 	if err != nil {
+		if opts.StrictStorage {
+			return nil, fmt.Errorf("ClusterCostsOverTime: no storage data: %w", err)
+		}
 		klog.Infof("[Warning] ClusterCostsOverTime: no storage data: %s", err)
+		warnings = append(warnings, "no storage cost data in range; storage cost is zero")
+		storageTotal = zeroTotals(coreTotal)
 	}
 
 	clusterTotal, err := resultToTotals(resultTotal)
@@ -1041,7 +3275,7 @@ func ClusterCostsOverTime(cli prometheus.Client, provider cloud.Provider, startS
 		// If clusterTotal query failed, it's likely because there are no PVs, which
 		// causes the qTotal query to return no data. Instead, query only node costs.
 		// If that fails, return an error because something is actually wrong.
-		qNodes := fmt.Sprintf(queryNodes, env.GetPromClusterLabel(), localStorageQuery)
+		qNodes := fmt.Sprintf(queryNodes, env.GetPromClusterLabel(), localStorageClause(queryLocalStorage))
 
 		resultNodes, warnings, err := ctx.QueryRangeSync(qNodes, start, end, window)
 		for _, warning := range warnings {
@@ -1058,12 +3292,36 @@ func ClusterCostsOverTime(cli prometheus.Client, provider cloud.Provider, startS
 		}
 	}
 
-	return &Totals{
+	totals := &Totals{
 		TotalCost:   clusterTotal,
 		CPUCost:     coreTotal,
+		GPUCost:     gpuTotal,
 		MemCost:     ramTotal,
 		StorageCost: storageTotal,
-	}, nil
+		Warnings:    warnings,
+	}
+
+	if opts.WithCounts {
+		counts := make([][][]string, len(resChCounts))
+		for i, resCh := range resChCounts {
+			resCount, err := resCh.Await()
+			if err != nil {
+				return nil, err
+			}
+			// Series without samples, e.g. storage without PVs, count zero
+			counts[i], _ = resultToTotals(resCount)
+		}
+
+		totals.Counts = &TotalsCounts{
+			TotalCost:   alignCounts(clusterTotal, counts[0]),
+			CPUCost:     alignCounts(coreTotal, counts[1]),
+			GPUCost:     alignCounts(gpuTotal, counts[2]),
+			MemCost:     alignCounts(ramTotal, counts[3]),
+			StorageCost: alignCounts(storageTotal, counts[4]),
+		}
+	}
+
+	return totals, nil
 }
 
 func pvCosts(diskMap map[string]*Disk, resolution time.Duration, resActiveMins, resPVSize, resPVCost []*prom.QueryResult) {
@@ -1,9 +1,16 @@
 package costmodel
 
 import (
-	"github.com/kubecost/cost-model/pkg/cloud"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/kubecost/cost-model/pkg/cloud"
+
 	"github.com/kubecost/cost-model/pkg/env"
 	"github.com/kubecost/cost-model/pkg/log"
 	"github.com/kubecost/cost-model/pkg/prom"
@@ -257,6 +264,497 @@ func buildRAMBytesMap(resNodeRAMBytes []*prom.QueryResult) map[nodeIdentifierNoP
 	return m
 }
 
+// clampDiscount clamps the given discount, parsed from the config field of the
+// given name, to the range [0, 1], logging a warning if clamping was required.
+// Returns the clamped discount and true if clamping occurred.
+func clampDiscount(field string, discount float64) (float64, bool) {
+	clamped := math.Max(0.0, math.Min(1.0, discount))
+	if clamped != discount {
+		log.Warningf("Config field '%s' has illegal value %.0f%%: clamping to %.0f%%", field, discount*100.0, clamped*100.0)
+		return clamped, true
+	}
+
+	return discount, false
+}
+
+// clusterDiscounts are the discounts, as fractions in [0, 1], applied to the
+// costs of each cluster
+type clusterDiscounts struct {
+	discount       float64
+	customDiscount float64
+	byCluster      map[string]DiscountConfig
+}
+
+// forCluster returns the discount and negotiated discount of the given
+// cluster, preferring its per-cluster discounts, if any, to the defaults.
+func (cd *clusterDiscounts) forCluster(clusterID string) (float64, float64) {
+	if dc, ok := cd.byCluster[clusterID]; ok {
+		return dc.Discount, dc.NegotiatedDiscount
+	}
+	return cd.discount, cd.customDiscount
+}
+
+// providerDiscounts returns the discounts configured by the provider, clamped
+// to [0, 1], as ComputeClusterCosts applies them to node costs. Per-cluster
+// discounts configured by the provider take precedence over the provider's
+// discounts, and the given overrides, if any, take precedence over both.
+// Discounts that are missing or cannot be parsed are zero.
+func providerDiscounts(provider cloud.Provider, overrides map[string]DiscountConfig) *clusterDiscounts {
+	parse := func(field, value string) float64 {
+		discount, err := ParsePercentString(value)
+		if err != nil {
+			log.DedupedWarningf(5, "Config field '%s' has illegal value %q: using 0%%", field, value)
+			discount = 0.0
+		}
+		discount, _ = clampDiscount(field, discount)
+		return discount
+	}
+
+	cd := &clusterDiscounts{byCluster: map[string]DiscountConfig{}}
+	c, err := provider.GetConfig()
+	if err == nil && c != nil {
+		cd.discount = parse("discount", c.Discount)
+		cd.customDiscount = parse("negotiatedDiscount", c.NegotiatedDiscount)
+	}
+
+	for clusterID, dc := range cloud.DiscountsByCluster(provider) {
+		cd.byCluster[clusterID] = DiscountConfig{
+			Discount:           parse(fmt.Sprintf("discountByCluster[%s].discount", clusterID), dc.Discount),
+			NegotiatedDiscount: parse(fmt.Sprintf("discountByCluster[%s].negotiatedDiscount", clusterID), dc.NegotiatedDiscount),
+		}
+	}
+
+	for clusterID, dc := range overrides {
+		dc.Discount, _ = clampDiscount(fmt.Sprintf("discountByCluster[%s].discount", clusterID), dc.Discount)
+		dc.NegotiatedDiscount, _ = clampDiscount(fmt.Sprintf("discountByCluster[%s].negotiatedDiscount", clusterID), dc.NegotiatedDiscount)
+		cd.byCluster[clusterID] = dc
+	}
+
+	return cd
+}
+
+// unknownGPUModel is the model name to which GPU costs are attributed when
+// the model of a node's GPUs cannot be determined.
+const unknownGPUModel = "unknown"
+
+// buildGPUCostsByModel sums GPU costs by cluster and GPU model. The model for
+// each node is read from the cost result itself, if labelled, or otherwise
+// from the DCGM model results, matched on cluster and node name.
+func buildGPUCostsByModel(resGPUCost, resGPUModel []*prom.QueryResult, defaultClusterID string) map[string]map[string]float64 {
+	modelByNode := map[nodeIdentifierNoProviderID]string{}
+	for _, result := range resGPUModel {
+		cluster, _ := result.GetString(env.GetPromClusterLabel())
+		if cluster == "" {
+			cluster = defaultClusterID
+		}
+
+		node, err := result.GetString("Hostname")
+		if err != nil {
+			log.DedupedWarningf(5, "GPUCostsByModel: GPU model data missing Hostname")
+			continue
+		}
+
+		model, _ := result.GetString("modelName")
+		if model == "" {
+			continue
+		}
+
+		modelByNode[nodeIdentifierNoProviderID{Cluster: cluster, Name: node}] = model
+	}
+
+	costsByModel := map[string]map[string]float64{}
+	for _, result := range resGPUCost {
+		cluster, _ := result.GetString(env.GetPromClusterLabel())
+		if cluster == "" {
+			cluster = defaultClusterID
+		}
+
+		if len(result.Values) == 0 {
+			continue
+		}
+
+		model, _ := result.GetString("modelName")
+		if model == "" {
+			node, _ := result.GetString("node")
+			model = modelByNode[nodeIdentifierNoProviderID{Cluster: cluster, Name: node}]
+		}
+		if model == "" {
+			model = unknownGPUModel
+		}
+
+		if _, ok := costsByModel[cluster]; !ok {
+			costsByModel[cluster] = map[string]float64{}
+		}
+		costsByModel[cluster][model] += result.Values[0].Value
+	}
+
+	return costsByModel
+}
+
+// dataRange is the range of time actually covered by data, as opposed to
+// the range of time requested.
+type dataRange struct {
+	start time.Time
+	end   time.Time
+}
+
+// buildDataRangeMap determines, per cluster, the earliest and latest sample
+// timestamps seen in the given range results, clamped to the requested
+// [start, end] window. The end of the range is extended by one resolution to
+// account for the interval covered by the final sample.
+func buildDataRangeMap(results []*prom.QueryResult, resolution time.Duration, start, end time.Time, clusterLabel, defaultClusterID string) map[string]*dataRange {
+	dataRangeMap := map[string]*dataRange{}
+
+	for _, result := range results {
+		clusterID, _ := result.GetString(clusterLabel)
+		if clusterID == "" {
+			clusterID = defaultClusterID
+		}
+
+		if len(result.Values) == 0 {
+			continue
+		}
+
+		s := time.Unix(int64(result.Values[0].Timestamp), 0)
+		e := time.Unix(int64(result.Values[len(result.Values)-1].Timestamp), 0).Add(resolution)
+		for _, v := range result.Values {
+			t := time.Unix(int64(v.Timestamp), 0)
+			if t.Before(s) {
+				s = t
+			}
+			if t.Add(resolution).After(e) {
+				e = t.Add(resolution)
+			}
+		}
+
+		if s.Before(start) {
+			s = start
+		}
+		if e.After(end) {
+			e = end
+		}
+
+		if dr, ok := dataRangeMap[clusterID]; ok {
+			if s.Before(dr.start) {
+				dr.start = s
+			}
+			if e.After(dr.end) {
+				dr.end = e
+			}
+			continue
+		}
+
+		dataRangeMap[clusterID] = &dataRange{start: s, end: e}
+	}
+
+	return dataRangeMap
+}
+
+// Breakdown categories to which node_cpu_seconds_total modes can be mapped
+const (
+	CPUModeCategoryIdle   = "idle"
+	CPUModeCategoryOther  = "other"
+	CPUModeCategorySystem = "system"
+	CPUModeCategoryUser   = "user"
+)
+
+// DefaultCPUModeCategories maps node_cpu_seconds_total modes to breakdown
+// categories. Modes not present in the mapping are categorized as "other".
+var DefaultCPUModeCategories = map[string]string{
+	"idle":   CPUModeCategoryIdle,
+	"system": CPUModeCategorySystem,
+	"user":   CPUModeCategoryUser,
+}
+
+// DefaultCPUUserModes are the node_cpu_seconds_total modes categorized as
+// "user". Time spent in "nice" is user time at a lowered priority.
+var DefaultCPUUserModes = []string{"user", "nice"}
+
+// cpuModeCategories returns the given mapping of node_cpu_seconds_total modes
+// to breakdown categories, with each of the given user modes mapped to "user".
+// If the mapping is nil, DefaultCPUModeCategories is used and, if the user
+// modes are nil too, DefaultCPUUserModes, so that a given mapping is never
+// overridden by the default user modes.
+func cpuModeCategories(categories map[string]string, userModes []string) map[string]string {
+	if categories == nil {
+		categories = DefaultCPUModeCategories
+		if userModes == nil {
+			userModes = DefaultCPUUserModes
+		}
+	}
+
+	resolved := make(map[string]string, len(categories)+len(userModes))
+	for mode, category := range categories {
+		resolved[mode] = category
+	}
+	for _, mode := range userModes {
+		resolved[mode] = CPUModeCategoryUser
+	}
+
+	return resolved
+}
+
+// buildZeroPricedResources returns, per cluster, the sorted names of the
+// resources (e.g. "cpu") that have non-zero capacity, according to the given
+// capacity query results, but zero cost in the given costData. Resources with
+// no capacity are not zero-priced.
+func buildZeroPricedResources(costData map[string]map[string]float64, clusterLabel, defaultClusterID string, resCapacityByResource map[string][]*prom.QueryResult) map[string][]string {
+	zeroPriced := map[string][]string{}
+
+	for resource, resCapacity := range resCapacityByResource {
+		for _, result := range resCapacity {
+			clusterID, _ := result.GetString(clusterLabel)
+			if clusterID == "" {
+				clusterID = defaultClusterID
+			}
+			if len(result.Values) == 0 || result.Values[0].Value <= 0 {
+				continue
+			}
+			if costData[clusterID][resource] != 0 {
+				continue
+			}
+
+			zeroPriced[clusterID] = append(zeroPriced[clusterID], resource)
+		}
+	}
+
+	for _, resources := range zeroPriced {
+		sort.Strings(resources)
+	}
+
+	return zeroPriced
+}
+
+// coverageResources are the resources for which coverage is computed, each
+// priced by the corresponding metric of coverageMetrics
+var coverageResources = []string{"cpu", "ram", "gpu", "storage"}
+
+var coverageMetrics = map[string]string{
+	"cpu":     "node_cpu_hourly_cost",
+	"ram":     "node_ram_hourly_cost",
+	"gpu":     "node_gpu_hourly_cost",
+	"storage": "pv_hourly_cost",
+}
+
+// buildCoverageByResource returns, per cluster and resource, the fraction of
+// the expected number of samples present, according to the given sample count
+// query results, keyed by resource name. Coverage is capped at 1.0, and is
+// zero if no samples are expected.
+func buildCoverageByResource(resSampleCountByResource map[string][]*prom.QueryResult, expected float64, clusterLabel, defaultClusterID string) map[string]map[string]float64 {
+	coverage := map[string]map[string]float64{}
+
+	for resource, resSampleCount := range resSampleCountByResource {
+		for _, result := range resSampleCount {
+			clusterID, _ := result.GetString(clusterLabel)
+			if clusterID == "" {
+				clusterID = defaultClusterID
+			}
+			if len(result.Values) == 0 || expected <= 0 {
+				continue
+			}
+
+			if _, ok := coverage[clusterID]; !ok {
+				coverage[clusterID] = map[string]float64{}
+			}
+			coverage[clusterID][resource] = math.Min(result.Values[0].Value/expected, 1.0)
+		}
+	}
+
+	return coverage
+}
+
+// capacityDivisors convert the capacity metrics of each resource to the units
+// of the provisioned capacity fields of ClusterCosts; i.e. cores and GiB
+var capacityDivisors = map[string]float64{
+	"cpu":     1.0,
+	"ram":     1024 * 1024 * 1024,
+	"storage": 1024 * 1024 * 1024,
+}
+
+// buildProvisionedCapacity returns, per cluster and resource, the average
+// provisioned capacity according to the given capacity query results, keyed
+// by resource name, in cores for CPU and GiB for RAM and storage.
+func buildProvisionedCapacity(resCapacityByResource map[string][]*prom.QueryResult, clusterLabel, defaultClusterID string) map[string]map[string]float64 {
+	capacity := map[string]map[string]float64{}
+
+	for resource, resCapacity := range resCapacityByResource {
+		divisor, ok := capacityDivisors[resource]
+		if !ok {
+			continue
+		}
+		for _, result := range resCapacity {
+			clusterID, _ := result.GetString(clusterLabel)
+			if clusterID == "" {
+				clusterID = defaultClusterID
+			}
+			if len(result.Values) == 0 {
+				continue
+			}
+
+			if _, ok := capacity[clusterID]; !ok {
+				capacity[clusterID] = map[string]float64{}
+			}
+			capacity[clusterID][resource] += result.Values[0].Value / divisor
+		}
+	}
+
+	return capacity
+}
+
+// recordingRuleTotalResources are the resources whose totals may be taken
+// from recording rules, in query order
+var recordingRuleTotalResources = []string{"cpu", "ram", "gpu", "storage"}
+
+// RecordingRuleTotalMetric returns the name of the recording rule expected to
+// record the hourly cost of the given resource by cluster, e.g.
+// "cluster:cost:cpu" for "cpu".
+func RecordingRuleTotalMetric(resource string) string {
+	return "cluster:cost:" + resource
+}
+
+// queryOverrideResources are the resources whose queries may be overridden
+// by ClusterCostsOptions.QueryOverrides
+var queryOverrideResources = map[string]bool{"cpu": true, "gpu": true, "ram": true, "storage": true}
+
+// validateQueryOverrides returns an error if any of the given query overrides
+// is for an unknown resource, or is not a template accepting exactly the
+// window and offset.
+func validateQueryOverrides(overrides map[string]string) error {
+	for resource, template := range overrides {
+		if !queryOverrideResources[resource] {
+			return fmt.Errorf("illegal query override for resource %q: must be one of cpu, gpu, ram, or storage", resource)
+		}
+		if strings.TrimSpace(template) == "" {
+			return fmt.Errorf("illegal query override for %s: must not be empty", resource)
+		}
+
+		// Formatting errors, e.g. too few or many placeholders, are reported
+		// inline by fmt as "%!"
+		if query := fmt.Sprintf(template, "1h", "offset 1h"); strings.Contains(query, "%!") {
+			return fmt.Errorf("illegal query override for %s: must have exactly two %%s placeholders, for window and offset: %s", resource, query)
+		}
+	}
+
+	return nil
+}
+
+// maskedLabelPrefix prefixes the pseudonyms of masked label values
+const maskedLabelPrefix = "redacted-"
+
+// isMaskedLabel returns true if the given label is in the given mask
+func isMaskedLabel(mask []string, label string) bool {
+	for _, masked := range mask {
+		if masked == label {
+			return true
+		}
+	}
+	return false
+}
+
+// maskLabelValue returns a stable pseudonym for the given label value, derived
+// from its SHA-256 hash, so that distinct values remain distinct. The value
+// UnallocatedSubfield is not sensitive, so is returned as-is.
+func maskLabelValue(value string) string {
+	if value == UnallocatedSubfield {
+		return value
+	}
+
+	sum := sha256.Sum256([]byte(value))
+	return maskedLabelPrefix + hex.EncodeToString(sum[:8])
+}
+
+// maskCostsByLabelValue returns the given costs, keyed by cluster ID and then
+// by label value, with each label value replaced by its pseudonym if any of
+// the given labels is masked. UnallocatedSubfield and the taint keys, such as
+// UntaintedNodeKey, are not label values, so are not masked.
+func maskCostsByLabelValue(costs map[string]map[string]*ClusterCosts, mask []string, labels ...string) map[string]map[string]*ClusterCosts {
+	masked := false
+	for _, label := range labels {
+		if isMaskedLabel(mask, label) {
+			masked = true
+		}
+	}
+	if !masked {
+		return costs
+	}
+
+	maskedCosts := make(map[string]map[string]*ClusterCosts, len(costs))
+	for clusterID, byValue := range costs {
+		maskedCosts[clusterID] = make(map[string]*ClusterCosts, len(byValue))
+		for value, cc := range byValue {
+			if value != UntaintedNodeKey && value != TaintedNodeKey {
+				value = maskLabelValue(value)
+			}
+			maskedCosts[clusterID][value] = cc
+		}
+	}
+	return maskedCosts
+}
+
+// buildNodePoolCostData returns costs, keyed by cluster ID, node pool, and
+// resource name, from the given query results, keyed by resource name, of
+// costs by cluster and the given pool label. Costs without a pool label are
+// attributed to UnallocatedSubfield.
+func buildNodePoolCostData(poolLabel, defaultClusterID string, resCostsByResource map[string][]*prom.QueryResult) map[string]map[string]map[string]float64 {
+	costData := map[string]map[string]map[string]float64{}
+
+	for resource, resCosts := range resCostsByResource {
+		for _, result := range resCosts {
+			clusterID, _ := result.GetString(env.GetPromClusterLabel())
+			if clusterID == "" {
+				clusterID = defaultClusterID
+			}
+			pool, _ := result.GetString(poolLabel)
+			if pool == "" {
+				pool = UnallocatedSubfield
+			}
+			if len(result.Values) == 0 {
+				continue
+			}
+
+			if _, ok := costData[clusterID]; !ok {
+				costData[clusterID] = map[string]map[string]float64{}
+			}
+			if _, ok := costData[clusterID][pool]; !ok {
+				costData[clusterID][pool] = map[string]float64{}
+			}
+			costData[clusterID][pool][resource] += result.Values[0].Value
+		}
+	}
+
+	return costData
+}
+
+// mergeBreakdown merges the given partial breakdown into the breakdown of the
+// given cluster, adding a breakdown for the cluster if there is none.
+func mergeBreakdown(breakdownMap map[string]*ClusterCostsBreakdown, clusterID string, partial *ClusterCostsBreakdown) {
+	if _, ok := breakdownMap[clusterID]; !ok {
+		breakdownMap[clusterID] = &ClusterCostsBreakdown{}
+	}
+	breakdownMap[clusterID].Merge(partial)
+}
+
+// addCPUModeToBreakdown adds the given value to the breakdown category to
+// which the given node_cpu_seconds_total mode maps in the given categories.
+// If categories is nil, DefaultCPUModeCategories and DefaultCPUUserModes are
+// used.
+func addCPUModeToBreakdown(bd *ClusterCostsBreakdown, mode string, value float64, categories map[string]string) {
+	if categories == nil {
+		categories = cpuModeCategories(nil, nil)
+	}
+
+	switch categories[mode] {
+	case CPUModeCategoryIdle:
+		bd.Idle += value
+	case CPUModeCategorySystem:
+		bd.System += value
+	case CPUModeCategoryUser:
+		bd.User += value
+	default:
+		bd.Other += value
+	}
+}
+
 // Mapping of cluster/node=cpu for computing resource efficiency
 func buildCPUBreakdownMap(resNodeCPUModeTotal []*prom.QueryResult) map[nodeIdentifierNoProviderID]*ClusterCostsBreakdown {
 
@@ -318,16 +816,7 @@ func buildCPUBreakdownMap(resNodeCPUModeTotal []*prom.QueryResult) map[nodeIdent
 					cpuBreakdownMap[key] = &ClusterCostsBreakdown{}
 				}
 
-				switch mode {
-				case "idle":
-					cpuBreakdownMap[key].Idle += pct
-				case "system":
-					cpuBreakdownMap[key].System += pct
-				case "user":
-					cpuBreakdownMap[key].User += pct
-				default:
-					cpuBreakdownMap[key].Other += pct
-				}
+				addCPUModeToBreakdown(cpuBreakdownMap[key], mode, pct, nil)
 			}
 		}
 	}
@@ -696,3 +1185,23 @@ func buildNodeMap(
 
 	return nodeMap
 }
+
+// usedFraction returns the fraction of the given capacity that is used,
+// clamped to [0, 1], and whether it was clamped. Usage can exceed capacity,
+// e.g. for thinly provisioned volumes, which would otherwise result in
+// negative idle fractions. Zero capacity results in a zero fraction.
+func usedFraction(used, capacity float64) (float64, bool) {
+	if capacity <= 0 {
+		return 0.0, used > 0
+	}
+
+	frac := used / capacity
+	if frac > 1.0 {
+		return 1.0, true
+	}
+	if frac < 0.0 {
+		return 0.0, true
+	}
+
+	return frac, false
+}
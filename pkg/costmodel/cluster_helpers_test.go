@@ -856,3 +856,226 @@ func TestBuildGPUCostMap(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildDataRangeMap(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	resolution := 5 * time.Minute
+
+	// Data only exists from 06:00 through 17:55 of the requested day
+	dataStart := start.Add(6 * time.Hour)
+	dataLast := start.Add(18*time.Hour - resolution)
+
+	values := []*util.Vector{}
+	for ts := dataStart; !ts.After(dataLast); ts = ts.Add(resolution) {
+		values = append(values, &util.Vector{Timestamp: float64(ts.Unix()), Value: 1})
+	}
+
+	results := []*prom.QueryResult{
+		{
+			Metric: map[string]interface{}{"cluster_id": "cluster1"},
+			Values: values,
+		},
+	}
+
+	drMap := buildDataRangeMap(results, resolution, start, end, "cluster_id", "cluster1")
+	dr, ok := drMap["cluster1"]
+	if !ok {
+		t.Fatalf("expected data range for cluster1")
+	}
+	if !dr.start.Equal(dataStart) {
+		t.Errorf("expected data start %s; got %s", dataStart, dr.start)
+	}
+	if !dr.end.Equal(start.Add(18 * time.Hour)) {
+		t.Errorf("expected data end %s; got %s", start.Add(18*time.Hour), dr.end)
+	}
+	if !dr.start.After(start) || !dr.end.Before(end) {
+		t.Errorf("expected data range [%s, %s] to be narrower than requested range [%s, %s]", dr.start, dr.end, start, end)
+	}
+}
+
+func TestBuildGPUCostsByModel(t *testing.T) {
+	resGPUCost := []*prom.QueryResult{
+		{
+			Metric: map[string]interface{}{
+				"cluster_id": "cluster1",
+				"node":       "node1",
+				"modelName":  "A100",
+			},
+			Values: []*util.Vector{&util.Vector{Value: 30.0}},
+		},
+		{
+			Metric: map[string]interface{}{
+				"cluster_id": "cluster1",
+				"node":       "node2",
+			},
+			Values: []*util.Vector{&util.Vector{Value: 5.0}},
+		},
+		{
+			Metric: map[string]interface{}{
+				"cluster_id": "cluster1",
+				"node":       "node3",
+			},
+			Values: []*util.Vector{&util.Vector{Value: 4.0}},
+		},
+		{
+			Metric: map[string]interface{}{
+				"cluster_id": "cluster1",
+				"node":       "node4",
+			},
+			Values: []*util.Vector{&util.Vector{Value: 1.0}},
+		},
+	}
+	resGPUModel := []*prom.QueryResult{
+		{
+			Metric: map[string]interface{}{
+				"cluster_id": "cluster1",
+				"Hostname":   "node2",
+				"modelName":  "T4",
+			},
+			Values: []*util.Vector{&util.Vector{Value: 1.0}},
+		},
+		{
+			Metric: map[string]interface{}{
+				"cluster_id": "cluster1",
+				"Hostname":   "node3",
+				"modelName":  "T4",
+			},
+			Values: []*util.Vector{&util.Vector{Value: 1.0}},
+		},
+	}
+
+	expected := map[string]map[string]float64{
+		"cluster1": {
+			"A100":    30.0,
+			"T4":      9.0,
+			"unknown": 1.0,
+		},
+	}
+
+	result := buildGPUCostsByModel(resGPUCost, resGPUModel, "cluster1")
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("buildGPUCostsByModel: expected %+v; got %+v", expected, result)
+	}
+}
+
+func TestAddCPUModeToBreakdown(t *testing.T) {
+	modes := map[string]float64{
+		"idle":   0.4,
+		"iowait": 0.1,
+		"steal":  0.2,
+		"system": 0.1,
+		"user":   0.2,
+	}
+
+	// Default mapping: iowait and steal fall into "other"
+	bd := &ClusterCostsBreakdown{}
+	for mode, value := range modes {
+		addCPUModeToBreakdown(bd, mode, value, nil)
+	}
+	if !util.IsApproximately(bd.Other, 0.3) || !util.IsApproximately(bd.System, 0.1) || !util.IsApproximately(bd.Idle, 0.4) {
+		t.Errorf("default mapping: unexpected breakdown %+v", bd)
+	}
+
+	// Custom mapping: iowait counts as idle, steal counts as system
+	categories := map[string]string{
+		"idle":   CPUModeCategoryIdle,
+		"iowait": CPUModeCategoryIdle,
+		"steal":  CPUModeCategorySystem,
+		"system": CPUModeCategorySystem,
+		"user":   CPUModeCategoryUser,
+	}
+	bd = &ClusterCostsBreakdown{}
+	for mode, value := range modes {
+		addCPUModeToBreakdown(bd, mode, value, categories)
+	}
+	if !util.IsApproximately(bd.System, 0.3) {
+		t.Errorf("custom mapping: expected system %f; got %f", 0.3, bd.System)
+	}
+	if !util.IsApproximately(bd.Idle, 0.5) {
+		t.Errorf("custom mapping: expected idle %f; got %f", 0.5, bd.Idle)
+	}
+	if bd.Other != 0.0 {
+		t.Errorf("custom mapping: expected other %f; got %f", 0.0, bd.Other)
+	}
+}
+
+func TestClampDiscount(t *testing.T) {
+	discount, err := ParsePercentString("150%")
+	if err != nil {
+		t.Fatalf("unexpected error parsing discount: %s", err)
+	}
+
+	clamped, warned := clampDiscount("discount", discount)
+	if clamped != 1.0 {
+		t.Errorf("expected discount of 150%% to be clamped to 1.0; got %f", clamped)
+	}
+	if !warned {
+		t.Errorf("expected a warning when clamping discount of 150%%")
+	}
+
+	clamped, warned = clampDiscount("negotiatedDiscount", -0.1)
+	if clamped != 0.0 || !warned {
+		t.Errorf("expected discount of -10%% to be clamped to 0.0 with a warning; got %f (warned: %t)", clamped, warned)
+	}
+
+	clamped, warned = clampDiscount("discount", 0.3)
+	if clamped != 0.3 || warned {
+		t.Errorf("expected discount of 30%% to be unchanged without warning; got %f (warned: %t)", clamped, warned)
+	}
+}
+
+func TestCPUModeCategories_UserModes(t *testing.T) {
+	modes := map[string]float64{
+		"idle":   0.4,
+		"nice":   0.1,
+		"system": 0.1,
+		"user":   0.4,
+	}
+
+	// Default user modes: nice counts as user
+	bd := &ClusterCostsBreakdown{}
+	for mode, value := range modes {
+		addCPUModeToBreakdown(bd, mode, value, cpuModeCategories(nil, nil))
+	}
+	if !util.IsApproximately(bd.User, 0.5) {
+		t.Errorf("default user modes: expected user %f; got %f", 0.5, bd.User)
+	}
+	if bd.Other != 0.0 {
+		t.Errorf("default user modes: expected other %f; got %f", 0.0, bd.Other)
+	}
+
+	// Custom user modes: nice falls into "other"
+	bd = &ClusterCostsBreakdown{}
+	for mode, value := range modes {
+		addCPUModeToBreakdown(bd, mode, value, cpuModeCategories(nil, []string{"user"}))
+	}
+	if !util.IsApproximately(bd.User, 0.4) || !util.IsApproximately(bd.Other, 0.1) {
+		t.Errorf("custom user modes: unexpected breakdown %+v", bd)
+	}
+
+	// Given categories are not overridden by the default user modes
+	categories := cpuModeCategories(map[string]string{"nice": CPUModeCategoryOther}, nil)
+	if categories["nice"] != CPUModeCategoryOther {
+		t.Errorf("expected nice to be categorized as %s; got %s", CPUModeCategoryOther, categories["nice"])
+	}
+	categories = cpuModeCategories(map[string]string{
+		"idle":   CPUModeCategoryIdle,
+		"nice":   CPUModeCategoryOther,
+		"system": CPUModeCategorySystem,
+		"user":   CPUModeCategoryUser,
+	}, nil)
+	bd = &ClusterCostsBreakdown{}
+	for mode, value := range modes {
+		addCPUModeToBreakdown(bd, mode, value, categories)
+	}
+	if !util.IsApproximately(bd.User, 0.4) || !util.IsApproximately(bd.Other, 0.1) {
+		t.Errorf("overridden categories: unexpected breakdown %+v", bd)
+	}
+
+	// Given user modes take precedence over given categories
+	categories = cpuModeCategories(map[string]string{"nice": CPUModeCategoryOther}, []string{"nice"})
+	if categories["nice"] != CPUModeCategoryUser {
+		t.Errorf("expected nice to be categorized as %s; got %s", CPUModeCategoryUser, categories["nice"])
+	}
+}
@@ -0,0 +1,2774 @@
+package costmodel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util"
+	"github.com/kubecost/cost-model/pkg/util/json"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+
+	prometheus "github.com/prometheus/client_golang/api"
+	"k8s.io/klog"
+)
+
+// mockPromResponse is a canned Prometheus response, returned for any query
+// containing Match. Result is the raw JSON of the response's result array.
+type mockPromResponse struct {
+	Match  string
+	Result string
+}
+
+// mockPromClient is a prometheus.Client that answers each query with the
+// first response whose Match is contained in the query, or with an empty
+// result if none match. All queries received are recorded.
+type mockPromClient struct {
+	responses []mockPromResponse
+	queries   []string
+	params    []url.Values
+	lock      sync.Mutex
+}
+
+func (mpc *mockPromClient) URL(ep string, args map[string]string) *url.URL {
+	return &url.URL{Scheme: "http", Host: "prometheus", Path: ep}
+}
+
+func (mpc *mockPromClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, prometheus.Warnings, error) {
+	query := req.URL.Query().Get("query")
+
+	mpc.lock.Lock()
+	mpc.queries = append(mpc.queries, query)
+	mpc.params = append(mpc.params, req.URL.Query())
+	mpc.lock.Unlock()
+
+	result := "[]"
+	for _, resp := range mpc.responses {
+		if strings.Contains(query, resp.Match) {
+			result = resp.Result
+			break
+		}
+	}
+
+	body := []byte(fmt.Sprintf(`{"status":"success","data":{"resultType":"vector","result":%s}}`, result))
+	httpResp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+	}
+
+	return httpResp, body, nil, nil
+}
+
+// Queries returns the queries received by the client
+func (mpc *mockPromClient) Queries() []string {
+	mpc.lock.Lock()
+	defer mpc.lock.Unlock()
+
+	return append([]string{}, mpc.queries...)
+}
+
+// Params returns the query parameters of the requests received by the client
+func (mpc *mockPromClient) Params() []url.Values {
+	mpc.lock.Lock()
+	defer mpc.lock.Unlock()
+
+	return append([]url.Values{}, mpc.params...)
+}
+
+// mockProvider is a cloud.Provider with a static config and no local storage
+type mockProvider struct {
+	cloud.Provider
+	config *cloud.CustomPricing
+}
+
+func (mp *mockProvider) GetConfig() (*cloud.CustomPricing, error) {
+	return mp.config, nil
+}
+
+func (mp *mockProvider) GetLocalStorageQuery(window, offset time.Duration, rate bool, used bool) string {
+	return ""
+}
+
+// mockLocalStorageProvider is a mockProvider returning the given local storage
+// query, or the given used local storage query, if set, for usage.
+type mockLocalStorageProvider struct {
+	mockProvider
+	query     string
+	usedQuery string
+}
+
+func (mp *mockLocalStorageProvider) GetLocalStorageQuery(window, offset time.Duration, rate bool, used bool) string {
+	if used && mp.usedQuery != "" {
+		return mp.usedQuery
+	}
+	return mp.query
+}
+
+// newMockClusterCostsClient returns a mockPromClient answering the cluster
+// costs queries with a single cluster, "cluster1", with the given cumulative
+// CPU, RAM, GPU, and storage costs over 24 hours of data.
+func newMockClusterCostsClient(cpu, ram, gpu, storage float64) *mockPromClient {
+	vector := func(value float64) string {
+		return fmt.Sprintf(`[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"%f"]}]`, value)
+	}
+
+	return &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "count_over_time(sum(kube_node_status_capacity_cpu_cores)", Result: vector(24 * 60)},
+			{Match: "sum_over_time(node_gpu_hourly_cost", Result: vector(gpu)},
+			{Match: "node_cpu_hourly_cost", Result: vector(cpu)},
+			{Match: "node_ram_hourly_cost", Result: vector(ram)},
+			{Match: "pv_hourly_cost", Result: vector(storage)},
+		},
+	}
+}
+
+// mockLogger is a log.Logger recording the messages it receives by level
+type mockLogger struct {
+	debug []string
+	info  []string
+	warn  []string
+	lock  sync.Mutex
+}
+
+func (ml *mockLogger) Debug(msg string, keysAndValues ...interface{}) {
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+	ml.debug = append(ml.debug, msg)
+}
+
+func (ml *mockLogger) Info(msg string, keysAndValues ...interface{}) {
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+	ml.info = append(ml.info, msg)
+}
+
+func (ml *mockLogger) Warn(msg string, keysAndValues ...interface{}) {
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+	ml.warn = append(ml.warn, msg)
+}
+
+var _ log.Logger = &mockLogger{}
+
+func TestDiffClusterCosts(t *testing.T) {
+	old := map[string]*ClusterCosts{
+		"removed":   &ClusterCosts{TotalCumulative: 10.0},
+		"unchanged": &ClusterCosts{TotalCumulative: 100.0},
+		"small":     &ClusterCosts{TotalCumulative: 100.0},
+		"changed":   &ClusterCosts{TotalCumulative: 100.0},
+	}
+	new := map[string]*ClusterCosts{
+		"added":     &ClusterCosts{TotalCumulative: 20.0},
+		"unchanged": &ClusterCosts{TotalCumulative: 100.0},
+		"small":     &ClusterCosts{TotalCumulative: 105.0},
+		"changed":   &ClusterCosts{TotalCumulative: 150.0},
+	}
+
+	diff := DiffClusterCosts(old, new, 0.1)
+
+	if len(diff.Added) != 1 || diff.Added[0] != "added" {
+		t.Errorf("expected Added to be [added]; got %v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0] != "removed" {
+		t.Errorf("expected Removed to be [removed]; got %v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 {
+		t.Fatalf("expected 1 changed cluster; got %d", len(diff.Changed))
+	}
+
+	change := diff.Changed[0]
+	if change.Cluster != "changed" {
+		t.Errorf("expected changed cluster to be \"changed\"; got %s", change.Cluster)
+	}
+	if change.OldTotal != 100.0 || change.NewTotal != 150.0 || change.Delta != 50.0 {
+		t.Errorf("expected change 100.0 -> 150.0 (delta 50.0); got %f -> %f (delta %f)", change.OldTotal, change.NewTotal, change.Delta)
+	}
+}
+
+func TestResourceDeltas(t *testing.T) {
+	baseline := &ClusterCosts{CPUMonthly: 100.0, RAMMonthly: 50.0, StorageMonthly: 40.0, GPUMonthly: 10.0}
+	current := &ClusterCosts{CPUMonthly: 100.0, RAMMonthly: 80.0, StorageMonthly: 25.0, GPUMonthly: 10.0}
+
+	expected := map[string]float64{"cpu": 0.0, "ram": 30.0, "storage": -15.0, "gpu": 0.0}
+	deltas := ResourceDeltas(current, baseline)
+	if len(deltas) != len(expected) {
+		t.Fatalf("expected %d deltas; got %v", len(expected), deltas)
+	}
+	for resource, delta := range expected {
+		if !util.IsApproximately(deltas[resource], delta) {
+			t.Errorf("expected %s delta %f; got %f", resource, delta, deltas[resource])
+		}
+	}
+
+	// A nil baseline is treated as zero cost
+	deltas = ResourceDeltas(current, nil)
+	if !util.IsApproximately(deltas["ram"], 80.0) || !util.IsApproximately(deltas["storage"], 25.0) {
+		t.Errorf("expected deltas equal to current costs for nil baseline; got %v", deltas)
+	}
+}
+
+func TestClustersMissingPricing(t *testing.T) {
+	costs := map[string]*ClusterCosts{
+		"priced":   {CPUCumulative: 10.0, TotalCumulative: 10.0, NodeCount: 3},
+		"unpriced": {ZeroPricedResources: []string{"cpu", "ram"}, NodeCount: 3},
+		"empty":    {},
+		"nil":      nil,
+	}
+
+	missing := ClustersMissingPricing(costs)
+	if len(missing) != 1 || missing[0] != "unpriced" {
+		t.Errorf("expected [unpriced]; got %v", missing)
+	}
+}
+
+func TestClusterCosts_Scale(t *testing.T) {
+	cc := &ClusterCosts{
+		CPUCumulative:      10.0,
+		CPUMonthly:         100.0,
+		CPUBreakdown:       &ClusterCostsBreakdown{Idle: 0.5, User: 0.5},
+		GPUCumulative:      20.0,
+		GPUMonthly:         200.0,
+		RAMCumulative:      30.0,
+		RAMMonthly:         300.0,
+		RAMBreakdown:       &ClusterCostsBreakdown{Idle: 0.25, System: 0.75},
+		StorageCumulative:  40.0,
+		StorageMonthly:     400.0,
+		TotalCumulative:    100.0,
+		TotalMonthly:       1000.0,
+		EffectiveDiscounts: map[string]float64{"cpu": 0.1},
+		Warnings:           []string{"warning"},
+	}
+
+	scaled := cc.Scale(1.3)
+	if scaled == nil {
+		t.Fatalf("expected scaled costs; got nil")
+	}
+
+	if !util.IsApproximately(scaled.TotalCumulative, 130.0) {
+		t.Errorf("expected TotalCumulative %f; got %f", 130.0, scaled.TotalCumulative)
+	}
+	if !util.IsApproximately(scaled.TotalMonthly, 1300.0) {
+		t.Errorf("expected TotalMonthly %f; got %f", 1300.0, scaled.TotalMonthly)
+	}
+	if !util.IsApproximately(scaled.CPUCumulative, 13.0) || !util.IsApproximately(scaled.StorageMonthly, 520.0) {
+		t.Errorf("expected resource costs to scale; got CPUCumulative %f, StorageMonthly %f", scaled.CPUCumulative, scaled.StorageMonthly)
+	}
+
+	if *scaled.CPUBreakdown != *cc.CPUBreakdown || *scaled.RAMBreakdown != *cc.RAMBreakdown {
+		t.Errorf("expected breakdowns to be unchanged; got CPU %+v, RAM %+v", scaled.CPUBreakdown, scaled.RAMBreakdown)
+	}
+	if scaled.CPUBreakdown == cc.CPUBreakdown {
+		t.Errorf("expected scaled breakdown to be a copy")
+	}
+
+	// Maps and slices are not shared with the original
+	scaled.EffectiveDiscounts["cpu"] = 0.5
+	scaled.Warnings[0] = "changed"
+	if cc.EffectiveDiscounts["cpu"] != 0.1 || cc.Warnings[0] != "warning" {
+		t.Errorf("expected original maps and slices to be unchanged; got %v, %v", cc.EffectiveDiscounts, cc.Warnings)
+	}
+
+	// Original must not be modified
+	if cc.TotalCumulative != 100.0 {
+		t.Errorf("expected original TotalCumulative to be unchanged; got %f", cc.TotalCumulative)
+	}
+
+	if cc.Scale(-1.0) != nil {
+		t.Errorf("expected nil for negative scale factor")
+	}
+}
+
+func TestQueryRAMPctAtPercentile(t *testing.T) {
+	query := queryRAMPctAtPercentile(0.95, "kubecost_cluster_memory_working_set_bytes", "cluster_id", 24*time.Hour, 5, "offset 1h")
+	if !strings.Contains(query, "quantile_over_time(0.95, sum(kubecost_cluster_memory_working_set_bytes)") {
+		t.Errorf("expected query to use quantile_over_time at 0.95; got %s", query)
+	}
+
+	for _, p := range []float64{0.0, 1.0, -0.5, 95} {
+		if err := validateUtilizationPercentile(p); err == nil {
+			t.Errorf("expected error validating utilization percentile %f", p)
+		}
+	}
+	if err := validateUtilizationPercentile(0.95); err != nil {
+		t.Errorf("unexpected error validating utilization percentile 0.95: %s", err)
+	}
+}
+
+func TestComputeClusterCostsWithOptions_Logger(t *testing.T) {
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	logger := &mockLogger{}
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{Logger: logger})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := costs["cluster1"]; !ok {
+		t.Fatalf("expected costs for cluster1")
+	}
+
+	found := false
+	for _, msg := range logger.debug {
+		if msg == "ComputeClusterCosts: computed cluster costs" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected injected logger to receive debug event for computed cluster costs; got %v", logger.debug)
+	}
+
+	if len(logger.info) > 0 {
+		t.Errorf("expected no info logs; got %v", logger.info)
+	}
+}
+
+func TestComputeClusterCosts_NoInfoLogsAtDefaultVerbosity(t *testing.T) {
+	// Capture klog output at default verbosity
+	var buf bytes.Buffer
+	fs := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(fs)
+	fs.Set("logtostderr", "false")
+	fs.Set("v", "0")
+	klog.SetOutput(&buf)
+	defer func() {
+		fs.Set("logtostderr", "true")
+		klog.SetOutput(os.Stderr)
+	}()
+
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	client.responses = append(client.responses,
+		mockPromResponse{
+			Match: "node_cpu_seconds_total",
+			Result: `[
+				{"metric":{"cluster_id":"cluster1","mode":"idle"},"value":[1609459200,"0.6"]},
+				{"metric":{"cluster_id":"cluster1","mode":"user"},"value":[1609459200,"0.3"]},
+				{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"0.1"]}
+			]`,
+		},
+		mockPromResponse{Match: "container_memory_usage_bytes", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"0.2"]}]`},
+		mockPromResponse{Match: "kubecost_cluster_memory_working_set_bytes", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"0.3"]}]`},
+	)
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	costs, err := a.ComputeClusterCosts(client, provider, 24*time.Hour, 0, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if costs["cluster1"] == nil || costs["cluster1"].CPUBreakdown == nil {
+		t.Fatalf("expected CPU breakdown for cluster1")
+	}
+
+	klog.Flush()
+	if buf.Len() > 0 {
+		t.Errorf("expected no log output at default verbosity; got:\n%s", buf.String())
+	}
+}
+
+func TestClusterCosts_MonthToDate(t *testing.T) {
+	cc := &ClusterCosts{TotalMonthly: 3000.0}
+
+	cases := []struct {
+		now      time.Time
+		expected float64
+	}{
+		// Halfway through the 30-day April, at the end of the 15th
+		{time.Date(2021, time.April, 16, 0, 0, 0, 0, time.UTC), 1500.0},
+		// Month boundaries: nothing has elapsed at the start of a month
+		{time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC), 0.0},
+		// The final hour of the 28-day February
+		{time.Date(2021, time.February, 28, 23, 0, 0, 0, time.UTC), 3000.0 * (28.0*24.0 - 1.0) / (28.0 * 24.0)},
+	}
+
+	for _, c := range cases {
+		if actual := cc.MonthToDate(c.now); !util.IsApproximately(actual, c.expected) {
+			t.Errorf("expected month-to-date cost %f at %s; got %f", c.expected, c.now, actual)
+		}
+	}
+}
+
+func TestClusterCosts_HourlyRates(t *testing.T) {
+	cc, err := NewClusterCostsFromCumulative(24.0, 12.0, 6.0, 3.0, 24*time.Hour, 0, 24.0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	hourly := cc.HourlyRates()
+
+	if !util.IsApproximately(hourly.CPUHourly, 1.0) {
+		t.Errorf("expected CPUHourly %f; got %f", 1.0, hourly.CPUHourly)
+	}
+
+	roundTrips := map[string][2]float64{
+		"cpu":     {hourly.CPUHourly, cc.CPUMonthly},
+		"gpu":     {hourly.GPUHourly, cc.GPUMonthly},
+		"ram":     {hourly.RAMHourly, cc.RAMMonthly},
+		"storage": {hourly.StorageHourly, cc.StorageMonthly},
+		"total":   {hourly.TotalHourly, cc.TotalMonthly},
+	}
+	for name, rt := range roundTrips {
+		if !util.IsApproximately(rt[0]*730.0, rt[1]) {
+			t.Errorf("%s: expected hourly %f x 730 to equal monthly %f", name, rt[0], rt[1])
+		}
+	}
+}
+
+func TestOffsetAt(t *testing.T) {
+	now := time.Date(2021, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	// 2021-01-01T00:00:00Z + 1d ends 8d12h before now
+	offset, err := offsetAt(now, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), 24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if offset != 204*time.Hour {
+		t.Errorf("expected offset %s; got %s", 204*time.Hour, offset)
+	}
+
+	// Windows ending within the clock skew tolerance of now end now
+	offset, err = offsetAt(now, now.Add(-time.Hour), time.Hour+30*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if offset != 0 {
+		t.Errorf("expected offset 0; got %s", offset)
+	}
+
+	// Windows ending in the future are illegal
+	if _, err := offsetAt(now, now.Add(-time.Hour), 2*time.Hour); err == nil {
+		t.Errorf("expected error for window ending in the future")
+	}
+
+	// Times in the future are illegal
+	if _, err := offsetAt(now, now.Add(time.Hour), time.Hour); err == nil {
+		t.Errorf("expected error for time in the future")
+	}
+}
+
+func TestComputeClusterCostsAt(t *testing.T) {
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	// 2021-01-01T00:00:00Z + 1d ends 8d12h before the clock
+	clock := &timeutil.FakeClock{T: time.Date(2021, 1, 10, 12, 0, 0, 0, time.UTC)}
+	at := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	costs, err := a.ComputeClusterCostsAt(context.Background(), client, provider, at, "1d", &ClusterCostsOptions{Clock: clock})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cc, ok := costs["cluster1"]
+	if !ok {
+		t.Fatalf("expected costs for cluster1")
+	}
+	if cc.Start == nil || !cc.Start.Equal(at) {
+		t.Errorf("expected costs to start at %s; got %v", at, cc.Start)
+	}
+	offsetQueries := 0
+	for _, query := range client.Queries() {
+		if strings.Contains(query, "offset 204h") {
+			offsetQueries++
+		}
+	}
+	if offsetQueries == 0 {
+		t.Errorf("expected queries offset by 204h relative to the clock; got %v", client.Queries())
+	}
+
+	// Times after the clock are illegal, even if before the current time
+	if _, err := a.ComputeClusterCostsAt(context.Background(), client, provider, clock.T.Add(time.Hour), "1h", &ClusterCostsOptions{Clock: clock}); err == nil {
+		t.Errorf("expected error for time after the clock")
+	}
+}
+
+func TestClusterCostsOverTime_NoGPU(t *testing.T) {
+	// A GPU-less cluster of one node with 4 cores at $0.03/core/hour and
+	// 16GiB at $0.005/GiB/hour exports no node_gpu_hourly_cost, so the GPU
+	// query has no data, which must not affect CPU costs.
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_cpu_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"87.6"]]}]`},
+			{Match: "node_ram_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"58.4"]]}]`},
+			{Match: "node_total_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"146"]]}]`},
+		},
+	}
+
+	totals, err := ClusterCostsOverTime(client, &mockProvider{}, "2021-01-01T00:00:00.000Z", "2021-01-02T00:00:00.000Z", 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// 4 cores * $0.03/hour * 730 hours/month
+	if len(totals.CPUCost) != 1 || totals.CPUCost[0][1] != "87.600000" {
+		t.Errorf("expected CPU cost %s; got %v", "87.600000", totals.CPUCost)
+	}
+	if len(totals.GPUCost) != 1 || totals.GPUCost[0][1] != "0.000000" {
+		t.Errorf("expected zero GPU cost; got %v", totals.GPUCost)
+	}
+	// 87.6 CPU + 58.4 RAM, with nothing for GPU
+	if sum, err := totals.Sum(DimensionTotal); err != nil || sum != 146.0 {
+		t.Errorf("expected total cost %f; got %f, %v", 146.0, sum, err)
+	}
+
+	// The cores query has no GPU term that could drop or NaN the CPU cost of
+	// nodes without GPU prices; GPU cost is queried on its own
+	expected := map[string]bool{
+		"sum( avg(avg_over_time(kube_node_status_capacity_cpu_cores[1d] )) by (node, cluster_id) * avg(avg_over_time(node_cpu_hourly_cost[1d] )) by (node, cluster_id) * 730 ) by (cluster_id)": false,
+		"sum( avg(avg_over_time(node_gpu_hourly_cost[1d] )) by (node, cluster_id) * 730 ) by (cluster_id)":                                                                                      false,
+	}
+	for _, query := range client.Queries() {
+		query = strings.Join(strings.Fields(query), " ")
+		if _, ok := expected[query]; ok {
+			expected[query] = true
+		}
+	}
+	for query, found := range expected {
+		if !found {
+			t.Errorf("expected query: %s; got %v", query, client.Queries())
+		}
+	}
+}
+
+func TestClusterCostsOverTime_GPUCost(t *testing.T) {
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_gpu_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"300"]]}]`},
+			{Match: "node_cpu_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"100"]]}]`},
+			{Match: "node_ram_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"50"]]}]`},
+			{Match: "node_total_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"450"]]}]`},
+		},
+	}
+
+	totals, err := ClusterCostsOverTime(client, &mockProvider{}, "2021-01-01T00:00:00.000Z", "2021-01-02T00:00:00.000Z", 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(totals.CPUCost) != 1 || totals.CPUCost[0][1] != "100.000000" {
+		t.Errorf("expected CPU cost %s, excluding GPU cost; got %v", "100.000000", totals.CPUCost)
+	}
+	if gpu, err := totals.Sum(DimensionGPU); err != nil || gpu != 300.0 {
+		t.Errorf("expected GPU cost %f; got %f, %v", 300.0, gpu, err)
+	}
+}
+
+func TestClusterCostsOverTime_WithCounts(t *testing.T) {
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "count_over_time(node_total_hourly_cost", Result: `[{"metric":{},"values":[[1609459200,"12"],[1609462800,"3"]]}]`},
+			{Match: "count_over_time(node_cpu_hourly_cost", Result: `[{"metric":{},"values":[[1609459200,"12"],[1609462800,"12"]]}]`},
+			{Match: "count_over_time(node_gpu_hourly_cost", Result: `[{"metric":{},"values":[[1609459200,"4"],[1609462800,"4"]]}]`},
+			{Match: "count_over_time(node_ram_hourly_cost", Result: `[{"metric":{},"values":[[1609462800,"12"]]}]`},
+			{Match: "node_cpu_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"100"],[1609462800,"100"]]}]`},
+			{Match: "node_ram_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"50"],[1609462800,"50"]]}]`},
+			{Match: "node_total_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"150"],[1609462800,"150"]]}]`},
+		},
+	}
+
+	totals, err := ClusterCostsOverTimeWithOptions(client, &mockProvider{}, "2021-01-01T00:00:00.000Z", "2021-01-01T02:00:00.000Z", time.Hour, 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if totals.Counts != nil {
+		t.Errorf("expected no counts by default; got %v", totals.Counts)
+	}
+	for _, query := range client.Queries() {
+		if strings.Contains(query, "count_over_time") {
+			t.Errorf("expected no count queries by default; got: %s", query)
+		}
+	}
+
+	totals, err = ClusterCostsOverTimeWithOptions(client, &mockProvider{}, "2021-01-01T00:00:00.000Z", "2021-01-01T02:00:00.000Z", time.Hour, 0, &ClusterCostsOverTimeOptions{WithCounts: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if totals.Counts == nil {
+		t.Fatalf("expected counts")
+	}
+
+	series := map[string][2][][]string{
+		"total":   {totals.TotalCost, totals.Counts.TotalCost},
+		"cpu":     {totals.CPUCost, totals.Counts.CPUCost},
+		"gpu":     {totals.GPUCost, totals.Counts.GPUCost},
+		"ram":     {totals.MemCost, totals.Counts.MemCost},
+		"storage": {totals.StorageCost, totals.Counts.StorageCost},
+	}
+	for name, s := range series {
+		values, counts := s[0], s[1]
+		if len(counts) != len(values) {
+			t.Errorf("expected %d %s counts; got %d", len(values), name, len(counts))
+			continue
+		}
+		for i := range values {
+			if counts[i][0] != values[i][0] {
+				t.Errorf("expected %s count %d at timestamp %s; got %s", name, i, values[i][0], counts[i][0])
+			}
+		}
+	}
+
+	// Points without samples count zero
+	if totals.Counts.MemCost[0][1] != "0.000000" || totals.Counts.MemCost[1][1] != "12.000000" {
+		t.Errorf("expected RAM counts [0, 12]; got %v", totals.Counts.MemCost)
+	}
+	if totals.Counts.TotalCost[1][1] != "3.000000" {
+		t.Errorf("expected a total count of 3; got %v", totals.Counts.TotalCost)
+	}
+	if totals.Counts.GPUCost[0][1] != "4.000000" || totals.Counts.GPUCost[1][1] != "4.000000" {
+		t.Errorf("expected GPU counts [4, 4]; got %v", totals.Counts.GPUCost)
+	}
+}
+
+func TestPriceAggregation(t *testing.T) {
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	priceQueries := func(queries []string) []string {
+		prices := []string{}
+		for _, query := range queries {
+			if strings.Contains(query, "node_cpu_hourly_cost") || strings.Contains(query, "node_ram_hourly_cost") {
+				prices = append(prices, query)
+			}
+		}
+		return prices
+	}
+
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	_, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{PriceAggregation: PriceAggregationMedian})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	overTimeClient := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_cpu_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"100"]]}]`},
+			{Match: "node_ram_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"50"]]}]`},
+			{Match: "node_total_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"150"]]}]`},
+		},
+	}
+	_, err = ClusterCostsOverTimeWithOptions(overTimeClient, provider, "2021-01-01T00:00:00.000Z", "2021-01-02T00:00:00.000Z", 24*time.Hour, 0, &ClusterCostsOverTimeOptions{PriceAggregation: PriceAggregationMedian})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	queries := append(priceQueries(client.Queries()), priceQueries(overTimeClient.Queries())...)
+	if len(queries) != 4 {
+		t.Fatalf("expected 4 CPU and RAM price queries; got %d", len(queries))
+	}
+	for _, query := range queries {
+		if !strings.Contains(query, "quantile_over_time(0.5, node_") || strings.Contains(query, "avg_over_time(node_") {
+			t.Errorf("expected median price aggregation in query: %s", query)
+		}
+	}
+
+	// Average by default
+	client = newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	_, err = a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, query := range priceQueries(client.Queries()) {
+		if !strings.Contains(query, "avg_over_time(node_") || strings.Contains(query, "quantile_over_time") {
+			t.Errorf("expected average price aggregation in query: %s", query)
+		}
+	}
+}
+
+func TestClusterCostsBreakdown_Merge(t *testing.T) {
+	bd := &ClusterCostsBreakdown{System: 0.2}
+	bd.Merge(&ClusterCostsBreakdown{User: 0.5})
+	bd.Merge(nil)
+
+	if !util.IsApproximately(bd.System, 0.2) || !util.IsApproximately(bd.User, 0.5) {
+		t.Errorf("expected system %f and user %f; got %+v", 0.2, 0.5, *bd)
+	}
+	if bd.Complete() {
+		t.Errorf("expected breakdown without idle to be incomplete: %+v", *bd)
+	}
+
+	bd.Merge(&ClusterCostsBreakdown{Idle: 0.3})
+	if !bd.Complete() {
+		t.Errorf("expected breakdown to be complete: %+v", *bd)
+	}
+
+	var nilBD *ClusterCostsBreakdown
+	if nilBD.Complete() {
+		t.Errorf("expected nil breakdown to be incomplete")
+	}
+}
+
+func TestComputeClusterCostsRange(t *testing.T) {
+	now := time.Date(2021, 1, 10, 12, 0, 0, 0, time.UTC)
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	rangeClient := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	_, err := a.computeClusterCostsRange(context.Background(), rangeClient, provider, now, start, end)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// [2021-01-01, 2021-01-02) is equivalent to 1d offset 8d12h
+	windowClient := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	_, err = a.ComputeClusterCostsWithOptions(windowClient, provider, 24*time.Hour, 204*time.Hour, &ClusterCostsOptions{WithBreakdown: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rangeQueries, windowQueries := rangeClient.Queries(), windowClient.Queries()
+	sort.Strings(rangeQueries)
+	sort.Strings(windowQueries)
+	if len(rangeQueries) != len(windowQueries) {
+		t.Fatalf("expected %d queries; got %d", len(windowQueries), len(rangeQueries))
+	}
+	for i := range rangeQueries {
+		if rangeQueries[i] != windowQueries[i] {
+			t.Errorf("expected query %s; got %s", windowQueries[i], rangeQueries[i])
+		}
+	}
+
+	// Illegal ranges
+	if _, err := a.computeClusterCostsRange(context.Background(), rangeClient, provider, now, end, start); err == nil {
+		t.Errorf("expected error for start after end")
+	}
+	if _, err := a.computeClusterCostsRange(context.Background(), rangeClient, provider, now, start, now.Add(time.Hour)); err == nil {
+		t.Errorf("expected error for end in the future")
+	}
+}
+
+func TestComputeCostsBy(t *testing.T) {
+	vector := func(value float64) string {
+		return fmt.Sprintf(`[{"metric":{"tenant":"tenant1"},"value":[1609459200,"%f"]},{"metric":{"tenant":"tenant2"},"value":[1609459200,"%f"]}]`, value, 2*value)
+	}
+
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "count_over_time(sum(kube_node_status_capacity_cpu_cores)", Result: vector(24 * 60)},
+			{Match: "sum_over_time(node_gpu_hourly_cost", Result: vector(0.0)},
+			{Match: "node_cpu_hourly_cost", Result: vector(10.0)},
+			{Match: "node_ram_hourly_cost", Result: vector(5.0)},
+			{Match: "pv_hourly_cost", Result: vector(1.0)},
+		},
+	}
+
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	costs, err := a.ComputeCostsBy(context.Background(), client, provider, "tenant", 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(costs) != 2 {
+		t.Fatalf("expected costs for 2 tenants; got %d", len(costs))
+	}
+	for tenant, cpu := range map[string]float64{"tenant1": 10.0, "tenant2": 20.0} {
+		cc, ok := costs[tenant]
+		if !ok {
+			t.Fatalf("expected costs for %s", tenant)
+		}
+		if !util.IsApproximately(cc.CPUCumulative, cpu) {
+			t.Errorf("expected %s CPU cost %f; got %f", tenant, cpu, cc.CPUCumulative)
+		}
+	}
+
+	for _, query := range client.Queries() {
+		if strings.Contains(query, env.GetPromClusterLabel()) {
+			t.Errorf("expected query not to group by %s: %s", env.GetPromClusterLabel(), query)
+		}
+	}
+	if !strings.Contains(strings.Join(client.Queries(), "\n"), "by (tenant)") {
+		t.Errorf("expected queries to group by tenant")
+	}
+
+	// Illegal labels
+	for _, label := range []string{"", "tenant-id", "1tenant"} {
+		if _, err := a.ComputeCostsBy(context.Background(), client, provider, label, 24*time.Hour, 0); err == nil {
+			t.Errorf("expected error for group label %q", label)
+		}
+	}
+}
+
+func TestComputeClusterCosts_LabelMask(t *testing.T) {
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_cpu_hourly_cost", Result: `[{"metric":{"customer_id":"acme"},"value":[1609459200,"10"]},{"metric":{"customer_id":"globex"},"value":[1609459200,"20"]}]`},
+		},
+	}
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{
+		GroupLabel: "customer_id",
+		LabelMask:  []string{"customer_id"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(costs) != 2 {
+		t.Fatalf("expected masked costs to remain distinct; got %v", costs)
+	}
+	for key := range costs {
+		if !strings.HasPrefix(key, maskedLabelPrefix) || strings.Contains(key, "acme") || strings.Contains(key, "globex") {
+			t.Errorf("expected masked key; got %s", key)
+		}
+	}
+	cc, ok := costs[maskLabelValue("globex")]
+	if !ok || !util.IsApproximately(cc.CPUCumulative, 20.0) {
+		t.Errorf("expected costs keyed by the pseudonym of globex; got %v", costs)
+	}
+
+	// Unmasked labels are unaffected
+	costs, err = a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{
+		GroupLabel: "customer_id",
+		LabelMask:  []string{"team"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := costs["acme"]; !ok {
+		t.Errorf("expected unmasked costs keyed by acme; got %v", costs)
+	}
+
+	// ComputeCostsBy masks its groups likewise
+	costs, err = a.ComputeCostsByWithOptions(context.Background(), client, provider, "customer_id", 24*time.Hour, 0, &ClusterCostsOptions{
+		LabelMask: []string{"customer_id"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := costs[maskLabelValue("acme")]; !ok || len(costs) != 2 {
+		t.Errorf("expected costs keyed by the pseudonyms of acme and globex; got %v", costs)
+	}
+}
+
+func TestClusterCostsByNodePool_LabelMask(t *testing.T) {
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_cpu_hourly_cost", Result: `[
+				{"metric":{"cluster_id":"cluster1","label_customer_id":"acme"},"value":[1609459200,"10"]},
+				{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"5"]}
+			]`},
+		},
+	}
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+
+	costs, err := ClusterCostsByNodePoolWithOptions(client, provider, 24*time.Hour, 0, "customer_id", &ClusterCostsOptions{
+		LabelMask: []string{"customer_id"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	pools := costs["cluster1"]
+	if _, ok := pools["acme"]; ok {
+		t.Errorf("expected masked node pool acme; got %v", pools)
+	}
+	if cc, ok := pools[maskLabelValue("acme")]; !ok || !util.IsApproximately(cc.CPUCumulative, 10.0) {
+		t.Errorf("expected costs keyed by the pseudonym of acme; got %v", pools)
+	}
+	if _, ok := pools[UnallocatedSubfield]; !ok {
+		t.Errorf("expected unallocated costs to remain unmasked; got %v", pools)
+	}
+}
+
+func TestCostPerPod(t *testing.T) {
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	client.responses = append(client.responses, mockPromResponse{
+		Match:  `kube_pod_status_phase{phase="Running"}`,
+		Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"8"]}]`,
+	})
+
+	costPerPod, err := a.CostPerPod(client, provider, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// $16 over 24 hours is $16 / 24 * 730 per month, across 8 pods
+	expected := 16.0 / 24.0 * timeutil.HoursPerMonth / 8.0
+	if !util.IsApproximately(costPerPod["cluster1"], expected) {
+		t.Errorf("expected cost per pod %f; got %f", expected, costPerPod["cluster1"])
+	}
+
+	// Clusters without running pods are omitted
+	client = newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	client.responses = append(client.responses, mockPromResponse{
+		Match:  `kube_pod_status_phase{phase="Running"}`,
+		Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"0"]}]`,
+	})
+	costPerPod, err = a.CostPerPod(client, provider, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := costPerPod["cluster1"]; ok {
+		t.Errorf("expected no cost per pod for cluster without pods; got %f", costPerPod["cluster1"])
+	}
+}
+
+func TestComputeClusterCosts_InvalidLocalStorageQuery(t *testing.T) {
+	provider := &mockLocalStorageProvider{
+		mockProvider: mockProvider{config: &cloud.CustomPricing{}},
+		query:        `sum(container_fs_limit_bytes{id="/"}) by (cluster_id * 0.04`,
+	}
+	a := &Accesses{CloudProvider: provider}
+
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	_, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, nil)
+	if err == nil {
+		t.Fatalf("expected error for invalid local storage query")
+	}
+	if !strings.Contains(err.Error(), "mockLocalStorageProvider") || !strings.Contains(err.Error(), "local storage query") {
+		t.Errorf("expected error naming the provider and local storage query; got %s", err)
+	}
+	if len(client.Queries()) != 0 {
+		t.Errorf("expected no queries to be sent; got %d", len(client.Queries()))
+	}
+
+	if _, err := ClusterCostsOverTime(client, provider, "2021-01-01T00:00:00.000Z", "2021-01-02T00:00:00.000Z", time.Hour, 0); err == nil {
+		t.Errorf("expected error for invalid local storage query over time")
+	}
+
+	// A valid query is accepted
+	provider.query = `sum(container_fs_limit_bytes{id="/"}) by (cluster_id) * 0.04`
+	if _, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, nil); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestComputeClusterCosts_StorageUsedExceedsCapacity(t *testing.T) {
+	provider := &mockLocalStorageProvider{
+		mockProvider: mockProvider{config: &cloud.CustomPricing{}},
+		query:        `sum(container_fs_limit_bytes) by (cluster_id)`,
+		usedQuery:    `sum(container_fs_usage_bytes) by (cluster_id)`,
+	}
+	a := &Accesses{CloudProvider: provider}
+
+	// Used local storage cost of 5.0 exceeds the total storage cost of 3.0
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	client.responses = append([]mockPromResponse{
+		{Match: "container_fs_limit_bytes", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"2"]}]`},
+		{Match: "container_fs_usage_bytes", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"5"]}]`},
+	}, client.responses...)
+
+	logger := &mockLogger{}
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{WithBreakdown: true, Logger: logger})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	bd := costs["cluster1"].StorageBreakdown
+	if bd.User != 1.0 || bd.Idle != 0.0 {
+		t.Errorf("expected used fraction capped at 1.0 with no idle; got user %f, idle %f", bd.User, bd.Idle)
+	}
+
+	warned := false
+	for _, msg := range logger.warn {
+		if strings.Contains(msg, "used storage cost exceeds storage cost") {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Errorf("expected a warning for used storage exceeding capacity; got %v", logger.warn)
+	}
+}
+
+func TestComputeClusterCosts_ZeroPricedWarning(t *testing.T) {
+	// CPU has capacity, but a zero price; RAM has a price, but no capacity
+	client := newMockClusterCostsClient(0.0, 5.0, 0.0, 1.0)
+	client.responses = append([]mockPromResponse{
+		{Match: "sum(avg_over_time(kube_node_status_capacity_cpu_cores[", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"4"]}]`},
+	}, client.responses...)
+
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	logger := &mockLogger{}
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{Logger: logger})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Capacity is not queried by default
+	if cc := costs["cluster1"]; cc == nil || len(cc.Warnings) != 0 || cc.ZeroPricedResources != nil {
+		t.Errorf("expected no zero price warnings by default; got %v", cc)
+	}
+	for _, query := range client.Queries() {
+		if strings.Contains(query, "kube_node_status_capacity{") {
+			t.Errorf("expected no GPU capacity query by default; got: %s", query)
+		}
+	}
+
+	costs, err = a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{Logger: logger, WithZeroPriceWarnings: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cc, ok := costs["cluster1"]
+	if !ok {
+		t.Fatalf("expected costs for cluster1")
+	}
+	if len(cc.Warnings) != 1 || !strings.HasPrefix(cc.Warnings[0], "cpu ") {
+		t.Errorf("expected a single cpu warning; got %v", cc.Warnings)
+	}
+	if len(cc.ZeroPricedResources) != 1 || cc.ZeroPricedResources[0] != "cpu" {
+		t.Errorf("expected zero-priced resources [cpu]; got %v", cc.ZeroPricedResources)
+	}
+}
+
+func TestBuildZeroPricedResources(t *testing.T) {
+	capacity := func(value float64) []*prom.QueryResult {
+		return []*prom.QueryResult{{
+			Metric: map[string]interface{}{"cluster_id": "cluster1"},
+			Values: []*util.Vector{{Timestamp: 1609459200, Value: value}},
+		}}
+	}
+
+	costData := map[string]map[string]float64{
+		"cluster1": {"cpu": 0.0, "ram": 10.0},
+	}
+
+	zeroPriced := buildZeroPricedResources(costData, "cluster_id", "cluster1", map[string][]*prom.QueryResult{
+		"cpu": capacity(4.0),
+		"ram": capacity(1024.0),
+		"gpu": capacity(0.0),
+	})
+
+	if len(zeroPriced["cluster1"]) != 1 || zeroPriced["cluster1"][0] != "cpu" {
+		t.Errorf("expected only cpu to be zero-priced; got %v", zeroPriced["cluster1"])
+	}
+}
+
+func TestClusterCostsByNodePool(t *testing.T) {
+	// pool-a and pool-b nodes, and a node missing from kube_node_labels
+	poolCosts := func(a, b, unlabeled float64) string {
+		return fmt.Sprintf(`[
+			{"metric":{"cluster_id":"cluster1","label_cloud_google_com_gke_nodepool":"pool-a"},"value":[1609459200,"%f"]},
+			{"metric":{"cluster_id":"cluster1","label_cloud_google_com_gke_nodepool":"pool-b"},"value":[1609459200,"%f"]},
+			{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"%f"]}
+		]`, a, b, unlabeled)
+	}
+
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_cpu_hourly_cost", Result: poolCosts(6.0, 4.0, 1.0)},
+			{Match: "node_ram_hourly_cost", Result: poolCosts(3.0, 2.0, 1.0)},
+			{Match: "node_gpu_hourly_cost", Result: poolCosts(0.0, 5.0, 0.0)},
+		},
+	}
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+
+	costs, err := ClusterCostsByNodePool(client, provider, 24*time.Hour, 0, "cloud.google.com/gke-nodepool")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	pools, ok := costs["cluster1"]
+	if !ok || len(pools) != 3 {
+		t.Fatalf("expected costs for two pools and unallocated nodes of cluster1; got %v", costs)
+	}
+
+	if !util.IsApproximately(pools["pool-a"].TotalCumulative, 9.0) {
+		t.Errorf("expected pool-a total %f; got %f", 9.0, pools["pool-a"].TotalCumulative)
+	}
+	if !util.IsApproximately(pools["pool-b"].TotalCumulative, 11.0) {
+		t.Errorf("expected pool-b total %f; got %f", 11.0, pools["pool-b"].TotalCumulative)
+	}
+	if !util.IsApproximately(pools[UnallocatedSubfield].TotalCumulative, 2.0) {
+		t.Errorf("expected unallocated total %f; got %f", 2.0, pools[UnallocatedSubfield].TotalCumulative)
+	}
+
+	for _, query := range client.Queries() {
+		if !strings.Contains(query, "group_left(label_cloud_google_com_gke_nodepool)") {
+			t.Errorf("expected query to join node pool label: %s", query)
+		}
+		if !strings.Contains(query, "or on (node, cluster_id)") {
+			t.Errorf("expected query to keep nodes missing from kube_node_labels: %s", query)
+		}
+	}
+
+	// Pool totals sum to the total of the same nodes computed for the cluster
+	// as a whole, which has no storage
+	a := &Accesses{CloudProvider: provider}
+	clusterCosts, err := a.ComputeClusterCosts(newMockClusterCostsClient(11.0, 6.0, 5.0, 0.0), provider, 24*time.Hour, 0, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	clusterTotal := clusterCosts["cluster1"].TotalCumulative
+
+	total := 0.0
+	for _, pc := range pools {
+		total += pc.TotalCumulative
+	}
+	if !util.IsApproximately(total, clusterTotal) {
+		t.Errorf("expected pool totals to sum to cluster total %f; got %f", clusterTotal, total)
+	}
+
+	// A pool label is required for providers without a default
+	if _, err := ClusterCostsByNodePool(client, provider, 24*time.Hour, 0, ""); err == nil {
+		t.Errorf("expected error without pool label")
+	}
+}
+
+func TestClusterCostsOverTime_MaxRangePoints(t *testing.T) {
+	os.Setenv(env.MaxQueryRangePointsEnvVar, "24")
+	defer os.Unsetenv(env.MaxQueryRangePointsEnvVar)
+
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_cpu_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"100"]]}]`},
+			{Match: "node_ram_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"50"]]}]`},
+			{Match: "node_total_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"150"]]}]`},
+		},
+	}
+
+	// 24 hours at a 1h step is 25 points, counting both start and end
+	_, err := ClusterCostsOverTime(client, &mockProvider{}, "2021-01-01T00:00:00.000Z", "2021-01-02T00:00:00.000Z", time.Hour, 0)
+	if err == nil {
+		t.Errorf("expected error for range exceeding maximum points")
+	}
+	if len(client.Queries()) > 0 {
+		t.Errorf("expected no queries for range exceeding maximum points; got %d", len(client.Queries()))
+	}
+
+	// 23 hours at a 1h step is 24 points, exactly the maximum
+	_, err = ClusterCostsOverTime(client, &mockProvider{}, "2021-01-01T00:00:00.000Z", "2021-01-01T23:00:00.000Z", time.Hour, 0)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	// Ranges not a multiple of the step are evaluated at each whole step
+	os.Setenv(env.MaxQueryRangePointsEnvVar, "2")
+	_, err = ClusterCostsOverTime(client, &mockProvider{}, "2021-01-01T00:00:00.000Z", "2021-01-01T01:30:00.000Z", time.Hour, 0)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestClusterCosts_WriteInfluxLineProtocol(t *testing.T) {
+	cc := &ClusterCosts{
+		CPUCumulative:   10.0,
+		CPUMonthly:      300.0,
+		CPUBreakdown:    &ClusterCostsBreakdown{Idle: 0.5, User: 0.5},
+		RAMCumulative:   5.5,
+		TotalCumulative: 15.5,
+		TotalMonthly:    465.0,
+	}
+	ts := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	if err := cc.WriteInfluxLineProtocol(&buf, "prod, us=east", ts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	line := buf.String()
+	if !strings.HasSuffix(line, "\n") || strings.Count(line, "\n") != 1 {
+		t.Fatalf("expected a single line; got %q", line)
+	}
+
+	// Split into measurement and tags, fields, and timestamp on unescaped spaces
+	var parts []string
+	var part strings.Builder
+	escaped := false
+	for _, r := range strings.TrimSuffix(line, "\n") {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ' ':
+			parts = append(parts, part.String())
+			part.Reset()
+			continue
+		}
+		part.WriteRune(r)
+	}
+	parts = append(parts, part.String())
+	if len(parts) != 3 {
+		t.Fatalf("expected measurement, fields, and timestamp; got %q", line)
+	}
+
+	if parts[0] != `cluster_cost,cluster_id=prod\,\ us\=east` {
+		t.Errorf("expected measurement cluster_cost with escaped cluster_id tag; got %s", parts[0])
+	}
+
+	fields := map[string]string{}
+	for _, field := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			t.Fatalf("illegal field: %s", field)
+		}
+		fields[kv[0]] = kv[1]
+	}
+	expected := map[string]string{
+		"cpu_cumulative_cost":   "10",
+		"cpu_monthly_cost":      "300",
+		"ram_cumulative_cost":   "5.5",
+		"gpu_cumulative_cost":   "0",
+		"total_cumulative_cost": "15.5",
+		"total_monthly_cost":    "465",
+		"cpu_breakdown_idle":    "0.5",
+		"cpu_breakdown_user":    "0.5",
+	}
+	for field, value := range expected {
+		if fields[field] != value {
+			t.Errorf("expected field %s=%s; got %s", field, value, fields[field])
+		}
+	}
+	if _, ok := fields["ram_breakdown_idle"]; ok {
+		t.Errorf("expected no fields for missing RAM breakdown")
+	}
+
+	if parts[2] != fmt.Sprintf("%d", ts.UnixNano()) {
+		t.Errorf("expected timestamp %d; got %s", ts.UnixNano(), parts[2])
+	}
+
+	if err := cc.WriteInfluxLineProtocol(&buf, "", ts); err == nil {
+		t.Errorf("expected error for empty cluster ID")
+	}
+}
+
+func TestClusterCosts_WritePrometheus(t *testing.T) {
+	day := &ClusterCosts{Window: "1d", CPUCumulative: 10.0, TotalCumulative: 10.0}
+	week := &ClusterCosts{Window: "7d", CPUCumulative: 70.0, TotalCumulative: 70.0}
+
+	var buf bytes.Buffer
+	if err := day.WritePrometheus(&buf, "cluster1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := week.WritePrometheus(&buf, "cluster1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Series of both windows coexist, distinguished by the window label
+	series := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		i := strings.LastIndex(line, " ")
+		if i < 0 {
+			t.Fatalf("illegal sample: %s", line)
+		}
+		if _, ok := series[line[:i]]; ok {
+			t.Errorf("duplicate series: %s", line[:i])
+		}
+		series[line[:i]] = line[i+1:]
+	}
+	if v := series[`cluster_cpu_cumulative_cost{cluster_id="cluster1",window="1d"}`]; v != "10" {
+		t.Errorf("expected 1d CPU cost 10; got %q", v)
+	}
+	if v := series[`cluster_cpu_cumulative_cost{cluster_id="cluster1",window="7d"}`]; v != "70" {
+		t.Errorf("expected 7d CPU cost 70; got %q", v)
+	}
+
+	// Label values are escaped
+	buf.Reset()
+	odd := &ClusterCosts{Window: "1d\"x"}
+	if err := odd.WritePrometheus(&buf, "cluster1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(buf.String(), `window="1d\"x"`) {
+		t.Errorf("expected escaped window label; got %s", buf.String())
+	}
+
+	if err := day.WritePrometheus(&buf, ""); err == nil {
+		t.Errorf("expected error for empty cluster ID")
+	}
+}
+
+func TestClusterCosts_ToAllocation(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	cc := &ClusterCosts{
+		Start:             &start,
+		End:               &end,
+		CPUCumulative:     10.0,
+		GPUCumulative:     4.0,
+		RAMCumulative:     5.0,
+		StorageCumulative: 1.0,
+		TotalCumulative:   20.0,
+	}
+
+	alloc := cc.ToAllocation("cluster1")
+
+	if alloc.Name != "cluster1" || alloc.Properties.Cluster != "cluster1" {
+		t.Errorf("expected allocation for cluster1; got name %s, cluster %s", alloc.Name, alloc.Properties.Cluster)
+	}
+	if alloc.CPUCost != 10.0 || alloc.GPUCost != 4.0 || alloc.RAMCost != 5.0 || alloc.PVCost() != 1.0 {
+		t.Errorf("expected costs (cpu, gpu, ram, pv) = (10, 4, 5, 1); got (%f, %f, %f, %f)", alloc.CPUCost, alloc.GPUCost, alloc.RAMCost, alloc.PVCost())
+	}
+	if !util.IsApproximately(alloc.TotalCost(), cc.TotalCumulative) {
+		t.Errorf("expected total cost %f; got %f", cc.TotalCumulative, alloc.TotalCost())
+	}
+
+	windowJSON, err := alloc.Window.MarshalJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := `{"start":"2021-01-01T00:00:00Z","end":"2021-01-02T00:00:00Z"}`
+	if string(windowJSON) != expected {
+		t.Errorf("expected window %s; got %s", expected, windowJSON)
+	}
+}
+
+func TestComputeClusterCosts_NodeCount(t *testing.T) {
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	client.responses = append([]mockPromResponse{
+		{Match: "count(max(max_over_time(kube_node_status_capacity_cpu_cores", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"3"]}]`},
+	}, client.responses...)
+
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{WithNodeCount: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if costs["cluster1"].NodeCount != 3 {
+		t.Errorf("expected NodeCount %d; got %d", 3, costs["cluster1"].NodeCount)
+	}
+}
+
+func TestComputeClusterCosts_CountersAccumulatedWithRate(t *testing.T) {
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	// node_cpu_seconds_total is a counter, which resets when nodes restart, so
+	// must only ever be accumulated by rate, never by sum_over_time or by
+	// subtracting samples
+	for _, agg := range []CPUModeAggregation{CPUModeAggregationRate, CPUModeAggregationAvg} {
+		client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+
+		_, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{
+			WithBreakdown:      true,
+			CPUModeAggregation: agg,
+		})
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %s", agg, err)
+		}
+
+		found := false
+		for _, query := range client.Queries() {
+			n := strings.Count(query, "node_cpu_seconds_total")
+			if n == 0 {
+				continue
+			}
+			found = true
+			if rates := strings.Count(query, "rate(node_cpu_seconds_total["); rates != n {
+				t.Errorf("%d: expected node_cpu_seconds_total to be accumulated by rate; got %s", agg, query)
+			}
+		}
+		if !found {
+			t.Errorf("%d: expected a node_cpu_seconds_total query", agg)
+		}
+	}
+}
+
+func TestComputeClusterCosts_WithCapacity(t *testing.T) {
+	// 16 cores, 64GiB of RAM, and 250GiB of storage, on average
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	client.responses = append([]mockPromResponse{
+		{Match: "sum(avg_over_time(kube_node_status_capacity_cpu_cores[", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"16"]}]`},
+		{Match: "sum(avg_over_time(kube_node_status_capacity_memory_bytes[", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"68719476736"]}]`},
+		{Match: "sum(avg_over_time(kube_persistentvolume_capacity_bytes[", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"268435456000"]}]`},
+	}, client.responses...)
+
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{WithCapacity: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cc := costs["cluster1"]
+	if !util.IsApproximately(cc.ProvisionedCPU, 16.0) {
+		t.Errorf("expected 16 provisioned cores; got %f", cc.ProvisionedCPU)
+	}
+	if !util.IsApproximately(cc.ProvisionedRAMGiB, 64.0) {
+		t.Errorf("expected 64GiB provisioned RAM; got %f", cc.ProvisionedRAMGiB)
+	}
+	if !util.IsApproximately(cc.ProvisionedStorageGiB, 250.0) {
+		t.Errorf("expected 250GiB provisioned storage; got %f", cc.ProvisionedStorageGiB)
+	}
+
+	// Capacity is opt-in, and storage capacity is not queried otherwise
+	client.queries = nil
+	costs, err = a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cc := costs["cluster1"]; cc.ProvisionedCPU != 0 || cc.ProvisionedRAMGiB != 0 || cc.ProvisionedStorageGiB != 0 {
+		t.Errorf("expected no capacity without WithCapacity; got %f, %f, %f", cc.ProvisionedCPU, cc.ProvisionedRAMGiB, cc.ProvisionedStorageGiB)
+	}
+	for _, query := range client.Queries() {
+		if strings.Contains(query, "sum(avg_over_time(kube_persistentvolume_capacity_bytes[") {
+			t.Errorf("expected no storage capacity query without WithCapacity")
+		}
+	}
+}
+
+func TestComputeClusterCosts_QueryOverrides(t *testing.T) {
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	client.responses = append([]mockPromResponse{
+		{Match: "my_ram_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"7"]}]`},
+	}, client.responses...)
+
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, time.Hour, &ClusterCostsOptions{
+		QueryOverrides: map[string]string{"ram": `sum(sum_over_time(my_ram_cost[%s:5m]%s)) by (cluster_id)`},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cc := costs["cluster1"]
+	if !util.IsApproximately(cc.RAMCumulative, 7.0) {
+		t.Errorf("expected overridden RAM cost 7.0; got %f", cc.RAMCumulative)
+	}
+	if !util.IsApproximately(cc.CPUCumulative, 10.0) {
+		t.Errorf("expected default CPU cost 10.0; got %f", cc.CPUCumulative)
+	}
+
+	queries := strings.Join(client.Queries(), "\n")
+	if !strings.Contains(queries, "sum(sum_over_time(my_ram_cost[24h0m0s:5m]offset 1h)) by (cluster_id)") {
+		t.Errorf("expected override to be filled with window and offset; got:\n%s", queries)
+	}
+	if strings.Contains(queries, "node_ram_hourly_cost") {
+		t.Errorf("expected default RAM query to be replaced")
+	}
+
+	illegal := []map[string]string{
+		{"network": `sum(my_network_cost[%s]%s)`},
+		{"ram": ""},
+		{"ram": `sum(my_ram_cost[%s])`},
+		{"ram": `sum(my_ram_cost[%s]%s) * %d`},
+	}
+	for _, overrides := range illegal {
+		if _, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{QueryOverrides: overrides}); err == nil {
+			t.Errorf("expected error for query overrides %v", overrides)
+		}
+	}
+}
+
+func TestComputeClusterCosts_DefaultClusterID(t *testing.T) {
+	// Series without the cluster label are keyed by the default cluster ID
+	unlabeled := func(value float64) string {
+		return fmt.Sprintf(`[{"metric":{},"value":[1609459200,"%f"]}]`, value)
+	}
+	newClient := func() *mockPromClient {
+		return &mockPromClient{
+			responses: []mockPromResponse{
+				{Match: "count_over_time(sum(kube_node_status_capacity_cpu_cores)", Result: unlabeled(24 * 60)},
+				{Match: "node_cpu_hourly_cost", Result: unlabeled(10.0)},
+				{Match: "node_ram_hourly_cost", Result: unlabeled(5.0)},
+			},
+		}
+	}
+
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		for _, clusterID := range []string{"alpha", "beta"} {
+			wg.Add(1)
+			go func(clusterID string) {
+				defer wg.Done()
+				costs, err := a.ComputeClusterCostsWithOptions(newClient(), provider, 24*time.Hour, 0, &ClusterCostsOptions{DefaultClusterID: clusterID})
+				if err != nil {
+					errs <- err
+					return
+				}
+				if len(costs) != 1 || costs[clusterID] == nil {
+					errs <- fmt.Errorf("expected costs keyed only by %s; got %d clusters", clusterID, len(costs))
+				}
+			}(clusterID)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Defaults to the cluster ID from the environment
+	costs, err := a.ComputeClusterCostsWithOptions(newClient(), provider, 24*time.Hour, 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := costs[env.GetClusterIDOrDefault()]; !ok || len(costs) != 1 {
+		t.Errorf("expected costs keyed by the environment's cluster ID %q", env.GetClusterIDOrDefault())
+	}
+
+	// Without a cluster ID in the environment, costs are keyed by the default
+	// cluster ID, but the environment's cluster ID remains unset for other
+	// consumers, e.g. cluster metadata and allocation keys
+	if clusterID, ok := os.LookupEnv(env.ClusterIDEnvVar); ok {
+		defer os.Setenv(env.ClusterIDEnvVar, clusterID)
+	}
+	os.Unsetenv(env.ClusterIDEnvVar)
+
+	costs, err = a.ComputeClusterCostsWithOptions(newClient(), provider, 24*time.Hour, 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := costs[env.DefaultClusterID]; !ok || len(costs) != 1 {
+		t.Errorf("expected costs keyed by the default cluster ID %q; got %v", env.DefaultClusterID, costs)
+	}
+	if clusterID := env.GetClusterID(); clusterID != "" {
+		t.Errorf("expected no cluster ID in the environment; got %q", clusterID)
+	}
+	res := &prom.QueryResult{Metric: map[string]interface{}{"namespace": "ns", "pod": "pod"}}
+	if key, err := resultPodKey(res, env.GetPromClusterLabel(), "namespace"); err != nil || key.Cluster != "" {
+		t.Errorf("expected allocation key without a cluster ID; got %v, %v", key, err)
+	}
+}
+
+func TestClusterCostsOptions_DefaultClusterID(t *testing.T) {
+	// Every function taking ClusterCostsOptions keys series without the
+	// cluster label by DefaultClusterID
+	unlabeled := `[{"metric":{"label_pool":"pool-a","value":"gpu"},"value":[1609459200,"1"]}]`
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_total_hourly_cost", Result: `[{"metric":{},"values":[[1609459200,"1"]]}]`},
+			{Match: "node_cpu_hourly_cost", Result: unlabeled},
+			{Match: "node_ram_hourly_cost", Result: unlabeled},
+		},
+	}
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	opts := &ClusterCostsOptions{
+		DefaultClusterID: "alpha",
+		Clock:            &timeutil.FakeClock{T: time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)},
+	}
+
+	pools, err := ClusterCostsByNodePoolWithOptions(client, provider, 24*time.Hour, 0, "pool", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := pools["alpha"]; !ok || len(pools) != 1 {
+		t.Errorf("expected node pool costs keyed by alpha; got %v", pools)
+	}
+
+	taints, err := CostByNodeTaintWithOptions(client, provider, "dedicated", 24*time.Hour, 0, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := taints["alpha"]; !ok || len(taints) != 1 {
+		t.Errorf("expected taint costs keyed by alpha; got %v", taints)
+	}
+
+	sparklines, err := ClusterCostSparkline(context.Background(), client, provider, 1, 24*time.Hour, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := sparklines["alpha"]; !ok || len(sparklines) != 1 {
+		t.Errorf("expected sparklines keyed by alpha; got %v", sparklines)
+	}
+}
+func TestComputeClusterCosts_OnProgress(t *testing.T) {
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	// Calls are made from a single goroutine, so need no synchronization
+	var completed []int
+	var totals []int
+	_, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{
+		WithBreakdown: true,
+		WithNodeCount: true,
+		OnProgress: func(c, total int) {
+			completed = append(completed, c)
+			totals = append(totals, total)
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	numQueries := len(client.Queries())
+	if len(completed) != numQueries {
+		t.Fatalf("expected %d progress calls; got %d", numQueries, len(completed))
+	}
+	for i := range completed {
+		if completed[i] != i+1 {
+			t.Errorf("expected call %d to report %d completed; got %d", i, i+1, completed[i])
+		}
+		if totals[i] != numQueries {
+			t.Errorf("expected call %d to report %d total; got %d", i, numQueries, totals[i])
+		}
+	}
+}
+
+func TestClusterCosts_ResourceShares(t *testing.T) {
+	cc, err := NewClusterCostsFromCumulative(9.0, 2.0, 6.0, 3.0, 24*time.Hour, 0, 24.0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	shares := cc.ResourceShares()
+	if !util.IsApproximately(shares.CPUSharePct, 0.45) {
+		t.Errorf("expected CPU share %f; got %f", 0.45, shares.CPUSharePct)
+	}
+
+	sum := shares.CPUSharePct + shares.GPUSharePct + shares.RAMSharePct + shares.StorageSharePct
+	if !util.IsApproximately(sum, 1.0) {
+		t.Errorf("expected shares to sum to 1.0; got %f", sum)
+	}
+
+	// Zero total cost results in zero shares, rather than NaN
+	shares = (&ClusterCosts{}).ResourceShares()
+	if shares.CPUSharePct != 0 || shares.GPUSharePct != 0 || shares.RAMSharePct != 0 || shares.StorageSharePct != 0 {
+		t.Errorf("expected zero shares for zero total cost; got %+v", *shares)
+	}
+}
+
+func TestComputeClusterCosts_QueryTimeout(t *testing.T) {
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	_, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{QueryTimeout: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	params := client.Params()
+	if len(params) == 0 {
+		t.Fatalf("expected queries")
+	}
+	for _, p := range params {
+		if timeout := p.Get("timeout"); timeout != "30.000" {
+			t.Errorf("expected timeout 30.000 for query %s; got %q", p.Get("query"), timeout)
+		}
+	}
+}
+
+func TestComputeClusterCosts_ExcludeGPU(t *testing.T) {
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	costs, err := a.ComputeClusterCostsWithOptions(newMockClusterCostsClient(10.0, 5.0, 4.0, 1.0), provider, 24*time.Hour, 0, &ClusterCostsOptions{ExcludeGPU: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cc := costs["cluster1"]
+	if !util.IsApproximately(cc.GPUCumulative, 4.0) || cc.GPUMonthly == 0 {
+		t.Errorf("expected GPU costs to be reported; got cumulative %f, monthly %f", cc.GPUCumulative, cc.GPUMonthly)
+	}
+	if !util.IsApproximately(cc.TotalCumulative, 16.0) {
+		t.Errorf("expected TotalCumulative %f excluding GPU; got %f", 16.0, cc.TotalCumulative)
+	}
+	if !util.IsApproximately(cc.TotalMonthly, cc.CPUMonthly+cc.RAMMonthly+cc.StorageMonthly) {
+		t.Errorf("expected TotalMonthly %f excluding GPU; got %f", cc.CPUMonthly+cc.RAMMonthly+cc.StorageMonthly, cc.TotalMonthly)
+	}
+
+	// Shares are of all resources, so are unaffected by the exclusion
+	shares := cc.ResourceShares()
+	if !util.IsApproximately(shares.GPUSharePct, 0.2) {
+		t.Errorf("expected GPU share %f; got %f", 0.2, shares.GPUSharePct)
+	}
+
+	// GPU is included by default
+	costs, err = a.ComputeClusterCostsWithOptions(newMockClusterCostsClient(10.0, 5.0, 4.0, 1.0), provider, 24*time.Hour, 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !util.IsApproximately(costs["cluster1"].TotalCumulative, 20.0) {
+		t.Errorf("expected TotalCumulative %f including GPU; got %f", 20.0, costs["cluster1"].TotalCumulative)
+	}
+}
+
+func TestComputeClusterCosts_ProjectionConfidence(t *testing.T) {
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	costs, err := a.ComputeClusterCostsWithOptions(newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0), provider, 5*time.Minute, 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cc := costs["cluster1"]
+	if cc.ProjectionConfidence != ProjectionConfidenceLow {
+		t.Errorf("expected %s confidence for sub-threshold window; got %s", ProjectionConfidenceLow, cc.ProjectionConfidence)
+	}
+	if cc.TotalMonthly == 0 {
+		t.Errorf("expected monthly costs to be computed")
+	}
+	if len(cc.Warnings) != 1 || !strings.Contains(cc.Warnings[0], "shorter than the minimum") {
+		t.Errorf("expected a projection window warning; got %v", cc.Warnings)
+	}
+
+	cases := []struct {
+		window   time.Duration
+		dataMins float64
+		expected ProjectionConfidence
+	}{
+		{30 * time.Minute, 30, ProjectionConfidenceLow},
+		{7 * 24 * time.Hour, 1440, ProjectionConfidenceLow},
+		{6 * time.Hour, 360, ProjectionConfidenceMedium},
+		{48 * time.Hour, 2000, ProjectionConfidenceMedium},
+		{48 * time.Hour, 2880, ProjectionConfidenceHigh},
+	}
+	for _, c := range cases {
+		if conf := projectionConfidence(c.window, c.dataMins, DefaultMinProjectionWindow); conf != c.expected {
+			t.Errorf("expected %s confidence for window %s with %.0f data minutes; got %s", c.expected, c.window, c.dataMins, conf)
+		}
+	}
+}
+
+func TestAggregateClusterCosts(t *testing.T) {
+	// One very large cluster and many small clusters, whose costs would be lost
+	// to rounding by naive summation
+	costs := map[string]*ClusterCosts{
+		"cluster0": {CPUCumulative: 1e16, TotalCumulative: 1e16, DataMinutes: 1440, CPUBreakdown: &ClusterCostsBreakdown{Idle: 0.5, User: 0.5}},
+	}
+	reference := new(big.Float).SetPrec(256).SetFloat64(1e16)
+	for i := 1; i < 1000; i++ {
+		cost := 1.0 + float64(i)*0.001
+		costs[fmt.Sprintf("cluster%d", i)] = &ClusterCosts{
+			CPUCumulative:   cost,
+			TotalCumulative: cost,
+			DataMinutes:     1440,
+			CPUBreakdown:    &ClusterCostsBreakdown{Idle: 0.5, User: 0.5},
+		}
+		reference.Add(reference, new(big.Float).SetFloat64(cost))
+	}
+
+	agg := AggregateClusterCosts(costs)
+
+	expected, _ := reference.Float64()
+	if math.Abs(agg.TotalCumulative-expected) > 4.0 {
+		t.Errorf("expected total %f; got %f (error %f)", expected, agg.TotalCumulative, agg.TotalCumulative-expected)
+	}
+	if agg.CPUCumulative != agg.TotalCumulative {
+		t.Errorf("expected CPU cumulative %f; got %f", agg.TotalCumulative, agg.CPUCumulative)
+	}
+	if agg.DataMinutes != 1000*1440 {
+		t.Errorf("expected data minutes %d; got %f", 1000*1440, agg.DataMinutes)
+	}
+	if !util.IsApproximately(agg.CPUBreakdown.Idle, 0.5) || !util.IsApproximately(agg.CPUBreakdown.User, 0.5) {
+		t.Errorf("expected CPU breakdown {idle: 0.5, user: 0.5}; got %+v", *agg.CPUBreakdown)
+	}
+	if agg.RAMBreakdown != nil {
+		t.Errorf("expected no RAM breakdown; got %+v", *agg.RAMBreakdown)
+	}
+
+	if AggregateClusterCosts(nil) != nil {
+		t.Errorf("expected nil aggregate of no costs")
+	}
+}
+
+func TestComputeClusterCosts_EffectiveDiscounts(t *testing.T) {
+	client := newMockClusterCostsClient(10.0, 5.0, 2.0, 1.0)
+	provider := &mockProvider{config: &cloud.CustomPricing{Discount: "30%", NegotiatedDiscount: "10%"}}
+	a := &Accesses{CloudProvider: provider}
+
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// CPU and RAM receive both discounts; GPU and storage only the negotiated
+	// discount: 1 - (1 - 0.3)(1 - 0.1) = 0.37
+	expected := map[string]float64{"cpu": 0.37, "ram": 0.37, "gpu": 0.1, "storage": 0.1}
+	actual := costs["cluster1"].EffectiveDiscounts
+	for resource, discount := range expected {
+		if !util.IsApproximately(actual[resource], discount) {
+			t.Errorf("expected %s discount %f; got %f", resource, discount, actual[resource])
+		}
+	}
+
+	// Costs without effective discounts marshal, too
+	data, err := json.Marshal(&ClusterCosts{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(string(data), `"effectiveDiscounts":null`) {
+		t.Errorf("expected null effective discounts in JSON: %s", data)
+	}
+}
+
+func TestComputeClusterCosts_DiscountByCluster(t *testing.T) {
+	vector := func(cluster1, cluster2 float64) string {
+		return fmt.Sprintf(`[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"%f"]},{"metric":{"cluster_id":"cluster2"},"value":[1609459200,"%f"]}]`, cluster1, cluster2)
+	}
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_cpu_hourly_cost", Result: vector(10.0, 10.0)},
+			{Match: "node_ram_hourly_cost", Result: vector(5.0, 5.0)},
+			{Match: "pv_hourly_cost", Result: vector(2.0, 2.0)},
+		},
+	}
+	provider := &mockProvider{config: &cloud.CustomPricing{Discount: "10%"}}
+	a := &Accesses{CloudProvider: provider}
+
+	// cluster1 has its own discounts; cluster2 receives the provider's
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{
+		DiscountByCluster: map[string]DiscountConfig{
+			"cluster1": {Discount: 0.3, NegotiatedDiscount: 0.5},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := map[string]struct {
+		cpu, ram, storage float64
+		discount          float64
+	}{
+		"cluster1": {cpu: 10.0 * 0.7 * 0.5, ram: 5.0 * 0.7 * 0.5, storage: 2.0 * 0.5, discount: 1.0 - 0.7*0.5},
+		"cluster2": {cpu: 10.0 * 0.9, ram: 5.0 * 0.9, storage: 2.0, discount: 0.1},
+	}
+	for clusterID, exp := range cases {
+		cc, ok := costs[clusterID]
+		if !ok {
+			t.Fatalf("expected costs for %s", clusterID)
+		}
+		if !util.IsApproximately(cc.CPUCumulative, exp.cpu) {
+			t.Errorf("%s: expected CPU cost %f; got %f", clusterID, exp.cpu, cc.CPUCumulative)
+		}
+		if !util.IsApproximately(cc.RAMCumulative, exp.ram) {
+			t.Errorf("%s: expected RAM cost %f; got %f", clusterID, exp.ram, cc.RAMCumulative)
+		}
+		if !util.IsApproximately(cc.StorageCumulative, exp.storage) {
+			t.Errorf("%s: expected storage cost %f; got %f", clusterID, exp.storage, cc.StorageCumulative)
+		}
+		if !util.IsApproximately(cc.EffectiveDiscounts["cpu"], exp.discount) {
+			t.Errorf("%s: expected effective CPU discount %f; got %f", clusterID, exp.discount, cc.EffectiveDiscounts["cpu"])
+		}
+	}
+}
+
+func TestComputeClusterCosts_Markup(t *testing.T) {
+	client := newMockClusterCostsClient(10.0, 5.0, 2.0, 1.0)
+	provider := &mockProvider{config: &cloud.CustomPricing{Discount: "50%"}}
+	a := &Accesses{CloudProvider: provider}
+
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{Markup: 0.15})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cc, ok := costs["cluster1"]
+	if !ok {
+		t.Fatalf("expected costs for cluster1")
+	}
+
+	// The markup applies after discounts
+	if !util.IsApproximately(cc.CPUCumulative, 10.0*0.5*1.15) {
+		t.Errorf("expected CPU cost %f; got %f", 10.0*0.5*1.15, cc.CPUCumulative)
+	}
+	if !util.IsApproximately(cc.RAMCumulative, 5.0*0.5*1.15) {
+		t.Errorf("expected RAM cost %f; got %f", 5.0*0.5*1.15, cc.RAMCumulative)
+	}
+	if !util.IsApproximately(cc.GPUCumulative, 2.0*1.15) {
+		t.Errorf("expected GPU cost %f; got %f", 2.0*1.15, cc.GPUCumulative)
+	}
+	if !util.IsApproximately(cc.StorageCumulative, 1.0*1.15) {
+		t.Errorf("expected storage cost %f; got %f", 1.0*1.15, cc.StorageCumulative)
+	}
+	if !util.IsApproximately(cc.TotalCumulative, 10.5*1.15) {
+		t.Errorf("expected total cost %f; got %f", 10.5*1.15, cc.TotalCumulative)
+	}
+	if cc.Markup != 0.15 {
+		t.Errorf("expected markup %f to be recorded; got %f", 0.15, cc.Markup)
+	}
+
+	// No markup by default
+	costs, err = a.ComputeClusterCostsWithOptions(newMockClusterCostsClient(10.0, 5.0, 2.0, 1.0), provider, 24*time.Hour, 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cc := costs["cluster1"]; cc.Markup != 0.0 || !util.IsApproximately(cc.CPUCumulative, 5.0) {
+		t.Errorf("expected no markup by default; got markup %f and CPU cost %f", cc.Markup, cc.CPUCumulative)
+	}
+
+	if _, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{Markup: -0.1}); err == nil {
+		t.Errorf("expected error for negative markup")
+	}
+}
+
+func TestComputeClusterCosts_ProviderDiscount(t *testing.T) {
+	// The Accesses provider has no discount; the injected provider does
+	a := &Accesses{CloudProvider: &mockProvider{config: &cloud.CustomPricing{}}}
+	provider := &mockProvider{config: &cloud.CustomPricing{Discount: "50%"}}
+
+	costs, err := a.ComputeClusterCostsWithOptions(newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0), provider, 24*time.Hour, 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cc := costs["cluster1"]; !util.IsApproximately(cc.CPUCumulative, 5.0) || !util.IsApproximately(cc.RAMCumulative, 2.5) {
+		t.Errorf("expected discounted CPU, RAM costs %f, %f; got %f, %f", 5.0, 2.5, cc.CPUCumulative, cc.RAMCumulative)
+	}
+
+	// A nil provider falls back to the Accesses provider
+	costs, err = a.ComputeClusterCostsWithOptions(newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0), nil, 24*time.Hour, 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cc := costs["cluster1"]; !util.IsApproximately(cc.CPUCumulative, 10.0) || !util.IsApproximately(cc.RAMCumulative, 5.0) {
+		t.Errorf("expected undiscounted CPU, RAM costs %f, %f; got %f, %f", 10.0, 5.0, cc.CPUCumulative, cc.RAMCumulative)
+	}
+}
+
+func TestNewClusterCostsFromCumulative_WindowOffset(t *testing.T) {
+	cc, err := NewClusterCostsFromCumulative(10.0, 0.0, 5.0, 1.0, 7*24*time.Hour, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if cc.Window != "7d" || cc.Offset != "1d" {
+		t.Errorf("expected window, offset %s, %s; got %s, %s", "7d", "1d", cc.Window, cc.Offset)
+	}
+
+	data, err := json.Marshal(cc)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(string(data), `"window":"7d"`) || !strings.Contains(string(data), `"offset":"1d"`) {
+		t.Errorf("expected window and offset in JSON: %s", data)
+	}
+}
+
+func TestComputeClusterCosts_FakeClock(t *testing.T) {
+	now := time.Date(2021, 1, 10, 12, 30, 0, 0, time.UTC)
+	clock := &timeutil.FakeClock{T: now}
+
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	costs, err := a.ComputeClusterCostsWithOptions(newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0), provider, 24*time.Hour, time.Hour, &ClusterCostsOptions{Clock: clock})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cc, ok := costs["cluster1"]
+	if !ok {
+		t.Fatalf("expected costs for cluster1")
+	}
+	expStart, expEnd := time.Date(2021, 1, 9, 11, 30, 0, 0, time.UTC), time.Date(2021, 1, 10, 11, 30, 0, 0, time.UTC)
+	if !cc.Start.Equal(expStart) || !cc.End.Equal(expEnd) {
+		t.Errorf("expected range [%s, %s]; got [%s, %s]", expStart, expEnd, cc.Start, cc.End)
+	}
+
+	// Aligned windows are aligned relative to the clock, too
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	costs, err = a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{Clock: clock, AlignTo: timeutil.AlignDay})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cc = costs["cluster1"]
+	expStart, expEnd = time.Date(2021, 1, 9, 0, 0, 0, 0, time.UTC), time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	if !cc.Start.Equal(expStart) || !cc.End.Equal(expEnd) {
+		t.Errorf("expected aligned range [%s, %s]; got [%s, %s]", expStart, expEnd, cc.Start, cc.End)
+	}
+	// Queries are pinned to the aligned end time, rather than offset from now,
+	// so they do not drift with the time of evaluation
+	queries := strings.Join(client.Queries(), "\n")
+	if !strings.Contains(queries, fmt.Sprintf("@ %d", expEnd.Unix())) {
+		t.Errorf("expected queries to be pinned to the aligned end time")
+	}
+	if strings.Contains(queries, "offset") {
+		t.Errorf("expected no offset in aligned queries")
+	}
+
+	// Days are aligned in the given location, and last 23h when clocks spring
+	// forward
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no timezone data: %s", err)
+	}
+	clock = &timeutil.FakeClock{T: time.Date(2021, 3, 15, 12, 0, 0, 0, time.UTC)}
+	client = newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	costs, err = a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{Clock: clock, AlignTo: timeutil.AlignDay, Location: ny})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cc = costs["cluster1"]
+	expStart, expEnd = time.Date(2021, 3, 14, 0, 0, 0, 0, ny), time.Date(2021, 3, 15, 0, 0, 0, 0, ny)
+	if !cc.Start.Equal(expStart) || !cc.End.Equal(expEnd) {
+		t.Errorf("expected aligned range [%s, %s]; got [%s, %s]", expStart, expEnd, cc.Start, cc.End)
+	}
+	if !strings.Contains(strings.Join(client.Queries(), "\n"), "[23h0m0s:5m]") {
+		t.Errorf("expected queries over the 23h day")
+	}
+}
+
+func TestComputeClusterCosts_BreakdownByCluster(t *testing.T) {
+	twoClusters := func(a, b float64) string {
+		return fmt.Sprintf(`[
+			{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"%f"]},
+			{"metric":{"cluster_id":"cluster2"},"value":[1609459200,"%f"]}
+		]`, a, b)
+	}
+
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_cpu_seconds_total", Result: `[
+				{"metric":{"cluster_id":"cluster1","mode":"idle"},"value":[1609459200,"0.8"]},
+				{"metric":{"cluster_id":"cluster1","mode":"user"},"value":[1609459200,"0.2"]},
+				{"metric":{"cluster_id":"cluster2","mode":"idle"},"value":[1609459200,"0.3"]},
+				{"metric":{"cluster_id":"cluster2","mode":"user"},"value":[1609459200,"0.7"]}
+			]`},
+			{Match: "count_over_time(sum(kube_node_status_capacity_cpu_cores)", Result: twoClusters(1440, 1440)},
+			{Match: "node_cpu_hourly_cost", Result: twoClusters(10.0, 20.0)},
+			{Match: "node_ram_hourly_cost", Result: twoClusters(5.0, 10.0)},
+		},
+	}
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	costs, err := a.ComputeClusterCosts(client, provider, 24*time.Hour, 0, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, query := range client.Queries() {
+		if strings.Contains(query, "node_cpu_seconds_total") && !strings.Contains(query, "by (cluster_id, mode)") {
+			t.Errorf("expected CPU breakdown query to group by cluster: %s", query)
+		}
+	}
+
+	expected := map[string]float64{"cluster1": 0.8, "cluster2": 0.3}
+	for cluster, idle := range expected {
+		cc, ok := costs[cluster]
+		if !ok || cc.CPUBreakdown == nil {
+			t.Fatalf("expected CPU breakdown for %s", cluster)
+		}
+		if !util.IsApproximately(cc.CPUBreakdown.Idle, idle) {
+			t.Errorf("expected %s CPU idle %f; got %f", cluster, idle, cc.CPUBreakdown.Idle)
+		}
+	}
+}
+
+func TestClusterCostsOverTimeWithOptions_EmptyStorage(t *testing.T) {
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_cpu_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"100"],[1609462800,"100"]]}]`},
+			{Match: "node_ram_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"50"],[1609462800,"50"]]}]`},
+			{Match: "node_total_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"150"],[1609462800,"150"]]}]`},
+		},
+	}
+
+	// Lenient by default: empty storage is a zero series
+	totals, err := ClusterCostsOverTimeWithOptions(client, &mockProvider{}, "2021-01-01T00:00:00.000Z", "2021-01-01T02:00:00.000Z", time.Hour, 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(totals.StorageCost) != 2 {
+		t.Fatalf("expected 2 storage totals; got %d", len(totals.StorageCost))
+	}
+	for _, total := range totals.StorageCost {
+		if total[1] != "0.000000" {
+			t.Errorf("expected zero storage cost; got %s", total[1])
+		}
+	}
+
+	// Strict: empty storage is an error
+	_, err = ClusterCostsOverTimeWithOptions(client, &mockProvider{}, "2021-01-01T00:00:00.000Z", "2021-01-01T02:00:00.000Z", time.Hour, 0, &ClusterCostsOverTimeOptions{StrictStorage: true})
+	if !errors.Is(err, ErrNoData) {
+		t.Errorf("expected ErrNoData for empty storage in strict mode; got %v", err)
+	}
+}
+
+func TestTotals_SortByTime(t *testing.T) {
+	// Merged sources produce out-of-order timestamps, consistently across the
+	// series
+	series := func(a, b, c float64) [][]string {
+		return [][]string{
+			{"1609462800.000000", fmt.Sprintf("%f", b)},
+			{"1609459200.000000", fmt.Sprintf("%f", a)},
+			{"1609466400.000000", fmt.Sprintf("%f", c)},
+		}
+	}
+
+	totals := &Totals{
+		TotalCost:   series(10.0, 20.0, 30.0),
+		CPUCost:     series(4.0, 8.0, 12.0),
+		GPUCost:     series(0.0, 1.0, 1.0),
+		MemCost:     series(2.5, 5.0, 7.5),
+		StorageCost: series(0.0, 0.0, 1.0),
+		Counts: &TotalsCounts{
+			TotalCost:   series(12, 11, 12),
+			CPUCost:     series(12, 11, 12),
+			GPUCost:     series(12, 11, 12),
+			MemCost:     series(12, 11, 12),
+			StorageCost: series(12, 11, 12),
+		},
+	}
+	if totals.IsSorted() {
+		t.Fatalf("expected out-of-order totals not to be sorted")
+	}
+
+	sorted := totals.SortByTime()
+	if !sorted.IsSorted() {
+		t.Fatalf("expected sorted totals to be sorted")
+	}
+	if totals.IsSorted() {
+		t.Errorf("expected SortByTime not to modify the totals")
+	}
+
+	for i, s := range sorted.series() {
+		if s[0][0] != "1609459200.000000" || s[1][0] != "1609462800.000000" || s[2][0] != "1609466400.000000" {
+			t.Errorf("series %d: expected timestamps in order; got %v", i, s)
+		}
+	}
+	if sorted.CPUCost[0][1] != "4.000000" || sorted.CPUCost[1][1] != "8.000000" {
+		t.Errorf("expected values to move with their timestamps; got %v", sorted.CPUCost)
+	}
+	if sorted.Counts.TotalCost[1][1] != "11.000000" {
+		t.Errorf("expected counts to stay aligned with totals; got %v", sorted.Counts.TotalCost)
+	}
+	if sorted.Counts.GPUCost[1][1] != "11.000000" {
+		t.Errorf("expected GPU counts to stay aligned with totals; got %v", sorted.Counts.GPUCost)
+	}
+
+	// Out-of-order GPU counts alone make the totals unsorted
+	gpuCounts := totals.SortByTime()
+	gpuCounts.Counts.GPUCost = series(12, 11, 12)
+	if gpuCounts.IsSorted() {
+		t.Errorf("expected totals with out-of-order GPU counts not to be sorted")
+	}
+	if !gpuCounts.SortByTime().IsSorted() {
+		t.Errorf("expected totals with sorted GPU counts to be sorted")
+	}
+}
+
+func TestTotals_Sum(t *testing.T) {
+	series := func(a, b, c float64) [][]string {
+		return [][]string{
+			{"1609459200.000000", fmt.Sprintf("%f", a)},
+			{"1609462800.000000", fmt.Sprintf("%f", b)},
+			{"1609466400.000000", fmt.Sprintf("%f", c)},
+		}
+	}
+
+	totals := &Totals{
+		TotalCost:   series(10.0, 20.0, 30.0),
+		CPUCost:     series(4.0, 8.0, 12.0),
+		MemCost:     series(2.5, 5.0, 7.5),
+		StorageCost: series(0.0, 0.0, 1.0),
+	}
+
+	expected := map[ResourceDimension]float64{
+		DimensionTotal:   60.0,
+		DimensionCPU:     24.0,
+		DimensionRAM:     15.0,
+		DimensionStorage: 1.0,
+	}
+	for dim, exp := range expected {
+		sum, err := totals.Sum(dim)
+		if err != nil {
+			t.Fatalf("unexpected error summing dimension %d: %s", dim, err)
+		}
+		if !util.IsApproximately(sum, exp) {
+			t.Errorf("expected dimension %d sum %f; got %f", dim, exp, sum)
+		}
+	}
+
+	if _, err := totals.Sum(ResourceDimension(-1)); err == nil {
+		t.Errorf("expected error for unknown dimension")
+	}
+
+	totals.CPUCost[1][1] = "NaN?"
+	if _, err := totals.Sum(DimensionCPU); err == nil {
+		t.Errorf("expected error for malformed value")
+	}
+	totals.MemCost[1] = []string{"1609462800.000000"}
+	if _, err := totals.Sum(DimensionRAM); err == nil {
+		t.Errorf("expected error for malformed entry")
+	}
+}
+
+func TestResultToTotals_WrongShape(t *testing.T) {
+	parse := func(body string) []*prom.QueryResult {
+		var raw interface{}
+		if err := json.Unmarshal([]byte(body), &raw); err != nil {
+			t.Fatalf("unexpected error unmarshaling: %s", err)
+		}
+		qrs := prom.NewQueryResults("query", raw)
+		if qrs.Error != nil {
+			t.Fatalf("unexpected error: %s", qrs.Error)
+		}
+		return qrs.Results
+	}
+
+	vector := parse(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1609459200,"1"]}]}}`)
+	matrix := parse(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1609459200,"1"],[1609462800,"2"]]}]}}`)
+
+	if totals, err := resultToTotals(matrix); err != nil || len(totals) != 2 {
+		t.Errorf("expected 2 totals from matrix results; got %v, %v", totals, err)
+	}
+	if _, err := resultToTotals(vector); err == nil || !strings.Contains(err.Error(), "expected range (matrix) query results") {
+		t.Errorf("expected descriptive error for totals from vector results; got %v", err)
+	}
+
+	// Propagated by ClusterCostsOverTime for GPU costs, too, rather than
+	// mistaken for a cluster without GPUs
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_gpu_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"300"]}]`},
+			{Match: "node_cpu_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"100"]]}]`},
+			{Match: "node_ram_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"50"]]}]`},
+			{Match: "node_total_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"450"]]}]`},
+		},
+	}
+	_, err := ClusterCostsOverTime(client, &mockProvider{}, "2021-01-01T00:00:00.000Z", "2021-01-02T00:00:00.000Z", 24*time.Hour, 0)
+	if err == nil || !strings.Contains(err.Error(), "expected range (matrix) query results") {
+		t.Errorf("expected descriptive error for GPU totals from vector results; got %v", err)
+	}
+}
+
+func TestClusterCostsOverTime_MissingSeries(t *testing.T) {
+	// The storage range query returns no series
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "pv_hourly_cost", Result: `[]`},
+			{Match: "node_cpu_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"100"],[1609462800,"100"]]}]`},
+			{Match: "node_ram_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"50"],[1609462800,"50"]]}]`},
+			{Match: "node_total_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"150"],[1609462800,"150"]]}]`},
+		},
+	}
+
+	totals, err := ClusterCostsOverTime(client, &mockProvider{}, "2021-01-01T00:00:00.000Z", "2021-01-01T02:00:00.000Z", time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(totals.CPUCost) != 2 || len(totals.MemCost) != 2 || len(totals.TotalCost) != 2 {
+		t.Errorf("expected 2 CPU, RAM, and total costs; got %d, %d, %d", len(totals.CPUCost), len(totals.MemCost), len(totals.TotalCost))
+	}
+	if len(totals.CPUCost) > 0 && totals.CPUCost[0][1] != "100.000000" {
+		t.Errorf("expected CPU cost 100; got %s", totals.CPUCost[0][1])
+	}
+	if len(totals.Warnings) != 1 || !strings.Contains(totals.Warnings[0], "storage") {
+		t.Errorf("expected a warning about missing storage data; got %v", totals.Warnings)
+	}
+
+	// The RAM range query returns no series: RAM is an empty series, rather
+	// than an error
+	client = &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_cpu_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"100"],[1609462800,"100"]]}]`},
+			{Match: "node_total_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"150"],[1609462800,"150"]]}]`},
+			{Match: "pv_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"5"],[1609462800,"5"]]}]`},
+		},
+	}
+
+	totals, err = ClusterCostsOverTime(client, &mockProvider{}, "2021-01-01T00:00:00.000Z", "2021-01-01T02:00:00.000Z", time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if totals.MemCost == nil || len(totals.MemCost) != 0 {
+		t.Errorf("expected empty RAM series; got %v", totals.MemCost)
+	}
+	if len(totals.CPUCost) != 2 || len(totals.StorageCost) != 2 {
+		t.Errorf("expected 2 CPU and storage costs; got %d, %d", len(totals.CPUCost), len(totals.StorageCost))
+	}
+	if len(totals.Warnings) != 1 || !strings.Contains(totals.Warnings[0], "RAM") {
+		t.Errorf("expected a warning about missing RAM data; got %v", totals.Warnings)
+	}
+}
+
+func TestSumTotalsAcrossClusters(t *testing.T) {
+	// cluster1 has points at 0h and 1h; cluster2 at 1h and 2h
+	totalsByCluster := map[string]*Totals{
+		"cluster1": {
+			TotalCost:   [][]string{{"1609459200.000000", "10.000000"}, {"1609462800.000000", "20.000000"}},
+			CPUCost:     [][]string{{"1609459200.000000", "6.000000"}, {"1609462800.000000", "12.000000"}},
+			GPUCost:     [][]string{},
+			MemCost:     [][]string{{"1609459200.000000", "4.000000"}, {"1609462800.000000", "8.000000"}},
+			StorageCost: [][]string{{"1609459200.000000", "0.000000"}, {"1609462800.000000", "0.000000"}},
+			Warnings:    []string{"no GPU cost data in range"},
+		},
+		"cluster2": {
+			// The same instant, formatted differently
+			TotalCost:   [][]string{{"1609462800", "5"}, {"1609466400.000000", "7.000000"}},
+			CPUCost:     [][]string{{"1609462800.000000", "3.000000"}, {"1609466400.000000", "4.000000"}},
+			GPUCost:     [][]string{},
+			MemCost:     [][]string{},
+			StorageCost: [][]string{{"1609462800.000000", "2.000000"}, {"1609466400.000000", "3.000000"}},
+			Counts:      &TotalsCounts{},
+		},
+		"cluster3": nil,
+	}
+
+	summed := SumTotalsAcrossClusters(totalsByCluster)
+
+	cases := map[string]struct {
+		actual   [][]string
+		expected [][]string
+	}{
+		"total":   {summed.TotalCost, [][]string{{"1609459200.000000", "10.000000"}, {"1609462800.000000", "25.000000"}, {"1609466400.000000", "7.000000"}}},
+		"cpu":     {summed.CPUCost, [][]string{{"1609459200.000000", "6.000000"}, {"1609462800.000000", "15.000000"}, {"1609466400.000000", "4.000000"}}},
+		"gpu":     {summed.GPUCost, [][]string{}},
+		"ram":     {summed.MemCost, [][]string{{"1609459200.000000", "4.000000"}, {"1609462800.000000", "8.000000"}}},
+		"storage": {summed.StorageCost, [][]string{{"1609459200.000000", "0.000000"}, {"1609462800.000000", "2.000000"}, {"1609466400.000000", "3.000000"}}},
+	}
+	for name, tc := range cases {
+		if len(tc.actual) != len(tc.expected) {
+			t.Errorf("%s: expected %v; got %v", name, tc.expected, tc.actual)
+			continue
+		}
+		for i := range tc.expected {
+			if tc.actual[i][0] != tc.expected[i][0] || tc.actual[i][1] != tc.expected[i][1] {
+				t.Errorf("%s: expected %v; got %v", name, tc.expected, tc.actual)
+				break
+			}
+		}
+	}
+
+	if len(summed.Warnings) != 1 || summed.Warnings[0] != "cluster1: no GPU cost data in range" {
+		t.Errorf("expected cluster1's warning; got %v", summed.Warnings)
+	}
+	if summed.Counts != nil {
+		t.Errorf("expected no counts when only some clusters have counts")
+	}
+
+	if empty := SumTotalsAcrossClusters(nil); empty == nil || len(empty.TotalCost) != 0 {
+		t.Errorf("expected empty totals for no clusters; got %v", empty)
+	}
+}
+
+func TestResultToTotals_ErrNoData(t *testing.T) {
+	if _, err := resultToTotals([]*prom.QueryResult{}); !errors.Is(err, ErrNoData) {
+		t.Errorf("expected ErrNoData for totals from empty results; got %v", err)
+	}
+
+	// Propagated by ClusterCostsOverTime when there is no CPU data
+	client := &mockPromClient{}
+	_, err := ClusterCostsOverTimeWithOptions(client, &mockProvider{}, "2021-01-01T00:00:00.000Z", "2021-01-01T02:00:00.000Z", time.Hour, 0, nil)
+	if !errors.Is(err, ErrNoData) {
+		t.Errorf("expected ErrNoData from ClusterCostsOverTime; got %v", err)
+	}
+}
+
+// recordingAuditor is a prom.QueryAuditor recording the outcome of each query
+type recordingAuditor struct {
+	records map[string][]error
+	lock    sync.Mutex
+}
+
+func (ra *recordingAuditor) Record(query string, at time.Time, duration time.Duration, err error) {
+	ra.lock.Lock()
+	defer ra.lock.Unlock()
+
+	ra.records[query] = append(ra.records[query], err)
+}
+
+func TestComputeClusterCosts_QueryAuditor(t *testing.T) {
+	auditor := &recordingAuditor{records: map[string][]error{}}
+	prom.SetDefaultQueryAuditor(auditor)
+	defer prom.SetDefaultQueryAuditor(nil)
+
+	// A malformed result for the GPU cost query fails it
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	client.responses = append([]mockPromResponse{
+		{Match: "node_gpu_hourly_cost", Result: `"malformed"`},
+	}, client.responses...)
+
+	a := &Accesses{CloudProvider: &mockProvider{}}
+	a.ComputeClusterCostsWithOptions(client, &mockProvider{}, 24*time.Hour, 0, &ClusterCostsOptions{WithBreakdown: true})
+
+	queries := client.Queries()
+	if len(auditor.records) != len(queries) {
+		t.Errorf("expected %d distinct queries to be recorded; got %d", len(queries), len(auditor.records))
+	}
+	for _, query := range queries {
+		errs := auditor.records[query]
+		if len(errs) != 1 {
+			t.Errorf("expected query to be recorded once; got %d records: %s", len(errs), query)
+			continue
+		}
+		if failed := strings.Contains(query, "node_gpu_hourly_cost"); failed != (errs[0] != nil) {
+			t.Errorf("expected recorded error %t; got %v: %s", failed, errs[0], query)
+		}
+	}
+}
+
+func TestBuildStorageQuery(t *testing.T) {
+	local := `sum(container_fs_limit_bytes) by (cluster_id)`
+
+	// Previously formatted as "... ) by (%s) %s" with "+ <local storage query>"
+	const fmtPreviousStorage = `sum(
+		avg(avg_over_time(pv_hourly_cost[%s] %s)) by (persistentvolume, %s) * 730
+		* avg(avg_over_time(kube_persistentvolume_capacity_bytes[%s] %s)) by (persistentvolume, %s) / 1024 / 1024 / 1024
+	  ) by (%s) + %s`
+	label := env.GetPromClusterLabel()
+	expected := fmt.Sprintf(fmtPreviousStorage, "1h", "offset 1h", label, "1h", "offset 1h", label, label, local)
+	if actual := buildStorageQuery("1h", "offset 1h", local, StorageUnitGiB); actual != expected {
+		t.Errorf("expected storage query:\n%s\ngot:\n%s", expected, actual)
+	}
+
+	// Every query including local storage formats the clause identically
+	queries := []string{
+		buildStorageQuery("1h", "offset 1h", local, StorageUnitGiB),
+		fmt.Sprintf(queryTotal, label, label, label, StorageUnitGiB.divisor(), label, localStorageClause(local)),
+		fmt.Sprintf(queryNodes, label, localStorageClause(local)),
+	}
+	for _, query := range queries {
+		if !strings.HasSuffix(query, " + "+local) || strings.Contains(query, "  + ") {
+			t.Errorf("expected query to end with local storage clause %q; got:\n%s", " + "+local, query)
+		}
+	}
+
+	// Without a local storage query, no clause is added
+	for _, query := range []string{
+		buildStorageQuery("1h", "offset 1h", "", StorageUnitGiB),
+		fmt.Sprintf(queryTotal, label, label, label, StorageUnitGiB.divisor(), label, localStorageClause("")),
+		fmt.Sprintf(queryNodes, label, localStorageClause("")),
+	} {
+		if strings.HasSuffix(query, " ") || strings.HasSuffix(query, "+") {
+			t.Errorf("expected no local storage clause; got:\n%s", query)
+		}
+	}
+}
+
+func TestComputeClusterCosts_EvalTime(t *testing.T) {
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	evalTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, time.Hour, &ClusterCostsOptions{
+		WithBreakdown: true,
+		EvalTime:      evalTime,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	at := fmt.Sprintf("@ %d", evalTime.Unix())
+	for _, query := range client.Queries() {
+		if !strings.Contains(query, at) {
+			t.Errorf("expected query to contain %q; got:\n%s", at, query)
+		}
+	}
+
+	cc := costs["cluster1"]
+	if expected := evalTime.Add(-time.Hour); cc.End == nil || !cc.End.Equal(expected) {
+		t.Errorf("expected end %s; got %v", expected, cc.End)
+	}
+
+	// Evaluation times in the future are illegal
+	_, err = a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{EvalTime: time.Now().Add(time.Hour)})
+	if err == nil {
+		t.Errorf("expected error for evaluation time in the future")
+	}
+}
+
+func TestClusterCosts_Clone(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	cc := &ClusterCosts{
+		Start:              &start,
+		CPUBreakdown:       &ClusterCostsBreakdown{Idle: 0.5, User: 0.5},
+		EffectiveDiscounts: map[string]float64{"discount": 0.1},
+		CoverageByResource: map[string]float64{"cpu": 1.0},
+		Warnings:           []string{"warning"},
+	}
+
+	clone := cc.Clone()
+	clone.CPUBreakdown.Idle = 0.0
+	*clone.Start = start.Add(time.Hour)
+	clone.EffectiveDiscounts["discount"] = 0.2
+	clone.CoverageByResource["cpu"] = 0.5
+	clone.Warnings[0] = "changed"
+
+	if cc.CPUBreakdown.Idle != 0.5 {
+		t.Errorf("expected original CPU breakdown idle %f; got %f", 0.5, cc.CPUBreakdown.Idle)
+	}
+	if !cc.Start.Equal(start) {
+		t.Errorf("expected original start %s; got %s", start, cc.Start)
+	}
+	if cc.EffectiveDiscounts["discount"] != 0.1 {
+		t.Errorf("expected original discount %f; got %f", 0.1, cc.EffectiveDiscounts["discount"])
+	}
+	if cc.CoverageByResource["cpu"] != 1.0 {
+		t.Errorf("expected original CPU coverage %f; got %f", 1.0, cc.CoverageByResource["cpu"])
+	}
+	if cc.Warnings[0] != "warning" {
+		t.Errorf("expected original warning %q; got %q", "warning", cc.Warnings[0])
+	}
+	if clone.RAMBreakdown != nil || clone.End != nil {
+		t.Errorf("expected nil pointers to remain nil in clone")
+	}
+}
+
+func TestStorageUnit(t *testing.T) {
+	// divisorValue evaluates a divisor expression of the form "a / b / c"
+	divisorValue := func(divisor string) float64 {
+		value := 1.0
+		for _, term := range strings.Split(divisor, "/") {
+			f, err := strconv.ParseFloat(strings.TrimSpace(term), 64)
+			if err != nil {
+				t.Fatalf("illegal divisor %q: %s", divisor, err)
+			}
+			value *= f
+		}
+		return value
+	}
+
+	gib, gb := StorageUnitGiB.divisor(), StorageUnitGB.divisor()
+	if gib == gb {
+		t.Fatalf("expected GiB and GB divisors to differ; both %q", gib)
+	}
+
+	// The same bytes cost ~1.074x as much priced per GB as per GiB
+	if ratio := divisorValue(gib) / divisorValue(gb); math.Abs(ratio-1.074) > 0.001 {
+		t.Errorf("expected GB costs to scale by ~1.074 relative to GiB; got %f", ratio)
+	}
+
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+	for unit, divisor := range map[StorageUnit]string{StorageUnitGiB: gib, StorageUnitGB: gb} {
+		client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+		_, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{StorageUnit: unit})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		found := false
+		for _, query := range client.Queries() {
+			if strings.Contains(query, "pv_hourly_cost") {
+				found = true
+				if !strings.Contains(query, "/ "+divisor+" *") {
+					t.Errorf("expected storage query to divide by %q; got:\n%s", divisor, query)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("expected a storage query")
+		}
+	}
+}
+
+func TestComputeClusterCosts_CPUModeAggregation(t *testing.T) {
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	cpuModeQuery := func(agg CPUModeAggregation) string {
+		client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+		_, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{WithBreakdown: true, CPUModeAggregation: agg})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for _, query := range client.Queries() {
+			if strings.Contains(query, "node_cpu_seconds_total") {
+				return query
+			}
+		}
+		t.Fatalf("expected a CPU mode query")
+		return ""
+	}
+
+	if query := cpuModeQuery(CPUModeAggregationRate); strings.Contains(query, "avg_over_time") || !strings.Contains(query, "rate(node_cpu_seconds_total[24h0m0s])") {
+		t.Errorf("expected CPU mode fractions from the rate over the window by default; got:\n%s", query)
+	}
+
+	query := cpuModeQuery(CPUModeAggregationAvg)
+	if !strings.Contains(query, "avg_over_time((") || !strings.Contains(query, "rate(node_cpu_seconds_total[5m])") || !strings.Contains(query, ")[24h0m0s:5m]") {
+		t.Errorf("expected CPU mode fractions averaged over the window; got:\n%s", query)
+	}
+}
+
+func TestComputeClusterCosts_CostBasis(t *testing.T) {
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	// Requested CPU costs 4.0 of the 10.0 of node capacity; RAM is unchanged
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	client.responses = append([]mockPromResponse{
+		{Match: `kube_pod_container_resource_requests{resource="cpu"`, Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"4"]}]`},
+	}, client.responses...)
+
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{CostBasis: CostBasisRequests})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, query := range client.Queries() {
+		if strings.Contains(query, "node_cpu_hourly_cost") && !strings.Contains(query, `sum(kube_pod_container_resource_requests{resource="cpu", unit="core", container!="", container!="POD", node!=""}) by (node, cluster_id)`) {
+			t.Errorf("expected CPU cost query to price summed CPU requests; got:\n%s", query)
+		}
+		if strings.Contains(query, "node_ram_hourly_cost") && !strings.Contains(query, `kube_pod_container_resource_requests{resource="memory", unit="byte"`) {
+			t.Errorf("expected RAM cost query to price summed RAM requests; got:\n%s", query)
+		}
+	}
+
+	cc, ok := costs["cluster1"]
+	if !ok {
+		t.Fatalf("expected costs for cluster1")
+	}
+	if !util.IsApproximately(cc.CPUCumulative, 4.0) {
+		t.Errorf("expected requested CPU cost %f; got %f", 4.0, cc.CPUCumulative)
+	}
+
+	// Node capacity is the default
+	client = newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	if _, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, query := range client.Queries() {
+		if strings.Contains(query, "kube_pod_container_resource_requests") {
+			t.Errorf("expected no requests in queries by default; got:\n%s", query)
+		}
+	}
+}
+
+func TestComputeClusterCosts_RecordingRuleTotals(t *testing.T) {
+	provider := &mockProvider{config: &cloud.CustomPricing{Discount: "50%"}}
+	a := &Accesses{CloudProvider: provider}
+
+	// The CPU and RAM recording rules replace the raw totals of 10.0 and 5.0;
+	// the GPU and storage rules are empty, so they fall back to raw totals
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	client.responses = append([]mockPromResponse{
+		{Match: "cluster:cost:cpu", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"8"]}]`},
+		{Match: "cluster:cost:ram", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"4"]}]`},
+		{Match: "cluster:cost:storage", Result: `[]`},
+	}, client.responses...)
+
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{RecordingRuleTotals: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, resource := range []string{"cpu", "ram", "gpu", "storage"} {
+		queried := false
+		for _, query := range client.Queries() {
+			if strings.Contains(query, RecordingRuleTotalMetric(resource)) {
+				queried = true
+			}
+		}
+		if !queried {
+			t.Errorf("expected recording rule %s to be queried", RecordingRuleTotalMetric(resource))
+		}
+	}
+
+	// Raw totals are queried only for the resources whose recording rules
+	// have no data
+	rawTotalMetrics := map[string]bool{
+		"node_cpu_hourly_cost": false,
+		"node_ram_hourly_cost": false,
+		"node_gpu_hourly_cost": true,
+		"pv_hourly_cost":       true,
+	}
+	for metric, expected := range rawTotalMetrics {
+		queried := false
+		for _, query := range client.Queries() {
+			if strings.Contains(query, metric) {
+				queried = true
+			}
+		}
+		if queried != expected {
+			t.Errorf("expected %s queried to be %t; got %t", metric, expected, queried)
+		}
+	}
+
+	cc, ok := costs["cluster1"]
+	if !ok {
+		t.Fatalf("expected costs for cluster1")
+	}
+
+	// The discount applies on top of the recording rule totals
+	if !util.IsApproximately(cc.CPUCumulative, 4.0) {
+		t.Errorf("expected discounted recording rule CPU cost %f; got %f", 4.0, cc.CPUCumulative)
+	}
+	if !util.IsApproximately(cc.RAMCumulative, 2.0) {
+		t.Errorf("expected discounted recording rule RAM cost %f; got %f", 2.0, cc.RAMCumulative)
+	}
+	if !util.IsApproximately(cc.StorageCumulative, 1.0) {
+		t.Errorf("expected raw storage cost %f; got %f", 1.0, cc.StorageCumulative)
+	}
+
+	// Recording rules are not queried by default
+	client = newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	if _, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, query := range client.Queries() {
+		if strings.Contains(query, "cluster:cost:") {
+			t.Errorf("expected no recording rules in queries by default; got:\n%s", query)
+		}
+	}
+}
+
+func TestComputeClusterCosts_CoverageByResource(t *testing.T) {
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	// A day at 5m resolution is 288 samples: CPU and RAM are fully covered,
+	// storage is half covered, and there are no GPU samples
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	client.responses = append([]mockPromResponse{
+		{Match: "count_over_time(sum(node_cpu_hourly_cost)", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"288"]}]`},
+		{Match: "count_over_time(sum(node_ram_hourly_cost)", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"288"]}]`},
+		{Match: "count_over_time(sum(pv_hourly_cost)", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"144"]}]`},
+		{Match: "count_over_time(sum(node_gpu_hourly_cost)", Result: `[]`},
+	}, client.responses...)
+
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, &ClusterCostsOptions{WithCoverage: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cc, ok := costs["cluster1"]
+	if !ok {
+		t.Fatalf("expected costs for cluster1")
+	}
+	expected := map[string]float64{
+		"cpu":     1.0,
+		"ram":     1.0,
+		"gpu":     0.0,
+		"storage": 0.5,
+	}
+	if len(cc.CoverageByResource) != len(expected) {
+		t.Errorf("expected coverage of %d resources; got %v", len(expected), cc.CoverageByResource)
+	}
+	for resource, coverage := range expected {
+		if !util.IsApproximately(cc.CoverageByResource[resource], coverage) {
+			t.Errorf("expected %s coverage %f; got %f", resource, coverage, cc.CoverageByResource[resource])
+		}
+	}
+
+	// Coverage is not computed by default
+	client = newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	costs, err = a.ComputeClusterCostsWithOptions(client, provider, 24*time.Hour, 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if costs["cluster1"].CoverageByResource != nil {
+		t.Errorf("expected no coverage by default; got %v", costs["cluster1"].CoverageByResource)
+	}
+}
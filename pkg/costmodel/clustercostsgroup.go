@@ -0,0 +1,102 @@
+package costmodel
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+	"github.com/patrickmn/go-cache"
+	"golang.org/x/sync/singleflight"
+)
+
+// ClusterCostsFunc computes cluster costs for all clusters over the given
+// window and offset; e.g. a closure over Accesses.ComputeClusterCosts.
+type ClusterCostsFunc func(window, offset time.Duration) (map[string]*ClusterCosts, error)
+
+// ClusterCostsGroup caches cluster costs by (cluster ID, window, offset) for a
+// short TTL, and ensures that concurrent requests for the same window and
+// offset share a single in-flight computation rather than each querying
+// Prometheus. Because one computation yields the costs of every cluster,
+// in-flight computations are shared by window and offset, while the results
+// are cached both per cluster and, as a whole, by window and offset. Errors
+// are never cached.
+type ClusterCostsGroup struct {
+	compute ClusterCostsFunc
+	cache   *cache.Cache
+	group   singleflight.Group
+}
+
+// NewClusterCostsGroup creates a ClusterCostsGroup computing costs with the
+// given function and caching successful results for the given TTL.
+func NewClusterCostsGroup(compute ClusterCostsFunc, ttl time.Duration) *ClusterCostsGroup {
+	return &ClusterCostsGroup{
+		compute: compute,
+		cache:   cache.New(ttl, 2*ttl),
+	}
+}
+
+// GetClusterCost returns the costs of the cluster with the given ID over the
+// given window and offset, from cache if possible. Returns an error if no
+// costs exist for the cluster.
+func (ccg *ClusterCostsGroup) GetClusterCost(clusterID string, window, offset time.Duration) (*ClusterCosts, error) {
+	if data, ok := ccg.cache.Get(clusterCostsCacheKey(clusterID, window, offset)); ok {
+		return data.(*ClusterCosts), nil
+	}
+
+	costs, err := ccg.GetClusterCosts(window, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	cc, ok := costs[clusterID]
+	if !ok {
+		return nil, fmt.Errorf("no cluster costs found for cluster %s", clusterID)
+	}
+
+	return cc, nil
+}
+
+// GetClusterCosts returns the costs of all clusters over the given window and
+// offset, from cache if possible, or else joining an identical in-flight
+// computation if one exists. The returned map is shared, and must not be
+// modified.
+func (ccg *ClusterCostsGroup) GetClusterCosts(window, offset time.Duration) (map[string]*ClusterCosts, error) {
+	key := allClusterCostsCacheKey(window, offset)
+	if data, ok := ccg.cache.Get(key); ok {
+		return data.(map[string]*ClusterCosts), nil
+	}
+
+	result, err, _ := ccg.group.Do(key, func() (interface{}, error) {
+		costs, err := ccg.compute(window, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		for clusterID, cc := range costs {
+			ccg.cache.SetDefault(clusterCostsCacheKey(clusterID, window, offset), cc)
+		}
+		ccg.cache.SetDefault(key, costs)
+
+		return costs, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	costs, ok := result.(map[string]*ClusterCosts)
+	if !ok {
+		return nil, fmt.Errorf("Failed to cast result as map[string]*ClusterCosts")
+	}
+
+	return costs, nil
+}
+
+func clusterCostsCacheKey(clusterID string, window, offset time.Duration) string {
+	fmtWindow, fmtOffset := timeutil.DurationOffsetStrings(window, offset)
+	return fmt.Sprintf("%s:%s:%s", clusterID, fmtWindow, fmtOffset)
+}
+
+func allClusterCostsCacheKey(window, offset time.Duration) string {
+	fmtWindow, fmtOffset := timeutil.DurationOffsetStrings(window, offset)
+	return fmt.Sprintf("%s:%s", fmtWindow, fmtOffset)
+}
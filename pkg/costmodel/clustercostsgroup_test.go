@@ -0,0 +1,157 @@
+package costmodel
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+)
+
+func TestClusterCostsGroup_GetClusterCost(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+
+	compute := func(window, offset time.Duration) (map[string]*ClusterCosts, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return map[string]*ClusterCosts{
+			"cluster1": &ClusterCosts{TotalCumulative: 10.0},
+		}, nil
+	}
+
+	ccg := NewClusterCostsGroup(compute, time.Minute)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cc, err := ccg.GetClusterCost("cluster1", 24*time.Hour, 0)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if cc.TotalCumulative != 10.0 {
+				errs <- fmt.Errorf("expected TotalCumulative %f; got %f", 10.0, cc.TotalCumulative)
+			}
+		}()
+	}
+
+	// Give all requests a chance to join the in-flight computation
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expected 1 computation for 10 concurrent identical requests; got %d", n)
+	}
+
+	// Subsequent requests are served from cache
+	if _, err := ccg.GetClusterCost("cluster1", 24*time.Hour, 0); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expected cached result; got %d computations", n)
+	}
+}
+
+func TestClusterCostsGroup_ErrorsNotCached(t *testing.T) {
+	calls := 0
+	compute := func(window, offset time.Duration) (map[string]*ClusterCosts, error) {
+		calls++
+		if calls == 1 {
+			return nil, fmt.Errorf("prometheus unavailable")
+		}
+		return map[string]*ClusterCosts{"cluster1": &ClusterCosts{}}, nil
+	}
+
+	ccg := NewClusterCostsGroup(compute, time.Minute)
+
+	if _, err := ccg.GetClusterCost("cluster1", time.Hour, 0); err == nil {
+		t.Errorf("expected error from first computation")
+	}
+	if _, err := ccg.GetClusterCost("cluster1", time.Hour, 0); err != nil {
+		t.Errorf("expected error not to be cached; got %s", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 computations; got %d", calls)
+	}
+}
+
+func TestClusterCostsGroup_GetClusterCosts(t *testing.T) {
+	calls := 0
+	compute := func(window, offset time.Duration) (map[string]*ClusterCosts, error) {
+		calls++
+		return map[string]*ClusterCosts{
+			"cluster1": &ClusterCosts{TotalCumulative: 10.0},
+			"cluster2": &ClusterCosts{TotalCumulative: 20.0},
+		}, nil
+	}
+
+	ccg := NewClusterCostsGroup(compute, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		costs, err := ccg.GetClusterCosts(24*time.Hour, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(costs) != 2 {
+			t.Errorf("expected costs for 2 clusters; got %d", len(costs))
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected all-cluster costs to be served from cache; got %d computations", calls)
+	}
+
+	// Per-cluster costs are cached by the same computation
+	if cc, err := ccg.GetClusterCost("cluster2", 24*time.Hour, 0); err != nil || cc.TotalCumulative != 20.0 {
+		t.Errorf("expected cached cluster2 costs; got %v, %v", cc, err)
+	}
+
+	// Other windows are computed separately
+	if _, err := ccg.GetClusterCosts(time.Hour, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected a computation for a different window; got %d computations", calls)
+	}
+}
+
+func TestAccesses_ClusterCostsGroup(t *testing.T) {
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{PrometheusClient: client, CloudProvider: provider}
+
+	ccg := a.clusterCostsGroup(false)
+	if a.clusterCostsGroup(false) != ccg {
+		t.Errorf("expected the same group for the same client")
+	}
+	if a.clusterCostsGroup(true) == ccg {
+		t.Errorf("expected a separate group for Thanos")
+	}
+
+	costs, err := ccg.GetClusterCosts(24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := costs["cluster1"]; !ok {
+		t.Errorf("expected costs for cluster1; got %v", costs)
+	}
+
+	queries := len(client.Queries())
+	if _, err := a.clusterCostsGroup(false).GetClusterCosts(24*time.Hour, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(client.Queries()) != queries {
+		t.Errorf("expected repeated request to be served from cache; got %d more queries", len(client.Queries())-queries)
+	}
+}
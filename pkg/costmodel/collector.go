@@ -0,0 +1,124 @@
+package costmodel
+
+import (
+	"context"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/log"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
+
+// DefaultSnapshotInterval is the interval at which a SnapshotCollector
+// computes snapshots, if no positive interval is given.
+const DefaultSnapshotInterval = time.Hour
+
+// DefaultSnapshotMaxBackoff is the longest a SnapshotCollector waits between
+// attempts while Prometheus is failing, if no maximum is given.
+const DefaultSnapshotMaxBackoff = 30 * time.Minute
+
+// SnapshotCollector continuously computes snapshots of cluster costs over a
+// trailing window, at a fixed interval, passing each to a handler. While
+// Prometheus is failing, e.g. during a restart, the collector backs off,
+// doubling the interval after each consecutive failure up to a maximum, and
+// returns to the regular interval on the first success.
+type SnapshotCollector struct {
+	accesses   *Accesses
+	client     prometheus.Client
+	provider   cloud.Provider
+	window     time.Duration
+	interval   time.Duration
+	maxBackoff time.Duration
+	opts       *ClusterCostsOptions
+	handler    func(map[string]*ClusterCosts)
+
+	// sleep waits for the given duration, returning false if the context is
+	// done first. Replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) bool
+}
+
+// NewSnapshotCollector creates a SnapshotCollector computing cluster costs
+// over the given trailing window, with the given options, every interval, or
+// DefaultSnapshotInterval if not positive. If maxBackoff is less than the
+// interval, DefaultSnapshotMaxBackoff, or the interval if greater, is used.
+func NewSnapshotCollector(a *Accesses, client prometheus.Client, provider cloud.Provider, window, interval, maxBackoff time.Duration, opts *ClusterCostsOptions, handler func(map[string]*ClusterCosts)) *SnapshotCollector {
+	if interval <= 0 {
+		interval = DefaultSnapshotInterval
+	}
+	if maxBackoff < interval {
+		maxBackoff = DefaultSnapshotMaxBackoff
+		if maxBackoff < interval {
+			maxBackoff = interval
+		}
+	}
+
+	return &SnapshotCollector{
+		accesses:   a,
+		client:     client,
+		provider:   provider,
+		window:     window,
+		interval:   interval,
+		maxBackoff: maxBackoff,
+		opts:       opts,
+		handler:    handler,
+		sleep:      sleepContext,
+	}
+}
+
+// Run collects snapshots until the given context is done.
+func (sc *SnapshotCollector) Run(ctx context.Context) {
+	failures := 0
+	for {
+		costs, err := sc.accesses.ComputeClusterCostsWithOptions(sc.client, sc.provider, sc.window, 0, sc.opts)
+		if err != nil {
+			failures++
+			delay := sc.backoff(failures)
+			if failures == 1 {
+				log.Warningf("SnapshotCollector: failed to compute cluster costs: %s; backing off", err)
+			}
+			log.Infof("SnapshotCollector: %d consecutive failures; retrying in %s", failures, delay)
+			if !sc.sleep(ctx, delay) {
+				return
+			}
+			continue
+		}
+
+		if failures > 0 {
+			log.Infof("SnapshotCollector: recovered after %d consecutive failures", failures)
+			failures = 0
+		}
+		sc.handler(costs)
+
+		if !sc.sleep(ctx, sc.interval) {
+			return
+		}
+	}
+}
+
+// backoff returns the delay after the given number of consecutive failures;
+// i.e. the interval doubled for each failure, capped at maxBackoff.
+func (sc *SnapshotCollector) backoff(failures int) time.Duration {
+	delay := sc.interval
+	for i := 0; i < failures && delay < sc.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > sc.maxBackoff {
+		delay = sc.maxBackoff
+	}
+	return delay
+}
+
+// sleepContext waits for the given duration, returning false if the context
+// is done first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,90 @@
+package costmodel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
+
+// outagePromClient is a mockPromClient failing every request while down
+type outagePromClient struct {
+	*mockPromClient
+	down int32
+}
+
+func (opc *outagePromClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, prometheus.Warnings, error) {
+	if atomic.LoadInt32(&opc.down) == 1 {
+		return nil, nil, nil, fmt.Errorf("connection refused")
+	}
+	return opc.mockPromClient.Do(ctx, req)
+}
+
+func TestSnapshotCollector_Backoff(t *testing.T) {
+	client := &outagePromClient{mockPromClient: newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0), down: 1}
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	snapshots := 0
+	sc := NewSnapshotCollector(a, client, provider, 24*time.Hour, time.Minute, 5*time.Minute, nil, func(costs map[string]*ClusterCosts) {
+		if _, ok := costs["cluster1"]; !ok {
+			t.Errorf("expected a snapshot of cluster1; got %v", costs)
+		}
+		snapshots++
+	})
+
+	// Prometheus recovers after four failed attempts; stop after the first
+	// regular interval following recovery
+	var delays []time.Duration
+	sc.sleep = func(ctx context.Context, d time.Duration) bool {
+		delays = append(delays, d)
+		if len(delays) == 4 {
+			atomic.StoreInt32(&client.down, 0)
+		}
+		return len(delays) < 5
+	}
+
+	sc.Run(context.Background())
+
+	expected := []time.Duration{2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute, time.Minute}
+	if len(delays) != len(expected) {
+		t.Fatalf("expected delays %v; got %v", expected, delays)
+	}
+	for i := range expected {
+		if delays[i] != expected[i] {
+			t.Errorf("delay %d: expected %s; got %s", i, expected[i], delays[i])
+		}
+	}
+	if snapshots != 1 {
+		t.Errorf("expected 1 snapshot after recovery; got %d", snapshots)
+	}
+}
+
+func TestSnapshotCollector_Cancel(t *testing.T) {
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+	a := &Accesses{CloudProvider: provider}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sc := NewSnapshotCollector(a, client, provider, 24*time.Hour, time.Hour, 0, nil, func(map[string]*ClusterCosts) {
+		cancel()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		sc.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected Run to return once the context is cancelled")
+	}
+}
@@ -0,0 +1,113 @@
+package costmodel
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
+
+// maxEfficiencyBuckets is the most step buckets EfficiencyOverTime computes,
+// as each bucket is a full cluster cost computation
+const maxEfficiencyBuckets = 100
+
+// EfficiencyScore returns the efficiency of the cluster as the fraction of
+// its CPU and RAM cost that is not idle, weighting each resource's non-idle
+// fraction, according to its normalized breakdown, by its cumulative cost.
+// Resources without a breakdown are not considered. Returns NaN if neither
+// resource has a breakdown, or if neither has any cost.
+func (cc *ClusterCosts) EfficiencyScore() float64 {
+	if cc == nil {
+		return math.NaN()
+	}
+
+	cost, used := 0.0, 0.0
+	if cpuBD := cc.CPUBreakdown.normalized(); cpuBD != nil {
+		cost += cc.CPUCumulative
+		used += cc.CPUCumulative * (1.0 - cpuBD.Idle)
+	}
+	if ramBD := cc.RAMBreakdown.normalized(); ramBD != nil {
+		cost += cc.RAMCumulative
+		used += cc.RAMCumulative * (1.0 - ramBD.Idle)
+	}
+	if cost <= 0 {
+		return math.NaN()
+	}
+
+	return used / cost
+}
+
+// EfficiencyOverTime gives, per cluster, the EfficiencyScore of each step
+// bucket between start and end, computed from the cluster costs, with
+// breakdowns, over that bucket. The last bucket is truncated at end, if the
+// range is not a whole number of steps. Buckets in which a cluster has no
+// costs or no breakdowns have an efficiency of NaN.
+func EfficiencyOverTime(client prometheus.Client, provider cloud.Provider, start, end time.Time, step time.Duration) (map[string][]float64, error) {
+	if !start.Before(end) {
+		return nil, fmt.Errorf("illegal range: start %s must be before end %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("illegal step %s: must be positive", step)
+	}
+
+	numBuckets := int(end.Sub(start) / step)
+	if end.Sub(start)%step != 0 {
+		numBuckets++
+	}
+	if numBuckets > maxEfficiencyBuckets {
+		return nil, fmt.Errorf("illegal step %s: range of %s has %d buckets, more than the maximum of %d", step, end.Sub(start), numBuckets, maxEfficiencyBuckets)
+	}
+
+	a := &Accesses{CloudProvider: provider}
+
+	buckets := make([]map[string]*ClusterCosts, numBuckets)
+	for i := range buckets {
+		bucketStart := start.Add(time.Duration(i) * step)
+		bucketEnd := bucketStart.Add(step)
+		if bucketEnd.After(end) {
+			bucketEnd = end
+		}
+
+		// Evaluate each bucket as of its end, rather than offset from now, so
+		// that buckets are exactly aligned to the range
+		costs, err := a.ComputeClusterCostsWithOptions(client, provider, bucketEnd.Sub(bucketStart), 0, &ClusterCostsOptions{
+			WithBreakdown: true,
+			EvalTime:      bucketEnd,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("computing costs for bucket [%s, %s): %s", bucketStart.Format(time.RFC3339), bucketEnd.Format(time.RFC3339), err)
+		}
+		buckets[i] = costs
+	}
+
+	return efficiencySeries(buckets), nil
+}
+
+// efficiencySeries returns, per cluster appearing in any of the given buckets
+// of costs, the EfficiencyScore of each bucket, or NaN for the buckets in
+// which the cluster does not appear.
+func efficiencySeries(buckets []map[string]*ClusterCosts) map[string][]float64 {
+	series := map[string][]float64{}
+	for _, costs := range buckets {
+		for clusterID := range costs {
+			if _, ok := series[clusterID]; ok {
+				continue
+			}
+			series[clusterID] = make([]float64, len(buckets))
+			for i := range series[clusterID] {
+				series[clusterID][i] = math.NaN()
+			}
+		}
+	}
+
+	for i, costs := range buckets {
+		for clusterID, cc := range costs {
+			series[clusterID][i] = cc.EfficiencyScore()
+		}
+	}
+
+	return series
+}
@@ -0,0 +1,130 @@
+package costmodel
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestClusterCosts_EfficiencyScore(t *testing.T) {
+	// $10 of CPU at 30% idle and $5 of RAM at 60% idle: $9 of $15 is not idle
+	cc := &ClusterCosts{
+		CPUCumulative: 10.0,
+		CPUBreakdown:  &ClusterCostsBreakdown{Idle: 0.3, User: 0.7},
+		RAMCumulative: 5.0,
+		RAMBreakdown:  &ClusterCostsBreakdown{Idle: 0.6, User: 0.4},
+	}
+	if score := cc.EfficiencyScore(); !util.IsApproximately(score, 0.6) {
+		t.Errorf("expected efficiency 0.6; got %f", score)
+	}
+
+	// Resources without breakdowns are not considered
+	cc.RAMBreakdown = nil
+	if score := cc.EfficiencyScore(); !util.IsApproximately(score, 0.7) {
+		t.Errorf("expected efficiency 0.7; got %f", score)
+	}
+
+	cc.CPUBreakdown = nil
+	if score := cc.EfficiencyScore(); !math.IsNaN(score) {
+		t.Errorf("expected NaN efficiency without breakdowns; got %f", score)
+	}
+}
+
+func TestClusterCosts_EfficiencyScore_Normalized(t *testing.T) {
+	// Fractions summing to 0.5 and 2.0 normalize to 60% and 25% idle
+	cc := &ClusterCosts{
+		CPUCumulative:   10.0,
+		CPUBreakdown:    &ClusterCostsBreakdown{Idle: 0.3, User: 0.2},
+		RAMCumulative:   5.0,
+		RAMBreakdown:    &ClusterCostsBreakdown{Idle: 0.5, User: 1.5},
+		TotalCumulative: 15.0,
+	}
+
+	expected := (10.0*0.4 + 5.0*0.75) / 15.0
+	score := cc.EfficiencyScore()
+	if !util.IsApproximately(score, expected) {
+		t.Errorf("expected efficiency %f; got %f", expected, score)
+	}
+
+	// Without storage, the score is the complement of the idle share
+	idle, ok := cc.IdleCost()
+	if !ok {
+		t.Fatalf("expected idle cost")
+	}
+	if !util.IsApproximately(score, 1.0-idle/cc.TotalCumulative) {
+		t.Errorf("expected efficiency %f to match idle share %f", score, idle/cc.TotalCumulative)
+	}
+}
+
+func TestEfficiencyOverTime(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(3 * time.Hour)
+
+	// RAM is 60% then 80% used in the first two hourly buckets, with no
+	// breakdown data in the third
+	ramUserPct := func(bucketEnd time.Time, pct float64) mockPromResponse {
+		return mockPromResponse{
+			Match:  fmt.Sprintf("kubecost_cluster_memory_working_set_bytes[1h0m0s:5m]@ %d", bucketEnd.Unix()),
+			Result: fmt.Sprintf(`[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"%f"]}]`, pct),
+		}
+	}
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	client.responses = append([]mockPromResponse{
+		ramUserPct(start.Add(1*time.Hour), 0.6),
+		ramUserPct(start.Add(2*time.Hour), 0.8),
+	}, client.responses...)
+
+	series, err := EfficiencyOverTime(client, &mockProvider{config: &cloud.CustomPricing{}}, start, end, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	efficiency, ok := series["cluster1"]
+	if !ok || len(efficiency) != 3 {
+		t.Fatalf("expected 3 buckets for cluster1; got %v", series)
+	}
+	if !util.IsApproximately(efficiency[0], 0.6) || !util.IsApproximately(efficiency[1], 0.8) {
+		t.Errorf("expected efficiency [0.6, 0.8, NaN]; got %v", efficiency)
+	}
+	if !math.IsNaN(efficiency[2]) {
+		t.Errorf("expected NaN efficiency for bucket without breakdown; got %f", efficiency[2])
+	}
+
+	illegal := []struct {
+		start, end time.Time
+		step       time.Duration
+	}{
+		{start: end, end: start, step: time.Hour},
+		{start: start, end: end, step: 0},
+		{start: start, end: start.Add(24 * time.Hour), step: time.Minute},
+	}
+	for _, tc := range illegal {
+		if _, err := EfficiencyOverTime(client, &mockProvider{config: &cloud.CustomPricing{}}, tc.start, tc.end, tc.step); err == nil {
+			t.Errorf("expected error for range [%s, %s) with step %s", tc.start, tc.end, tc.step)
+		}
+	}
+}
+
+func TestEfficiencySeries(t *testing.T) {
+	withRAMIdle := func(idle float64) *ClusterCosts {
+		return &ClusterCosts{RAMCumulative: 1.0, RAMBreakdown: &ClusterCostsBreakdown{Idle: idle, User: 1.0 - idle}}
+	}
+
+	// cluster2 only exists in the middle bucket
+	series := efficiencySeries([]map[string]*ClusterCosts{
+		{"cluster1": withRAMIdle(0.5)},
+		{"cluster1": withRAMIdle(0.25), "cluster2": withRAMIdle(0.0)},
+		{"cluster1": withRAMIdle(0.0)},
+	})
+
+	if c1 := series["cluster1"]; len(c1) != 3 || c1[0] != 0.5 || c1[1] != 0.75 || c1[2] != 1.0 {
+		t.Errorf("expected cluster1 efficiency [0.5, 0.75, 1]; got %v", c1)
+	}
+	if c2 := series["cluster2"]; len(c2) != 3 || !math.IsNaN(c2[0]) || c2[1] != 1.0 || !math.IsNaN(c2[2]) {
+		t.Errorf("expected cluster2 efficiency [NaN, 1, NaN]; got %v", c2)
+	}
+}
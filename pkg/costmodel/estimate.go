@@ -0,0 +1,140 @@
+package costmodel
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EstimateNodeAdditionCost projects the monthly cost of adding count nodes of
+// the given instance type, e.g. 3 "m5.2xlarge", to the cluster, for capacity
+// planning. The instance type is priced by the provider in the cluster's
+// region, if known, and its CPU and RAM, and GPUs if any, are priced
+// separately according to the instance's specs. Discounts are applied as in
+// ComputeClusterCosts. The resulting ClusterCosts spans a month, so its
+// cumulative and monthly costs are equal. Returns an error if the provider
+// cannot price the instance type or does not know its specs.
+func EstimateNodeAdditionCost(provider cloud.Provider, instanceType string, count int) (*ClusterCosts, error) {
+	if instanceType == "" {
+		return nil, fmt.Errorf("illegal instance type: must not be empty")
+	}
+	if count <= 0 {
+		return nil, fmt.Errorf("illegal node count: %d; must be positive", count)
+	}
+
+	labels := map[string]string{
+		v1.LabelInstanceType:       instanceType,
+		v1.LabelInstanceTypeStable: instanceType,
+	}
+	if info, err := provider.ClusterInfo(); err == nil {
+		if region := info["region"]; region != "" {
+			labels[v1.LabelZoneRegion] = region
+			labels[v1.LabelTopologyRegion] = region
+		}
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: labels}}
+
+	pricing, err := provider.NodePricing(provider.GetKey(labels, node))
+	if err != nil {
+		return nil, fmt.Errorf("unknown instance type %q: %s", instanceType, err)
+	}
+	if pricing == nil {
+		return nil, fmt.Errorf("unknown instance type %q: no pricing found", instanceType)
+	}
+
+	cpuHourly, ramHourly, gpuHourly, err := nodeHourlyCosts(pricing, provider)
+	if err != nil {
+		return nil, fmt.Errorf("instance type %q: %s", instanceType, err)
+	}
+
+	discount, customDiscount := providerDiscounts(provider, nil).forCluster(env.GetClusterIDOrDefault())
+
+	nodes := float64(count)
+	cpu := cpuHourly * nodes * timeutil.HoursPerMonth * (1.0 - discount) * (1.0 - customDiscount)
+	ram := ramHourly * nodes * timeutil.HoursPerMonth * (1.0 - discount) * (1.0 - customDiscount)
+	gpu := gpuHourly * nodes * timeutil.HoursPerMonth * (1.0 - customDiscount)
+
+	month := time.Duration(timeutil.HoursPerMonth * float64(time.Hour))
+	return NewClusterCostsFromCumulative(cpu, gpu, ram, 0.0, month, 0, timeutil.HoursPerMonth)
+}
+
+// nodeHourlyCosts returns the hourly CPU, RAM, and GPU costs of a single node
+// with the given pricing. If the pricing has no separate CPU and RAM prices,
+// the node's total cost is split between CPU and RAM in proportion to the
+// provider's default CPU and RAM prices, as in GetNodeCost.
+func nodeHourlyCosts(pricing *cloud.Node, provider cloud.Provider) (float64, float64, float64, error) {
+	cpus, err := strconv.ParseFloat(strings.TrimSpace(pricing.VCPU), 64)
+	if err != nil || cpus <= 0 {
+		return 0, 0, 0, fmt.Errorf("no CPU specs available")
+	}
+
+	ramGiB, err := nodeRAMGiB(pricing)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	parse := func(value string) float64 {
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return 0.0
+		}
+		return f
+	}
+
+	gpuHourly := 0.0
+	if gpus := parse(pricing.GPU); gpus > 0 {
+		gpuHourly = gpus * parse(pricing.GPUCost)
+	}
+
+	if pricing.VCPUCost != "" && pricing.RAMCost != "" {
+		return cpus * parse(pricing.VCPUCost), ramGiB * parse(pricing.RAMCost), gpuHourly, nil
+	}
+
+	nodeHourly := parse(pricing.Cost) - gpuHourly
+	if nodeHourly <= 0 {
+		return 0, 0, 0, fmt.Errorf("no price available")
+	}
+
+	cpuToRAMRatio := 0.0
+	if cfg, err := provider.GetConfig(); err == nil && cfg != nil {
+		if defaultRAM := parse(cfg.RAM); defaultRAM > 0 {
+			cpuToRAMRatio = parse(cfg.CPU) / defaultRAM
+		}
+	}
+
+	ramMultiple := cpus*cpuToRAMRatio + ramGiB
+	if ramMultiple <= 0 {
+		return nodeHourly, 0.0, gpuHourly, nil
+	}
+	ramPrice := nodeHourly / ramMultiple
+
+	return cpus * ramPrice * cpuToRAMRatio, ramGiB * ramPrice, gpuHourly, nil
+}
+
+// nodeRAMGiB returns the RAM of a node with the given pricing, in GiB, from
+// its RAM in bytes or, failing that, its RAM as reported by the provider,
+// e.g. "32 GiB" or "32Gi".
+func nodeRAMGiB(pricing *cloud.Node) (float64, error) {
+	if bytes, err := strconv.ParseFloat(strings.TrimSpace(pricing.RAMBytes), 64); err == nil && bytes > 0 {
+		return bytes / 1024 / 1024 / 1024, nil
+	}
+
+	ram := strings.TrimSpace(pricing.RAM)
+	if gib, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(ram, "GiB")), 64); err == nil && gib > 0 {
+		return gib, nil
+	}
+	if q, err := resource.ParseQuantity(ram); err == nil && q.Value() > 0 {
+		return float64(q.Value()) / 1024 / 1024 / 1024, nil
+	}
+
+	return 0, fmt.Errorf("no RAM specs available")
+}
@@ -0,0 +1,106 @@
+package costmodel
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/util"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// instanceTypeKey is a cloud.Key identifying a node by its instance type
+type instanceTypeKey string
+
+func (k instanceTypeKey) ID() string       { return "" }
+func (k instanceTypeKey) Features() string { return string(k) }
+func (k instanceTypeKey) GPUType() string  { return "" }
+
+// pricedProvider is a mockProvider pricing nodes by instance type
+type pricedProvider struct {
+	mockProvider
+	nodes map[string]*cloud.Node
+}
+
+func (pp *pricedProvider) ClusterInfo() (map[string]string, error) {
+	return map[string]string{"region": "us-east-1"}, nil
+}
+
+func (pp *pricedProvider) GetKey(labels map[string]string, n *v1.Node) cloud.Key {
+	return instanceTypeKey(labels[v1.LabelInstanceTypeStable])
+}
+
+func (pp *pricedProvider) NodePricing(key cloud.Key) (*cloud.Node, error) {
+	node, ok := pp.nodes[key.Features()]
+	if !ok {
+		return nil, fmt.Errorf("no pricing for %s", key.Features())
+	}
+	return node, nil
+}
+
+func TestEstimateNodeAdditionCost(t *testing.T) {
+	provider := &pricedProvider{
+		mockProvider: mockProvider{config: &cloud.CustomPricing{CPU: "0.031611", RAM: "0.004237"}},
+		nodes: map[string]*cloud.Node{
+			// Separate CPU and RAM prices
+			"m5.2xlarge": {VCPU: "8", RAM: "32 GiB", VCPUCost: "0.03", RAMCost: "0.004"},
+			// Total price only: split in proportion to the default prices
+			"c5.xlarge": {VCPU: "4", RAM: "8 GiB", Cost: "0.17"},
+			// No specs
+			"x1.mystery": {Cost: "1.0"},
+		},
+	}
+
+	// 3 m5.2xlarge: $0.24/hr of CPU and $0.128/hr of RAM each
+	cc, err := EstimateNodeAdditionCost(provider, "m5.2xlarge", 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expCPU := 3 * 8 * 0.03 * timeutil.HoursPerMonth
+	expRAM := 3 * 32 * 0.004 * timeutil.HoursPerMonth
+	if !util.IsApproximately(cc.CPUMonthly, expCPU) {
+		t.Errorf("expected monthly CPU cost %f; got %f", expCPU, cc.CPUMonthly)
+	}
+	if !util.IsApproximately(cc.RAMMonthly, expRAM) {
+		t.Errorf("expected monthly RAM cost %f; got %f", expRAM, cc.RAMMonthly)
+	}
+	if !util.IsApproximately(cc.TotalMonthly, expCPU+expRAM) {
+		t.Errorf("expected monthly total cost %f; got %f", expCPU+expRAM, cc.TotalMonthly)
+	}
+	if !util.IsApproximately(cc.TotalCumulative, cc.TotalMonthly) {
+		t.Errorf("expected cumulative cost over a month to equal monthly cost; got %f and %f", cc.TotalCumulative, cc.TotalMonthly)
+	}
+
+	// The total price is preserved when split
+	cc, err = EstimateNodeAdditionCost(provider, "c5.xlarge", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if exp := 2 * 0.17 * timeutil.HoursPerMonth; !util.IsApproximately(cc.TotalMonthly, exp) {
+		t.Errorf("expected monthly total cost %f; got %f", exp, cc.TotalMonthly)
+	}
+	if cc.CPUMonthly <= 0 || cc.RAMMonthly <= 0 {
+		t.Errorf("expected cost split between CPU and RAM; got %f and %f", cc.CPUMonthly, cc.RAMMonthly)
+	}
+
+	// Discounts apply
+	provider.config.Discount = "50%"
+	cc, err = EstimateNodeAdditionCost(provider, "m5.2xlarge", 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !util.IsApproximately(cc.TotalMonthly, (expCPU+expRAM)*0.5) {
+		t.Errorf("expected discounted monthly total cost %f; got %f", (expCPU+expRAM)*0.5, cc.TotalMonthly)
+	}
+
+	for _, instanceType := range []string{"unknown.large", "x1.mystery", ""} {
+		if _, err := EstimateNodeAdditionCost(provider, instanceType, 1); err == nil {
+			t.Errorf("expected error for instance type %q", instanceType)
+		}
+	}
+	if _, err := EstimateNodeAdditionCost(provider, "m5.2xlarge", 0); err == nil {
+		t.Errorf("expected error for zero nodes")
+	}
+}
@@ -0,0 +1,137 @@
+package costmodel
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// ExportOptions provides optional parameters to the CSV and line protocol
+// writers of ClusterCosts.
+type ExportOptions struct {
+	// Precision, if set and not negative, is the number of decimal places to
+	// which monetary values are written; e.g. 0 for whole units. Otherwise,
+	// each writer's default is used.
+	Precision *int
+
+	// BreakdownPrecision, if set and not negative, is the number of decimal
+	// places to which breakdown fractions are written. Otherwise, each
+	// writer's default is used.
+	BreakdownPrecision *int
+}
+
+// precision returns the decimal precision of monetary values, or the given
+// default if none is set.
+func (eo *ExportOptions) precision(def int) int {
+	if eo == nil || eo.Precision == nil || *eo.Precision < 0 {
+		return def
+	}
+	return *eo.Precision
+}
+
+// breakdownPrecision returns the decimal precision of breakdown fractions, or
+// the given default if none is set.
+func (eo *ExportOptions) breakdownPrecision(def int) int {
+	if eo == nil || eo.BreakdownPrecision == nil || *eo.BreakdownPrecision < 0 {
+		return def
+	}
+	return *eo.BreakdownPrecision
+}
+
+// defaultCSVPrecision is the decimal precision of values written by
+// WriteClusterCostsCSV by default, matching the %f verb.
+const defaultCSVPrecision = 6
+
+// clusterCostsCSVHeader is the header row written by WriteClusterCostsCSV
+var clusterCostsCSVHeader = []string{
+	"cluster_id",
+	"window",
+	"offset",
+	"cpu_cumulative_cost",
+	"cpu_monthly_cost",
+	"gpu_cumulative_cost",
+	"gpu_monthly_cost",
+	"ram_cumulative_cost",
+	"ram_monthly_cost",
+	"storage_cumulative_cost",
+	"storage_monthly_cost",
+	"total_cumulative_cost",
+	"total_monthly_cost",
+	"cpu_breakdown_idle",
+	"cpu_breakdown_other",
+	"cpu_breakdown_system",
+	"cpu_breakdown_user",
+	"ram_breakdown_idle",
+	"ram_breakdown_other",
+	"ram_breakdown_system",
+	"ram_breakdown_user",
+	"storage_breakdown_idle",
+	"storage_breakdown_other",
+	"storage_breakdown_system",
+	"storage_breakdown_user",
+}
+
+// WriteClusterCostsCSV writes the given costs, keyed by cluster ID, to w as
+// CSV, with a header row followed by a row per cluster, in order of cluster
+// ID. Breakdown columns are empty for costs computed without breakdowns.
+// Values are written to six decimal places, unless the options set another
+// precision.
+func WriteClusterCostsCSV(w io.Writer, costs map[string]*ClusterCosts, opts *ExportOptions) error {
+	precision := opts.precision(defaultCSVPrecision)
+	breakdownPrecision := opts.breakdownPrecision(defaultCSVPrecision)
+
+	formatCost := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', precision, 64)
+	}
+
+	clusterIDs := make([]string, 0, len(costs))
+	for clusterID, cc := range costs {
+		if cc == nil {
+			continue
+		}
+		clusterIDs = append(clusterIDs, clusterID)
+	}
+	sort.Strings(clusterIDs)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(clusterCostsCSVHeader); err != nil {
+		return err
+	}
+
+	for _, clusterID := range clusterIDs {
+		cc := costs[clusterID]
+		row := []string{
+			clusterID,
+			cc.Window,
+			cc.Offset,
+			formatCost(cc.CPUCumulative),
+			formatCost(cc.CPUMonthly),
+			formatCost(cc.GPUCumulative),
+			formatCost(cc.GPUMonthly),
+			formatCost(cc.RAMCumulative),
+			formatCost(cc.RAMMonthly),
+			formatCost(cc.StorageCumulative),
+			formatCost(cc.StorageMonthly),
+			formatCost(cc.TotalCumulative),
+			formatCost(cc.TotalMonthly),
+		}
+
+		for _, bd := range []*ClusterCostsBreakdown{cc.CPUBreakdown, cc.RAMBreakdown, cc.StorageBreakdown} {
+			if bd == nil {
+				row = append(row, "", "", "", "")
+				continue
+			}
+			for _, f := range []float64{bd.Idle, bd.Other, bd.System, bd.User} {
+				row = append(row, strconv.FormatFloat(f, 'f', breakdownPrecision, 64))
+			}
+		}
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
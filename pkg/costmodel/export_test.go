@@ -0,0 +1,124 @@
+package costmodel
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteClusterCostsCSV(t *testing.T) {
+	costs := map[string]*ClusterCosts{
+		"cluster2": {
+			Window:          "1d",
+			CPUCumulative:   1.0 / 3.0,
+			TotalCumulative: 1.0 / 3.0,
+		},
+		"cluster1": {
+			Window:          "1d",
+			CPUCumulative:   10.123456789,
+			CPUBreakdown:    &ClusterCostsBreakdown{Idle: 2.0 / 3.0, User: 1.0 / 3.0},
+			TotalCumulative: 10.123456789,
+		},
+	}
+
+	read := func(opts *ExportOptions) [][]string {
+		var buf bytes.Buffer
+		if err := WriteClusterCostsCSV(&buf, costs, opts); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		rows, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatalf("unexpected error reading CSV: %s", err)
+		}
+		if len(rows) != 3 {
+			t.Fatalf("expected a header and 2 rows; got %d rows", len(rows))
+		}
+		return rows
+	}
+	column := func(name string) int {
+		for i, header := range clusterCostsCSVHeader {
+			if header == name {
+				return i
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return -1
+	}
+	cpu, cpuIdle := column("cpu_cumulative_cost"), column("cpu_breakdown_idle")
+
+	// Six decimal places by default, in order of cluster ID
+	rows := read(nil)
+	if rows[1][0] != "cluster1" || rows[2][0] != "cluster2" {
+		t.Errorf("expected rows in order of cluster ID; got %s, %s", rows[1][0], rows[2][0])
+	}
+	if rows[1][cpu] != "10.123457" {
+		t.Errorf("expected CPU cost 10.123457; got %s", rows[1][cpu])
+	}
+	if rows[1][cpuIdle] != "0.666667" {
+		t.Errorf("expected CPU idle 0.666667; got %s", rows[1][cpuIdle])
+	}
+	if rows[2][cpuIdle] != "" {
+		t.Errorf("expected empty breakdown without breakdown; got %s", rows[2][cpuIdle])
+	}
+
+	// Four decimal places for costs; breakdowns separately
+	precision, breakdownPrecision := 4, 2
+	rows = read(&ExportOptions{Precision: &precision, BreakdownPrecision: &breakdownPrecision})
+	if rows[1][cpu] != "10.1235" || rows[2][cpu] != "0.3333" {
+		t.Errorf("expected CPU costs 10.1235 and 0.3333; got %s and %s", rows[1][cpu], rows[2][cpu])
+	}
+	if rows[1][cpuIdle] != "0.67" {
+		t.Errorf("expected CPU idle 0.67; got %s", rows[1][cpuIdle])
+	}
+
+	// Zero decimal places for whole units
+	precision = 0
+	rows = read(&ExportOptions{Precision: &precision})
+	if rows[1][cpu] != "10" || rows[2][cpu] != "0" {
+		t.Errorf("expected CPU costs 10 and 0; got %s and %s", rows[1][cpu], rows[2][cpu])
+	}
+	if rows[1][cpuIdle] != "0.666667" {
+		t.Errorf("expected CPU idle 0.666667; got %s", rows[1][cpuIdle])
+	}
+
+	// Negative precision is the default
+	precision = -1
+	rows = read(&ExportOptions{Precision: &precision})
+	if rows[1][cpu] != "10.123457" {
+		t.Errorf("expected CPU cost 10.123457; got %s", rows[1][cpu])
+	}
+}
+
+func TestClusterCosts_WriteInfluxLineProtocolWithOptions(t *testing.T) {
+	cc := &ClusterCosts{
+		CPUCumulative: 10.123456789,
+		CPUBreakdown:  &ClusterCostsBreakdown{Idle: 2.0 / 3.0, User: 1.0 / 3.0},
+	}
+	ts := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	write := func(opts *ExportOptions) string {
+		var buf bytes.Buffer
+		if err := cc.WriteInfluxLineProtocolWithOptions(&buf, "cluster1", ts, opts); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return buf.String()
+	}
+
+	precision, breakdownPrecision := 4, 2
+	line := write(&ExportOptions{Precision: &precision, BreakdownPrecision: &breakdownPrecision})
+	for _, field := range []string{"cpu_cumulative_cost=10.1235", "ram_cumulative_cost=0.0000", "cpu_breakdown_idle=0.67"} {
+		if !strings.Contains(line, field) {
+			t.Errorf("expected field %s; got %s", field, line)
+		}
+	}
+
+	precision, breakdownPrecision = 0, 0
+	line = write(&ExportOptions{Precision: &precision, BreakdownPrecision: &breakdownPrecision})
+	for _, field := range []string{"cpu_cumulative_cost=10,", "ram_cumulative_cost=0,", "cpu_breakdown_idle=1,"} {
+		if !strings.Contains(line, field) {
+			t.Errorf("expected field %s; got %s", field, line)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package costmodel
+
+import (
+	"sort"
+)
+
+// ClusterIdle is the cumulative cost of a cluster's idle resources, for
+// targeting clusters for reclamation.
+type ClusterIdle struct {
+	ClusterID string  `json:"clusterId"`
+	IdleCost  float64 `json:"idleCost"`
+	IdlePct   float64 `json:"idlePct"`
+}
+
+// normalized returns a copy of the breakdown with its fractions scaled to sum
+// to 1.0, or nil if the breakdown is nil or its fractions sum to zero.
+func (ccb *ClusterCostsBreakdown) normalized() *ClusterCostsBreakdown {
+	if ccb == nil {
+		return nil
+	}
+
+	sum := ccb.Idle + ccb.Other + ccb.System + ccb.User
+	if sum <= 0 {
+		return nil
+	}
+
+	return &ClusterCostsBreakdown{
+		Idle:   ccb.Idle / sum,
+		Other:  ccb.Other / sum,
+		System: ccb.System / sum,
+		User:   ccb.User / sum,
+	}
+}
+
+// IdleCost returns the cumulative cost of the idle fractions of the cluster's
+// CPU, RAM, and storage, according to their normalized breakdowns, and true.
+// GPU costs have no breakdown, so are never idle. Returns false if the CPU or
+// RAM breakdown is missing; a missing storage breakdown counts as no idle
+// storage.
+func (cc *ClusterCosts) IdleCost() (float64, bool) {
+	if cc == nil {
+		return 0.0, false
+	}
+
+	cpuBD, ramBD := cc.CPUBreakdown.normalized(), cc.RAMBreakdown.normalized()
+	if cpuBD == nil || ramBD == nil {
+		return 0.0, false
+	}
+
+	idle := cc.CPUCumulative*cpuBD.Idle + cc.RAMCumulative*ramBD.Idle
+	if storageBD := cc.StorageBreakdown.normalized(); storageBD != nil {
+		idle += cc.StorageCumulative * storageBD.Idle
+	}
+
+	return idle, true
+}
+
+// MostIdleClusters returns the n clusters with the greatest idle cost, in
+// descending order of idle cost, with ties broken by cluster ID. IdlePct is
+// the fraction, in [0, 1], of each cluster's TotalCumulative that is idle.
+// Clusters missing CPU or RAM breakdowns, e.g. computed without
+// WithBreakdown, are excluded.
+func MostIdleClusters(costs map[string]*ClusterCosts, n int) []ClusterIdle {
+	idles := []ClusterIdle{}
+	for clusterID, cc := range costs {
+		idle, ok := cc.IdleCost()
+		if !ok {
+			continue
+		}
+
+		pct := 0.0
+		if cc.TotalCumulative > 0 {
+			pct = idle / cc.TotalCumulative
+		}
+
+		idles = append(idles, ClusterIdle{
+			ClusterID: clusterID,
+			IdleCost:  idle,
+			IdlePct:   pct,
+		})
+	}
+
+	sort.Slice(idles, func(i, j int) bool {
+		if idles[i].IdleCost != idles[j].IdleCost {
+			return idles[i].IdleCost > idles[j].IdleCost
+		}
+		return idles[i].ClusterID < idles[j].ClusterID
+	})
+
+	if n < 0 {
+		n = 0
+	}
+	if n < len(idles) {
+		idles = idles[:n]
+	}
+
+	return idles
+}
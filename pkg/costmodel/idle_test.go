@@ -0,0 +1,74 @@
+package costmodel
+
+import (
+	"testing"
+
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestMostIdleClusters(t *testing.T) {
+	costs := map[string]*ClusterCosts{
+		// 40% of $100 CPU and 50% of $50 RAM idle: $65 of $150
+		"cluster1": {
+			CPUCumulative:   100.0,
+			CPUBreakdown:    &ClusterCostsBreakdown{Idle: 0.4, User: 0.6},
+			RAMCumulative:   50.0,
+			RAMBreakdown:    &ClusterCostsBreakdown{Idle: 0.5, User: 0.5},
+			TotalCumulative: 150.0,
+		},
+		// 90% of $20 CPU, 10% of $20 RAM, and half of $20 storage idle: $30 of
+		// $60. The RAM breakdown sums to 2.0, so is normalized.
+		"cluster2": {
+			CPUCumulative:     20.0,
+			CPUBreakdown:      &ClusterCostsBreakdown{Idle: 0.9, User: 0.1},
+			RAMCumulative:     20.0,
+			RAMBreakdown:      &ClusterCostsBreakdown{Idle: 0.2, User: 1.8},
+			StorageCumulative: 20.0,
+			StorageBreakdown:  &ClusterCostsBreakdown{Idle: 0.5, User: 0.5},
+			TotalCumulative:   60.0,
+		},
+		// 10% of $200 CPU and none of $100 RAM idle: $20 of $300
+		"cluster3": {
+			CPUCumulative:   200.0,
+			CPUBreakdown:    &ClusterCostsBreakdown{Idle: 0.1, User: 0.9},
+			RAMCumulative:   100.0,
+			RAMBreakdown:    &ClusterCostsBreakdown{User: 1.0},
+			TotalCumulative: 300.0,
+		},
+		// No breakdowns: excluded
+		"cluster4": {
+			CPUCumulative:   1000.0,
+			TotalCumulative: 1000.0,
+		},
+	}
+
+	idles := MostIdleClusters(costs, 10)
+	expected := []ClusterIdle{
+		{ClusterID: "cluster1", IdleCost: 65.0, IdlePct: 65.0 / 150.0},
+		{ClusterID: "cluster2", IdleCost: 30.0, IdlePct: 0.5},
+		{ClusterID: "cluster3", IdleCost: 20.0, IdlePct: 20.0 / 300.0},
+	}
+	if len(idles) != len(expected) {
+		t.Fatalf("expected %d clusters; got %d: %v", len(expected), len(idles), idles)
+	}
+	for i, exp := range expected {
+		act := idles[i]
+		if act.ClusterID != exp.ClusterID {
+			t.Errorf("rank %d: expected %s; got %s", i, exp.ClusterID, act.ClusterID)
+			continue
+		}
+		if !util.IsApproximately(act.IdleCost, exp.IdleCost) {
+			t.Errorf("%s: expected idle cost %f; got %f", exp.ClusterID, exp.IdleCost, act.IdleCost)
+		}
+		if !util.IsApproximately(act.IdlePct, exp.IdlePct) {
+			t.Errorf("%s: expected idle pct %f; got %f", exp.ClusterID, exp.IdlePct, act.IdlePct)
+		}
+	}
+
+	if top := MostIdleClusters(costs, 2); len(top) != 2 || top[1].ClusterID != "cluster2" {
+		t.Errorf("expected top 2 clusters to be cluster1 and cluster2; got %v", top)
+	}
+	if none := MostIdleClusters(costs, 0); len(none) != 0 {
+		t.Errorf("expected no clusters for n=0; got %v", none)
+	}
+}
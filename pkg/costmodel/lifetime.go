@@ -0,0 +1,137 @@
+package costmodel
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
+
+// LifetimeLookback is how far back LifetimeCost looks for the first data of
+// a cluster by default.
+const LifetimeLookback = 30 * 24 * time.Hour
+
+// LifetimeCostOptions are the optional parameters of LifetimeCost.
+type LifetimeCostOptions struct {
+	// Lookback is how far back from now to look for the first data of the
+	// cluster, bounding the span over which it is costed. Clusters whose data
+	// begins earlier are costed from this far back. Defaults to
+	// LifetimeLookback if zero.
+	Lookback time.Duration
+
+	// Clock provides the time from which Lookback is taken, and up to which
+	// running clusters are costed. Defaults to timeutil.RealClock if nil.
+	Clock timeutil.Clock
+}
+
+// LifetimeCost gives the cumulative costs of the given cluster over its whole
+// lifetime, from the first to the last time its nodes were observed, e.g. for
+// short-lived CI clusters. A cluster observed within the last two resolution
+// steps is considered still running, and costed up to now. Monthly-rate costs
+// are not projected from the lifetime, so are zero. The options may be nil.
+func LifetimeCost(client prometheus.Client, provider cloud.Provider, clusterID string, opts *LifetimeCostOptions) (*ClusterCosts, error) {
+	if opts == nil {
+		opts = &LifetimeCostOptions{}
+	}
+
+	if clusterID == "" {
+		return nil, fmt.Errorf("illegal cluster ID: must not be empty")
+	}
+
+	lookback := opts.Lookback
+	if lookback == 0 {
+		lookback = LifetimeLookback
+	}
+
+	clock := opts.Clock
+	if clock == nil {
+		clock = timeutil.RealClock{}
+	}
+
+	// minsPerResolution determines the precision of the lifetime, and the
+	// resource use of the queries discovering it
+	minsPerResolution := 5
+	resolution := time.Duration(minsPerResolution) * time.Minute
+	if lookback < resolution {
+		return nil, fmt.Errorf("illegal lookback: %s; must be at least %s", lookback, resolution)
+	}
+
+	const fmtQueryLifetimeBound = `
+		%s(timestamp(count(kube_node_status_capacity_cpu_cores{%s="%s"}))[%s:%dm])
+	`
+
+	fmtLookback := timeutil.DurationString(lookback)
+
+	clusterLabel := env.GetPromClusterLabel()
+	clusterValue := promLabelValue(clusterID)
+
+	ctx := prom.NewNamedContext(client, prom.ClusterContextName)
+	resChs := ctx.QueryAll(
+		fmt.Sprintf(fmtQueryLifetimeBound, "min_over_time", clusterLabel, clusterValue, fmtLookback, minsPerResolution),
+		fmt.Sprintf(fmtQueryLifetimeBound, "max_over_time", clusterLabel, clusterValue, fmtLookback, minsPerResolution),
+	)
+
+	resFirst, _ := resChs[0].Await()
+	resLast, _ := resChs[1].Await()
+	if ctx.HasErrors() {
+		return nil, ctx.ErrorCollection()
+	}
+
+	timestamp := func(results []*prom.QueryResult) (time.Time, bool) {
+		if len(results) == 0 || len(results[0].Values) == 0 {
+			return time.Time{}, false
+		}
+		secs, frac := math.Modf(results[0].Values[0].Value)
+		return time.Unix(int64(secs), int64(frac*1e9)).UTC(), true
+	}
+
+	start, ok := timestamp(resFirst)
+	if !ok {
+		return nil, fmt.Errorf("no data for cluster %s in the last %s", clusterID, fmtLookback)
+	}
+	end, ok := timestamp(resLast)
+	if !ok {
+		return nil, fmt.Errorf("no data for cluster %s in the last %s", clusterID, fmtLookback)
+	}
+
+	now := clock.Now().UTC().Truncate(time.Second)
+	if now.Sub(end) <= 2*resolution {
+		end = now
+	}
+
+	window := end.Sub(start).Truncate(time.Second)
+	if window <= 0 {
+		return nil, fmt.Errorf("cluster %s has no lifetime: first and last observed at %s", clusterID, start.Format(time.RFC3339))
+	}
+	offset := now.Sub(end).Truncate(time.Second)
+
+	a := &Accesses{CloudProvider: provider}
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, window, offset, &ClusterCostsOptions{Clock: clock})
+	if err != nil {
+		return nil, err
+	}
+
+	cc, ok := costs[clusterID]
+	if !ok {
+		return nil, fmt.Errorf("no costs for cluster %s between %s and %s", clusterID, start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+
+	// Span exactly the lifetime, rather than the window as of the time the
+	// costs were computed, and project nothing beyond it
+	cc.Start = &start
+	cc.End = &end
+	cc.CPUMonthly = 0.0
+	cc.GPUMonthly = 0.0
+	cc.RAMMonthly = 0.0
+	cc.StorageMonthly = 0.0
+	cc.TotalMonthly = 0.0
+	cc.ProjectionConfidence = ""
+
+	return cc, nil
+}
@@ -0,0 +1,90 @@
+package costmodel
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/util"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+)
+
+func TestLifetimeCost(t *testing.T) {
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+
+	// cluster1 lived for 3 hours, from 2021-01-01T00:00:00Z
+	first := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := first.Add(3 * time.Hour)
+
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	client.responses = append([]mockPromResponse{
+		{Match: "min_over_time(timestamp(", Result: fmt.Sprintf(`[{"metric":{},"value":[1609459200,"%d"]}]`, first.Unix())},
+		{Match: "max_over_time(timestamp(", Result: fmt.Sprintf(`[{"metric":{},"value":[1609459200,"%d"]}]`, last.Unix())},
+		{Match: "count_over_time(sum(kube_node_status_capacity_cpu_cores)", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"180"]}]`},
+	}, client.responses...)
+
+	// The cluster stopped a day ago
+	clock := &timeutil.FakeClock{T: last.Add(24 * time.Hour)}
+	opts := &LifetimeCostOptions{Clock: clock}
+
+	cc, err := LifetimeCost(client, provider, "cluster1", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !cc.Start.Equal(first) || !cc.End.Equal(last) {
+		t.Errorf("expected lifetime [%s, %s]; got [%s, %s]", first, last, cc.Start, cc.End)
+	}
+	if !util.IsApproximately(cc.TotalCumulative, 16.0) {
+		t.Errorf("expected cumulative cost 16.0; got %f", cc.TotalCumulative)
+	}
+	if cc.TotalMonthly != 0.0 || cc.CPUMonthly != 0.0 || cc.RAMMonthly != 0.0 || cc.StorageMonthly != 0.0 {
+		t.Errorf("expected no monthly projection; got %f", cc.TotalMonthly)
+	}
+
+	queries := strings.Join(client.Queries(), "\n")
+	if !strings.Contains(queries, `kube_node_status_capacity_cpu_cores{cluster_id="cluster1"}`) {
+		t.Errorf("expected lifetime to be discovered for cluster1")
+	}
+	if !strings.Contains(queries, "[3h0m0s:5m]") {
+		t.Errorf("expected costs to be queried over the 3h lifetime")
+	}
+	if !strings.Contains(queries, "offset 1d") {
+		t.Errorf("expected costs to be queried as of a day before the clock")
+	}
+	if !strings.Contains(queries, fmt.Sprintf("[%s:5m]", timeutil.DurationString(LifetimeLookback))) {
+		t.Errorf("expected lifetime to be discovered over the default lookback")
+	}
+
+	// A cluster observed within the last resolution step is still running
+	clock.T = last.Add(time.Minute)
+	cc, err = LifetimeCost(client, provider, "cluster1", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !cc.End.Equal(clock.T) {
+		t.Errorf("expected running cluster to be costed up to now %s; got end %s", clock.T, cc.End)
+	}
+
+	// The lookback bounds the span in which the lifetime is discovered
+	client = newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	if _, err := LifetimeCost(client, provider, "cluster1", &LifetimeCostOptions{Clock: clock, Lookback: 48 * time.Hour}); err == nil {
+		t.Errorf("expected error for cluster without data")
+	}
+	if queries := strings.Join(client.Queries(), "\n"); !strings.Contains(queries, "[2d:5m]") {
+		t.Errorf("expected lifetime to be discovered over the 2d lookback; got:\n%s", queries)
+	}
+	if _, err := LifetimeCost(client, provider, "cluster1", &LifetimeCostOptions{Lookback: time.Minute}); err == nil {
+		t.Errorf("expected error for lookback shorter than the resolution")
+	}
+
+	// Unknown clusters have no data
+	if _, err := LifetimeCost(newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0), provider, "cluster2", opts); err == nil {
+		t.Errorf("expected error for cluster without data")
+	}
+	if _, err := LifetimeCost(client, provider, "", nil); err == nil {
+		t.Errorf("expected error for empty cluster ID")
+	}
+}
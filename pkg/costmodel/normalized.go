@@ -0,0 +1,48 @@
+package costmodel
+
+import (
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
+
+// NormalizedClusterCost holds the monthly-rate CPU and RAM costs of a cluster
+// per unit of provisioned capacity, for comparing clusters of different sizes.
+type NormalizedClusterCost struct {
+	CPUCores          float64 `json:"cpuCores"`
+	RAMGiB            float64 `json:"ramGiB"`
+	CPUMonthlyPerCore float64 `json:"cpuMonthlyCostPerCore"`
+	RAMMonthlyPerGiB  float64 `json:"ramMonthlyCostPerGiB"`
+}
+
+// NormalizedCosts gives, per cluster, the monthly-rate CPU cost per vCPU and
+// RAM cost per GiB, dividing the costs computed by ComputeClusterCosts by the
+// average CPU cores and RAM GiB provisioned over the window, as reported by
+// ComputeClusterCosts WithCapacity. Costs per unit are zero for clusters
+// without provisioned capacity.
+func NormalizedCosts(client prometheus.Client, provider cloud.Provider, window, offset time.Duration) (map[string]*NormalizedClusterCost, error) {
+	a := &Accesses{CloudProvider: provider}
+	costs, err := a.ComputeClusterCostsWithOptions(client, provider, window, offset, &ClusterCostsOptions{WithCapacity: true})
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := map[string]*NormalizedClusterCost{}
+	for clusterID, cc := range costs {
+		nc := &NormalizedClusterCost{
+			CPUCores: cc.ProvisionedCPU,
+			RAMGiB:   cc.ProvisionedRAMGiB,
+		}
+		if nc.CPUCores > 0 {
+			nc.CPUMonthlyPerCore = cc.CPUMonthly / nc.CPUCores
+		}
+		if nc.RAMGiB > 0 {
+			nc.RAMMonthlyPerGiB = cc.RAMMonthly / nc.RAMGiB
+		}
+		normalized[clusterID] = nc
+	}
+
+	return normalized, nil
+}
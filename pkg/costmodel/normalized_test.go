@@ -0,0 +1,64 @@
+package costmodel
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/util"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+)
+
+func TestNormalizedCosts(t *testing.T) {
+	// $10 of CPU and $5 of RAM over a day, on 4 cores and 8GiB of RAM
+	client := newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	client.responses = append([]mockPromResponse{
+		{Match: "avg_over_time(kube_node_status_capacity_cpu_cores[", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"4"]}]`},
+		{Match: "avg_over_time(kube_node_status_capacity_memory_bytes[", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"8589934592"]}]`},
+	}, client.responses...)
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+
+	normalized, err := NormalizedCosts(client, provider, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	nc, ok := normalized["cluster1"]
+	if !ok {
+		t.Fatalf("expected normalized costs for cluster1; got %v", normalized)
+	}
+	if !util.IsApproximately(nc.CPUCores, 4.0) || !util.IsApproximately(nc.RAMGiB, 8.0) {
+		t.Errorf("expected 4 cores and 8GiB; got %f cores and %fGiB", nc.CPUCores, nc.RAMGiB)
+	}
+
+	cpuPerCore := 10.0 / 24.0 * timeutil.HoursPerMonth / 4.0
+	if !util.IsApproximately(nc.CPUMonthlyPerCore, cpuPerCore) {
+		t.Errorf("expected monthly CPU cost per core %f; got %f", cpuPerCore, nc.CPUMonthlyPerCore)
+	}
+	ramPerGiB := 5.0 / 24.0 * timeutil.HoursPerMonth / 8.0
+	if !util.IsApproximately(nc.RAMMonthlyPerGiB, ramPerGiB) {
+		t.Errorf("expected monthly RAM cost per GiB %f; got %f", ramPerGiB, nc.RAMMonthlyPerGiB)
+	}
+
+	// No provisioned capacity: no division by zero
+	client = newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0)
+	normalized, err = NormalizedCosts(client, provider, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if nc := normalized["cluster1"]; nc == nil || nc.CPUMonthlyPerCore != 0.0 || nc.RAMMonthlyPerGiB != 0.0 {
+		t.Errorf("expected zero costs per unit without capacity; got %+v", nc)
+	}
+
+	// Capacity is queried once, by ComputeClusterCosts
+	count := 0
+	for _, query := range client.Queries() {
+		if strings.Contains(query, "avg_over_time(kube_node_status_capacity_cpu_cores[") {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected CPU capacity to be queried once; got %d", count)
+	}
+}
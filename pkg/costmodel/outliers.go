@@ -0,0 +1,112 @@
+package costmodel
+
+import (
+	"math"
+	"sort"
+)
+
+// minOutlierClusters is the fewest clusters among which CostOutliers finds
+// outliers; with fewer, the fleet has no meaningful norm.
+const minOutlierClusters = 3
+
+// cumulativeCost returns the cumulative cost of the given dimension, and
+// false if the dimension is unknown.
+func (cc *ClusterCosts) cumulativeCost(dim ResourceDimension) (float64, bool) {
+	switch dim {
+	case DimensionTotal:
+		return cc.TotalCumulative, true
+	case DimensionCPU:
+		return cc.CPUCumulative, true
+	case DimensionRAM:
+		return cc.RAMCumulative, true
+	case DimensionStorage:
+		return cc.StorageCumulative, true
+	case DimensionGPU:
+		return cc.GPUCumulative, true
+	default:
+		return 0.0, false
+	}
+}
+
+// CostOutliers returns the IDs, in order, of the clusters whose cumulative
+// cost of the given dimension deviates from the fleet norm; i.e. whose robust
+// z-score, relative to the median and median absolute deviation (MAD) of that
+// cost across all clusters, exceeds the given threshold in magnitude. Unlike
+// the mean and standard deviation, the median and MAD are not skewed by the
+// outliers themselves, so an outlier is found even among three clusters. If
+// the MAD is zero, i.e. most clusters have the median cost, the mean absolute
+// deviation from the median is used instead. Returns none if there are fewer
+// than three clusters, if all clusters have the same cost, or if the dimension
+// is unknown.
+func CostOutliers(costs map[string]*ClusterCosts, dim ResourceDimension, zThreshold float64) []string {
+	outliers := []string{}
+
+	values := map[string]float64{}
+	for clusterID, cc := range costs {
+		if cc == nil {
+			continue
+		}
+		value, ok := cc.cumulativeCost(dim)
+		if !ok {
+			return outliers
+		}
+		values[clusterID] = value
+	}
+
+	if len(values) < minOutlierClusters {
+		return outliers
+	}
+
+	costValues := make([]float64, 0, len(values))
+	for _, value := range values {
+		costValues = append(costValues, value)
+	}
+	median := medianOf(costValues)
+
+	deviations := make([]float64, 0, len(values))
+	meanDeviation := 0.0
+	for _, value := range values {
+		deviations = append(deviations, math.Abs(value-median))
+		meanDeviation += math.Abs(value - median)
+	}
+	meanDeviation /= float64(len(values))
+
+	// Scale the MAD, or else the mean absolute deviation, to estimate the
+	// standard deviation of normally distributed costs
+	scale := madToStdDev * medianOf(deviations)
+	if scale == 0 {
+		scale = meanADToStdDev * meanDeviation
+	}
+	if scale == 0 {
+		return outliers
+	}
+
+	for clusterID, value := range values {
+		if math.Abs(value-median)/scale > zThreshold {
+			outliers = append(outliers, clusterID)
+		}
+	}
+	sort.Strings(outliers)
+
+	return outliers
+}
+
+const (
+	// madToStdDev scales the median absolute deviation of normally
+	// distributed values to their standard deviation
+	madToStdDev = 1.4826
+
+	// meanADToStdDev scales the mean absolute deviation of normally
+	// distributed values to their standard deviation
+	meanADToStdDev = 1.2533
+)
+
+// medianOf returns the median of the given values, which it sorts.
+func medianOf(values []float64) float64 {
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
@@ -0,0 +1,66 @@
+package costmodel
+
+import (
+	"testing"
+)
+
+func TestCostOutliers(t *testing.T) {
+	costs := map[string]*ClusterCosts{
+		"cluster1": {CPUCumulative: 100.0, TotalCumulative: 200.0},
+		"cluster2": {CPUCumulative: 110.0, TotalCumulative: 210.0},
+		"cluster3": {CPUCumulative: 90.0, TotalCumulative: 190.0},
+		"cluster4": {CPUCumulative: 105.0, TotalCumulative: 205.0},
+		"cluster5": {CPUCumulative: 95.0, TotalCumulative: 195.0},
+		// An obvious CPU outlier, within the norm by total
+		"cluster6": {CPUCumulative: 1000.0, TotalCumulative: 200.0},
+	}
+
+	outliers := CostOutliers(costs, DimensionCPU, 2.0)
+	if len(outliers) != 1 || outliers[0] != "cluster6" {
+		t.Errorf("expected cluster6 to be the only CPU outlier; got %v", outliers)
+	}
+
+	if outliers := CostOutliers(costs, DimensionTotal, 2.0); len(outliers) != 0 {
+		t.Errorf("expected no total cost outliers; got %v", outliers)
+	}
+
+	// An obvious outlier is found among as few as three clusters, whose mean
+	// and standard deviation it would skew
+	three := map[string]*ClusterCosts{
+		"cluster1": {RAMCumulative: 100.0},
+		"cluster2": {RAMCumulative: 110.0},
+		"cluster3": {RAMCumulative: 1000.0},
+	}
+	if outliers := CostOutliers(three, DimensionRAM, 2.0); len(outliers) != 1 || outliers[0] != "cluster3" {
+		t.Errorf("expected cluster3 to be the only RAM outlier of three clusters; got %v", outliers)
+	}
+
+	// Even if most clusters have the same cost
+	three["cluster2"].RAMCumulative = 100.0
+	if outliers := CostOutliers(three, DimensionRAM, 2.0); len(outliers) != 1 || outliers[0] != "cluster3" {
+		t.Errorf("expected cluster3 to be the only RAM outlier of three clusters; got %v", outliers)
+	}
+
+	// Fewer than three clusters have no norm
+	few := map[string]*ClusterCosts{
+		"cluster1": {CPUCumulative: 100.0},
+		"cluster6": {CPUCumulative: 1000.0},
+	}
+	if outliers := CostOutliers(few, DimensionCPU, 0.5); len(outliers) != 0 {
+		t.Errorf("expected no outliers among fewer than 3 clusters; got %v", outliers)
+	}
+
+	// Identical costs have no outliers
+	same := map[string]*ClusterCosts{
+		"cluster1": {GPUCumulative: 10.0},
+		"cluster2": {GPUCumulative: 10.0},
+		"cluster3": {GPUCumulative: 10.0},
+	}
+	if outliers := CostOutliers(same, DimensionGPU, 0.0); len(outliers) != 0 {
+		t.Errorf("expected no outliers among identical costs; got %v", outliers)
+	}
+
+	if outliers := CostOutliers(costs, ResourceDimension(-1), 2.0); len(outliers) != 0 {
+		t.Errorf("expected no outliers for unknown dimension; got %v", outliers)
+	}
+}
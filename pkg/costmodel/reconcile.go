@@ -0,0 +1,72 @@
+package costmodel
+
+// ReconciliationReport compares the modeled cumulative cost of a set of
+// clusters against the actual total of the cloud bill covering the same
+// window, e.g. to validate the cost model against an invoice.
+type ReconciliationReport struct {
+	ModeledTotal float64 `json:"modeledTotal"`
+	InvoiceTotal float64 `json:"invoiceTotal"`
+
+	// Difference is the modeled total less the invoice total, which is
+	// negative if the model underestimates the bill
+	Difference float64 `json:"difference"`
+
+	// DifferencePct is Difference as a fraction of the invoice total; e.g.
+	// -0.1 if the model is 10% below the bill
+	DifferencePct float64 `json:"differencePct"`
+
+	// CorrectionFactor is the factor by which to multiply every cluster's
+	// modeled cost for their total to match the invoice; e.g. ~1.11 if the
+	// model is 10% below the bill. Zero if nothing is modeled.
+	CorrectionFactor float64 `json:"correctionFactor"`
+
+	Clusters map[string]*ClusterReconciliation `json:"clusters"`
+}
+
+// ClusterReconciliation is a cluster's share of a ReconciliationReport,
+// assuming the discrepancy is distributed in proportion to modeled cost.
+type ClusterReconciliation struct {
+	Modeled    float64 `json:"modeled"`
+	Corrected  float64 `json:"corrected"`
+	Difference float64 `json:"difference"`
+}
+
+// Reconcile compares the total cumulative cost of the given clusters against
+// the given invoice total, which must cover the same window, without
+// modifying the costs. Each cluster's discrepancy is its modeled cost less
+// its corrected cost, per the uniform CorrectionFactor.
+func Reconcile(costs map[string]*ClusterCosts, invoiceTotal float64) *ReconciliationReport {
+	report := &ReconciliationReport{
+		InvoiceTotal: invoiceTotal,
+		Clusters:     make(map[string]*ClusterReconciliation, len(costs)),
+	}
+
+	for _, cc := range costs {
+		if cc == nil {
+			continue
+		}
+		report.ModeledTotal += cc.TotalCumulative
+	}
+
+	report.Difference = report.ModeledTotal - invoiceTotal
+	if invoiceTotal != 0 {
+		report.DifferencePct = report.Difference / invoiceTotal
+	}
+	if report.ModeledTotal > 0 {
+		report.CorrectionFactor = invoiceTotal / report.ModeledTotal
+	}
+
+	for clusterID, cc := range costs {
+		if cc == nil {
+			continue
+		}
+		corrected := cc.TotalCumulative * report.CorrectionFactor
+		report.Clusters[clusterID] = &ClusterReconciliation{
+			Modeled:    cc.TotalCumulative,
+			Corrected:  corrected,
+			Difference: cc.TotalCumulative - corrected,
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,53 @@
+package costmodel
+
+import (
+	"testing"
+
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestReconcile(t *testing.T) {
+	// $900 modeled against a $1000 invoice: 10% below
+	costs := map[string]*ClusterCosts{
+		"cluster1": {TotalCumulative: 600.0},
+		"cluster2": {TotalCumulative: 300.0},
+	}
+
+	report := Reconcile(costs, 1000.0)
+	if !util.IsApproximately(report.ModeledTotal, 900.0) || report.InvoiceTotal != 1000.0 {
+		t.Errorf("expected modeled total 900 and invoice total 1000; got %f and %f", report.ModeledTotal, report.InvoiceTotal)
+	}
+	if !util.IsApproximately(report.Difference, -100.0) {
+		t.Errorf("expected difference -100; got %f", report.Difference)
+	}
+	if !util.IsApproximately(report.DifferencePct, -0.1) {
+		t.Errorf("expected difference of -10%%; got %f", report.DifferencePct)
+	}
+	if !util.IsApproximately(report.CorrectionFactor, 1000.0/900.0) {
+		t.Errorf("expected correction factor ~1.11; got %f", report.CorrectionFactor)
+	}
+
+	// The discrepancy is distributed in proportion to modeled cost
+	c1 := report.Clusters["cluster1"]
+	if c1 == nil || !util.IsApproximately(c1.Corrected, 1000.0*2.0/3.0) || !util.IsApproximately(c1.Difference, 600.0-1000.0*2.0/3.0) {
+		t.Errorf("expected cluster1 corrected to %f; got %+v", 1000.0*2.0/3.0, c1)
+	}
+	corrected := 0.0
+	for _, cr := range report.Clusters {
+		corrected += cr.Corrected
+	}
+	if !util.IsApproximately(corrected, 1000.0) {
+		t.Errorf("expected corrected costs to sum to the invoice total; got %f", corrected)
+	}
+
+	// The costs are not modified
+	if costs["cluster1"].TotalCumulative != 600.0 {
+		t.Errorf("expected costs to be unmodified; got %f", costs["cluster1"].TotalCumulative)
+	}
+
+	// Nothing modeled has no correction
+	report = Reconcile(map[string]*ClusterCosts{}, 1000.0)
+	if report.CorrectionFactor != 0.0 || !util.IsApproximately(report.DifferencePct, -1.0) {
+		t.Errorf("expected no correction factor and -100%% difference; got %f and %f", report.CorrectionFactor, report.DifferencePct)
+	}
+}
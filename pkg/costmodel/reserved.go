@@ -0,0 +1,167 @@
+package costmodel
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
+
+const (
+	// DefaultReservedDiscount is the discount of reserved pricing relative to
+	// on-demand pricing assumed when none is configured.
+	DefaultReservedDiscount = 0.3
+
+	// DefaultReservedTermMonths is the length of the reserved commitment term
+	// assumed when none is configured.
+	DefaultReservedTermMonths = 12.0
+)
+
+// BreakEvenReport compares, for a cluster, the monthly on-demand cost of its
+// steady-state compute capacity against the cost of reserving that capacity.
+type BreakEvenReport struct {
+	OnDemandMonthly      float64 `json:"onDemandMonthlyCost"`
+	SteadyStateMonthly   float64 `json:"steadyStateMonthlyCost"`
+	ReservedMonthly      float64 `json:"reservedMonthlyCost"`
+	BreakEvenUtilization float64 `json:"breakEvenUtilization"`
+	SavingsMonthly       float64 `json:"savingsMonthly"`
+	SavingsTerm          float64 `json:"savingsTerm"`
+	TermMonths           float64 `json:"termMonths"`
+}
+
+// ReservedBreakEven computes, per cluster, the break-even point of reserving
+// the cluster's steady-state compute capacity; i.e. the minimum compute cost
+// observed over the window, which is in use for the entire window. Reserved
+// pricing is configured by the provider's reservedDiscount, relative to
+// on-demand pricing, and reservedTermMonths; DefaultReservedDiscount and
+// DefaultReservedTermMonths apply if either is not configured.
+//
+// BreakEvenUtilization is the fraction of the commitment term for which
+// reserved capacity must be in use to cost less than the same capacity
+// on-demand. Projected savings assume the steady-state capacity remains in use
+// for the whole term, and are negative if reserving costs more.
+func ReservedBreakEven(client prometheus.Client, provider cloud.Provider, window, offset time.Duration) (map[string]*BreakEvenReport, error) {
+	if err := timeutil.ValidateTimeRange(window, offset, env.GetPrometheusRetention()); err != nil {
+		return nil, err
+	}
+
+	discounts := providerDiscounts(provider, nil)
+
+	reservedDiscount, termMonths := DefaultReservedDiscount, DefaultReservedTermMonths
+	c, err := provider.GetConfig()
+	if err != nil || c == nil {
+		log.Warningf("ReservedBreakEven: failed to get config: %v; using default reserved pricing", err)
+	} else {
+		if c.ReservedDiscount != "" {
+			reservedDiscount, err = ParsePercentString(c.ReservedDiscount)
+			if err != nil {
+				return nil, fmt.Errorf("illegal reservedDiscount: %s", c.ReservedDiscount)
+			}
+		}
+		if c.ReservedTermMonths != "" {
+			termMonths, err = strconv.ParseFloat(c.ReservedTermMonths, 64)
+			if err != nil || termMonths <= 0 {
+				return nil, fmt.Errorf("illegal reservedTermMonths: %s; must be positive", c.ReservedTermMonths)
+			}
+		}
+	}
+	reservedDiscount, _ = clampDiscount("reservedDiscount", reservedDiscount)
+
+	// minsPerResolution determines accuracy and resource use for the following
+	// queries. Smaller values (higher resolution) result in better accuracy,
+	// but more expensive queries, and vice-a-versa.
+	minsPerResolution := 5
+
+	const fmtQueryOnDemandHourly = `
+		sum(
+			avg(avg_over_time(node_total_hourly_cost[%s:%dm]%s)) by (node, %s)
+		) by (%s)
+	`
+
+	const fmtQuerySteadyStateHourly = `
+		min_over_time(
+			sum(avg(node_total_hourly_cost) by (node, %s)) by (%s)[%s:%dm]%s
+		)
+	`
+
+	clusterLabel := env.GetPromClusterLabel()
+	fmtOffset := timeutil.DurationToPromOffsetString(offset)
+
+	queryOnDemandHourly := fmt.Sprintf(fmtQueryOnDemandHourly, window, minsPerResolution, fmtOffset, clusterLabel, clusterLabel)
+	querySteadyStateHourly := fmt.Sprintf(fmtQuerySteadyStateHourly, clusterLabel, clusterLabel, window, minsPerResolution, fmtOffset)
+
+	ctx := prom.NewNamedContext(client, prom.ClusterContextName)
+	resChs := ctx.QueryAll(queryOnDemandHourly, querySteadyStateHourly)
+
+	resOnDemandHourly, _ := resChs[0].Await()
+	resSteadyStateHourly, _ := resChs[1].Await()
+	if ctx.HasErrors() {
+		return nil, ctx.ErrorCollection()
+	}
+
+	defaultClusterID := env.GetClusterIDOrDefault()
+	valuesByCluster := func(results []*prom.QueryResult) map[string]float64 {
+		values := map[string]float64{}
+		for _, result := range results {
+			clusterID, _ := result.GetString(clusterLabel)
+			if clusterID == "" {
+				clusterID = defaultClusterID
+			}
+			if len(result.Values) == 0 {
+				continue
+			}
+			values[clusterID] += result.Values[0].Value
+		}
+		return values
+	}
+
+	onDemandHourly := valuesByCluster(resOnDemandHourly)
+	steadyStateHourly := valuesByCluster(resSteadyStateHourly)
+
+	reports := map[string]*BreakEvenReport{}
+	for clusterID, hourly := range onDemandHourly {
+		discount, customDiscount := discounts.forCluster(clusterID)
+		discountFactor := (1.0 - discount) * (1.0 - customDiscount)
+
+		steadyState, ok := steadyStateHourly[clusterID]
+		if !ok {
+			log.Warningf("ReservedBreakEven: no steady-state compute cost for cluster %s", clusterID)
+			continue
+		}
+
+		reports[clusterID] = computeBreakEvenReport(hourly*timeutil.HoursPerMonth, steadyState*timeutil.HoursPerMonth, discountFactor, reservedDiscount, termMonths)
+	}
+
+	return reports, nil
+}
+
+// computeBreakEvenReport compares the given monthly steady-state on-demand
+// cost, at list prices, with the cost of reserving it at the given reserved
+// discount from list prices. On-demand costs are subject to discountFactor.
+func computeBreakEvenReport(onDemandMonthly, steadyStateMonthly, discountFactor, reservedDiscount, termMonths float64) *BreakEvenReport {
+	onDemand := onDemandMonthly * discountFactor
+	steadyState := steadyStateMonthly * discountFactor
+	reserved := steadyStateMonthly * (1.0 - reservedDiscount)
+
+	breakEven := 0.0
+	if steadyState > 0 {
+		breakEven = reserved / steadyState
+	}
+
+	return &BreakEvenReport{
+		OnDemandMonthly:      onDemand,
+		SteadyStateMonthly:   steadyState,
+		ReservedMonthly:      reserved,
+		BreakEvenUtilization: breakEven,
+		SavingsMonthly:       steadyState - reserved,
+		SavingsTerm:          (steadyState - reserved) * termMonths,
+		TermMonths:           termMonths,
+	}
+}
@@ -0,0 +1,51 @@
+package costmodel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestReservedBreakEven(t *testing.T) {
+	// A steady cluster costing $1/hr throughout the window, i.e. $730/mo
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "min_over_time", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"1"]}]`},
+			{Match: "node_total_hourly_cost", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"1"]}]`},
+		},
+	}
+	provider := &mockProvider{config: &cloud.CustomPricing{ReservedDiscount: "40%", ReservedTermMonths: "12"}}
+
+	reports, err := ReservedBreakEven(client, provider, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	report, ok := reports["cluster1"]
+	if !ok {
+		t.Fatalf("expected a report for cluster1; got %v", reports)
+	}
+	if !util.IsApproximately(report.SteadyStateMonthly, 730.0) {
+		t.Errorf("expected steady-state monthly cost %f; got %f", 730.0, report.SteadyStateMonthly)
+	}
+	if !util.IsApproximately(report.ReservedMonthly, 438.0) {
+		t.Errorf("expected reserved monthly cost %f; got %f", 438.0, report.ReservedMonthly)
+	}
+	if !util.IsApproximately(report.BreakEvenUtilization, 0.6) {
+		t.Errorf("expected break-even utilization %f; got %f", 0.6, report.BreakEvenUtilization)
+	}
+	if !util.IsApproximately(report.SavingsMonthly, 292.0) {
+		t.Errorf("expected monthly savings %f; got %f", 292.0, report.SavingsMonthly)
+	}
+	if !util.IsApproximately(report.SavingsTerm, 3504.0) {
+		t.Errorf("expected term savings %f; got %f", 3504.0, report.SavingsTerm)
+	}
+
+	// Illegal reserved pricing config is an error
+	provider.config = &cloud.CustomPricing{ReservedTermMonths: "0"}
+	if _, err := ReservedBreakEven(client, provider, 24*time.Hour, 0); err == nil {
+		t.Errorf("expected an error for illegal reservedTermMonths")
+	}
+}
@@ -0,0 +1,179 @@
+package costmodel
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
+
+const (
+	// DefaultRightsizingPercentile is the percentile of usage to which clusters
+	// are sized by default when estimating rightsizing savings.
+	DefaultRightsizingPercentile = 0.95
+
+	// DefaultRightsizingHeadroom is the fraction of additional capacity, above
+	// the sized-to usage, recommended by default.
+	DefaultRightsizingHeadroom = 0.1
+)
+
+// RightsizingOptions provides optional parameters to RightsizingSavingsWithOptions
+type RightsizingOptions struct {
+	Percentile float64 // percentile of usage to size for, in (0, 1); e.g. 0.95
+	Headroom   float64 // fraction of capacity to add above the sized-to usage; e.g. 0.1 for 10%
+}
+
+// SavingsReport estimates the monthly CPU and RAM cost savings of a cluster
+// were its capacity sized to a percentile of its usage, plus headroom.
+type SavingsReport struct {
+	CPUUtilization     float64 `json:"cpuUtilization"`
+	RAMUtilization     float64 `json:"ramUtilization"`
+	CurrentMonthly     float64 `json:"currentMonthlyCost"`
+	RecommendedMonthly float64 `json:"recommendedMonthlyCost"`
+	SavingsMonthly     float64 `json:"savingsMonthly"`
+}
+
+// RightsizingSavings estimates, per cluster, the monthly savings of sizing
+// CPU and RAM capacity to the default percentile of usage plus the default
+// headroom. See RightsizingSavingsWithOptions.
+func RightsizingSavings(client prometheus.Client, provider cloud.Provider, window, offset time.Duration) (map[string]*SavingsReport, error) {
+	return RightsizingSavingsWithOptions(client, provider, window, offset, &RightsizingOptions{
+		Percentile: DefaultRightsizingPercentile,
+		Headroom:   DefaultRightsizingHeadroom,
+	})
+}
+
+// RightsizingSavingsWithOptions estimates, per cluster, the monthly savings of
+// sizing CPU and RAM capacity to the given percentile of usage over the window
+// plus the given headroom. GPU and storage costs are not considered.
+func RightsizingSavingsWithOptions(client prometheus.Client, provider cloud.Provider, window, offset time.Duration, opts *RightsizingOptions) (map[string]*SavingsReport, error) {
+	if opts == nil {
+		opts = &RightsizingOptions{
+			Percentile: DefaultRightsizingPercentile,
+			Headroom:   DefaultRightsizingHeadroom,
+		}
+	}
+
+	if err := timeutil.ValidateTimeRange(window, offset, env.GetPrometheusRetention()); err != nil {
+		return nil, err
+	}
+	if err := validateUtilizationPercentile(opts.Percentile); err != nil {
+		return nil, err
+	}
+	if opts.Headroom < 0 {
+		return nil, fmt.Errorf("illegal rightsizing headroom: %f; must not be negative", opts.Headroom)
+	}
+
+	// minsPerResolution determines accuracy and resource use for the following
+	// queries. Smaller values (higher resolution) result in better accuracy,
+	// but more expensive queries, and vice-a-versa.
+	minsPerResolution := 5
+
+	const fmtQueryCPUMonthly = `
+		sum(
+			avg(avg_over_time(kube_node_status_capacity_cpu_cores[%s:%dm]%s)) by (node, %s) *
+			avg(avg_over_time(node_cpu_hourly_cost[%s:%dm]%s)) by (node, %s) * %f
+		) by (%s)
+	`
+
+	const fmtQueryRAMMonthly = `
+		sum(
+			avg(avg_over_time(kube_node_status_capacity_memory_bytes[%s:%dm]%s)) by (node, %s) / 1024 / 1024 / 1024 *
+			avg(avg_over_time(node_ram_hourly_cost[%s:%dm]%s)) by (node, %s) * %f
+		) by (%s)
+	`
+
+	fmtOffset := timeutil.DurationToPromOffsetString(offset)
+
+	queryCPUMonthly := fmt.Sprintf(fmtQueryCPUMonthly, window, minsPerResolution, fmtOffset, env.GetPromClusterLabel(), window, minsPerResolution, fmtOffset, env.GetPromClusterLabel(), timeutil.HoursPerMonth, env.GetPromClusterLabel())
+	queryRAMMonthly := fmt.Sprintf(fmtQueryRAMMonthly, window, minsPerResolution, fmtOffset, env.GetPromClusterLabel(), window, minsPerResolution, fmtOffset, env.GetPromClusterLabel(), timeutil.HoursPerMonth, env.GetPromClusterLabel())
+	queryCPUUtilization := queryUsagePctAtPercentile(opts.Percentile, `rate(container_cpu_usage_seconds_total{container_name!="",container_name!="POD"}[5m])`, "kube_node_status_capacity_cpu_cores", env.GetPromClusterLabel(), window, minsPerResolution, fmtOffset)
+	queryRAMUtilization := queryUsagePctAtPercentile(opts.Percentile, `container_memory_working_set_bytes{container_name!="",container_name!="POD"}`, "kube_node_status_capacity_memory_bytes", env.GetPromClusterLabel(), window, minsPerResolution, fmtOffset)
+
+	ctx := prom.NewNamedContext(client, prom.ClusterContextName)
+	resChs := ctx.QueryAll(
+		queryCPUMonthly,
+		queryRAMMonthly,
+		queryCPUUtilization,
+		queryRAMUtilization,
+	)
+
+	resCPUMonthly, _ := resChs[0].Await()
+	resRAMMonthly, _ := resChs[1].Await()
+	resCPUUtilization, _ := resChs[2].Await()
+	resRAMUtilization, _ := resChs[3].Await()
+	if ctx.HasErrors() {
+		return nil, ctx.ErrorCollection()
+	}
+
+	// Apply the same discounts to CPU and RAM as ComputeClusterCosts
+	discounts := providerDiscounts(provider, nil)
+
+	defaultClusterID := env.GetClusterIDOrDefault()
+	valuesByCluster := func(results []*prom.QueryResult) map[string]float64 {
+		values := map[string]float64{}
+		for _, result := range results {
+			clusterID, _ := result.GetString(env.GetPromClusterLabel())
+			if clusterID == "" {
+				clusterID = defaultClusterID
+			}
+			if len(result.Values) == 0 {
+				continue
+			}
+			values[clusterID] += result.Values[0].Value
+		}
+		return values
+	}
+
+	cpuMonthly := valuesByCluster(resCPUMonthly)
+	ramMonthly := valuesByCluster(resRAMMonthly)
+	cpuUtilization := valuesByCluster(resCPUUtilization)
+	ramUtilization := valuesByCluster(resRAMUtilization)
+
+	reports := map[string]*SavingsReport{}
+	for clusterID := range cpuMonthly {
+		cpuUtil, ok := cpuUtilization[clusterID]
+		if !ok {
+			log.Warningf("RightsizingSavings: no CPU utilization data for cluster %s", clusterID)
+			cpuUtil = 1.0
+		}
+		ramUtil, ok := ramUtilization[clusterID]
+		if !ok {
+			log.Warningf("RightsizingSavings: no RAM utilization data for cluster %s", clusterID)
+			ramUtil = 1.0
+		}
+
+		discount, customDiscount := discounts.forCluster(clusterID)
+		discountFactor := (1.0 - discount) * (1.0 - customDiscount)
+
+		reports[clusterID] = computeSavingsReport(cpuMonthly[clusterID]*discountFactor, ramMonthly[clusterID]*discountFactor, cpuUtil, ramUtil, opts.Headroom)
+	}
+
+	return reports, nil
+}
+
+// computeSavingsReport estimates the savings of sizing CPU and RAM capacity to
+// the given utilization fractions plus headroom. Recommended capacity is never
+// larger than current capacity, so savings are never negative.
+func computeSavingsReport(cpuMonthly, ramMonthly, cpuUtilization, ramUtilization, headroom float64) *SavingsReport {
+	cpuFraction := math.Min(1.0, cpuUtilization*(1.0+headroom))
+	ramFraction := math.Min(1.0, ramUtilization*(1.0+headroom))
+
+	current := cpuMonthly + ramMonthly
+	recommended := cpuMonthly*cpuFraction + ramMonthly*ramFraction
+
+	return &SavingsReport{
+		CPUUtilization:     cpuUtilization,
+		RAMUtilization:     ramUtilization,
+		CurrentMonthly:     current,
+		RecommendedMonthly: recommended,
+		SavingsMonthly:     current - recommended,
+	}
+}
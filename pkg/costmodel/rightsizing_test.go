@@ -0,0 +1,29 @@
+package costmodel
+
+import (
+	"testing"
+
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestComputeSavingsReport(t *testing.T) {
+	// Usage is 50% of capacity; sized to usage plus 10% headroom, the
+	// recommended capacity is 55% of current, saving 45%.
+	report := computeSavingsReport(100.0, 50.0, 0.5, 0.5, 0.1)
+
+	if !util.IsApproximately(report.CurrentMonthly, 150.0) {
+		t.Errorf("expected current monthly cost %f; got %f", 150.0, report.CurrentMonthly)
+	}
+	if !util.IsApproximately(report.RecommendedMonthly, 82.5) {
+		t.Errorf("expected recommended monthly cost %f; got %f", 82.5, report.RecommendedMonthly)
+	}
+	if !util.IsApproximately(report.SavingsMonthly/report.CurrentMonthly, 0.45) {
+		t.Errorf("expected savings of 45%%; got %f%%", 100.0*report.SavingsMonthly/report.CurrentMonthly)
+	}
+
+	// Fully-utilized clusters have no savings
+	report = computeSavingsReport(100.0, 50.0, 0.95, 1.0, 0.1)
+	if report.SavingsMonthly < 0 {
+		t.Errorf("expected savings never to be negative; got %f", report.SavingsMonthly)
+	}
+}
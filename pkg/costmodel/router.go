@@ -51,6 +51,7 @@ const (
 	maxCacheMinutes2d           = 17
 	maxCacheMinutes7d           = 37
 	maxCacheMinutes30d          = 137
+	clusterCostsGroupTTL        = time.Minute
 	CustomPricingSetting        = "CustomPricing"
 	DiscountSetting             = "Discount"
 )
@@ -84,6 +85,11 @@ type Accesses struct {
 	// settings will be published in a pub/sub model
 	settingsSubscribers map[string][]chan string
 	settingsMutex       sync.Mutex
+	// clusterCostsGroups share, and briefly cache, the cluster cost
+	// computations of the cluster costs endpoints, keyed by whether they
+	// query Thanos
+	clusterCostsGroups      map[bool]*ClusterCostsGroup
+	clusterCostsGroupsMutex sync.Mutex
 }
 
 // GetPrometheusClient decides whether the default Prometheus client or the Thanos client
@@ -101,6 +107,32 @@ func (a *Accesses) GetPrometheusClient(remote bool) prometheusClient.Client {
 	return pc
 }
 
+// clusterCostsGroup returns the ClusterCostsGroup computing cluster costs,
+// with breakdowns, from Thanos if thanos is true, or else from Prometheus, so
+// that concurrent identical requests share a single computation.
+func (a *Accesses) clusterCostsGroup(thanos bool) *ClusterCostsGroup {
+	a.clusterCostsGroupsMutex.Lock()
+	defer a.clusterCostsGroupsMutex.Unlock()
+
+	if a.clusterCostsGroups == nil {
+		a.clusterCostsGroups = map[bool]*ClusterCostsGroup{}
+	}
+	if ccg, ok := a.clusterCostsGroups[thanos]; ok {
+		return ccg
+	}
+
+	ccg := NewClusterCostsGroup(func(window, offset time.Duration) (map[string]*ClusterCosts, error) {
+		client := a.PrometheusClient
+		if thanos {
+			client = a.ThanosClient
+		}
+		return a.ComputeClusterCosts(client, a.CloudProvider, window, offset, true)
+	}, clusterCostsGroupTTL)
+	a.clusterCostsGroups[thanos] = ccg
+
+	return ccg
+}
+
 // GetCacheExpiration looks up and returns custom cache expiration for the given duration.
 // If one does not exists, it returns the default cache expiration, which is defined by
 // the particular cache.
@@ -130,14 +162,13 @@ func (a *Accesses) ClusterCostsFromCacheHandler(w http.ResponseWriter, r *http.R
 	offset := time.Minute
 	durationHrs := "24h"
 	fmtOffset := "1m"
-	pClient := a.GetPrometheusClient(true)
 
 	key := fmt.Sprintf("%s:%s", durationHrs, fmtOffset)
 	if data, valid := a.ClusterCostsCache.Get(key); valid {
 		clusterCosts := data.(map[string]*ClusterCosts)
 		w.Write(WrapDataWithMessage(clusterCosts, nil, "clusterCosts cache hit"))
 	} else {
-		data, err := a.ComputeClusterCosts(pClient, a.CloudProvider, duration, offset, true)
+		data, err := a.clusterCostsGroup(a.ThanosClient != nil).GetClusterCosts(duration, offset)
 		w.Write(WrapDataWithMessage(data, err, fmt.Sprintf("clusterCosts cache miss: %s", key)))
 	}
 }
@@ -387,22 +418,13 @@ func (a *Accesses) ClusterCosts(w http.ResponseWriter, r *http.Request, ps httpr
 		w.Write(WrapData(nil, fmt.Errorf("missing window arguement")))
 		return
 	}
-	windowDur, err := timeutil.ParseDuration(window)
+	// offset is not a required parameter
+	windowDur, offsetDur, err := timeutil.ParseDurationOffsetStrings(window, offset, env.GetPrometheusRetention())
 	if err != nil {
-		w.Write(WrapData(nil, fmt.Errorf("error parsing window (%s): %s", window, err)))
+		w.Write(WrapData(nil, fmt.Errorf("error parsing window (%s) and offset (%s): %s", window, offset, err)))
 		return
 	}
 
-	// offset is not a required parameter
-	var offsetDur time.Duration
-	if offset != "" {
-		offsetDur, err = timeutil.ParseDuration(offset)
-		if err != nil {
-			w.Write(WrapData(nil, fmt.Errorf("error parsing offset (%s): %s", offset, err)))
-			return
-		}
-	}
-
 	useThanos, _ := strconv.ParseBool(r.URL.Query().Get("multi"))
 
 	if useThanos && !thanos.IsEnabled() {
@@ -410,16 +432,11 @@ func (a *Accesses) ClusterCosts(w http.ResponseWriter, r *http.Request, ps httpr
 		return
 	}
 
-	var client prometheusClient.Client
 	if useThanos {
-		client = a.ThanosClient
 		offsetDur = thanos.OffsetDuration()
-
-	} else {
-		client = a.PrometheusClient
 	}
 
-	data, err := a.ComputeClusterCosts(client, a.CloudProvider, windowDur, offsetDur, true)
+	data, err := a.clusterCostsGroup(useThanos).GetClusterCosts(windowDur, offsetDur)
 	w.Write(WrapData(data, err))
 }
 
@@ -436,22 +453,13 @@ func (a *Accesses) ClusterCostsOverTime(w http.ResponseWriter, r *http.Request,
 		w.Write(WrapData(nil, fmt.Errorf("missing window arguement")))
 		return
 	}
-	windowDur, err := timeutil.ParseDuration(window)
+	// offset is not a required parameter
+	windowDur, offsetDur, err := timeutil.ParseDurationOffsetStrings(window, offset, env.GetPrometheusRetention())
 	if err != nil {
-		w.Write(WrapData(nil, fmt.Errorf("error parsing window (%s): %s", window, err)))
+		w.Write(WrapData(nil, fmt.Errorf("error parsing window (%s) and offset (%s): %s", window, offset, err)))
 		return
 	}
 
-	// offset is not a required parameter
-	var offsetDur time.Duration
-	if offset != "" {
-		offsetDur, err = timeutil.ParseDuration(offset)
-		if err != nil {
-			w.Write(WrapData(nil, fmt.Errorf("error parsing offset (%s): %s", offset, err)))
-			return
-		}
-	}
-
 	data, err := ClusterCostsOverTime(a.PrometheusClient, a.CloudProvider, start, end, windowDur, offsetDur)
 	w.Write(WrapData(data, err))
 }
@@ -0,0 +1,210 @@
+package costmodel
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
+
+var (
+	// selectorKeyRegex matches Kubernetes label keys; i.e. an optional DNS
+	// prefix and a slash, followed by a name
+	selectorKeyRegex = regexp.MustCompile(`^([a-zA-Z0-9]([-a-zA-Z0-9_.]*[a-zA-Z0-9])?/)?[a-zA-Z0-9]([-a-zA-Z0-9_.]*[a-zA-Z0-9])?$`)
+
+	// selectorValueRegex matches Kubernetes label values, which may be empty
+	selectorValueRegex = regexp.MustCompile(`^([a-zA-Z0-9]([-a-zA-Z0-9_.]*[a-zA-Z0-9])?)?$`)
+)
+
+// parseLabelSelector parses a Kubernetes equality-based label selector, e.g.
+// "team=payments,env!=dev", into the equivalent PromQL label matchers on the
+// kube_pod_labels metric, e.g. `label_team="payments", label_env!="dev"`.
+func parseLabelSelector(selector string) (string, error) {
+	if strings.TrimSpace(selector) == "" {
+		return "", fmt.Errorf("illegal label selector: must not be empty")
+	}
+
+	matchers := []string{}
+	for _, requirement := range strings.Split(selector, ",") {
+		op := "="
+		if strings.Contains(requirement, "!=") {
+			op = "!="
+		} else if strings.Contains(requirement, "==") {
+			requirement = strings.Replace(requirement, "==", "=", 1)
+		}
+
+		kv := strings.SplitN(requirement, op, 2)
+		if len(kv) != 2 {
+			return "", fmt.Errorf("illegal label selector %q: requirement %q must be of the form key=value or key!=value", selector, requirement)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if !selectorKeyRegex.MatchString(key) {
+			return "", fmt.Errorf("illegal label selector %q: invalid label key %q", selector, key)
+		}
+		if !selectorValueRegex.MatchString(value) {
+			return "", fmt.Errorf("illegal label selector %q: invalid label value %q", selector, value)
+		}
+
+		matchers = append(matchers, fmt.Sprintf(`label_%s%s"%s"`, prom.SanitizeLabelName(key), op, value))
+	}
+
+	return strings.Join(matchers, ", "), nil
+}
+
+// CostForSelector gives the cumulative and monthly-rate CPU, RAM, and storage
+// costs of the pods matching the given Kubernetes equality-based label
+// selector, e.g. "team=payments,env=prod", over the window, summed across all
+// clusters. CPU and RAM costs are of the pods' allocations on their nodes and
+// storage costs are of their PVC allocations. Idle and GPU costs are not
+// included.
+func CostForSelector(client prometheus.Client, provider cloud.Provider, selector string, window, offset time.Duration) (*ClusterCosts, error) {
+	if err := timeutil.ValidateTimeRange(window, offset, env.GetPrometheusRetention()); err != nil {
+		return nil, err
+	}
+
+	matchers, err := parseLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each allocation is joined to the labels of its pod, dropping pods not
+	// matching the selector
+	clusterLabel := env.GetPromClusterLabel()
+	podJoin := fmt.Sprintf(`* on (namespace, pod, %s) group_left() max(kube_pod_labels{%s}) by (namespace, pod, %s)`, clusterLabel, matchers, clusterLabel)
+
+	return podCostsAcrossClusters(client, provider, podJoin, window, offset)
+}
+
+// NamespaceCostAcrossClusters gives the cumulative and monthly-rate CPU, RAM,
+// and storage costs allocated to the pods of the given namespace over the
+// window, summed across all clusters, e.g. the total cost of "monitoring"
+// everywhere. Costs are computed as by CostForSelector.
+func NamespaceCostAcrossClusters(client prometheus.Client, provider cloud.Provider, namespace string, window, offset time.Duration) (*ClusterCosts, error) {
+	if err := timeutil.ValidateTimeRange(window, offset, env.GetPrometheusRetention()); err != nil {
+		return nil, err
+	}
+
+	if namespace == "" || !selectorValueRegex.MatchString(namespace) {
+		return nil, fmt.Errorf("illegal namespace %q", namespace)
+	}
+
+	// Each allocation is joined to the pods of the namespace, dropping pods
+	// in other namespaces
+	clusterLabel := env.GetPromClusterLabel()
+	podJoin := fmt.Sprintf(`* on (namespace, pod, %s) group_left() max(kube_pod_labels{namespace="%s"}) by (namespace, pod, %s)`, clusterLabel, namespace, clusterLabel)
+
+	return podCostsAcrossClusters(client, provider, podJoin, window, offset)
+}
+
+// podCostsAcrossClusters gives the costs of the pods' allocations over the
+// window, summed across all clusters, after applying the given join to each
+// pod's allocations, with discounts applied as in ComputeClusterCosts.
+func podCostsAcrossClusters(client prometheus.Client, provider cloud.Provider, podJoin string, window, offset time.Duration) (*ClusterCosts, error) {
+	clusterLabel := env.GetPromClusterLabel()
+	fmtOffset := timeutil.DurationToPromOffsetString(offset)
+
+	queryCPU, queryRAM, queryStorage := podCostQueries(podJoin, clusterLabel, window, fmtOffset)
+
+	ctx := prom.NewNamedContext(client, prom.ClusterContextName)
+	resChs := ctx.QueryAll(queryCPU, queryRAM, queryStorage)
+
+	resCPU, _ := resChs[0].Await()
+	resRAM, _ := resChs[1].Await()
+	resStorage, _ := resChs[2].Await()
+	if ctx.HasErrors() {
+		return nil, ctx.ErrorCollection()
+	}
+
+	discounts := providerDiscounts(provider, nil)
+	defaultClusterID := env.GetClusterIDOrDefault()
+
+	// sum totals the results across clusters, discounting each cluster's
+	// results by the given function of its discounts
+	sum := func(results []*prom.QueryResult, discountFactor func(discount, customDiscount float64) float64) float64 {
+		total := 0.0
+		for _, result := range results {
+			if len(result.Values) == 0 {
+				continue
+			}
+			clusterID, _ := result.GetString(clusterLabel)
+			if clusterID == "" {
+				clusterID = defaultClusterID
+			}
+			total += result.Values[0].Value * discountFactor(discounts.forCluster(clusterID))
+		}
+		return total
+	}
+	nodeDiscount := func(discount, customDiscount float64) float64 {
+		return (1.0 - discount) * (1.0 - customDiscount)
+	}
+	storageDiscount := func(_, customDiscount float64) float64 {
+		return 1.0 - customDiscount
+	}
+
+	cpu := sum(resCPU, nodeDiscount)
+	ram := sum(resRAM, nodeDiscount)
+	storage := sum(resStorage, storageDiscount)
+
+	return NewClusterCostsFromCumulative(cpu, 0.0, ram, storage, window, offset, window.Hours())
+}
+
+// podCostQueries returns queries for the cumulative CPU, RAM, and storage costs
+// of pods' allocations over the window, grouped by the given labels. The given
+// join, if any, is applied to each pod's allocations, e.g. to filter pods by
+// their labels, before they are priced by their node or volume.
+func podCostQueries(podJoin, groupBy string, window time.Duration, fmtOffset string) (string, string, string) {
+	// minsPerResolution determines accuracy and resource use for the following
+	// queries. Smaller values (higher resolution) result in better accuracy,
+	// but more expensive queries, and vice-a-versa.
+	minsPerResolution := 5
+
+	// hourlyToCumulative is a scaling factor that, when multiplied by an hourly
+	// value, converts it to a cumulative value; i.e.
+	// [$/hr] * [min/res]*[hr/min] = [$/res]
+	hourlyToCumulative := float64(minsPerResolution) * (1.0 / 60.0)
+
+	const fmtQueryPodCPU = `
+		sum(
+			sum_over_time((
+				sum(container_cpu_allocation{container!="", container!="POD", node!=""}) by (namespace, pod, node, %s)
+				%s
+				* on (node, %s) group_left() avg(node_cpu_hourly_cost) by (node, %s)
+			)[%s:%dm]%s) * %f
+		) by (%s)
+	`
+
+	const fmtQueryPodRAM = `
+		sum(
+			sum_over_time((
+				sum(container_memory_allocation_bytes{container!="", container!="POD", node!=""}) by (namespace, pod, node, %s) / 1024 / 1024 / 1024
+				%s
+				* on (node, %s) group_left() avg(node_ram_hourly_cost) by (node, %s)
+			)[%s:%dm]%s) * %f
+		) by (%s)
+	`
+
+	const fmtQueryPodStorage = `
+		sum(
+			sum_over_time((
+				sum(pod_pvc_allocation) by (namespace, pod, persistentvolume, %s) / 1024 / 1024 / 1024
+				%s
+				* on (persistentvolume, %s) group_left() avg(pv_hourly_cost) by (persistentvolume, %s)
+			)[%s:%dm]%s) * %f
+		) by (%s)
+	`
+
+	clusterLabel := env.GetPromClusterLabel()
+
+	fmtQuery := func(fmtQuery string) string {
+		return fmt.Sprintf(fmtQuery, clusterLabel, podJoin, clusterLabel, clusterLabel, window, minsPerResolution, fmtOffset, hourlyToCumulative, groupBy)
+	}
+
+	return fmtQuery(fmtQueryPodCPU), fmtQuery(fmtQueryPodRAM), fmtQuery(fmtQueryPodStorage)
+}
@@ -0,0 +1,127 @@
+package costmodel
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/util"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	cases := map[string]string{
+		"team=payments":                   `label_team="payments"`,
+		"team==payments, env!=dev":        `label_team="payments", label_env!="dev"`,
+		"app.kubernetes.io/name=checkout": `label_app_kubernetes_io_name="checkout"`,
+	}
+	for selector, expected := range cases {
+		actual, err := parseLabelSelector(selector)
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %s", selector, err)
+			continue
+		}
+		if actual != expected {
+			t.Errorf("expected %q to parse to %s; got %s", selector, expected, actual)
+		}
+	}
+
+	for _, selector := range []string{"", "team", "team=payments,", "-team=payments", `team=pay"ments`} {
+		if _, err := parseLabelSelector(selector); err == nil {
+			t.Errorf("expected error parsing illegal selector %q", selector)
+		}
+	}
+}
+
+func TestCostForSelector(t *testing.T) {
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "container_cpu_allocation", Result: `[
+				{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"3"]},
+				{"metric":{"cluster_id":"cluster2"},"value":[1609459200,"1"]}
+			]`},
+			{Match: "container_memory_allocation_bytes", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"2"]}]`},
+			{Match: "pod_pvc_allocation", Result: `[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"1"]}]`},
+		},
+	}
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+
+	cc, err := CostForSelector(client, provider, "team=payments,env=prod", 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	matchers := `kube_pod_labels{label_team="payments", label_env="prod"}`
+	for _, query := range client.Queries() {
+		if !strings.Contains(query, matchers) {
+			t.Errorf("expected query to select pods by %s; got:\n%s", matchers, query)
+		}
+	}
+
+	if !util.IsApproximately(cc.CPUCumulative, 4.0) {
+		t.Errorf("expected CPU cost %f; got %f", 4.0, cc.CPUCumulative)
+	}
+	if !util.IsApproximately(cc.RAMCumulative, 2.0) {
+		t.Errorf("expected RAM cost %f; got %f", 2.0, cc.RAMCumulative)
+	}
+	if !util.IsApproximately(cc.StorageCumulative, 1.0) {
+		t.Errorf("expected storage cost %f; got %f", 1.0, cc.StorageCumulative)
+	}
+	if !util.IsApproximately(cc.TotalMonthly, 7.0*timeutil.HoursPerMonth/24.0) {
+		t.Errorf("expected monthly cost %f; got %f", 7.0*timeutil.HoursPerMonth/24.0, cc.TotalMonthly)
+	}
+
+	if _, err := CostForSelector(client, provider, "team", 24*time.Hour, 0); err == nil {
+		t.Errorf("expected error for illegal selector")
+	}
+}
+
+func TestNamespaceCostAcrossClusters(t *testing.T) {
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "container_cpu_allocation", Result: `[
+				{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"3"]},
+				{"metric":{"cluster_id":"cluster2"},"value":[1609459200,"5"]}
+			]`},
+			{Match: "container_memory_allocation_bytes", Result: `[
+				{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"2"]},
+				{"metric":{"cluster_id":"cluster2"},"value":[1609459200,"1"]}
+			]`},
+			{Match: "pod_pvc_allocation", Result: `[{"metric":{"cluster_id":"cluster2"},"value":[1609459200,"4"]}]`},
+		},
+	}
+	provider := &mockProvider{config: &cloud.CustomPricing{Discount: "50%"}}
+
+	cc, err := NamespaceCostAcrossClusters(client, provider, "monitoring", 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	matchers := `kube_pod_labels{namespace="monitoring"}`
+	for _, query := range client.Queries() {
+		if !strings.Contains(query, matchers) {
+			t.Errorf("expected query to select pods by %s; got:\n%s", matchers, query)
+		}
+	}
+
+	// CPU and RAM are discounted; storage is not
+	if !util.IsApproximately(cc.CPUCumulative, 4.0) {
+		t.Errorf("expected CPU cost %f; got %f", 4.0, cc.CPUCumulative)
+	}
+	if !util.IsApproximately(cc.RAMCumulative, 1.5) {
+		t.Errorf("expected RAM cost %f; got %f", 1.5, cc.RAMCumulative)
+	}
+	if !util.IsApproximately(cc.StorageCumulative, 4.0) {
+		t.Errorf("expected storage cost %f; got %f", 4.0, cc.StorageCumulative)
+	}
+	if !util.IsApproximately(cc.TotalCumulative, 9.5) {
+		t.Errorf("expected total cost %f; got %f", 9.5, cc.TotalCumulative)
+	}
+
+	for _, namespace := range []string{"", `monitoring"}`} {
+		if _, err := NamespaceCostAcrossClusters(client, provider, namespace, 24*time.Hour, 0); err == nil {
+			t.Errorf("expected error for illegal namespace %q", namespace)
+		}
+	}
+}
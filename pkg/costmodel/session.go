@@ -0,0 +1,90 @@
+package costmodel
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
+
+// CostModelSession computes costs against a single Prometheus client and
+// provider, fetching the provider's pricing config (e.g. discounts) once and
+// reusing it across calls until Refresh is called.
+type CostModelSession struct {
+	client   prometheus.Client
+	provider *configCachingProvider
+	accesses *Accesses
+}
+
+// NewCostModelSession creates a new CostModelSession for the given client and
+// provider.
+func NewCostModelSession(client prometheus.Client, provider cloud.Provider) *CostModelSession {
+	cp := &configCachingProvider{Provider: provider}
+
+	return &CostModelSession{
+		client:   client,
+		provider: cp,
+		accesses: &Accesses{CloudProvider: cp},
+	}
+}
+
+// ClusterCosts gives the cumulative and monthly-rate cluster costs, with
+// breakdowns, over a window of time for all clusters.
+func (s *CostModelSession) ClusterCosts(window, offset time.Duration) (map[string]*ClusterCosts, error) {
+	return s.ClusterCostsWithOptions(window, offset, &ClusterCostsOptions{WithBreakdown: true})
+}
+
+// ClusterCostsWithOptions gives the cumulative and monthly-rate cluster costs
+// over a window of time for all clusters. See ClusterCostsOptions.
+func (s *CostModelSession) ClusterCostsWithOptions(window, offset time.Duration, opts *ClusterCostsOptions) (map[string]*ClusterCosts, error) {
+	return s.accesses.ComputeClusterCostsWithOptions(s.client, s.provider, window, offset, opts)
+}
+
+// ClusterCostsOverTime gives the full cluster costs over time. See
+// ClusterCostsOverTimeWithOptions.
+func (s *CostModelSession) ClusterCostsOverTime(startString, endString string, window, offset time.Duration, opts *ClusterCostsOverTimeOptions) (*Totals, error) {
+	return ClusterCostsOverTimeWithOptions(s.client, s.provider, startString, endString, window, offset, opts)
+}
+
+// Refresh discards the cached pricing config, so that it is fetched from the
+// provider again by the next call requiring it.
+func (s *CostModelSession) Refresh() {
+	s.provider.refresh()
+}
+
+// configCachingProvider is a cloud.Provider caching the result of a
+// successful GetConfig until refreshed.
+type configCachingProvider struct {
+	cloud.Provider
+	config *cloud.CustomPricing
+	lock   sync.Mutex
+}
+
+// GetConfig returns the cached config, fetching it from the underlying
+// provider if it is not cached. Errors are not cached, so that a transient
+// failure is retried by the next call.
+func (cp *configCachingProvider) GetConfig() (*cloud.CustomPricing, error) {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	if cp.config != nil {
+		return cp.config, nil
+	}
+
+	config, err := cp.Provider.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	cp.config = config
+
+	return cp.config, nil
+}
+
+func (cp *configCachingProvider) refresh() {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	cp.config = nil
+}
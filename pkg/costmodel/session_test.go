@@ -0,0 +1,100 @@
+package costmodel
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+// countingProvider is a mockProvider counting calls to GetConfig, which fail
+// with err, if set
+type countingProvider struct {
+	mockProvider
+	calls int
+	err   error
+	lock  sync.Mutex
+}
+
+func (cp *countingProvider) GetConfig() (*cloud.CustomPricing, error) {
+	cp.lock.Lock()
+	cp.calls++
+	err := cp.err
+	cp.lock.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	return cp.mockProvider.GetConfig()
+}
+
+func (cp *countingProvider) Calls() int {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	return cp.calls
+}
+
+func TestCostModelSession(t *testing.T) {
+	provider := &countingProvider{mockProvider: mockProvider{config: &cloud.CustomPricing{Discount: "50%"}}}
+	session := NewCostModelSession(newMockClusterCostsClient(10.0, 5.0, 0.0, 1.0), provider)
+
+	for _, window := range []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour} {
+		costs, err := session.ClusterCosts(window, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if cc := costs["cluster1"]; !util.IsApproximately(cc.CPUCumulative, 5.0) {
+			t.Errorf("expected discounted CPU cost %f; got %f", 5.0, cc.CPUCumulative)
+		}
+	}
+
+	if provider.Calls() != 1 {
+		t.Errorf("expected config to be fetched once; got %d", provider.Calls())
+	}
+
+	// Refreshing fetches the config again, with any changes
+	provider.config = &cloud.CustomPricing{}
+	session.Refresh()
+
+	costs, err := session.ClusterCosts(24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cc := costs["cluster1"]; !util.IsApproximately(cc.CPUCumulative, 10.0) {
+		t.Errorf("expected undiscounted CPU cost %f after refresh; got %f", 10.0, cc.CPUCumulative)
+	}
+	if provider.Calls() != 2 {
+		t.Errorf("expected config to be fetched again after refresh; got %d fetches", provider.Calls())
+	}
+}
+
+func TestConfigCachingProvider_ErrorsNotCached(t *testing.T) {
+	provider := &countingProvider{
+		mockProvider: mockProvider{config: &cloud.CustomPricing{Discount: "50%"}},
+		err:          fmt.Errorf("config unavailable"),
+	}
+	cp := &configCachingProvider{Provider: provider}
+
+	if _, err := cp.GetConfig(); err == nil {
+		t.Fatalf("expected error from first fetch")
+	}
+
+	// The failure is retried, and the success cached
+	provider.err = nil
+	for i := 0; i < 2; i++ {
+		config, err := cp.GetConfig()
+		if err != nil {
+			t.Fatalf("expected error not to be cached; got %s", err)
+		}
+		if config.Discount != "50%" {
+			t.Errorf("expected discount 50%%; got %s", config.Discount)
+		}
+	}
+	if provider.Calls() != 2 {
+		t.Errorf("expected a failed fetch and a cached successful fetch; got %d fetches", provider.Calls())
+	}
+}
@@ -0,0 +1,179 @@
+package costmodel
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
+
+// sparklineMinsPerResolution is the resolution, in minutes, at which the
+// hourly costs within each sparkline bucket are sampled.
+const sparklineMinsPerResolution = 5
+
+// ClusterCostSparkline gives, per cluster, the total cumulative cost of each of
+// the last points buckets of the given duration, oldest first. Buckets are
+// aligned to multiples of the bucket duration since the zero time (e.g. to the
+// hour or to midnight UTC), so the last bucket is the most recent complete one.
+// Node, GPU, and storage costs are each computed by a single range query;
+// buckets lacking data are zero. Of the given options, which may be nil, the
+// Clock determines the most recent bucket, and discounts and markup are
+// applied as in ComputeClusterCosts.
+func ClusterCostSparkline(ctx context.Context, client prometheus.Client, provider cloud.Provider, points int, bucket time.Duration, opts *ClusterCostsOptions) (map[string][]float64, error) {
+	if opts == nil {
+		opts = &ClusterCostsOptions{}
+	}
+
+	if points <= 0 {
+		return nil, fmt.Errorf("illegal sparkline points: %d; must be positive", points)
+	}
+	if bucket < sparklineMinsPerResolution*time.Minute || bucket%time.Minute != 0 {
+		return nil, fmt.Errorf("illegal sparkline bucket: %s; must be a whole number of minutes, at least %dm", bucket, sparklineMinsPerResolution)
+	}
+	if maxPoints := env.GetMaxQueryRangePoints(); maxPoints > 0 && points > maxPoints {
+		return nil, fmt.Errorf("sparkline of %d points exceeds the maximum of %d", points, maxPoints)
+	}
+	if opts.Markup < 0 {
+		return nil, fmt.Errorf("illegal markup: %f; must not be negative", opts.Markup)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	clock := opts.Clock
+	if clock == nil {
+		clock = timeutil.RealClock{}
+	}
+
+	// Each bucket is evaluated at its end, so the range covers the ends of
+	// the buckets, from the oldest to the most recent complete bucket.
+	end := clock.Now().UTC().Truncate(bucket)
+	start := end.Add(-time.Duration(points-1) * bucket)
+
+	clusterLabel := env.GetPromClusterLabel()
+	fmtBucket := timeutil.DurationString(bucket)
+	hourlyToCumulative := float64(sparklineMinsPerResolution) * (1.0 / 60.0)
+
+	const fmtQueryNodeCost = `
+		sum(sum_over_time(sum(node_total_hourly_cost) by (node, %s)[%s:%dm])) by (%s) * %f
+	`
+
+	const fmtQueryGPUCost = `
+		sum(sum_over_time(sum(node_gpu_hourly_cost) by (node, %s)[%s:%dm])) by (%s) * %f
+	`
+
+	const fmtQueryPVCost = `
+		sum(sum_over_time(
+			sum(
+				avg(kube_persistentvolume_capacity_bytes) by (persistentvolume, %s) / 1024 / 1024 / 1024
+				* on (persistentvolume, %s) avg(pv_hourly_cost) by (persistentvolume, %s)
+			) by (persistentvolume, %s)[%s:%dm]
+		)) by (%s) * %f
+	`
+
+	queryNodeCost := fmt.Sprintf(fmtQueryNodeCost, clusterLabel, fmtBucket, sparklineMinsPerResolution, clusterLabel, hourlyToCumulative)
+	queryGPUCost := fmt.Sprintf(fmtQueryGPUCost, clusterLabel, fmtBucket, sparklineMinsPerResolution, clusterLabel, hourlyToCumulative)
+	queryPVCost := fmt.Sprintf(fmtQueryPVCost, clusterLabel, clusterLabel, clusterLabel, clusterLabel, fmtBucket, sparklineMinsPerResolution, clusterLabel, hourlyToCumulative)
+	queryLocalStorage, err := localStorageQuery(provider, bucket, 0, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	promCtx := prom.NewNamedContext(client, prom.ClusterContextName)
+	resChs := []prom.QueryResultsChan{
+		promCtx.QueryRange(queryNodeCost, start, end, bucket),
+		promCtx.QueryRange(queryGPUCost, start, end, bucket),
+		promCtx.QueryRange(queryPVCost, start, end, bucket),
+	}
+	if queryLocalStorage != "" {
+		resChs = append(resChs, promCtx.QueryRange(queryLocalStorage, start, end, bucket))
+	}
+
+	resNodeCost, _ := resChs[0].Await()
+	resGPUCost, _ := resChs[1].Await()
+	resPVCost, _ := resChs[2].Await()
+	var resLocalStorage []*prom.QueryResult
+	if len(resChs) > 3 {
+		resLocalStorage, _ = resChs[3].Await()
+	}
+	if promCtx.HasErrors() {
+		return nil, promCtx.ErrorCollection()
+	}
+
+	// As in ComputeClusterCosts, CPU and RAM, i.e. the node costs less GPU
+	// costs, are subject to both discounts, and GPU and storage only to the
+	// negotiated discount. The markup applies to all costs after discounts.
+	discounts := providerDiscounts(provider, opts.DiscountByCluster)
+	markup := 1.0 + opts.Markup
+	computeFactor := func(clusterID string) float64 {
+		discount, customDiscount := discounts.forCluster(clusterID)
+		return (1.0 - discount) * (1.0 - customDiscount) * markup
+	}
+	negotiatedFactor := func(clusterID string) float64 {
+		_, customDiscount := discounts.forCluster(clusterID)
+		return (1.0 - customDiscount) * markup
+	}
+	gpuFactor := func(clusterID string) float64 {
+		return negotiatedFactor(clusterID) - computeFactor(clusterID)
+	}
+
+	sparklines := map[string][]float64{}
+	sb := &sparklineBuilder{
+		sparklines:       sparklines,
+		clusterLabel:     clusterLabel,
+		defaultClusterID: opts.defaultClusterID(),
+		start:            start,
+		bucket:           bucket,
+		points:           points,
+	}
+	sb.add(resNodeCost, computeFactor)
+	sb.add(resGPUCost, gpuFactor)
+	sb.add(resPVCost, negotiatedFactor)
+	sb.add(resLocalStorage, negotiatedFactor)
+
+	return sparklines, nil
+}
+
+// sparklineBuilder places the values of range query results into points
+// buckets per cluster, by the offset of each value's timestamp from start.
+type sparklineBuilder struct {
+	sparklines       map[string][]float64
+	clusterLabel     string
+	defaultClusterID string
+	start            time.Time
+	bucket           time.Duration
+	points           int
+}
+
+// add adds the values of the given results, multiplied by the factor of each
+// result's cluster, to the cluster's sparkline. Values falling outside of the
+// buckets are dropped.
+func (sb *sparklineBuilder) add(results []*prom.QueryResult, factor func(clusterID string) float64) {
+	for _, result := range results {
+		clusterID, _ := result.GetString(sb.clusterLabel)
+		if clusterID == "" {
+			clusterID = sb.defaultClusterID
+		}
+
+		if _, ok := sb.sparklines[clusterID]; !ok {
+			sb.sparklines[clusterID] = make([]float64, sb.points)
+		}
+
+		f := factor(clusterID)
+		for _, v := range result.Values {
+			i := int(math.Round((v.Timestamp - float64(sb.start.Unix())) / sb.bucket.Seconds()))
+			if i < 0 || i >= sb.points {
+				continue
+			}
+			sb.sparklines[clusterID][i] += v.Value * f
+		}
+	}
+}
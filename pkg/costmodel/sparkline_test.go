@@ -0,0 +1,115 @@
+package costmodel
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/util"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+)
+
+func TestClusterCostSparkline(t *testing.T) {
+	now := time.Date(2021, 1, 10, 12, 30, 0, 0, time.UTC)
+	end := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	day := int64(24 * 60 * 60)
+
+	// cluster1 has data for all buckets; cluster2 is missing the oldest
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_total_hourly_cost", Result: fmt.Sprintf(`[
+				{"metric":{"cluster_id":"cluster1"},"values":[[%d,"1"],[%d,"2"],[%d,"3"]]},
+				{"metric":{"cluster_id":"cluster2"},"values":[[%d,"5"],[%d,"6"]]}
+			]`, end.Unix()-2*day, end.Unix()-day, end.Unix(), end.Unix()-day, end.Unix())},
+		},
+	}
+
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+
+	opts := &ClusterCostsOptions{Clock: &timeutil.FakeClock{T: now}}
+
+	sparklines, err := ClusterCostSparkline(context.Background(), client, provider, 3, 24*time.Hour, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := map[string][]float64{
+		"cluster1": {1.0, 2.0, 3.0},
+		"cluster2": {0.0, 5.0, 6.0},
+	}
+	if len(sparklines) != len(expected) {
+		t.Fatalf("expected %d sparklines; got %d", len(expected), len(sparklines))
+	}
+	for cluster, exp := range expected {
+		act := sparklines[cluster]
+		if len(act) != len(exp) {
+			t.Fatalf("expected %d values for %s; got %d", len(exp), cluster, len(act))
+		}
+		for i := range exp {
+			if act[i] != exp[i] {
+				t.Errorf("expected %s value %d to be %f; got %f", cluster, i, exp[i], act[i])
+			}
+		}
+	}
+
+	// Node, GPU, and PV costs are each a single range query
+	queries := client.Queries()
+	if len(queries) != 3 {
+		t.Fatalf("expected a range query each for node, GPU, and PV costs; got %d", len(queries))
+	}
+	for _, query := range queries {
+		if !strings.Contains(query, "[1d:5m]") {
+			t.Errorf("expected query to sum over daily buckets: %s", query)
+		}
+	}
+
+	// Illegal arguments
+	if _, err := ClusterCostSparkline(context.Background(), client, provider, 0, 24*time.Hour, opts); err == nil {
+		t.Errorf("expected error for zero points")
+	}
+	if _, err := ClusterCostSparkline(context.Background(), client, provider, 30, time.Minute, opts); err == nil {
+		t.Errorf("expected error for bucket smaller than the resolution")
+	}
+}
+
+func TestClusterCostSparkline_DiscountsAndMarkup(t *testing.T) {
+	now := time.Date(2021, 1, 10, 12, 30, 0, 0, time.UTC)
+	end := time.Date(2021, 1, 10, 12, 0, 0, 0, time.UTC).Unix()
+
+	// Node costs of 10.0 include GPU costs of 4.0, so CPU and RAM cost 6.0
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_total_hourly_cost", Result: fmt.Sprintf(`[{"metric":{"cluster_id":"cluster1"},"values":[[%d,"10"]]}]`, end)},
+			{Match: "node_gpu_hourly_cost", Result: fmt.Sprintf(`[{"metric":{"cluster_id":"cluster1"},"values":[[%d,"4"]]}]`, end)},
+			{Match: "pv_hourly_cost", Result: fmt.Sprintf(`[{"metric":{"cluster_id":"cluster1"},"values":[[%d,"2"]]}]`, end)},
+		},
+	}
+
+	provider := &mockProvider{config: &cloud.CustomPricing{Discount: "50%", NegotiatedDiscount: "10%"}}
+	opts := &ClusterCostsOptions{Clock: &timeutil.FakeClock{T: now}, Markup: 0.2}
+
+	sparklines, err := ClusterCostSparkline(context.Background(), client, provider, 1, time.Hour, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// CPU and RAM are subject to both discounts, GPU and storage only to the
+	// negotiated discount, and all to the markup
+	expected := (6.0*0.5*0.9 + 4.0*0.9 + 2.0*0.9) * 1.2
+	if len(sparklines["cluster1"]) != 1 || !util.IsApproximately(sparklines["cluster1"][0], expected) {
+		t.Errorf("expected cluster1 sparkline [%f]; got %v", expected, sparklines["cluster1"])
+	}
+
+	// The same costs agree with ComputeClusterCosts over the bucket
+	a := &Accesses{CloudProvider: provider}
+	costs, err := a.ComputeClusterCostsWithOptions(newMockClusterCostsClient(3.0, 3.0, 4.0, 2.0), provider, time.Hour, 0, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !util.IsApproximately(costs["cluster1"].TotalCumulative, expected) {
+		t.Errorf("expected sparkline %f to match ComputeClusterCosts total %f", expected, costs["cluster1"].TotalCumulative)
+	}
+}
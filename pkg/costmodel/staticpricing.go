@@ -0,0 +1,160 @@
+package costmodel
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"sigs.k8s.io/yaml"
+)
+
+// Sanitized kube_node_labels labels from which the instance type of a node is
+// read if StaticPricing.NodeLabel is not set, in order of preference.
+var staticPricingDefaultNodeLabels = []string{
+	"node_kubernetes_io_instance_type",
+	"beta_kubernetes_io_instance_type",
+}
+
+// StaticNodePricing holds the hourly prices of a single node type
+type StaticNodePricing struct {
+	CPU float64 `json:"cpu"` // cost per CPU core-hour
+	RAM float64 `json:"ram"` // cost per RAM GiB-hour
+	GPU float64 `json:"gpu"` // cost per GPU-hour
+}
+
+// StaticPricing is a static table of node prices by instance type, used to
+// synthesize node costs from capacity metrics when the node_*_hourly_cost
+// metrics are not available; e.g. in air-gapped installs with no access to a
+// cloud pricing API.
+type StaticPricing struct {
+	// NodeLabel is the sanitized kube_node_labels label (e.g.
+	// "node_kubernetes_io_instance_type") used to look up the instance type of
+	// each node. Defaults to the well-known instance type labels if empty.
+	NodeLabel string `json:"nodeLabel,omitempty"`
+
+	// InstanceTypes maps instance type to prices
+	InstanceTypes map[string]*StaticNodePricing `json:"instanceTypes"`
+
+	// Default is used for nodes whose instance type is unknown or not listed
+	// in InstanceTypes. Such nodes are not priced if Default is nil.
+	Default *StaticNodePricing `json:"default,omitempty"`
+}
+
+// LoadStaticPricing reads a StaticPricing table from the given YAML or JSON file.
+func LoadStaticPricing(path string) (*StaticPricing, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("LoadStaticPricing: %s", err)
+	}
+
+	return ParseStaticPricing(data)
+}
+
+// ParseStaticPricing parses a StaticPricing table from YAML or JSON.
+func ParseStaticPricing(data []byte) (*StaticPricing, error) {
+	sp := &StaticPricing{}
+	err := yaml.Unmarshal(data, sp)
+	if err != nil {
+		return nil, fmt.Errorf("ParseStaticPricing: %s", err)
+	}
+
+	return sp, nil
+}
+
+// PricingFor returns the prices for the given instance type, falling back on
+// the default prices. Returns nil if neither exist.
+func (sp *StaticPricing) PricingFor(instanceType string) *StaticNodePricing {
+	if sp == nil {
+		return nil
+	}
+
+	if p, ok := sp.InstanceTypes[instanceType]; ok && p != nil {
+		return p
+	}
+
+	return sp.Default
+}
+
+// instanceType returns the instance type of a node given its labels
+func (sp *StaticPricing) instanceType(labels map[string]string) string {
+	if sp.NodeLabel != "" {
+		return labels[sp.NodeLabel]
+	}
+
+	for _, label := range staticPricingDefaultNodeLabels {
+		if it, ok := labels[label]; ok {
+			return it
+		}
+	}
+
+	return ""
+}
+
+// buildStaticCostData computes cumulative CPU, RAM, and GPU costs by cluster
+// from the given static pricing, where each of the given resource results is
+// expected to hold the cumulative resource-hours (e.g. core-hours, GiB-hours)
+// per (cluster, node) and the label results to hold kube_node_labels per
+// (cluster, node). The returned map is keyed by cluster ID and then by
+// resource name ("cpu", "ram", "gpu").
+func buildStaticCostData(sp *StaticPricing, resCPUCoreHours, resRAMGiBHours, resGPUHours, resLabels []*prom.QueryResult, clusterLabel, defaultClusterID string) map[string]map[string]float64 {
+	costData := map[string]map[string]float64{}
+
+	if sp == nil {
+		return costData
+	}
+
+	instanceTypes := map[nodeIdentifierNoProviderID]string{}
+	for _, result := range resLabels {
+		cluster, _ := result.GetString(clusterLabel)
+		if cluster == "" {
+			cluster = defaultClusterID
+		}
+
+		node, err := result.GetString("node")
+		if err != nil {
+			log.DedupedWarningf(5, "StaticPricing: label data missing node")
+			continue
+		}
+
+		key := nodeIdentifierNoProviderID{Cluster: cluster, Name: node}
+		instanceTypes[key] = sp.instanceType(result.GetLabels())
+	}
+
+	addCosts := func(results []*prom.QueryResult, resource string, price func(*StaticNodePricing) float64) {
+		for _, result := range results {
+			cluster, _ := result.GetString(clusterLabel)
+			if cluster == "" {
+				cluster = defaultClusterID
+			}
+
+			node, err := result.GetString("node")
+			if err != nil {
+				log.DedupedWarningf(5, "StaticPricing: %s capacity data missing node", resource)
+				continue
+			}
+
+			if len(result.Values) == 0 {
+				continue
+			}
+
+			instanceType := instanceTypes[nodeIdentifierNoProviderID{Cluster: cluster, Name: node}]
+			pricing := sp.PricingFor(instanceType)
+			if pricing == nil {
+				log.DedupedWarningf(5, "StaticPricing: no price for instance type '%s' of node %s/%s", instanceType, cluster, node)
+				continue
+			}
+
+			if _, ok := costData[cluster]; !ok {
+				costData[cluster] = map[string]float64{}
+			}
+			costData[cluster][resource] += result.Values[0].Value * price(pricing)
+		}
+	}
+
+	addCosts(resCPUCoreHours, "cpu", func(p *StaticNodePricing) float64 { return p.CPU })
+	addCosts(resRAMGiBHours, "ram", func(p *StaticNodePricing) float64 { return p.RAM })
+	addCosts(resGPUHours, "gpu", func(p *StaticNodePricing) float64 { return p.GPU })
+
+	return costData
+}
@@ -0,0 +1,102 @@
+package costmodel
+
+import (
+	"testing"
+
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestBuildStaticCostData(t *testing.T) {
+	sp, err := ParseStaticPricing([]byte(`
+instanceTypes:
+  m5.large:
+    cpu: 0.03
+    ram: 0.004
+  p3.2xlarge:
+    cpu: 0.03
+    ram: 0.004
+    gpu: 2.5
+`))
+	if err != nil {
+		t.Fatalf("unexpected error parsing static pricing: %s", err)
+	}
+
+	// 24 hours of capacity for each node
+	resCPUCoreHours := []*prom.QueryResult{
+		{
+			Metric: map[string]interface{}{"cluster_id": "cluster1", "node": "node1"},
+			Values: []*util.Vector{&util.Vector{Value: 2 * 24}},
+		},
+		{
+			Metric: map[string]interface{}{"cluster_id": "cluster1", "node": "node2"},
+			Values: []*util.Vector{&util.Vector{Value: 8 * 24}},
+		},
+		{
+			Metric: map[string]interface{}{"cluster_id": "cluster1", "node": "node3"},
+			Values: []*util.Vector{&util.Vector{Value: 4 * 24}},
+		},
+	}
+	resRAMGiBHours := []*prom.QueryResult{
+		{
+			Metric: map[string]interface{}{"cluster_id": "cluster1", "node": "node1"},
+			Values: []*util.Vector{&util.Vector{Value: 8 * 24}},
+		},
+		{
+			Metric: map[string]interface{}{"cluster_id": "cluster1", "node": "node2"},
+			Values: []*util.Vector{&util.Vector{Value: 61 * 24}},
+		},
+	}
+	resGPUHours := []*prom.QueryResult{
+		{
+			Metric: map[string]interface{}{"cluster_id": "cluster1", "node": "node2"},
+			Values: []*util.Vector{&util.Vector{Value: 1 * 24}},
+		},
+	}
+	resLabels := []*prom.QueryResult{
+		{
+			Metric: map[string]interface{}{
+				"cluster_id":                             "cluster1",
+				"node":                                   "node1",
+				"label_node_kubernetes_io_instance_type": "m5.large",
+			},
+			Values: []*util.Vector{&util.Vector{Value: 1}},
+		},
+		{
+			Metric: map[string]interface{}{
+				"cluster_id":                             "cluster1",
+				"node":                                   "node2",
+				"label_beta_kubernetes_io_instance_type": "p3.2xlarge",
+			},
+			Values: []*util.Vector{&util.Vector{Value: 1}},
+		},
+		{
+			Metric: map[string]interface{}{
+				"cluster_id":                             "cluster1",
+				"node":                                   "node3",
+				"label_node_kubernetes_io_instance_type": "unlisted",
+			},
+			Values: []*util.Vector{&util.Vector{Value: 1}},
+		},
+	}
+
+	costData := buildStaticCostData(sp, resCPUCoreHours, resRAMGiBHours, resGPUHours, resLabels, "cluster_id", "cluster1")
+
+	expCPU := (2*24 + 8*24) * 0.03
+	expRAM := (8*24 + 61*24) * 0.004
+	expGPU := 24 * 2.5
+
+	cd, ok := costData["cluster1"]
+	if !ok {
+		t.Fatalf("expected cost data for cluster1")
+	}
+	if !util.IsApproximately(cd["cpu"], expCPU) {
+		t.Errorf("expected cpu cost %f; got %f", expCPU, cd["cpu"])
+	}
+	if !util.IsApproximately(cd["ram"], expRAM) {
+		t.Errorf("expected ram cost %f; got %f", expRAM, cd["ram"])
+	}
+	if !util.IsApproximately(cd["gpu"], expGPU) {
+		t.Errorf("expected gpu cost %f; got %f", expGPU, cd["gpu"])
+	}
+}
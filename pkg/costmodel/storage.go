@@ -0,0 +1,223 @@
+package costmodel
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
+
+// UnclaimedStorageKey indicates the storage cost of PVs not claimed by any
+// PVC over the window, and hence not attributable to a namespace.
+const UnclaimedStorageKey = "__unclaimed__"
+
+// StorageCostsByNamespace gives, per cluster, the cumulative storage cost of
+// PVs over the window, attributed to the namespaces of the PVCs claiming them.
+// The cost of PVs claimed by no PVC is attributed to UnclaimedStorageKey. PVs
+// claimed from multiple namespaces over the window are split evenly among them.
+func StorageCostsByNamespace(client prometheus.Client, window, offset time.Duration) (map[string]map[string]float64, error) {
+	if err := timeutil.ValidateTimeRange(window, offset, env.GetPrometheusRetention()); err != nil {
+		return nil, err
+	}
+
+	// minsPerResolution determines accuracy and resource use for the following
+	// queries. Smaller values (higher resolution) result in better accuracy,
+	// but more expensive queries, and vice-a-versa.
+	minsPerResolution := 5
+
+	// hourlyToCumulative is a scaling factor that, when multiplied by an hourly
+	// value, converts it to a cumulative value; i.e.
+	// [$/hr] * [min/res]*[hr/min] = [$/res]
+	hourlyToCumulative := float64(minsPerResolution) * (1.0 / 60.0)
+
+	const fmtQueryPVCost = `
+		sum(
+			sum_over_time(avg(kube_persistentvolume_capacity_bytes) by (persistentvolume, %s)[%s:%dm]%s) / 1024 / 1024 / 1024 *
+			avg(avg_over_time(pv_hourly_cost[%s:%dm]%s)) by (persistentvolume, %s) * %f
+		) by (persistentvolume, %s)
+	`
+
+	const fmtQueryPVCInfo = `
+		avg(avg_over_time(kube_persistentvolumeclaim_info{volumename != ""}[%s]%s)) by (volumename, namespace, %s)
+	`
+
+	clusterLabel := env.GetPromClusterLabel()
+	fmtOffset := timeutil.DurationToPromOffsetString(offset)
+
+	queryPVCost := fmt.Sprintf(fmtQueryPVCost, clusterLabel, window, minsPerResolution, fmtOffset, window, minsPerResolution, fmtOffset, clusterLabel, hourlyToCumulative, clusterLabel)
+	queryPVCInfo := fmt.Sprintf(fmtQueryPVCInfo, window, fmtOffset, clusterLabel)
+
+	ctx := prom.NewNamedContext(client, prom.ClusterContextName)
+	resChs := ctx.QueryAll(queryPVCost, queryPVCInfo)
+
+	resPVCost, _ := resChs[0].Await()
+	resPVCInfo, _ := resChs[1].Await()
+	if ctx.HasErrors() {
+		return nil, ctx.ErrorCollection()
+	}
+
+	return buildStorageCostsByNamespace(resPVCost, resPVCInfo, clusterLabel, env.GetClusterIDOrDefault()), nil
+}
+
+// buildStorageCostsByNamespace attributes the cost of each PV in the given PV
+// cost results to the namespaces claiming it per the given PVC info results,
+// returning costs by cluster, then namespace.
+func buildStorageCostsByNamespace(resPVCost, resPVCInfo []*prom.QueryResult, clusterLabel, defaultClusterID string) map[string]map[string]float64 {
+	type pvKey struct {
+		cluster string
+		pv      string
+	}
+
+	clusterFor := func(result *prom.QueryResult) string {
+		clusterID, _ := result.GetString(clusterLabel)
+		if clusterID == "" {
+			return defaultClusterID
+		}
+		return clusterID
+	}
+
+	namespacesByPV := map[pvKey][]string{}
+	for _, result := range resPVCInfo {
+		values, err := result.GetStrings("volumename", "namespace")
+		if err != nil {
+			log.DedupedWarningf(5, "StorageCostsByNamespace: PVC info missing field: %s", err)
+			continue
+		}
+		key := pvKey{cluster: clusterFor(result), pv: values["volumename"]}
+		namespacesByPV[key] = append(namespacesByPV[key], values["namespace"])
+	}
+
+	costs := map[string]map[string]float64{}
+	for _, result := range resPVCost {
+		pv, err := result.GetString("persistentvolume")
+		if err != nil {
+			log.DedupedWarningf(5, "StorageCostsByNamespace: PV cost missing field: %s", err)
+			continue
+		}
+		if len(result.Values) == 0 {
+			continue
+		}
+		cost := result.Values[0].Value
+
+		clusterID := clusterFor(result)
+		if _, ok := costs[clusterID]; !ok {
+			costs[clusterID] = map[string]float64{}
+		}
+
+		namespaces := namespacesByPV[pvKey{cluster: clusterID, pv: pv}]
+		if len(namespaces) == 0 {
+			costs[clusterID][UnclaimedStorageKey] += cost
+			continue
+		}
+		for _, namespace := range namespaces {
+			costs[clusterID][namespace] += cost / float64(len(namespaces))
+		}
+	}
+
+	return costs
+}
+
+// BlendedStorageRate gives, per cluster, the effective hourly storage rate, in
+// $/GiB-hr, across all PVs over the window, regardless of storage class; i.e.
+// the total storage cost divided by the total provisioned GiB-hours. This is
+// the average of the hourly rates of the PVs, weighted by their provisioned
+// GiB-hours. Clusters with no provisioned storage have a rate of zero.
+func BlendedStorageRate(client prometheus.Client, window, offset time.Duration) (map[string]float64, error) {
+	if err := timeutil.ValidateTimeRange(window, offset, env.GetPrometheusRetention()); err != nil {
+		return nil, err
+	}
+
+	// minsPerResolution determines accuracy and resource use for the following
+	// queries. Smaller values (higher resolution) result in better accuracy,
+	// but more expensive queries, and vice-a-versa.
+	minsPerResolution := 5
+
+	// hourlyToCumulative is a scaling factor that, when multiplied by an hourly
+	// value, converts it to a cumulative value; i.e.
+	// [GiB] * [min/res]*[hr/min] = [GiB-hr/res]
+	hourlyToCumulative := float64(minsPerResolution) * (1.0 / 60.0)
+
+	const fmtQueryPVGiBHours = `
+		sum_over_time(avg(kube_persistentvolume_capacity_bytes) by (persistentvolume, %s)[%s:%dm]%s) / 1024 / 1024 / 1024 * %f
+	`
+
+	const fmtQueryPVHourlyCost = `
+		avg(avg_over_time(pv_hourly_cost[%s:%dm]%s)) by (persistentvolume, %s)
+	`
+
+	clusterLabel := env.GetPromClusterLabel()
+	fmtOffset := timeutil.DurationToPromOffsetString(offset)
+
+	queryPVGiBHours := fmt.Sprintf(fmtQueryPVGiBHours, clusterLabel, window, minsPerResolution, fmtOffset, hourlyToCumulative)
+	queryPVHourlyCost := fmt.Sprintf(fmtQueryPVHourlyCost, window, minsPerResolution, fmtOffset, clusterLabel)
+
+	ctx := prom.NewNamedContext(client, prom.ClusterContextName)
+	resChs := ctx.QueryAll(queryPVGiBHours, queryPVHourlyCost)
+
+	resPVGiBHours, _ := resChs[0].Await()
+	resPVHourlyCost, _ := resChs[1].Await()
+	if ctx.HasErrors() {
+		return nil, ctx.ErrorCollection()
+	}
+
+	return buildBlendedStorageRates(resPVGiBHours, resPVHourlyCost, clusterLabel, env.GetClusterIDOrDefault()), nil
+}
+
+// buildBlendedStorageRates blends the hourly rates of the PVs in the given PV
+// cost results, weighted by their GiB-hours per the given GiB-hour results,
+// returning rates by cluster.
+func buildBlendedStorageRates(resPVGiBHours, resPVHourlyCost []*prom.QueryResult, clusterLabel, defaultClusterID string) map[string]float64 {
+	type pvKey struct {
+		cluster string
+		pv      string
+	}
+
+	keyFor := func(result *prom.QueryResult) (pvKey, bool) {
+		pv, err := result.GetString("persistentvolume")
+		if err != nil {
+			log.DedupedWarningf(5, "BlendedStorageRate: PV missing field: %s", err)
+			return pvKey{}, false
+		}
+		clusterID, _ := result.GetString(clusterLabel)
+		if clusterID == "" {
+			clusterID = defaultClusterID
+		}
+		return pvKey{cluster: clusterID, pv: pv}, true
+	}
+
+	ratesByPV := map[pvKey]float64{}
+	for _, result := range resPVHourlyCost {
+		key, ok := keyFor(result)
+		if !ok || len(result.Values) == 0 {
+			continue
+		}
+		ratesByPV[key] = result.Values[0].Value
+	}
+
+	costs := map[string]float64{}
+	gibHours := map[string]float64{}
+	for _, result := range resPVGiBHours {
+		key, ok := keyFor(result)
+		if !ok || len(result.Values) == 0 {
+			continue
+		}
+		gibHours[key.cluster] += result.Values[0].Value
+		costs[key.cluster] += result.Values[0].Value * ratesByPV[key]
+	}
+
+	rates := make(map[string]float64, len(gibHours))
+	for clusterID, gibHrs := range gibHours {
+		if gibHrs <= 0 {
+			rates[clusterID] = 0.0
+			continue
+		}
+		rates[clusterID] = costs[clusterID] / gibHrs
+	}
+
+	return rates
+}
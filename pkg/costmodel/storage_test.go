@@ -0,0 +1,80 @@
+package costmodel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestStorageCostsByNamespace(t *testing.T) {
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "pv_hourly_cost", Result: `[
+				{"metric":{"cluster_id":"cluster1","persistentvolume":"pv-a"},"value":[1609459200,"3"]},
+				{"metric":{"cluster_id":"cluster1","persistentvolume":"pv-b"},"value":[1609459200,"5"]},
+				{"metric":{"cluster_id":"cluster1","persistentvolume":"pv-c"},"value":[1609459200,"1"]}
+			]`},
+			{Match: "kube_persistentvolumeclaim_info", Result: `[
+				{"metric":{"cluster_id":"cluster1","volumename":"pv-a","namespace":"kubecost"},"value":[1609459200,"1"]},
+				{"metric":{"cluster_id":"cluster1","volumename":"pv-b","namespace":"default"},"value":[1609459200,"1"]}
+			]`},
+		},
+	}
+
+	costs, err := StorageCostsByNamespace(client, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := map[string]float64{
+		"kubecost":          3.0,
+		"default":           5.0,
+		UnclaimedStorageKey: 1.0,
+	}
+	actual := costs["cluster1"]
+	if len(actual) != len(expected) {
+		t.Fatalf("expected costs for %d namespaces; got %v", len(expected), actual)
+	}
+	for namespace, cost := range expected {
+		if !util.IsApproximately(actual[namespace], cost) {
+			t.Errorf("expected %s storage cost %f; got %f", namespace, cost, actual[namespace])
+		}
+	}
+}
+
+func TestBlendedStorageRate(t *testing.T) {
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			// 100GiB of standard at $0.04/GiB-hr and 50GiB of ssd at $0.17/GiB-hr
+			// over 24h; cluster2 has a PV provisioned for none of the window
+			{Match: "kube_persistentvolume_capacity_bytes", Result: `[
+				{"metric":{"cluster_id":"cluster1","persistentvolume":"pv-standard"},"value":[1609459200,"2400"]},
+				{"metric":{"cluster_id":"cluster1","persistentvolume":"pv-ssd"},"value":[1609459200,"1200"]},
+				{"metric":{"cluster_id":"cluster2","persistentvolume":"pv-empty"},"value":[1609459200,"0"]}
+			]`},
+			{Match: "pv_hourly_cost", Result: `[
+				{"metric":{"cluster_id":"cluster1","persistentvolume":"pv-standard"},"value":[1609459200,"0.04"]},
+				{"metric":{"cluster_id":"cluster1","persistentvolume":"pv-ssd"},"value":[1609459200,"0.17"]},
+				{"metric":{"cluster_id":"cluster2","persistentvolume":"pv-empty"},"value":[1609459200,"0.1"]}
+			]`},
+		},
+	}
+
+	rates, err := BlendedStorageRate(client, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := (100.0*0.04 + 50.0*0.17) / 150.0
+	if !util.IsApproximately(rates["cluster1"], expected) {
+		t.Errorf("expected cluster1 blended rate %f; got %f", expected, rates["cluster1"])
+	}
+	if rate, ok := rates["cluster2"]; !ok || rate != 0.0 {
+		t.Errorf("expected cluster2 blended rate 0; got %f", rate)
+	}
+
+	if _, err := BlendedStorageRate(client, 0, 0); err == nil {
+		t.Errorf("expected error for empty window")
+	}
+}
@@ -0,0 +1,129 @@
+package costmodel
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
+
+const (
+	// UntaintedNodeKey indicates the cost of nodes without the taint by which
+	// costs are grouped.
+	UntaintedNodeKey = "__untainted__"
+
+	// TaintedNodeKey indicates the cost of nodes with the taint by which costs
+	// are grouped, where the taint has no value; e.g. "dedicated:NoSchedule".
+	TaintedNodeKey = "__tainted__"
+)
+
+// CostByNodeTaint gives the cumulative and monthly-rate CPU, GPU, and RAM
+// costs of nodes over the window, keyed by cluster ID and then by the value of
+// the given taint key on each node, per kube_node_spec_taint; e.g. "gpu" for
+// nodes tainted "dedicated=gpu:NoSchedule" given the taint key "dedicated".
+// Costs of nodes tainted without a value are attributed to TaintedNodeKey, and
+// costs of nodes without the taint to UntaintedNodeKey. A node tainted at any
+// point in the window is considered tainted. Storage is not attributed to
+// nodes.
+func CostByNodeTaint(client prometheus.Client, provider cloud.Provider, taintKey string, window, offset time.Duration) (map[string]map[string]*ClusterCosts, error) {
+	return CostByNodeTaintWithOptions(client, provider, taintKey, window, offset, nil)
+}
+
+// CostByNodeTaintWithOptions is CostByNodeTaint with the given options, which
+// may be nil. Of the options, DiscountByCluster is applied as in
+// ComputeClusterCosts and, if taintKey is in LabelMask, taint values are keyed
+// by pseudonyms.
+func CostByNodeTaintWithOptions(client prometheus.Client, provider cloud.Provider, taintKey string, window, offset time.Duration, opts *ClusterCostsOptions) (map[string]map[string]*ClusterCosts, error) {
+	if opts == nil {
+		opts = &ClusterCostsOptions{}
+	}
+
+	if err := timeutil.ValidateTimeRange(window, offset, env.GetPrometheusRetention()); err != nil {
+		return nil, err
+	}
+
+	if !selectorKeyRegex.MatchString(taintKey) {
+		return nil, fmt.Errorf("illegal taint key %q", taintKey)
+	}
+
+	mins := timeutil.ParseTimeRangeDetailed(window, offset, time.Minute).Minutes()
+
+	// minsPerResolution determines accuracy and resource use for the following
+	// queries. Smaller values (higher resolution) result in better accuracy,
+	// but more expensive queries, and vice-a-versa.
+	minsPerResolution := 5
+
+	// hourlyToCumulative is a scaling factor that, when multiplied by an hourly
+	// value, converts it to a cumulative value; i.e.
+	// [$/hr] * [min/res]*[hr/min] = [$/res]
+	hourlyToCumulative := float64(minsPerResolution) * (1.0 / 60.0)
+
+	// Each per-node cost is joined to the value of the node's taint, if any,
+	// or else to UntaintedNodeKey, for nodes with capacity but not the taint
+	const fmtQueryNodeTaintCost = `
+		sum(
+			(%s)
+			* on (node, %s) group_left(value) (
+				label_replace(max(max_over_time(kube_node_spec_taint{key="%s"}[%s]%s)) by (node, %s, value), "value", "%s", "value", "")
+				or on (node, %s)
+				label_replace(max(max_over_time(kube_node_status_capacity_cpu_cores[%s]%s)) by (node, %s) * 0 + 1, "value", "%s", "", "")
+			)
+		) by (%s, value)
+	`
+
+	fmtOffset := timeutil.DurationToPromOffsetString(offset)
+	clusterLabel := env.GetPromClusterLabel()
+	key := promLabelValue(taintKey)
+
+	nodeTaintQuery := func(nodeCost string) string {
+		return fmt.Sprintf(fmtQueryNodeTaintCost, nodeCost, clusterLabel, key, window, fmtOffset, clusterLabel, TaintedNodeKey, clusterLabel, window, fmtOffset, clusterLabel, UntaintedNodeKey, clusterLabel)
+	}
+
+	queryCPU := nodeTaintQuery(fmt.Sprintf(fmtNodeCPUCost, clusterLabel, window, minsPerResolution, fmtOffset, window, minsPerResolution, fmtOffset, clusterLabel, hourlyToCumulative))
+	queryRAM := nodeTaintQuery(fmt.Sprintf(fmtNodeRAMCost, clusterLabel, window, minsPerResolution, fmtOffset, window, minsPerResolution, fmtOffset, clusterLabel, hourlyToCumulative))
+	queryGPU := nodeTaintQuery(fmt.Sprintf(fmtNodeGPUCost, window, minsPerResolution, fmtOffset, hourlyToCumulative, clusterLabel))
+
+	ctx := prom.NewNamedContext(client, prom.ClusterContextName)
+	resChs := ctx.QueryAll(queryCPU, queryRAM, queryGPU)
+
+	resCPU, _ := resChs[0].Await()
+	resRAM, _ := resChs[1].Await()
+	resGPU, _ := resChs[2].Await()
+	if ctx.HasErrors() {
+		return nil, ctx.ErrorCollection()
+	}
+
+	// Apply the same discounts as ComputeClusterCosts
+	discounts := providerDiscounts(provider, opts.DiscountByCluster)
+
+	costData := buildNodePoolCostData("value", opts.defaultClusterID(), map[string][]*prom.QueryResult{
+		"cpu": resCPU,
+		"ram": resRAM,
+		"gpu": resGPU,
+	})
+
+	costsByTaint := map[string]map[string]*ClusterCosts{}
+	for clusterID, taints := range costData {
+		discount, customDiscount := discounts.forCluster(clusterID)
+		costsByTaint[clusterID] = map[string]*ClusterCosts{}
+		for value, cd := range taints {
+			cpu := cd["cpu"] * (1.0 - discount) * (1.0 - customDiscount)
+			ram := cd["ram"] * (1.0 - discount) * (1.0 - customDiscount)
+			gpu := cd["gpu"] * (1.0 - customDiscount)
+
+			costs, err := NewClusterCostsFromCumulative(cpu, gpu, ram, 0.0, window, offset, mins/timeutil.MinsPerHour)
+			if err != nil {
+				return nil, err
+			}
+			costs.DataMinutes = mins
+			costsByTaint[clusterID][value] = costs
+		}
+	}
+
+	return maskCostsByLabelValue(costsByTaint, opts.LabelMask, taintKey), nil
+}
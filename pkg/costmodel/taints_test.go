@@ -0,0 +1,147 @@
+package costmodel
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestCostByNodeTaint(t *testing.T) {
+	taintCosts := func(tainted, untainted float64) string {
+		return fmt.Sprintf(`[
+			{"metric":{"cluster_id":"cluster1","value":"gpu"},"value":[1609459200,"%f"]},
+			{"metric":{"cluster_id":"cluster1","value":"%s"},"value":[1609459200,"%f"]}
+		]`, tainted, UntaintedNodeKey, untainted)
+	}
+
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_cpu_hourly_cost", Result: taintCosts(6.0, 4.0)},
+			{Match: "node_ram_hourly_cost", Result: taintCosts(3.0, 2.0)},
+			{Match: "node_gpu_hourly_cost", Result: taintCosts(5.0, 0.0)},
+		},
+	}
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+
+	costs, err := CostByNodeTaint(client, provider, "dedicated", 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, query := range client.Queries() {
+		if !strings.Contains(query, `kube_node_spec_taint{key="dedicated"}`) {
+			t.Errorf("expected query to join taint key dedicated; got %s", query)
+		}
+	}
+
+	taints, ok := costs["cluster1"]
+	if !ok || len(taints) != 2 {
+		t.Fatalf("expected costs for tainted and untainted nodes of cluster1; got %v", costs)
+	}
+
+	tainted, ok := taints["gpu"]
+	if !ok {
+		t.Fatalf("expected costs for nodes tainted dedicated=gpu")
+	}
+	if !util.IsApproximately(tainted.TotalCumulative, 14.0) {
+		t.Errorf("expected tainted total %f; got %f", 14.0, tainted.TotalCumulative)
+	}
+	if !util.IsApproximately(tainted.GPUCumulative, 5.0) {
+		t.Errorf("expected tainted GPU %f; got %f", 5.0, tainted.GPUCumulative)
+	}
+
+	untainted, ok := taints[UntaintedNodeKey]
+	if !ok {
+		t.Fatalf("expected costs for untainted nodes")
+	}
+	if !util.IsApproximately(untainted.TotalCumulative, 6.0) {
+		t.Errorf("expected untainted total %f; got %f", 6.0, untainted.TotalCumulative)
+	}
+	if untainted.GPUCumulative != 0.0 {
+		t.Errorf("expected untainted GPU %f; got %f", 0.0, untainted.GPUCumulative)
+	}
+
+	_, err = CostByNodeTaint(client, provider, "", 24*time.Hour, 0)
+	if err == nil {
+		t.Errorf("expected error for empty taint key")
+	}
+}
+
+func TestCostByNodeTaint_DiscountByCluster(t *testing.T) {
+	taintCosts := func(cost float64) string {
+		return fmt.Sprintf(`[
+			{"metric":{"cluster_id":"cluster1","value":"gpu"},"value":[1609459200,"%f"]},
+			{"metric":{"cluster_id":"cluster2","value":"gpu"},"value":[1609459200,"%f"]}
+		]`, cost, cost)
+	}
+
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_cpu_hourly_cost", Result: taintCosts(10.0)},
+			{Match: "node_ram_hourly_cost", Result: taintCosts(10.0)},
+			{Match: "node_gpu_hourly_cost", Result: taintCosts(10.0)},
+		},
+	}
+
+	// cluster2 has its own discounts, and cluster1 the provider's
+	provider := &mockProvider{config: &cloud.CustomPricing{
+		Discount:           "10%",
+		NegotiatedDiscount: "0%",
+		DiscountByCluster:  "cluster2:50%:20%",
+	}}
+
+	costs, err := CostByNodeTaint(client, provider, "dedicated", 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// CPU and RAM are subject to both discounts, and GPU only to the
+	// negotiated discount
+	expected := map[string]float64{
+		"cluster1": 10.0*0.9 + 10.0*0.9 + 10.0,
+		"cluster2": 10.0*0.5*0.8 + 10.0*0.5*0.8 + 10.0*0.8,
+	}
+	for clusterID, total := range expected {
+		cc, ok := costs[clusterID]["gpu"]
+		if !ok {
+			t.Fatalf("expected costs for tainted nodes of %s; got %v", clusterID, costs)
+		}
+		if !util.IsApproximately(cc.TotalCumulative, total) {
+			t.Errorf("expected %s total %f; got %f", clusterID, total, cc.TotalCumulative)
+		}
+	}
+}
+
+func TestCostByNodeTaint_LabelMask(t *testing.T) {
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "node_cpu_hourly_cost", Result: fmt.Sprintf(`[
+				{"metric":{"cluster_id":"cluster1","value":"acme"},"value":[1609459200,"10"]},
+				{"metric":{"cluster_id":"cluster1","value":"%s"},"value":[1609459200,"5"]}
+			]`, UntaintedNodeKey)},
+		},
+	}
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+
+	costs, err := CostByNodeTaintWithOptions(client, provider, "customer_id", 24*time.Hour, 0, &ClusterCostsOptions{
+		LabelMask: []string{"customer_id"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	taints := costs["cluster1"]
+	if _, ok := taints["acme"]; ok {
+		t.Errorf("expected masked taint value acme; got %v", taints)
+	}
+	if cc, ok := taints[maskLabelValue("acme")]; !ok || !util.IsApproximately(cc.CPUCumulative, 10.0) {
+		t.Errorf("expected costs keyed by the pseudonym of acme; got %v", taints)
+	}
+	if _, ok := taints[UntaintedNodeKey]; !ok {
+		t.Errorf("expected untainted costs to remain unmasked; got %v", taints)
+	}
+}
@@ -0,0 +1,107 @@
+package costmodel
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+)
+
+var (
+	// variableRegex matches Grafana-style template variables, e.g. $cluster
+	// or ${cluster}
+	variableRegex = regexp.MustCompile(`\$(\{[a-zA-Z_][a-zA-Z0-9_]*\}|[a-zA-Z_][a-zA-Z0-9_]*)`)
+
+	// variableNameRegex matches the names of template variables, which are
+	// also the names of the labels they match
+	variableNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// rangeVariable is the Grafana built-in variable expanding to the window
+const rangeVariable = "__range"
+
+// clusterVariable is the variable whose label matcher is on the configured
+// cluster label, rather than a label named for the variable
+const clusterVariable = "cluster"
+
+// ExpandedVariables holds the window, offset, and variables resolved from
+// Grafana-style template variables, for passing to the cluster cost
+// functions and expanding queries.
+type ExpandedVariables struct {
+	Window time.Duration
+	Offset time.Duration
+
+	// matchers are label matchers, keyed by variable name
+	matchers map[string]string
+}
+
+// ExpandVariables resolves the given window and offset, as Prometheus-style
+// duration strings, e.g. "7d" and "1h", and the given named variables, e.g.
+// {"cluster": "prod"}, for expanding Grafana-style template variables in
+// queries. The built-in $__range expands to the window; each named variable
+// expands to a label matcher on the label of the same name, e.g.
+// team="payments", except $cluster, which matches on the configured cluster
+// label. An empty offset is interpreted as no offset.
+func ExpandVariables(window, offset string, vars map[string]string) (*ExpandedVariables, error) {
+	dur, off, err := timeutil.ParseDurationOffsetStrings(window, offset, env.GetPrometheusRetention())
+	if err != nil {
+		return nil, err
+	}
+
+	matchers := make(map[string]string, len(vars))
+	for name, value := range vars {
+		if !variableNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("illegal variable name %q", name)
+		}
+		if strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("illegal variable name %q: built-in variables cannot be set", name)
+		}
+
+		label := name
+		if name == clusterVariable {
+			label = env.GetPromClusterLabel()
+		}
+		matchers[name] = fmt.Sprintf(`%s="%s"`, label, promLabelValue(value))
+	}
+
+	return &ExpandedVariables{
+		Window:   dur,
+		Offset:   off,
+		matchers: matchers,
+	}, nil
+}
+
+// Expand returns the given query with its template variables expanded; e.g.
+// `sum(node_cpu_hourly_cost{$cluster}[$__range])` expands to
+// `sum(node_cpu_hourly_cost{cluster_id="prod"}[7d])`. Returns an error naming
+// any variables that cannot be resolved.
+func (ev *ExpandedVariables) Expand(query string) (string, error) {
+	unresolved := map[string]bool{}
+
+	expanded := variableRegex.ReplaceAllStringFunc(query, func(variable string) string {
+		name := strings.Trim(variable, "${}")
+		if name == rangeVariable {
+			return timeutil.DurationString(ev.Window)
+		}
+		if matcher, ok := ev.matchers[name]; ok {
+			return matcher
+		}
+		unresolved[name] = true
+		return variable
+	})
+
+	if len(unresolved) > 0 {
+		names := make([]string, 0, len(unresolved))
+		for name := range unresolved {
+			names = append(names, "$"+name)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("unresolved variables in query: %s", strings.Join(names, ", "))
+	}
+
+	return expanded, nil
+}
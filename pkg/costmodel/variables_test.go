@@ -0,0 +1,66 @@
+package costmodel
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/env"
+)
+
+func TestExpandVariables(t *testing.T) {
+	ev, err := ExpandVariables("7d", "1h", map[string]string{"cluster": "prod", "team": `pay"ments`})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ev.Window != 7*24*time.Hour || ev.Offset != time.Hour {
+		t.Errorf("expected window 7d and offset 1h; got %s and %s", ev.Window, ev.Offset)
+	}
+
+	query, err := ev.Expand(`sum(sum_over_time(node_cpu_hourly_cost{$cluster, ${team}}[$__range])) by (node)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := `sum(sum_over_time(node_cpu_hourly_cost{cluster_id="prod", team="pay\"ments"}[7d])) by (node)`
+	if query != expected {
+		t.Errorf("expected query:\n%s\ngot:\n%s", expected, query)
+	}
+
+	// Unresolved variables are errors
+	_, err = ev.Expand(`sum(node_cpu_hourly_cost{$namespace, $node}[$__range])`)
+	if err == nil || !strings.Contains(err.Error(), "$namespace, $node") {
+		t.Errorf("expected error naming unresolved variables; got %v", err)
+	}
+
+	// No offset
+	ev, err = ExpandVariables("1d", "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ev.Offset != 0 {
+		t.Errorf("expected no offset; got %s", ev.Offset)
+	}
+
+	illegal := []struct {
+		window, offset string
+		vars           map[string]string
+	}{
+		{window: "", offset: ""},
+		{window: "1d", offset: "-1h"},
+		{window: "1d", vars: map[string]string{"__range": "2d"}},
+		{window: "1d", vars: map[string]string{"team-name": "payments"}},
+	}
+	for _, tc := range illegal {
+		if _, err := ExpandVariables(tc.window, tc.offset, tc.vars); err == nil {
+			t.Errorf("expected error for window %q, offset %q, and variables %v", tc.window, tc.offset, tc.vars)
+		}
+	}
+
+	// Offsets past the configured Prometheus retention are errors
+	os.Setenv(env.PrometheusRetentionHoursEnvVar, "24")
+	defer os.Unsetenv(env.PrometheusRetentionHoursEnvVar)
+	if _, err := ExpandVariables("1d", "2d", nil); err == nil || !strings.Contains(err.Error(), "retention") {
+		t.Errorf("expected error for offset past retention; got %v", err)
+	}
+}
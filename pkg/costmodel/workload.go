@@ -0,0 +1,133 @@
+package costmodel
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util/timeutil"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
+
+// CostByControllerKind gives the cumulative and monthly-rate CPU, RAM, and
+// storage costs of pods over the window, keyed by cluster and then by the kind
+// of controller owning each pod, e.g. "deployment", "daemonset", or
+// "statefulset". Pods are attributed to controllers as they are by
+// ComputeAllocation; pods without a controller are keyed by
+// UnallocatedSubfield. As with CostForSelector, costs are of the pods'
+// allocations, and idle and GPU costs are not included.
+func CostByControllerKind(client prometheus.Client, provider cloud.Provider, window, offset time.Duration) (map[string]map[string]*ClusterCosts, error) {
+	if err := timeutil.ValidateTimeRange(window, offset, env.GetPrometheusRetention()); err != nil {
+		return nil, err
+	}
+
+	clusterLabel := env.GetPromClusterLabel()
+	fmtOffset := timeutil.DurationToPromOffsetString(offset)
+
+	queryCPU, queryRAM, queryStorage := podCostQueries("", fmt.Sprintf("namespace, pod, %s", clusterLabel), window, fmtOffset)
+
+	durStr := timeutil.DurationString(window)
+	offStr := ""
+	if fmtOffset != "" {
+		offStr = fmt.Sprintf(" %s", fmtOffset)
+	}
+
+	ctx := prom.NewNamedContext(client, prom.ClusterContextName)
+	resChs := ctx.QueryAll(
+		queryCPU,
+		queryRAM,
+		queryStorage,
+		fmt.Sprintf(queryFmtPodLabels, durStr, offStr),
+		fmt.Sprintf(queryFmtDeploymentLabels, durStr, offStr),
+		fmt.Sprintf(queryFmtStatefulSetLabels, durStr, offStr),
+		fmt.Sprintf(queryFmtDaemonSetLabels, durStr, offStr, clusterLabel),
+		fmt.Sprintf(queryFmtJobLabels, durStr, offStr, clusterLabel),
+		fmt.Sprintf(queryFmtPodsWithReplicaSetOwner, durStr, offStr, clusterLabel),
+		fmt.Sprintf(queryFmtReplicaSetsWithoutOwners, durStr, offStr, clusterLabel),
+	)
+
+	resCPU, _ := resChs[0].Await()
+	resRAM, _ := resChs[1].Await()
+	resStorage, _ := resChs[2].Await()
+	resPodLabels, _ := resChs[3].Await()
+	resDeploymentLabels, _ := resChs[4].Await()
+	resStatefulSetLabels, _ := resChs[5].Await()
+	resDaemonSetLabels, _ := resChs[6].Await()
+	resJobLabels, _ := resChs[7].Await()
+	resPodsWithReplicaSetOwner, _ := resChs[8].Await()
+	resReplicaSetsWithoutOwners, _ := resChs[9].Await()
+	if ctx.HasErrors() {
+		return nil, ctx.ErrorCollection()
+	}
+
+	// Attribute pods to controllers in the same order as ComputeAllocation,
+	// such that later matches take precedence
+	podLabels := resToPodLabels(resPodLabels)
+	podControllerMaps := []map[podKey]controllerKey{
+		labelsToPodControllerMap(podLabels, resToDeploymentLabels(resDeploymentLabels)),
+		labelsToPodControllerMap(podLabels, resToStatefulSetLabels(resStatefulSetLabels)),
+		resToPodDaemonSetMap(resDaemonSetLabels),
+		resToPodJobMap(resJobLabels),
+		resToPodReplicaSetMap(resPodsWithReplicaSetOwner, resReplicaSetsWithoutOwners),
+	}
+	podControllerKind := map[podKey]string{}
+	for _, podControllerMap := range podControllerMaps {
+		for pKey, cKey := range podControllerMap {
+			podControllerKind[pKey] = cKey.ControllerKind
+		}
+	}
+
+	type kindCosts struct {
+		cpu, ram, storage float64
+	}
+	costs := map[string]map[string]*kindCosts{}
+
+	apply := func(results []*prom.QueryResult, fn func(*kindCosts, float64)) {
+		for _, result := range results {
+			pKey, err := resultPodKey(result, clusterLabel, "namespace")
+			if err != nil || len(result.Values) == 0 {
+				continue
+			}
+
+			kind, ok := podControllerKind[pKey]
+			if !ok {
+				kind = UnallocatedSubfield
+			}
+
+			if _, ok := costs[pKey.Cluster]; !ok {
+				costs[pKey.Cluster] = map[string]*kindCosts{}
+			}
+			if _, ok := costs[pKey.Cluster][kind]; !ok {
+				costs[pKey.Cluster][kind] = &kindCosts{}
+			}
+			fn(costs[pKey.Cluster][kind], result.Values[0].Value)
+		}
+	}
+	apply(resCPU, func(kc *kindCosts, v float64) { kc.cpu += v })
+	apply(resRAM, func(kc *kindCosts, v float64) { kc.ram += v })
+	apply(resStorage, func(kc *kindCosts, v float64) { kc.storage += v })
+
+	discounts := providerDiscounts(provider, nil)
+
+	costsByKind := map[string]map[string]*ClusterCosts{}
+	for clusterID, kinds := range costs {
+		discount, customDiscount := discounts.forCluster(clusterID)
+		costsByKind[clusterID] = map[string]*ClusterCosts{}
+		for kind, kc := range kinds {
+			cpu := kc.cpu * (1.0 - discount) * (1.0 - customDiscount)
+			ram := kc.ram * (1.0 - discount) * (1.0 - customDiscount)
+			storage := kc.storage * (1.0 - customDiscount)
+
+			cc, err := NewClusterCostsFromCumulative(cpu, 0.0, ram, storage, window, offset, window.Hours())
+			if err != nil {
+				return nil, err
+			}
+			costsByKind[clusterID][kind] = cc
+		}
+	}
+
+	return costsByKind, nil
+}
@@ -0,0 +1,74 @@
+package costmodel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestCostByControllerKind(t *testing.T) {
+	// cluster1 runs a pod of the "web" Deployment, a pod of the "agent"
+	// DaemonSet, and a pod without a controller
+	client := &mockPromClient{
+		responses: []mockPromResponse{
+			{Match: "container_cpu_allocation", Result: `[
+				{"metric":{"cluster_id":"cluster1","namespace":"default","pod":"web-abc"},"value":[1609459200,"3"]},
+				{"metric":{"cluster_id":"cluster1","namespace":"kube-system","pod":"agent-xyz"},"value":[1609459200,"1"]},
+				{"metric":{"cluster_id":"cluster1","namespace":"default","pod":"bare"},"value":[1609459200,"0.5"]}
+			]`},
+			{Match: "container_memory_allocation_bytes", Result: `[
+				{"metric":{"cluster_id":"cluster1","namespace":"default","pod":"web-abc"},"value":[1609459200,"2"]},
+				{"metric":{"cluster_id":"cluster1","namespace":"kube-system","pod":"agent-xyz"},"value":[1609459200,"0.5"]}
+			]`},
+			{Match: "pod_pvc_allocation", Result: `[
+				{"metric":{"cluster_id":"cluster1","namespace":"default","pod":"web-abc"},"value":[1609459200,"1"]}
+			]`},
+			{Match: "kube_pod_labels", Result: `[
+				{"metric":{"cluster_id":"cluster1","namespace":"default","pod":"web-abc","label_app":"web"},"value":[1609459200,"1"]},
+				{"metric":{"cluster_id":"cluster1","namespace":"kube-system","pod":"agent-xyz","label_app":"agent"},"value":[1609459200,"1"]}
+			]`},
+			{Match: "deployment_match_labels", Result: `[
+				{"metric":{"cluster_id":"cluster1","namespace":"default","deployment":"web","label_app":"web"},"value":[1609459200,"1"]}
+			]`},
+			{Match: `owner_kind="DaemonSet"`, Result: `[
+				{"metric":{"cluster_id":"cluster1","namespace":"kube-system","pod":"agent-xyz","owner_name":"agent"},"value":[1609459200,"1"]}
+			]`},
+		},
+	}
+	provider := &mockProvider{config: &cloud.CustomPricing{}}
+
+	costs, err := CostByControllerKind(client, provider, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	kinds, ok := costs["cluster1"]
+	if !ok {
+		t.Fatalf("expected costs for cluster1; got %v", costs)
+	}
+	if len(kinds) != 3 {
+		t.Errorf("expected 3 controller kinds; got %d: %v", len(kinds), kinds)
+	}
+
+	expected := map[string]float64{
+		"deployment":        6.0,
+		"daemonset":         1.5,
+		UnallocatedSubfield: 0.5,
+	}
+	for kind, total := range expected {
+		cc, ok := kinds[kind]
+		if !ok {
+			t.Errorf("expected costs for controller kind %s", kind)
+			continue
+		}
+		if !util.IsApproximately(cc.TotalCumulative, total) {
+			t.Errorf("expected %s cost %f; got %f", kind, total, cc.TotalCumulative)
+		}
+	}
+
+	if cc, ok := kinds["deployment"]; ok && !util.IsApproximately(cc.StorageCumulative, 1.0) {
+		t.Errorf("expected deployment storage cost %f; got %f", 1.0, cc.StorageCumulative)
+	}
+}
@@ -3,6 +3,7 @@ package env
 import (
 	"regexp"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/kubecost/cost-model/pkg/log"
@@ -24,6 +25,8 @@ const (
 	ClusterProfileEnvVar           = "CLUSTER_PROFILE"
 	PrometheusServerEndpointEnvVar = "PROMETHEUS_SERVER_ENDPOINT"
 	MaxQueryConcurrencyEnvVar      = "MAX_QUERY_CONCURRENCY"
+	MaxQueryRangePointsEnvVar      = "MAX_QUERY_RANGE_POINTS"
+	PrometheusRetentionHoursEnvVar = "PROMETHEUS_RETENTION_HOURS"
 	QueryLoggingFileEnvVar         = "QUERY_LOGGING_FILE"
 	RemoteEnabledEnvVar            = "REMOTE_WRITE_ENABLED"
 	RemotePWEnvVar                 = "REMOTE_WRITE_PASSWORD"
@@ -139,12 +142,34 @@ func GetClusterProfile() string {
 	return Get(ClusterProfileEnvVar, "development")
 }
 
+// DefaultClusterID is the cluster identifier by which costs are keyed when
+// ClusterIDEnvVar is not set, so that costs are never keyed by the empty string.
+const DefaultClusterID = "default-cluster"
+
+// clusterIDWarning ensures the missing ClusterIDEnvVar is only warned of once
+var clusterIDWarning sync.Once
+
 // GetClusterID returns the environment variable value for ClusterIDEnvVar which represents the
 // configurable identifier used for multi-cluster metric emission.
 func GetClusterID() string {
 	return Get(ClusterIDEnvVar, "")
 }
 
+// GetClusterIDOrDefault returns GetClusterID or, if it is not set, DefaultClusterID, logging a
+// warning the first time. It is for keying cost results, which must not be keyed by the empty
+// string; the cluster ID itself, e.g. as persisted or reported by providers, is GetClusterID.
+func GetClusterIDOrDefault() string {
+	clusterID := GetClusterID()
+	if clusterID == "" {
+		clusterIDWarning.Do(func() {
+			log.Warningf("$%s is not set: keying costs by cluster ID '%s'", ClusterIDEnvVar, DefaultClusterID)
+		})
+		return DefaultClusterID
+	}
+
+	return clusterID
+}
+
 // GetPrometheusServerEndpoint returns the environment variable value for PrometheusServerEndpointEnvVar which
 // represents the prometheus server endpoint used to execute prometheus queries.
 func GetPrometheusServerEndpoint() string {
@@ -278,6 +303,19 @@ func GetMaxQueryConcurrency() int {
 	return GetInt(MaxQueryConcurrencyEnvVar, 5)
 }
 
+// GetMaxQueryRangePoints returns the environment variable value for MaxQueryRangePointsEnvVar, which limits the number
+// of points, per series, that a range query may request. Defaults to Prometheus's own limit of 11,000.
+func GetMaxQueryRangePoints() int {
+	return GetInt(MaxQueryRangePointsEnvVar, 11000)
+}
+
+// GetPrometheusRetention returns the environment variable value for PrometheusRetentionHoursEnvVar, the retention of
+// the Prometheus server, beyond which time ranges are rejected as lying outside of the data. Defaults to 0, unlimited.
+func GetPrometheusRetention() time.Duration {
+	hrs := time.Duration(GetInt64(PrometheusRetentionHoursEnvVar, 0))
+	return hrs * time.Hour
+}
+
 // GetQueryLoggingFile returns a file location if query logging is enabled. Otherwise, empty string
 func GetQueryLoggingFile() string {
 	return Get(QueryLoggingFileEnvVar, "")
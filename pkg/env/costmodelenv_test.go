@@ -0,0 +1,52 @@
+package env
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"k8s.io/klog"
+)
+
+func TestGetClusterIDOrDefault(t *testing.T) {
+	// Capture klog output at warning verbosity
+	var buf bytes.Buffer
+	fs := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(fs)
+	fs.Set("logtostderr", "false")
+	fs.Set("v", "2")
+	klog.SetOutput(&buf)
+	defer func() {
+		fs.Set("logtostderr", "true")
+		fs.Set("v", "0")
+		klog.SetOutput(os.Stderr)
+	}()
+
+	clusterIDWarning = sync.Once{}
+	os.Unsetenv(ClusterIDEnvVar)
+
+	// The cluster ID itself remains unset
+	if clusterID := GetClusterID(); clusterID != "" {
+		t.Errorf("expected no cluster ID; got %s", clusterID)
+	}
+
+	for i := 0; i < 2; i++ {
+		if clusterID := GetClusterIDOrDefault(); clusterID != DefaultClusterID {
+			t.Errorf("expected fallback cluster ID %s; got %s", DefaultClusterID, clusterID)
+		}
+	}
+
+	klog.Flush()
+	if count := strings.Count(buf.String(), ClusterIDEnvVar+" is not set"); count != 1 {
+		t.Errorf("expected a single warning of the missing cluster ID; got %d:\n%s", count, buf.String())
+	}
+
+	os.Setenv(ClusterIDEnvVar, "cluster-one")
+	defer os.Unsetenv(ClusterIDEnvVar)
+	if clusterID := GetClusterIDOrDefault(); clusterID != "cluster-one" {
+		t.Errorf("expected configured cluster ID %s; got %s", "cluster-one", clusterID)
+	}
+}
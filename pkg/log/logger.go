@@ -0,0 +1,52 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Logger is a minimal structured logging interface, allowing callers of
+// library functions to route the logs those functions emit to their own
+// logging backend. Key-value pairs are given as alternating keys and values.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+}
+
+// klogLogger is a Logger backed by the package-level klog functions, logging
+// at the same verbosity levels as Debugf, Infof, and Warningf, respectively.
+type klogLogger struct{}
+
+// NewKlogLogger returns a Logger backed by klog
+func NewKlogLogger() Logger {
+	return &klogLogger{}
+}
+
+func (kl *klogLogger) Debug(msg string, keysAndValues ...interface{}) {
+	Debugf("%s%s", msg, formatKeysAndValues(keysAndValues))
+}
+
+func (kl *klogLogger) Info(msg string, keysAndValues ...interface{}) {
+	Infof("%s%s", msg, formatKeysAndValues(keysAndValues))
+}
+
+func (kl *klogLogger) Warn(msg string, keysAndValues ...interface{}) {
+	Warningf("%s%s", msg, formatKeysAndValues(keysAndValues))
+}
+
+// formatKeysAndValues formats alternating keys and values as " k1=v1 k2=v2".
+// A key missing its value is given the value "MISSING".
+func formatKeysAndValues(keysAndValues []interface{}) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var value interface{} = "MISSING"
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		fmt.Fprintf(&sb, " %v=%v", keysAndValues[i], value)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,36 @@
+package log
+
+import "testing"
+
+func TestFormatKeysAndValues(t *testing.T) {
+	cases := []struct {
+		name          string
+		keysAndValues []interface{}
+		expected      string
+	}{
+		{
+			name:          "empty",
+			keysAndValues: nil,
+			expected:      "",
+		},
+		{
+			name:          "pairs",
+			keysAndValues: []interface{}{"cluster", "cluster1", "total", 1.5},
+			expected:      " cluster=cluster1 total=1.5",
+		},
+		{
+			name:          "missing value",
+			keysAndValues: []interface{}{"cluster"},
+			expected:      " cluster=MISSING",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := formatKeysAndValues(c.keysAndValues)
+			if actual != c.expected {
+				t.Errorf("formatKeysAndValues: expected %q; got %q", c.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package prom
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/util/json"
+)
+
+// QueryAuditor records each query run against Prometheus, when it was run,
+// how long it took, and the error it resulted in, if any.
+type QueryAuditor interface {
+	Record(query string, at time.Time, duration time.Duration, err error)
+}
+
+// NoOpQueryAuditor is a QueryAuditor recording nothing. It is the default.
+type NoOpQueryAuditor struct{}
+
+// Record does nothing
+func (NoOpQueryAuditor) Record(query string, at time.Time, duration time.Duration, err error) {}
+
+var (
+	defaultAuditor     QueryAuditor = NoOpQueryAuditor{}
+	defaultAuditorLock sync.RWMutex
+)
+
+// SetDefaultQueryAuditor sets the QueryAuditor used by every Context for which
+// no QueryAuditor has been set. A nil auditor restores the NoOpQueryAuditor.
+func SetDefaultQueryAuditor(auditor QueryAuditor) {
+	if auditor == nil {
+		auditor = NoOpQueryAuditor{}
+	}
+
+	defaultAuditorLock.Lock()
+	defer defaultAuditorLock.Unlock()
+
+	defaultAuditor = auditor
+}
+
+// DefaultQueryAuditor returns the QueryAuditor used by every Context for which
+// no QueryAuditor has been set.
+func DefaultQueryAuditor() QueryAuditor {
+	defaultAuditorLock.RLock()
+	defer defaultAuditorLock.RUnlock()
+
+	return defaultAuditor
+}
+
+// auditRecord is a single line written by a FileQueryAuditor
+type auditRecord struct {
+	Query           string  `json:"query"`
+	At              string  `json:"at"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// FileQueryAuditor is a QueryAuditor appending each record to a file as a
+// line of JSON.
+type FileQueryAuditor struct {
+	file *os.File
+	lock sync.Mutex
+}
+
+// NewFileQueryAuditor creates a FileQueryAuditor appending to the file at the
+// given path, creating it if it does not exist.
+func NewFileQueryAuditor(path string) (*FileQueryAuditor, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening query audit file: %s", err)
+	}
+
+	return &FileQueryAuditor{file: file}, nil
+}
+
+// Record appends a line of JSON recording the query to the file. Failures to
+// write are logged, rather than returned, so that auditing never fails the
+// query itself.
+func (fqa *FileQueryAuditor) Record(query string, at time.Time, duration time.Duration, err error) {
+	record := auditRecord{
+		Query:           query,
+		At:              at.UTC().Format(time.RFC3339Nano),
+		DurationSeconds: duration.Seconds(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	line, mErr := json.Marshal(record)
+	if mErr != nil {
+		log.Errorf("QueryAuditor: failed to marshal record: %s", mErr)
+		return
+	}
+
+	fqa.lock.Lock()
+	defer fqa.lock.Unlock()
+
+	if _, wErr := fqa.file.Write(append(line, '\n')); wErr != nil {
+		log.Errorf("QueryAuditor: failed to write record: %s", wErr)
+	}
+}
+
+// Close closes the underlying file
+func (fqa *FileQueryAuditor) Close() error {
+	fqa.lock.Lock()
+	defer fqa.lock.Unlock()
+
+	return fqa.file.Close()
+}
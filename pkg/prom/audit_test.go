@@ -0,0 +1,57 @@
+package prom
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/util/json"
+)
+
+func TestFileQueryAuditor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	auditor, err := NewFileQueryAuditor(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	at := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	auditor.Record("up", at, 1500*time.Millisecond, nil)
+	auditor.Record("down", at, time.Second, fmt.Errorf("boom"))
+	if err := auditor.Close(); err != nil {
+		t.Fatalf("unexpected error closing: %s", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer file.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("unexpected error unmarshaling line %q: %s", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+
+	expected := []auditRecord{
+		{Query: "up", At: "2021-01-01T00:00:00Z", DurationSeconds: 1.5},
+		{Query: "down", At: "2021-01-01T00:00:00Z", DurationSeconds: 1.0, Error: "boom"},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records; got %d", len(expected), len(records))
+	}
+	for i, record := range records {
+		if record != expected[i] {
+			t.Errorf("expected record %d to be %+v; got %+v", i, expected[i], record)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package prom
+
+import (
+	"fmt"
+	"strings"
+)
+
+// exprOperatorChars are the characters of PromQL binary operators, which may
+// neither begin nor end an expression. Unary + and - may begin one.
+const exprOperatorChars = "*/%^=!<>~,"
+
+// ValidateExpression performs a structural check of the given PromQL
+// expression, returning a descriptive error if it is empty, contains
+// characters that cannot appear in PromQL, has unbalanced brackets or
+// unterminated strings, or begins or ends with a binary operator. It is not a
+// full parse, but catches malformed fragments before they are combined into
+// larger queries, where they would otherwise cause opaque Prometheus errors.
+func ValidateExpression(expr string) error {
+	trimmed := strings.TrimSpace(expr)
+	if trimmed == "" {
+		return fmt.Errorf("invalid expression: empty")
+	}
+
+	var brackets []rune
+	var quote rune
+	escaped := false
+
+	for i, r := range trimmed {
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\' && quote != '`':
+				escaped = true
+			case r == quote:
+				quote = 0
+			}
+			continue
+		}
+
+		switch {
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case r == '(' || r == '[' || r == '{':
+			brackets = append(brackets, r)
+		case r == ')' || r == ']' || r == '}':
+			if len(brackets) == 0 || brackets[len(brackets)-1] != openingBracket(r) {
+				return fmt.Errorf("invalid expression: unexpected '%c' at position %d", r, i)
+			}
+			brackets = brackets[:len(brackets)-1]
+		case !isExprChar(r):
+			return fmt.Errorf("invalid expression: illegal character '%c' at position %d", r, i)
+		}
+	}
+
+	if quote != 0 {
+		return fmt.Errorf("invalid expression: unterminated string")
+	}
+	if len(brackets) > 0 {
+		return fmt.Errorf("invalid expression: unclosed '%c'", brackets[len(brackets)-1])
+	}
+
+	first, last := rune(trimmed[0]), rune(trimmed[len(trimmed)-1])
+	if strings.ContainsRune(exprOperatorChars, first) {
+		return fmt.Errorf("invalid expression: must not begin with '%c'", first)
+	}
+	if strings.ContainsRune(exprOperatorChars+"+-", last) {
+		return fmt.Errorf("invalid expression: must not end with '%c'", last)
+	}
+
+	return nil
+}
+
+// openingBracket returns the opening bracket matching the given closing bracket
+func openingBracket(r rune) rune {
+	switch r {
+	case ')':
+		return '('
+	case ']':
+		return '['
+	default:
+		return '{'
+	}
+}
+
+// isExprChar returns true if the given rune may appear in a PromQL expression
+// outside of a string.
+func isExprChar(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+		return true
+	case strings.ContainsRune("_:.@+-#"+exprOperatorChars, r):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package prom
+
+import "testing"
+
+func TestValidateExpression(t *testing.T) {
+	valid := []string{
+		`up`,
+		`sum(rate(node_cpu_seconds_total{mode!="idle"}[5m] offset 1h)) by (cluster_id)`,
+		`-sum(x) / 1024 * 0.04`,
+		`sum(container_fs_limit_bytes{device!="tmpfs", id="/"}) by (cluster_id) / 1024 / 1024 / 1024 * 0.040000`,
+		`count(kube_pod_labels{label_app=~"a(b|c)"})`,
+	}
+	for _, expr := range valid {
+		if err := ValidateExpression(expr); err != nil {
+			t.Errorf("expected %q to be valid; got error: %s", expr, err)
+		}
+	}
+
+	invalid := []string{
+		``,
+		`   `,
+		`sum(x`,
+		`sum(x))`,
+		`sum(x[5m)]`,
+		`x{a="b}`,
+		`* sum(x)`,
+		`sum(x) +`,
+		`sum(x); drop`,
+		`$x`,
+	}
+	for _, expr := range invalid {
+		if err := ValidateExpression(expr); err == nil {
+			t.Errorf("expected %q to be invalid", expr)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package prom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	prometheus "github.com/prometheus/client_golang/api"
+	"k8s.io/klog"
+)
+
+// FailoverQuerier is a prometheus.Client sending each request to a primary
+// client, e.g. a read replica, and failing over to a secondary client, e.g.
+// the primary Prometheus, if the primary fails with a network error or a 5xx
+// response.
+type FailoverQuerier struct {
+	primary   prometheus.Client
+	secondary prometheus.Client
+}
+
+// NewFailoverQuerier creates a FailoverQuerier trying the primary client
+// before the secondary.
+func NewFailoverQuerier(primary, secondary prometheus.Client) *FailoverQuerier {
+	return &FailoverQuerier{
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+// URL returns the primary client's URL for the given endpoint. Requests for
+// it are redirected to the secondary client's URL on failover.
+func (fq *FailoverQuerier) URL(ep string, args map[string]string) *url.URL {
+	return fq.primary.URL(ep, args)
+}
+
+// Do sends the request to the primary client, resending it to the secondary
+// client if the primary fails with a network error or a 5xx response.
+func (fq *FailoverQuerier) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, prometheus.Warnings, error) {
+	resp, body, warnings, err := fq.primary.Do(ctx, req)
+	if err == nil && (resp == nil || resp.StatusCode < 500) {
+		return resp, body, warnings, err
+	}
+
+	reason := fmt.Sprintf("%v", err)
+	if err == nil {
+		reason = fmt.Sprintf("status %d", resp.StatusCode)
+	}
+
+	failoverReq, fErr := fq.secondaryRequest(ctx, req)
+	if fErr != nil {
+		klog.V(2).Infof("FailoverQuerier: primary failed (%s) and cannot fail over: %s", reason, fErr)
+		return resp, body, warnings, err
+	}
+
+	klog.V(2).Infof("FailoverQuerier: primary failed (%s): failing over to %s", reason, failoverReq.URL.Host)
+	return fq.secondary.Do(ctx, failoverReq)
+}
+
+// secondaryRequest returns a copy of the given request to the primary client,
+// addressed to the same endpoint of the secondary client.
+func (fq *FailoverQuerier) secondaryRequest(ctx context.Context, req *http.Request) (*http.Request, error) {
+	primaryBase := fq.primary.URL("", nil)
+	secondaryBase := fq.secondary.URL("", nil)
+
+	u := *req.URL
+	u.Scheme = secondaryBase.Scheme
+	u.Host = secondaryBase.Host
+	u.User = secondaryBase.User
+	u.Path = strings.TrimSuffix(secondaryBase.Path, "/") + "/" + strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, strings.TrimSuffix(primaryBase.Path, "/")), "/")
+
+	failoverReq := req.Clone(ctx)
+	failoverReq.URL = &u
+	failoverReq.Host = ""
+
+	// Bodies are consumed by the primary request, so must be re-read
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, fmt.Errorf("request body cannot be resent")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		failoverReq.Body = body
+	}
+
+	return failoverReq, nil
+}
@@ -0,0 +1,80 @@
+package prom
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
+
+// stubClient is a prometheus.Client at the given host answering each request
+// with the given status and a single-sample vector, or the given error
+type stubClient struct {
+	host   string
+	status int
+	err    error
+	urls   []*url.URL
+}
+
+func (sc *stubClient) URL(ep string, args map[string]string) *url.URL {
+	return &url.URL{Scheme: "http", Host: sc.host, Path: "/prometheus" + ep}
+}
+
+func (sc *stubClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, prometheus.Warnings, error) {
+	sc.urls = append(sc.urls, req.URL)
+	if sc.err != nil {
+		return nil, nil, nil, sc.err
+	}
+
+	body := []byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1609459200,"1"]}]}}`)
+	resp := &http.Response{
+		StatusCode: sc.status,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+	}
+	return resp, body, nil, nil
+}
+
+func TestFailoverQuerier(t *testing.T) {
+	cases := map[string]*stubClient{
+		"unavailable":   {host: "replica", status: http.StatusServiceUnavailable},
+		"network error": {host: "replica", err: fmt.Errorf("connection refused")},
+	}
+
+	for name, replica := range cases {
+		t.Run(name, func(t *testing.T) {
+			primary := &stubClient{host: "primary", status: http.StatusOK}
+
+			ctx := NewContext(NewFailoverQuerier(replica, primary))
+			results, _, err := ctx.QuerySync("up")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result; got %d", len(results))
+			}
+
+			if len(replica.urls) != 1 || len(primary.urls) != 1 {
+				t.Fatalf("expected one request to each client; got %d to replica and %d to primary", len(replica.urls), len(primary.urls))
+			}
+			u := primary.urls[0]
+			if u.Host != "primary" || u.Path != "/prometheus"+epQuery || u.Query().Get("query") != "up" {
+				t.Errorf("expected failover to %s with the same query; got %s", "http://primary/prometheus"+epQuery, u)
+			}
+		})
+	}
+
+	// A healthy replica is used without failing over
+	replica := &stubClient{host: "replica", status: http.StatusOK}
+	primary := &stubClient{host: "primary", status: http.StatusOK}
+	if _, _, err := NewContext(NewFailoverQuerier(replica, primary)).QuerySync("up"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(primary.urls) != 0 {
+		t.Errorf("expected no failover for a healthy replica; got %d requests", len(primary.urls))
+	}
+}
@@ -26,6 +26,8 @@ const (
 type Context struct {
 	Client         prometheus.Client
 	name           string
+	timeout        time.Duration
+	auditor        QueryAuditor
 	errorCollector *QueryErrorCollector
 }
 
@@ -47,6 +49,38 @@ func NewNamedContext(client prometheus.Client, name string) *Context {
 	return ctx
 }
 
+// SetTimeout sets the timeout passed to Prometheus with each query, after
+// which Prometheus aborts the query. A non-positive timeout is not passed, so
+// Prometheus applies its default.
+func (ctx *Context) SetTimeout(timeout time.Duration) {
+	ctx.timeout = timeout
+}
+
+// SetAuditor sets the QueryAuditor recording each query run by the Context,
+// overriding the DefaultQueryAuditor.
+func (ctx *Context) SetAuditor(auditor QueryAuditor) {
+	ctx.auditor = auditor
+}
+
+// audit records the given query, started at the given time, and its outcome
+// with the Context's QueryAuditor. The first non-nil error is recorded.
+func (ctx *Context) audit(query string, start time.Time, errs ...error) {
+	auditor := ctx.auditor
+	if auditor == nil {
+		auditor = DefaultQueryAuditor()
+	}
+
+	var err error
+	for _, e := range errs {
+		if e != nil {
+			err = e
+			break
+		}
+	}
+
+	auditor.Record(query, start, time.Since(start), err)
+}
+
 // Warnings returns the warnings collected from the Context's ErrorCollector
 func (ctx *Context) Warnings() []*QueryWarning {
 	return ctx.errorCollector.Warnings()
@@ -129,12 +163,16 @@ func (ctx *Context) ProfileQueryAll(queries ...string) []QueryResultsChan {
 }
 
 func (ctx *Context) QuerySync(query string) ([]*QueryResult, prometheus.Warnings, error) {
+	startQuery := time.Now()
+
 	raw, warnings, err := ctx.query(query)
 	if err != nil {
+		ctx.audit(query, startQuery, err)
 		return nil, warnings, err
 	}
 
 	results := NewQueryResults(query, raw)
+	ctx.audit(query, startQuery, results.Error)
 	if results.Error != nil {
 		return nil, warnings, results.Error
 	}
@@ -155,6 +193,7 @@ func runQuery(query string, ctx *Context, resCh QueryResultsChan, profileLabel s
 
 	raw, warnings, requestError := ctx.query(query)
 	results := NewQueryResults(query, raw)
+	ctx.audit(query, startQuery, requestError, results.Error)
 
 	// report all warnings, request, and parse errors (nils will be ignored)
 	ctx.errorCollector.Report(query, warnings, requestError, results.Error)
@@ -171,6 +210,7 @@ func (ctx *Context) RawQuery(query string) ([]byte, error) {
 	u := ctx.Client.URL(epQuery, nil)
 	q := u.Query()
 	q.Set("query", query)
+	ctx.setTimeoutParam(q)
 	u.RawQuery = q.Encode()
 
 	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
@@ -206,6 +246,14 @@ func (ctx *Context) RawQuery(query string) ([]byte, error) {
 	return body, err
 }
 
+// setTimeoutParam sets the timeout parameter of the given query values to the
+// Context's timeout, in seconds, if one is set.
+func (ctx *Context) setTimeoutParam(q url.Values) {
+	if ctx.timeout > 0 {
+		q.Set("timeout", strconv.FormatFloat(ctx.timeout.Seconds(), 'f', 3, 64))
+	}
+}
+
 func (ctx *Context) query(query string) (interface{}, prometheus.Warnings, error) {
 	body, err := ctx.RawQuery(query)
 	if err != nil {
@@ -250,12 +298,16 @@ func (ctx *Context) ProfileQueryRange(query string, start, end time.Time, step t
 }
 
 func (ctx *Context) QueryRangeSync(query string, start, end time.Time, step time.Duration) ([]*QueryResult, prometheus.Warnings, error) {
+	startQuery := time.Now()
+
 	raw, warnings, err := ctx.queryRange(query, start, end, step)
 	if err != nil {
+		ctx.audit(query, startQuery, err)
 		return nil, warnings, err
 	}
 
 	results := NewQueryResults(query, raw)
+	ctx.audit(query, startQuery, results.Error)
 	if results.Error != nil {
 		return nil, warnings, results.Error
 	}
@@ -276,6 +328,7 @@ func runQueryRange(query string, start, end time.Time, step time.Duration, ctx *
 
 	raw, warnings, requestError := ctx.queryRange(query, start, end, step)
 	results := NewQueryResults(query, raw)
+	ctx.audit(query, startQuery, requestError, results.Error)
 
 	// report all warnings, request, and parse errors (nils will be ignored)
 	ctx.errorCollector.Report(query, warnings, requestError, results.Error)
@@ -295,6 +348,7 @@ func (ctx *Context) RawQueryRange(query string, start, end time.Time, step time.
 	q.Set("start", start.Format(time.RFC3339Nano))
 	q.Set("end", end.Format(time.RFC3339Nano))
 	q.Set("step", strconv.FormatFloat(step.Seconds(), 'f', 3, 64))
+	ctx.setTimeoutParam(q)
 	u.RawQuery = q.Encode()
 
 	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
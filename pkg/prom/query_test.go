@@ -1,6 +1,16 @@
 package prom
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	prometheus "github.com/prometheus/client_golang/api"
+)
 
 func TestWarningsFrom(t *testing.T) {
 	var results interface{}
@@ -25,3 +35,44 @@ func TestWarningsFrom(t *testing.T) {
 		t.Errorf("Unexpected second warning: %s", warnings[1])
 	}
 }
+
+// recordingClient is a prometheus.Client recording the URL of each request and
+// answering with an empty vector
+type recordingClient struct {
+	urls []*url.URL
+}
+
+func (rc *recordingClient) URL(ep string, args map[string]string) *url.URL {
+	return &url.URL{Scheme: "http", Host: "prometheus", Path: ep}
+}
+
+func (rc *recordingClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, prometheus.Warnings, error) {
+	rc.urls = append(rc.urls, req.URL)
+
+	body := []byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`)
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+	}
+	return resp, body, nil, nil
+}
+
+func TestContextTimeout(t *testing.T) {
+	client := &recordingClient{}
+	ctx := NewContext(client)
+
+	// No timeout is passed by default
+	ctx.QuerySync("up")
+	if _, ok := client.urls[0].Query()["timeout"]; ok {
+		t.Errorf("expected no timeout parameter by default; got %s", client.urls[0].Query().Get("timeout"))
+	}
+
+	ctx.SetTimeout(90 * time.Second)
+	ctx.QuerySync("up")
+	ctx.QueryRangeSync("up", time.Now().Add(-time.Hour), time.Now(), time.Minute)
+	for _, u := range client.urls[1:] {
+		if timeout := u.Query().Get("timeout"); timeout != "90.000" {
+			t.Errorf("expected timeout parameter 90.000 on %s; got %q", u.Path, timeout)
+		}
+	}
+}
@@ -92,6 +92,10 @@ type QueryResults struct {
 type QueryResult struct {
 	Metric map[string]interface{} `json:"metric"`
 	Values []*util.Vector         `json:"values"`
+
+	// isRange is true if the result was parsed from a range (matrix) series,
+	// rather than an instant (vector or scalar) value
+	isRange bool
 }
 
 // NewQueryResults accepts the raw prometheus query result and returns an array of
@@ -126,6 +130,28 @@ func NewQueryResults(query string, queryResult interface{}) *QueryResults {
 		qrs.Error = ResultFieldDoesNotExistErr(query)
 		return qrs
 	}
+
+	// Scalar results are a single data point, rather than an array of result
+	// objects, so wrap them as a single unlabeled series
+	if resultType, _ := d["resultType"].(string); resultType == "scalar" {
+		v, warn, err := parseDataPoint(query, resultData)
+		if err != nil {
+			qrs.Error = err
+			return qrs
+		}
+		if warn != nil {
+			log.DedupedWarningf(5, "%s\nQuery: %s", warn.Message(), query)
+		}
+
+		qrs.Results = []*QueryResult{
+			{
+				Metric: map[string]interface{}{},
+				Values: []*util.Vector{v},
+			},
+		}
+		return qrs
+	}
+
 	resultsData, ok := resultData.([]interface{})
 	if !ok {
 		qrs.Error = ResultFieldFormatErr(query)
@@ -206,8 +232,9 @@ func NewQueryResults(query string, queryResult interface{}) *QueryResults {
 		}
 
 		results = append(results, &QueryResult{
-			Metric: metricMap,
-			Values: vectors,
+			Metric:  metricMap,
+			Values:  vectors,
+			isRange: isRange,
 		})
 	}
 
@@ -215,6 +242,12 @@ func NewQueryResults(query string, queryResult interface{}) *QueryResults {
 	return qrs
 }
 
+// IsRange returns true if the result is a range (matrix) series of values,
+// and false if it is an instant (vector or scalar) value.
+func (qr *QueryResult) IsRange() bool {
+	return qr.isRange
+}
+
 // GetString returns the requested field, or an error if it does not exist
 func (qr *QueryResult) GetString(field string) (string, error) {
 	f, ok := qr.Metric[field]
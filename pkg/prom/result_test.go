@@ -0,0 +1,79 @@
+package prom
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNewQueryResults(t *testing.T) {
+	cases := map[string]struct {
+		body    string
+		labels  []map[string]string
+		values  [][]float64
+		isRange bool
+	}{
+		"scalar": {
+			body:   `{"status":"success","data":{"resultType":"scalar","result":[1609459200,"42.5"]}}`,
+			labels: []map[string]string{{}},
+			values: [][]float64{{42.5}},
+		},
+		"vector": {
+			body:   `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"cluster_id":"cluster1"},"value":[1609459200,"1"]},{"metric":{"cluster_id":"cluster2"},"value":[1609459200,"2"]}]}}`,
+			labels: []map[string]string{{"cluster_id": "cluster1"}, {"cluster_id": "cluster2"}},
+			values: [][]float64{{1.0}, {2.0}},
+		},
+		"matrix": {
+			body:    `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"cluster_id":"cluster1"},"values":[[1609459200,"1"],[1609459260,"3"]]}]}}`,
+			labels:  []map[string]string{{"cluster_id": "cluster1"}},
+			values:  [][]float64{{1.0, 3.0}},
+			isRange: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var raw interface{}
+			if err := json.Unmarshal([]byte(c.body), &raw); err != nil {
+				t.Fatalf("unexpected error unmarshaling: %s", err)
+			}
+
+			qrs := NewQueryResults("query", raw)
+			if qrs.Error != nil {
+				t.Fatalf("unexpected error: %s", qrs.Error)
+			}
+			if len(qrs.Results) != len(c.values) {
+				t.Fatalf("expected %d results; got %d", len(c.values), len(qrs.Results))
+			}
+
+			for i, result := range qrs.Results {
+				if result.IsRange() != c.isRange {
+					t.Errorf("expected result %d IsRange to be %t", i, c.isRange)
+				}
+				if len(result.Metric) != len(c.labels[i]) {
+					t.Errorf("expected result %d to have %d labels; got %d", i, len(c.labels[i]), len(result.Metric))
+				}
+				for label, value := range c.labels[i] {
+					if v, _ := result.GetString(label); v != value {
+						t.Errorf("expected result %d label %s to be %s; got %s", i, label, value, v)
+					}
+				}
+
+				if len(result.Values) != len(c.values[i]) {
+					t.Fatalf("expected result %d to have %d values; got %d", i, len(c.values[i]), len(result.Values))
+				}
+				for j, value := range c.values[i] {
+					if result.Values[j].Value != value {
+						t.Errorf("expected result %d value %d to be %f; got %f", i, j, value, result.Values[j].Value)
+					}
+				}
+			}
+		})
+	}
+
+	// Malformed scalar
+	var raw interface{}
+	json.Unmarshal([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1609459200]}}`), &raw)
+	if qrs := NewQueryResults("query", raw); qrs.Error == nil {
+		t.Errorf("expected error for malformed scalar")
+	}
+}
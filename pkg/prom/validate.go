@@ -2,6 +2,7 @@ package prom
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/kubecost/cost-model/pkg/env"
 
@@ -70,3 +71,18 @@ func validate(cli prometheus.Client, q string) (*PrometheusMetadata, error) {
 		KubecostDataExists: false,
 	}, nil
 }
+
+// ValidateAtModifier returns an error if Prometheus does not support the @
+// modifier, pinning queries to an absolute evaluation time, by querying at the
+// given time. The @ modifier requires Prometheus v2.33+, or v2.25+ with the
+// promql-at-modifier feature enabled.
+func ValidateAtModifier(cli prometheus.Client, at time.Time) error {
+	ctx := NewContext(cli)
+
+	_, _, err := ctx.QuerySync(fmt.Sprintf("count(up @ %d)", at.Unix()))
+	if err != nil {
+		return fmt.Errorf("Prometheus does not support the @ modifier; requires v2.33+, or v2.25+ with --enable-feature=promql-at-modifier: %s", err)
+	}
+
+	return nil
+}
@@ -13,3 +13,28 @@ func IsApproximately(a, b float64) bool {
 func IsWithin(a, b, delta float64) bool {
 	return math.Abs(a-b) <= delta
 }
+
+// KahanSum is a running sum of float64 values that uses compensated (Kahan-
+// Babuska-Neumaier) summation to bound the floating point error accumulated
+// when adding many values, or values of widely varying magnitudes. The zero
+// value is an empty sum.
+type KahanSum struct {
+	sum          float64
+	compensation float64
+}
+
+// Add adds the given value to the sum
+func (ks *KahanSum) Add(value float64) {
+	t := ks.sum + value
+	if math.Abs(ks.sum) >= math.Abs(value) {
+		ks.compensation += (ks.sum - t) + value
+	} else {
+		ks.compensation += (value - t) + ks.sum
+	}
+	ks.sum = t
+}
+
+// Value returns the compensated sum
+func (ks *KahanSum) Value() float64 {
+	return ks.sum + ks.compensation
+}
@@ -2,6 +2,7 @@ package timeutil
 
 import (
 	"fmt"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
@@ -86,55 +87,331 @@ func FormatStoreResolution(dur time.Duration) string {
 	return fmt.Sprint(dur)
 }
 
-// ParseDuration converts a Prometheus-style duration string into a Duration
+// durationUnits are the units of Prometheus-style durations, from largest to
+// smallest, as they must appear in compound durations, e.g. "1d12h"
+var durationUnits = []struct {
+	symbol string
+	unit   time.Duration
+}{
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+}
+
+// durationTermRegex matches a single term of a Prometheus-style duration,
+// e.g. the "12h" of "1d12h"
+var durationTermRegex = regexp.MustCompile(`^([0-9]+)([a-z]+)`)
+
+// ParseDuration converts a Prometheus-style duration string into a Duration,
+// including compound durations, e.g. "1d12h" or "2w3d", whose units must
+// appear from largest to smallest: w, d, h, m, then s.
 func ParseDuration(duration string) (time.Duration, error) {
 	// Trim prefix of Prometheus format duration
 	duration = CleanDurationString(duration)
-	if len(duration) < 2 {
-		return 0, fmt.Errorf("error parsing duration: %s did not match expected format [0-9+](s|m|d|h)", duration)
-	}
-	unitStr := duration[len(duration)-1:]
-	var unit time.Duration
-	switch unitStr {
-	case "s":
-		unit = time.Second
-	case "m":
-		unit = time.Minute
-	case "h":
-		unit = time.Hour
-	case "d":
-		unit = 24.0 * time.Hour
-	default:
-		return 0, fmt.Errorf("error parsing duration: %s did not match expected format [0-9+](s|m|d|h)", duration)
-	}
-
-	amountStr := duration[:len(duration)-1]
-	amount, err := strconv.ParseInt(amountStr, 10, 64)
-	if err != nil {
-		return 0, fmt.Errorf("error parsing duration: %s did not match expected format [0-9+](s|m|d|h)", duration)
+	formatErr := fmt.Errorf("error parsing duration: %s did not match expected format ([0-9]+(w|d|h|m|s))+", duration)
+
+	remaining := duration
+	sign := int64(1)
+	if strings.HasPrefix(remaining, "-") {
+		sign = -1
+		remaining = remaining[1:]
+	}
+	if remaining == "" {
+		return 0, formatErr
 	}
 
-	return time.Duration(amount) * unit, nil
+	var total time.Duration
+	nextUnit := 0
+	for remaining != "" {
+		match := durationTermRegex.FindStringSubmatch(remaining)
+		if match == nil {
+			return 0, formatErr
+		}
+		remaining = remaining[len(match[0]):]
+
+		// Units must be known, and descend in size without repeating
+		i := nextUnit
+		for i < len(durationUnits) && durationUnits[i].symbol != match[2] {
+			i++
+		}
+		if i == len(durationUnits) {
+			return 0, formatErr
+		}
+		nextUnit = i + 1
+		unit := durationUnits[i].unit
+
+		amount, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return 0, formatErr
+		}
+
+		// Guard against silently overflowing time.Duration
+		if amount > (math.MaxInt64-int64(total))/int64(unit) {
+			return 0, fmt.Errorf("error parsing duration: %s is out of range", duration)
+		}
+		total += time.Duration(amount) * unit
+	}
+
+	return time.Duration(sign) * total, nil
 }
 
 // CleanDurationString removes prometheus formatted prefix "offset " allong with leading a trailing whitespace
-// from duration string, leaving behind a string with format [0-9+](s|m|d|h)
+// from duration string, leaving behind a string with format ([0-9]+(w|d|h|m|s))+
 func CleanDurationString(duration string) string {
 	duration = strings.TrimSpace(duration)
 	duration = strings.TrimPrefix(duration, "offset ")
 	return duration
 }
 
+// Alignment determines the boundary, if any, to which the end of a time range
+// is snapped, so that ranges computed at different times are identical.
+type Alignment int
+
+const (
+	// AlignNone does not align time ranges
+	AlignNone Alignment = iota
+
+	// AlignHour snaps the end of a time range to the start of the hour
+	AlignHour
+
+	// AlignDay snaps the end of a time range to midnight UTC, or midnight in
+	// the given location, if any
+	AlignDay
+)
+
+// Clock provides the current time, so that functions depending on "now" can
+// be made deterministic, e.g. in tests, by providing a FakeClock.
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock is a Clock returning the current system time
+type RealClock struct{}
+
+// Now returns the current system time
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a Clock that always returns the time it is set to
+type FakeClock struct {
+	T time.Time
+}
+
+// Now returns the time the FakeClock is set to
+func (fc *FakeClock) Now() time.Time {
+	return fc.T
+}
+
+// Advance moves the FakeClock forward by the given duration
+func (fc *FakeClock) Advance(d time.Duration) {
+	fc.T = fc.T.Add(d)
+}
+
 // ParseTimeRange returns a start and end time, respectively, which are converted from
 // a duration and offset, defined as strings with Prometheus-style syntax.
 func ParseTimeRange(duration, offset time.Duration) (time.Time, time.Time) {
-	// endTime defaults to the current time, unless an offset is explicity declared,
+	return ParseAlignedTimeRange(duration, offset, AlignNone)
+}
+
+// ValidateTimeRange returns a descriptive error if the given duration and
+// offset do not describe a valid time range: i.e. if the duration is not
+// positive, the offset is negative, or the offset is larger than the given
+// retention, in which case the range lies entirely outside of the data.
+// A retention of zero is treated as unlimited.
+func ValidateTimeRange(duration, offset, retention time.Duration) error {
+	if duration <= 0 {
+		return fmt.Errorf("invalid time range: duration must be positive; got %s", duration)
+	}
+
+	if offset < 0 {
+		return fmt.Errorf("invalid time range: offset must not be negative; got %s", offset)
+	}
+
+	if retention > 0 && offset > retention {
+		return fmt.Errorf("invalid time range: offset %s is larger than retention %s", offset, retention)
+	}
+
+	return nil
+}
+
+// ParseTimeRangeStrings returns a start and end time, respectively, which are
+// converted from a duration and offset given as Prometheus-style strings; e.g.
+// "7d" and "30m". An empty offset is interpreted as no offset. Returns an error
+// if either string cannot be parsed, or if the resulting range is invalid per
+// ValidateTimeRange.
+func ParseTimeRangeStrings(duration, offset string, retention time.Duration) (time.Time, time.Time, error) {
+	dur, off, err := ParseDurationOffsetStrings(duration, offset, retention)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	start, end := ParseTimeRange(dur, off)
+	return start, end, nil
+}
+
+// ParseDurationOffsetStrings is ParseTimeRangeStrings, returning the parsed
+// duration and offset, rather than the start and end times, for functions
+// taking a window and offset.
+func ParseDurationOffsetStrings(duration, offset string, retention time.Duration) (time.Duration, time.Duration, error) {
+	dur, err := ParseDuration(duration)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time range: %s", err)
+	}
+
+	var off time.Duration
+	if CleanDurationString(offset) != "" {
+		off, err = ParseDuration(offset)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid time range: %s", err)
+		}
+	}
+
+	err = ValidateTimeRange(dur, off, retention)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return dur, off, nil
+}
+
+// TimeRangeDetail describes a time range along with the number of samples
+// expected within it at a given scrape interval.
+type TimeRangeDetail struct {
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+	Samples  int
+}
+
+// Minutes returns the duration of the time range in minutes
+func (trd TimeRangeDetail) Minutes() float64 {
+	return trd.Duration.Minutes()
+}
+
+// Hours returns the duration of the time range in hours
+func (trd TimeRangeDetail) Hours() float64 {
+	return trd.Duration.Hours()
+}
+
+// NewTimeRangeDetail returns the TimeRangeDetail of the given range, with the
+// number of samples expected at the given scrape interval. A non-positive
+// scrape interval results in zero expected samples.
+func NewTimeRangeDetail(start, end time.Time, scrapeInterval time.Duration) TimeRangeDetail {
+	trd := TimeRangeDetail{
+		Start:    start,
+		End:      end,
+		Duration: end.Sub(start),
+	}
+
+	if scrapeInterval > 0 {
+		trd.Samples = int(trd.Duration / scrapeInterval)
+	}
+
+	return trd
+}
+
+// ParseTimeRangeDetailed returns the TimeRangeDetail of the time range given by
+// the duration and offset, as by ParseTimeRange, with the number of samples
+// expected at the given scrape interval.
+func ParseTimeRangeDetailed(duration, offset, scrapeInterval time.Duration) TimeRangeDetail {
+	start, end := ParseTimeRange(duration, offset)
+	return NewTimeRangeDetail(start, end, scrapeInterval)
+}
+
+// Window is the range of time [Start, End), including its start and
+// excluding its end.
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Duration returns the duration of the window
+func (w Window) Duration() time.Duration {
+	return w.End.Sub(w.Start)
+}
+
+// Contains returns true if the given time lies within the window; i.e. at or
+// after its start, and before its end.
+func (w Window) Contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// ParseWindow returns the Window given by the duration and offset, as by
+// ParseTimeRange, or an error if they are invalid per ValidateTimeRange.
+func ParseWindow(duration, offset time.Duration) (Window, error) {
+	if err := ValidateTimeRange(duration, offset, 0); err != nil {
+		return Window{}, err
+	}
+
+	start, end := ParseTimeRange(duration, offset)
+	return Window{Start: start, End: end}, nil
+}
+
+// ParseAlignedWindowAt returns the Window given by the duration and offset
+// relative to the given time, aligned as by ParseAlignedTimeRangeAt.
+func ParseAlignedWindowAt(now time.Time, duration, offset time.Duration, alignTo Alignment) Window {
+	return ParseAlignedWindowIn(now, duration, offset, alignTo, time.UTC)
+}
+
+// ParseAlignedWindowIn is ParseAlignedWindowAt, with boundaries aligned in
+// the given location, as by ParseAlignedTimeRangeIn.
+func ParseAlignedWindowIn(now time.Time, duration, offset time.Duration, alignTo Alignment, loc *time.Location) Window {
+	start, end := ParseAlignedTimeRangeIn(now, duration, offset, alignTo, loc)
+	return Window{Start: start, End: end}
+}
+
+// ParseAlignedTimeRange returns a start and end time, respectively, which are
+// converted from a duration and offset, with the end time snapped back to the
+// given alignment boundary. The start time is always the end time less the
+// duration, so the range retains the requested duration.
+func ParseAlignedTimeRange(duration, offset time.Duration, alignTo Alignment) (time.Time, time.Time) {
+	return ParseAlignedTimeRangeAt(time.Now(), duration, offset, alignTo)
+}
+
+// ParseAlignedTimeRangeAt is ParseAlignedTimeRange, with the duration and
+// offset taken relative to the given time rather than the current time.
+func ParseAlignedTimeRangeAt(now time.Time, duration, offset time.Duration, alignTo Alignment) (time.Time, time.Time) {
+	return ParseAlignedTimeRangeIn(now, duration, offset, alignTo, time.UTC)
+}
+
+// ParseAlignedTimeRangeIn is ParseAlignedTimeRangeAt, with the end time
+// snapped back to the alignment boundary in the given location (UTC, if nil)
+// rather than UTC; e.g. to midnight in America/New_York. When aligning to the
+// day, a duration of whole days spans that many calendar days in the given
+// location, so that a day crossing a daylight saving time transition lasts
+// 23 or 25 hours rather than 24.
+func ParseAlignedTimeRangeIn(now time.Time, duration, offset time.Duration, alignTo Alignment, loc *time.Location) (time.Time, time.Time) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	// endTime defaults to now, unless an offset is explicity declared,
 	// in which case it shifts endTime back by given duration
-	endTime := time.Now()
+	endTime := now
 	if offset > 0 {
 		endTime = endTime.Add(-1 * offset)
 	}
 
+	switch alignTo {
+	case AlignHour:
+		endTime = endTime.In(loc)
+		// Subtract the minutes past the hour on the local clock, rather than
+		// truncating absolute time, which is hour-aligned only in locations
+		// offset from UTC by whole hours
+		endTime = endTime.Add(-1 * time.Duration(endTime.Minute()*60+endTime.Second()) * time.Second)
+		endTime = endTime.Add(-1 * time.Duration(endTime.Nanosecond()))
+	case AlignDay:
+		endTime = endTime.In(loc)
+		endTime = time.Date(endTime.Year(), endTime.Month(), endTime.Day(), 0, 0, 0, 0, loc)
+		if duration > 0 && duration%(24*time.Hour) == 0 {
+			days := int(duration / (24 * time.Hour))
+			return endTime.AddDate(0, 0, -days), endTime
+		}
+	}
+
 	startTime := endTime.Add(-1 * duration)
 
 	return startTime, endTime
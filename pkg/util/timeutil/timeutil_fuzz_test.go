@@ -0,0 +1,36 @@
+//go:build go1.18
+// +build go1.18
+
+package timeutil
+
+import (
+	"testing"
+	"time"
+)
+
+func FuzzParseTimeRangeStrings(f *testing.F) {
+	f.Add("7d", "")
+	f.Add("30m", "1h")
+	f.Add("", "")
+	f.Add("-1h", "")
+	f.Add("1h", "-1h")
+	f.Add("24h", "offset 3d")
+	f.Add("9999999999999999d", "")
+	f.Add("oqwd3dk5hk", "%%")
+
+	retention := 15 * 24 * time.Hour
+
+	f.Fuzz(func(t *testing.T, duration, offset string) {
+		start, end, err := ParseTimeRangeStrings(duration, offset, retention)
+		if err != nil {
+			return
+		}
+
+		if !start.Before(end) {
+			t.Errorf("ParseTimeRangeStrings(%q, %q): expected start %s before end %s", duration, offset, start, end)
+		}
+		if end.After(time.Now()) {
+			t.Errorf("ParseTimeRangeStrings(%q, %q): expected end %s not to be in the future", duration, offset, end)
+		}
+	})
+}
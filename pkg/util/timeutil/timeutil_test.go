@@ -282,6 +282,46 @@ func Test_ParseDuration(t *testing.T) {
 			input:    "h",
 			expected: time.Duration(0),
 		},
+		"compound": {
+			input:    "1d12h",
+			expected: 36 * time.Hour,
+		},
+		"weeks": {
+			input:    "2w",
+			expected: 14 * 24 * time.Hour,
+		},
+		"minutes exceeding an hour": {
+			input:    "90m",
+			expected: 90 * time.Minute,
+		},
+		"compound all units": {
+			input:    "1w2d3h4m5s",
+			expected: 9*24*time.Hour + 3*time.Hour + 4*time.Minute + 5*time.Second,
+		},
+		"compound prom prefix": {
+			input:    "offset 1h30m",
+			expected: 90 * time.Minute,
+		},
+		"compound ascending units": {
+			input:    "30m1h",
+			expected: time.Duration(0),
+		},
+		"compound repeated unit": {
+			input:    "1h1h",
+			expected: time.Duration(0),
+		},
+		"compound trailing digits": {
+			input:    "1d12",
+			expected: time.Duration(0),
+		},
+		"unknown unit": {
+			input:    "3y",
+			expected: time.Duration(0),
+		},
+		"overflow": {
+			input:    "100000w",
+			expected: time.Duration(0),
+		},
 	}
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
@@ -376,3 +416,248 @@ func Test_FormatDurationStringDaysToHours(t *testing.T) {
 		})
 	}
 }
+
+func TestParseAlignedTimeRange(t *testing.T) {
+	start, end := ParseAlignedTimeRange(24*time.Hour, 0, AlignDay)
+	if !end.Equal(end.Truncate(24*time.Hour)) || end.Hour() != 0 || end.Minute() != 0 || end.Second() != 0 || end.Nanosecond() != 0 {
+		t.Errorf("expected end to be aligned to midnight; got %s", end)
+	}
+	if !start.Equal(end.Add(-24 * time.Hour)) {
+		t.Errorf("expected start to be 24h before end; got start %s, end %s", start, end)
+	}
+	if start.Hour() != 0 || start.Minute() != 0 || start.Second() != 0 {
+		t.Errorf("expected start to be aligned to midnight; got %s", start)
+	}
+	if end.After(time.Now()) {
+		t.Errorf("expected aligned end %s to not be in the future", end)
+	}
+
+	start, end = ParseAlignedTimeRange(6*time.Hour, 2*time.Hour, AlignHour)
+	if end.Minute() != 0 || end.Second() != 0 || end.Nanosecond() != 0 {
+		t.Errorf("expected end to be aligned to the hour; got %s", end)
+	}
+	if end.After(time.Now().Add(-2 * time.Hour)) {
+		t.Errorf("expected aligned end %s to respect offset", end)
+	}
+	if end.Sub(start) != 6*time.Hour {
+		t.Errorf("expected range of 6h; got %s", end.Sub(start))
+	}
+}
+
+func TestParseAlignedTimeRangeIn(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no timezone data: %s", err)
+	}
+
+	cases := map[string]struct {
+		now        time.Time
+		duration   time.Duration
+		alignTo    Alignment
+		start, end time.Time
+	}{
+		// Clocks spring forward at 2am on 2021-03-14: the day lasts 23h
+		"spring forward": {
+			now:      time.Date(2021, 3, 15, 9, 30, 0, 0, ny),
+			duration: 24 * time.Hour,
+			alignTo:  AlignDay,
+			start:    time.Date(2021, 3, 14, 0, 0, 0, 0, ny),
+			end:      time.Date(2021, 3, 15, 0, 0, 0, 0, ny),
+		},
+		// Clocks fall back at 2am on 2021-11-07: the day lasts 25h
+		"fall back": {
+			now:      time.Date(2021, 11, 8, 0, 0, 0, 0, ny),
+			duration: 24 * time.Hour,
+			alignTo:  AlignDay,
+			start:    time.Date(2021, 11, 7, 0, 0, 0, 0, ny),
+			end:      time.Date(2021, 11, 8, 0, 0, 0, 0, ny),
+		},
+		"week across fall back": {
+			now:      time.Date(2021, 11, 10, 23, 59, 0, 0, ny),
+			duration: 7 * 24 * time.Hour,
+			alignTo:  AlignDay,
+			start:    time.Date(2021, 11, 3, 0, 0, 0, 0, ny),
+			end:      time.Date(2021, 11, 10, 0, 0, 0, 0, ny),
+		},
+		// Partial days retain their duration
+		"partial day": {
+			now:      time.Date(2021, 3, 15, 9, 30, 0, 0, ny),
+			duration: 12 * time.Hour,
+			alignTo:  AlignDay,
+			start:    time.Date(2021, 3, 15, 0, 0, 0, 0, ny).Add(-12 * time.Hour),
+			end:      time.Date(2021, 3, 15, 0, 0, 0, 0, ny),
+		},
+		"hour": {
+			now:      time.Date(2021, 11, 7, 1, 45, 0, 0, ny),
+			duration: 2 * time.Hour,
+			alignTo:  AlignHour,
+			start:    time.Date(2021, 11, 6, 23, 0, 0, 0, ny),
+			end:      time.Date(2021, 11, 7, 1, 0, 0, 0, ny),
+		},
+	}
+
+	for name, tc := range cases {
+		start, end := ParseAlignedTimeRangeIn(tc.now, tc.duration, 0, tc.alignTo, ny)
+		if !start.Equal(tc.start) || !end.Equal(tc.end) {
+			t.Errorf("%s: expected [%s, %s); got [%s, %s)", name, tc.start, tc.end, start, end)
+		}
+	}
+
+	w := ParseAlignedWindowIn(time.Date(2021, 3, 15, 9, 30, 0, 0, ny), 24*time.Hour, 0, AlignDay, ny)
+	if w.Duration() != 23*time.Hour {
+		t.Errorf("expected a 23h day when clocks spring forward; got %s", w.Duration())
+	}
+	w = ParseAlignedWindowIn(time.Date(2021, 11, 8, 9, 30, 0, 0, ny), 24*time.Hour, 0, AlignDay, ny)
+	if w.Duration() != 25*time.Hour {
+		t.Errorf("expected a 25h day when clocks fall back; got %s", w.Duration())
+	}
+
+	// A nil location aligns in UTC
+	now := time.Date(2021, 3, 15, 3, 30, 0, 0, ny)
+	start, end := ParseAlignedTimeRangeIn(now, 24*time.Hour, 0, AlignDay, nil)
+	expStart, expEnd := ParseAlignedTimeRangeAt(now, 24*time.Hour, 0, AlignDay)
+	if !start.Equal(expStart) || !end.Equal(expEnd) {
+		t.Errorf("expected [%s, %s); got [%s, %s)", expStart, expEnd, start, end)
+	}
+}
+
+func TestParseTimeRangeStrings(t *testing.T) {
+	retention := 15 * 24 * time.Hour
+
+	valid := map[string][2]string{
+		"7d":              {"7d", ""},
+		"30m":             {"30m", ""},
+		"24h offset 1d":   {"24h", "1d"},
+		"prefixed offset": {"24h", "offset 1d"},
+		"compound":        {"1d12h", "1h30m"},
+	}
+	for name, tc := range valid {
+		t.Run(name, func(t *testing.T) {
+			start, end, err := ParseTimeRangeStrings(tc[0], tc[1], retention)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			expected, _ := ParseDuration(tc[0])
+			if end.Sub(start) != expected {
+				t.Errorf("expected range of %s; got %s", expected, end.Sub(start))
+			}
+		})
+	}
+
+	invalid := map[string][2]string{
+		"empty":                 {"", ""},
+		"negative duration":     {"-1h", ""},
+		"zero duration":         {"0h", ""},
+		"negative offset":       {"1h", "-1h"},
+		"garbage":               {"oqwd3dk5hk", ""},
+		"garbage offset":        {"1h", "oqwd3dk5hk"},
+		"offset past retention": {"1d", "30d"},
+		"overflow":              {"9999999999999999d", ""},
+	}
+	for name, tc := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := ParseTimeRangeStrings(tc[0], tc[1], retention)
+			if err == nil {
+				t.Errorf("expected error parsing time range (%q, %q)", tc[0], tc[1])
+			}
+		})
+	}
+}
+
+func TestParseDurationOffsetStrings(t *testing.T) {
+	dur, off, err := ParseDurationOffsetStrings("1d12h", "offset 1h30m", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if dur != 36*time.Hour || off != 90*time.Minute {
+		t.Errorf("expected 36h offset 1h30m; got %s offset %s", dur, off)
+	}
+
+	if _, _, err := ParseDurationOffsetStrings("1d", "30d", 15*24*time.Hour); err == nil {
+		t.Errorf("expected error for offset past retention")
+	}
+	if _, _, err := ParseDurationOffsetStrings("1d", "30d", 0); err != nil {
+		t.Errorf("expected unlimited retention to allow any offset; got %s", err)
+	}
+}
+
+func TestParseTimeRangeDetailed(t *testing.T) {
+	cases := map[string]struct {
+		scrapeInterval time.Duration
+		samples        int
+	}{
+		"1m":  {scrapeInterval: time.Minute, samples: 60},
+		"30s": {scrapeInterval: 30 * time.Second, samples: 120},
+		"0":   {scrapeInterval: 0, samples: 0},
+	}
+
+	for name, tc := range cases {
+		trd := ParseTimeRangeDetailed(time.Hour, 24*time.Hour, tc.scrapeInterval)
+
+		if trd.Samples != tc.samples {
+			t.Errorf("%s: expected %d samples; got %d", name, tc.samples, trd.Samples)
+		}
+		if trd.Duration != time.Hour || trd.End.Sub(trd.Start) != time.Hour {
+			t.Errorf("%s: expected duration %s; got %s", name, time.Hour, trd.Duration)
+		}
+		if trd.Minutes() != 60.0 {
+			t.Errorf("%s: expected 60 minutes; got %f", name, trd.Minutes())
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	w := Window{Start: start, End: end}
+
+	if w.Duration() != 24*time.Hour {
+		t.Errorf("expected duration %s; got %s", 24*time.Hour, w.Duration())
+	}
+	if (Window{Start: start, End: start}).Duration() != 0 {
+		t.Errorf("expected empty window to have zero duration")
+	}
+
+	cases := map[string]struct {
+		t        time.Time
+		contains bool
+	}{
+		"start":        {t: start, contains: true},
+		"middle":       {t: start.Add(12 * time.Hour), contains: true},
+		"before end":   {t: end.Add(-time.Nanosecond), contains: true},
+		"end":          {t: end, contains: false},
+		"before start": {t: start.Add(-time.Nanosecond), contains: false},
+		"after end":    {t: end.Add(time.Hour), contains: false},
+		"other zone":   {t: start.In(time.FixedZone("UTC+1", 3600)), contains: true},
+		"zero time":    {t: time.Time{}, contains: false},
+	}
+	for name, tc := range cases {
+		if w.Contains(tc.t) != tc.contains {
+			t.Errorf("%s: expected Contains(%s) to be %t", name, tc.t, tc.contains)
+		}
+	}
+
+	if (Window{Start: start, End: start}).Contains(start) {
+		t.Errorf("expected empty window to contain nothing")
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	w, err := ParseWindow(time.Hour, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if w.Duration() != time.Hour {
+		t.Errorf("expected duration %s; got %s", time.Hour, w.Duration())
+	}
+	if !w.Contains(time.Now().Add(-24*time.Hour - 30*time.Minute)) {
+		t.Errorf("expected window to contain the middle of its range")
+	}
+
+	if _, err := ParseWindow(0, 0); err == nil {
+		t.Errorf("expected error for zero duration")
+	}
+	if _, err := ParseWindow(time.Hour, -time.Hour); err == nil {
+		t.Errorf("expected error for negative offset")
+	}
+}